@@ -0,0 +1,146 @@
+// Command feeder-stub is a local stand-in for the Neo Feeder web service to
+// try the PDDikti export against. It answers GetToken, the lookups and the
+// Insert/Delete acts used by internal/feeder and keeps the records in
+// memory; GET / lists them.
+//
+//	go run ./cmd/feeder-stub -addr :3003
+//	FEEDER_URL=http://localhost:3003/ws/live2.php
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type request struct {
+	Act    string                 `json:"act"`
+	Token  string                 `json:"token"`
+	Filter string                 `json:"filter"`
+	Key    map[string]interface{} `json:"key"`
+	Record map[string]interface{} `json:"record"`
+}
+
+// lookups are the GetList acts and the ID field they return
+var lookups = map[string]string{
+	"GetProdi":                          "id_prodi",
+	"GetListRiwayatPendidikanMahasiswa": "id_registrasi_mahasiswa",
+	"GetListDosen":                      "id_dosen",
+	"GetListMataKuliah":                 "id_matkul",
+}
+
+// inserts are the Insert acts and the ID field they return
+var inserts = map[string]string{
+	"InsertAktivitasMahasiswa":        "id_aktivitas",
+	"InsertAnggotaAktivitasMahasiswa": "id_anggota",
+	"InsertBimbingMahasiswa":          "id_bimbing_mahasiswa",
+	"InsertUjiMahasiswa":              "id_uji",
+	"InsertKonversiKampusMerdeka":     "id_konversi_aktivitas",
+}
+
+type stub struct {
+	mu      sync.Mutex
+	seq     int
+	records map[string][]map[string]interface{}
+	unknown string
+}
+
+func (s *stub) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s-%08d", prefix, s.seq)
+}
+
+func reply(w http.ResponseWriter, code int, desc string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error_code": code,
+		"error_desc": desc,
+		"data":       data,
+	})
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.records)
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		reply(w, 1, "invalid request: "+err.Error(), nil)
+		return
+	}
+	log.Printf("%s %s", req.Act, req.Filter)
+
+	if req.Act == "GetToken" {
+		reply(w, 0, "", map[string]string{"token": "stub-token"})
+		return
+	}
+	if req.Token != "stub-token" {
+		reply(w, 100, "Invalid token. Token expired", nil)
+		return
+	}
+
+	if field, ok := lookups[req.Act]; ok {
+		// Values listed in -unknown are reported as missing
+		if s.unknown != "" && containsAny(req.Filter, strings.Split(s.unknown, ",")) {
+			reply(w, 0, "", []interface{}{})
+			return
+		}
+		reply(w, 0, "", []map[string]string{{field: s.nextID(field)}})
+		return
+	}
+	if field, ok := inserts[req.Act]; ok {
+		id := s.nextID(field)
+		record := map[string]interface{}{field: id}
+		for k, v := range req.Record {
+			record[k] = v
+		}
+		s.records[req.Act] = append(s.records[req.Act], record)
+		reply(w, 0, "", map[string]string{field: id})
+		return
+	}
+	if req.Act == "DeleteAktivitasMahasiswa" {
+		id, _ := req.Key["id_aktivitas"].(string)
+		for act, rows := range s.records {
+			kept := rows[:0]
+			for _, row := range rows {
+				if row["id_aktivitas"] != id {
+					kept = append(kept, row)
+				}
+			}
+			s.records[act] = kept
+		}
+		reply(w, 0, "", map[string]string{"id_aktivitas": id})
+		return
+	}
+
+	reply(w, 404, "unknown act "+req.Act, nil)
+}
+
+func containsAny(filter string, values []string) bool {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" && strings.Contains(filter, "'"+v+"'") {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	addr := flag.String("addr", ":3003", "listen address")
+	unknown := flag.String("unknown", "", "comma separated NIM, NIDN or codes to report as not found")
+	flag.Parse()
+
+	s := &stub{records: map[string][]map[string]interface{}{}, unknown: *unknown}
+	log.Printf("Feeder stub listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
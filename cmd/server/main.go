@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -8,8 +9,12 @@ import (
 
 	"mbkm-go/config"
 	"mbkm-go/database"
+	"mbkm-go/internal/handlers"
 	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/queue"
 	"mbkm-go/internal/routes"
+	"mbkm-go/internal/siakad"
+	"mbkm-go/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/logger"
@@ -27,6 +32,35 @@ func main() {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Set up file storage
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to set up file storage: %v", err)
+	}
+
+	// Background work stops with the server
+	ctx, stopWorkers := context.WithCancel(context.Background())
+
+	// Set up the SIAKAD sync and queue its scheduled runs
+	if err := siakad.Init(database.DB); err != nil {
+		log.Fatalf("Failed to set up the SIAKAD sync: %v", err)
+	}
+	if siakad.Default != nil && config.AppConfig.SiakadSyncInterval > 0 {
+		go handlers.ScheduleSiakadSync(ctx, config.AppConfig.SiakadSyncInterval)
+	}
+
+	// Run background jobs, unless they are left to cmd/worker
+	workersDone := make(chan struct{})
+	if config.AppConfig.QueueWorkers > 0 {
+		worker := queue.NewWorker(database.DB, config.AppConfig.QueueWorkers, config.AppConfig.QueuePollInterval)
+		handlers.RegisterJobs(worker)
+		go func() {
+			worker.Run(ctx)
+			close(workersDone)
+		}()
+	} else {
+		close(workersDone)
+	}
+
 	// Optional: Run migrations (uncomment if you want auto-migration)
 	// if err := database.Migrate(); err != nil {
 	// 	log.Printf("Warning: Migration failed: %v", err)
@@ -36,6 +70,7 @@ func main() {
 	app := fiber.New(fiber.Config{
 		AppName:      config.AppConfig.AppName,
 		ErrorHandler: customErrorHandler,
+		BodyLimit:    16 * 1024 * 1024, // report files up to 10 MB
 	})
 
 	// Middleware
@@ -45,9 +80,6 @@ func main() {
 	}))
 	app.Use(middleware.CORS())
 
-	// Static files for uploads
-	app.Static("/uploads", "./uploads")
-
 	// Setup routes
 	routes.SetupRoutes(app)
 
@@ -80,6 +112,10 @@ func main() {
 	if err := app.Listen(":" + port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+
+	// Running jobs go back to the queue
+	stopWorkers()
+	<-workersDone
 }
 
 func customErrorHandler(c *fiber.Ctx, err error) error {
@@ -0,0 +1,48 @@
+// Command worker runs the background job queue without the API, for
+// deployments that keep the jobs off the web servers (set QUEUE_WORKERS=0
+// there). Any number of workers can share the database.
+//
+//	go run ./cmd/worker -concurrency 4
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os/signal"
+	"syscall"
+
+	"mbkm-go/config"
+	"mbkm-go/database"
+	"mbkm-go/internal/handlers"
+	"mbkm-go/internal/queue"
+	"mbkm-go/internal/siakad"
+	"mbkm-go/internal/storage"
+)
+
+func main() {
+	concurrency := flag.Int("concurrency", 2, "jobs run at the same time")
+	flag.Parse()
+
+	if err := config.LoadConfig(); err != nil {
+		log.Printf("Warning: Could not load .env file: %v", err)
+	}
+	if err := database.Connect(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	if err := storage.Init(); err != nil {
+		log.Fatalf("Failed to set up file storage: %v", err)
+	}
+	if err := siakad.Init(database.DB); err != nil {
+		log.Fatalf("Failed to set up the SIAKAD sync: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	worker := queue.NewWorker(database.DB, *concurrency, config.AppConfig.QueuePollInterval)
+	handlers.RegisterJobs(worker)
+	log.Printf("Worker running %d jobs at a time: %v", *concurrency, worker.Types())
+	worker.Run(ctx)
+	log.Println("Worker stopped")
+}
@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -11,6 +13,7 @@ type Config struct {
 	AppName   string
 	AppPort   string
 	AppEnv    string
+	AppURL    string // public base URL, used in links printed on documents
 	DBHost    string
 	DBPort    string
 	DBName    string
@@ -18,6 +21,43 @@ type Config struct {
 	DBPass    string
 	JWTSecret string
 	JWTExpiry time.Duration
+
+	UploadDir      string
+	MaxImageSize   int64
+	MaxImageWidth  int
+	MaxImageHeight int
+
+	StorageDriver  string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	FileSigningKey string
+	SignedURLTTL   time.Duration
+
+	AppealWindow time.Duration // how long after publication a grade can be appealed
+
+	// PDDikti Neo Feeder web service, e.g. http://localhost:3003/ws/live2.php
+	FeederURL             string
+	FeederUsername        string
+	FeederPassword        string
+	FeederJenisAktivitas  string // id_jenis_aktivitas reported for placements
+	FeederProgramMBKM     string // program_mbkm of the activities, optional
+	FeederKategoriBimbing string // id_kategori_kegiatan of supervising lecturers
+	FeederKategoriUji     string // id_kategori_kegiatan of examiners
+
+	// SIAKAD sync: source rest or csv (off when empty)
+	SiakadSource       string
+	SiakadURL          string
+	SiakadToken        string
+	SiakadDir          string
+	SiakadSyncInterval time.Duration // 0 disables scheduled runs
+
+	// Background job queue: workers run by the server (0 leaves the jobs
+	// to cmd/worker) and how often idle workers look for jobs
+	QueueWorkers      int
+	QueuePollInterval time.Duration
 }
 
 var AppConfig *Config
@@ -29,23 +69,76 @@ func LoadConfig() error {
 	}
 
 	expiry, _ := time.ParseDuration(getEnv("JWT_EXPIRY", "24h"))
+	maxImageSize := getEnvSize("MAX_IMAGE_SIZE", 2097152)
+	maxImageWidth, _ := strconv.Atoi(getEnv("MAX_IMAGE_WIDTH", "6000"))
+	maxImageHeight, _ := strconv.Atoi(getEnv("MAX_IMAGE_HEIGHT", "6000"))
+	signedURLTTL, _ := time.ParseDuration(getEnv("SIGNED_URL_TTL", "15m"))
+	jwtSecret := getEnv("JWT_SECRET", "your-secret-key")
+	appealWindow, _ := time.ParseDuration(getEnv("APPEAL_WINDOW", "336h"))
+	siakadSyncInterval, _ := time.ParseDuration(getEnv("SIAKAD_SYNC_INTERVAL", "0"))
+	queueWorkers, _ := strconv.Atoi(getEnv("QUEUE_WORKERS", "2"))
+	queuePollInterval, _ := time.ParseDuration(getEnv("QUEUE_POLL_INTERVAL", "2s"))
 
 	AppConfig = &Config{
 		AppName:   getEnv("APP_NAME", "mbkm-go"),
 		AppPort:   getEnv("APP_PORT", "3000"),
 		AppEnv:    getEnv("APP_ENV", "development"),
+		AppURL:    strings.TrimRight(getEnv("APP_URL", "http://localhost:3000"), "/"),
 		DBHost:    getEnv("DB_HOST", "127.0.0.1"),
 		DBPort:    getEnv("DB_PORT", "5432"),
 		DBName:    getEnv("DB_DATABASE", "mbkm"),
 		DBUser:    getEnv("DB_USERNAME", "ridho"),
 		DBPass:    getEnv("DB_PASSWORD", "ridho"),
-		JWTSecret: getEnv("JWT_SECRET", "your-secret-key"),
+		JWTSecret: jwtSecret,
 		JWTExpiry: expiry,
+
+		UploadDir:      getEnv("UPLOAD_DIR", "./uploads"),
+		MaxImageSize:   maxImageSize,
+		MaxImageWidth:  maxImageWidth,
+		MaxImageHeight: maxImageHeight,
+
+		StorageDriver:  getEnv("STORAGE_DRIVER", "local"),
+		S3Endpoint:     getEnv("S3_ENDPOINT", ""),
+		S3Region:       getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:       getEnv("S3_BUCKET", ""),
+		S3AccessKey:    getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:    getEnv("S3_SECRET_KEY", ""),
+		FileSigningKey: getEnv("FILE_SIGNING_KEY", jwtSecret),
+		SignedURLTTL:   signedURLTTL,
+
+		AppealWindow: appealWindow,
+
+		FeederURL:             getEnv("FEEDER_URL", ""),
+		FeederUsername:        getEnv("FEEDER_USERNAME", ""),
+		FeederPassword:        getEnv("FEEDER_PASSWORD", ""),
+		FeederJenisAktivitas:  getEnv("FEEDER_JENIS_AKTIVITAS", "13"),
+		FeederProgramMBKM:     getEnv("FEEDER_PROGRAM_MBKM", ""),
+		FeederKategoriBimbing: getEnv("FEEDER_KATEGORI_BIMBING", ""),
+		FeederKategoriUji:     getEnv("FEEDER_KATEGORI_UJI", ""),
+
+		SiakadSource:       getEnv("SIAKAD_SOURCE", ""),
+		SiakadURL:          getEnv("SIAKAD_URL", ""),
+		SiakadToken:        getEnv("SIAKAD_TOKEN", ""),
+		SiakadDir:          getEnv("SIAKAD_DIR", "./siakad"),
+		SiakadSyncInterval: siakadSyncInterval,
+
+		QueueWorkers:      queueWorkers,
+		QueuePollInterval: queuePollInterval,
 	}
 
 	return nil
 }
 
+// getEnvSize reads a size in bytes, falling back to the default when it is
+// not a positive number
+func getEnvSize(key string, defaultValue int64) int64 {
+	size, err := strconv.ParseInt(getEnv(key, ""), 10, 64)
+	if err != nil || size <= 0 {
+		return defaultValue
+	}
+	return size
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
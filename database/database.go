@@ -40,29 +40,71 @@ func Connect() error {
 }
 
 func Migrate() error {
+	if err := convertUserProgramStudi(); err != nil {
+		return err
+	}
+
 	err := DB.AutoMigrate(
 		&models.Role{},
 		&models.User{},
 		&models.Permission{},
 		&models.Team{},
 		&models.Job{},
+		&models.JobMataKuliah{},
+		&models.JobRevision{},
 		&models.Article{},
 		&models.Company{},
 		&models.ApplyJob{},
 		&models.Report{},
+		&models.ReportVersion{},
+		&models.ReportReview{},
+		&models.ReportComment{},
 		&models.Evaluation{},
+		&models.Rubric{},
+		&models.RubricCriterion{},
+		&models.EvaluationScore{},
+		&models.EvaluationLog{},
+		&models.GradeAppeal{},
 		&models.ActivityDetail{},
+		&models.Attendance{},
 		&models.BobotNilai{},
+		&models.GradeScale{},
+		&models.GradeBand{},
 		&models.KonversiNilai{},
+		&models.KonversiRule{},
+		&models.KonversiCriterion{},
 		&models.Fakultas{},
 		&models.ProgramStudi{},
 		&models.MataKuliah{},
 		&models.Perusahaan{},
+		&models.Media{},
+		&models.DocumentTemplate{},
+		&models.IssuedDocument{},
+		&models.LetterRequest{},
+		&models.FeederSync{},
+		&models.SyncRun{},
+		&models.SyncRunError{},
+		&models.StudentImport{},
+		&models.StudentImportError{},
+		&models.QueueJob{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	// One grade scale without a program studi: the default of every prodi
+	// without its own. The unique index on id_program_studi lets NULLs repeat.
+	if err := DB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_grade_scales_default ON grade_scales ((id_program_studi IS NULL)) WHERE id_program_studi IS NULL").Error; err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	if err := migrateLegacyFiles(); err != nil {
+		return err
+	}
+	if err := mapUserProgramStudi(); err != nil {
+		return err
+	}
+
 	log.Println("Database migrated successfully")
 	return nil
 }
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"strings"
+
+	"mbkm-go/internal/models"
+	"mbkm-go/internal/storage"
+)
+
+// legacyFileColumn is a file path column that predates the media table
+type legacyFileColumn struct {
+	Table      string
+	Column     string
+	ModelType  string
+	Collection string
+	Image      bool // resized variants were stored next to the file
+}
+
+var legacyFileColumns = []legacyFileColumn{
+	{"reports", "file_laporan", models.MediaModelReport, models.MediaCollectionFileLaporan, false},
+	{"jobs", "job_vacancy_image_path", models.MediaModelJob, models.MediaCollectionJobVacancyImage, true},
+	{"companies", "company_logo_path", models.MediaModelCompany, models.MediaCollectionCompanyLogo, true},
+	{"articles", "picture_path", models.MediaModelArticle, models.MediaCollectionPicture, true},
+}
+
+// migrateLegacyFiles copies file paths stored directly on models into the
+// media table. Rows that already have a media entry for the same path are
+// skipped, so running it again is harmless. The old columns are left in
+// place for rollback.
+func migrateLegacyFiles() error {
+	for _, legacy := range legacyFileColumns {
+		if !DB.Migrator().HasColumn(legacy.Table, legacy.Column) {
+			continue
+		}
+
+		var rows []struct {
+			ID   uint
+			Path string
+		}
+		err := DB.Table(legacy.Table).
+			Select(fmt.Sprintf("id, %s AS path", legacy.Column)).
+			Where(fmt.Sprintf("%s IS NOT NULL AND %s <> ''", legacy.Column, legacy.Column)).
+			Scan(&rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to read %s.%s: %w", legacy.Table, legacy.Column, err)
+		}
+
+		migrated := 0
+		for _, row := range rows {
+			key := strings.TrimPrefix(row.Path, "/uploads/")
+
+			var existing int64
+			DB.Model(&models.Media{}).
+				Where("model_type = ? AND model_id = ? AND path = ?", legacy.ModelType, row.ID, key).
+				Count(&existing)
+			if existing > 0 {
+				continue
+			}
+
+			m := legacyMedia(legacy, row.ID, key)
+			if err := DB.Create(&m).Error; err != nil {
+				return fmt.Errorf("failed to migrate %s.%s of %d: %w", legacy.Table, legacy.Column, row.ID, err)
+			}
+			migrated++
+		}
+
+		if migrated > 0 {
+			log.Printf("Migrated %d files from %s.%s to media", migrated, legacy.Table, legacy.Column)
+		}
+	}
+	return nil
+}
+
+func legacyMedia(legacy legacyFileColumn, modelID uint, key string) models.Media {
+	ext := strings.ToLower(path.Ext(key))
+	mimeType := mime.TypeByExtension(ext)
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	m := models.Media{
+		ModelType:      legacy.ModelType,
+		ModelID:        modelID,
+		CollectionName: legacy.Collection,
+		FileName:       path.Base(key),
+		Path:           key,
+		MimeType:       mimeType,
+	}
+
+	// Size and checksum are only known when the file is still in storage
+	if storage.Default != nil {
+		if r, err := storage.Default.Get(context.Background(), key); err == nil {
+			hash := sha256.New()
+			size, err := io.Copy(hash, r)
+			r.Close()
+			if err == nil {
+				m.Size = size
+				m.Checksum = hex.EncodeToString(hash.Sum(nil))
+			}
+		}
+	}
+
+	if legacy.Image {
+		variantMime := "image/png"
+		if ext == ".jpg" {
+			variantMime = "image/jpeg"
+		}
+		m.Conversions = "thumb:" + variantMime + ",medium:" + variantMime
+	}
+	return m
+}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mbkm-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// legacyProdiColumn keeps the old free-text users.id_program_studi once the
+// column has become a foreign key
+const legacyProdiColumn = "id_program_studi_legacy"
+
+// convertUserProgramStudi moves a text users.id_program_studi out of the way
+// so AutoMigrate can add it back as a foreign key to program_studi. The old
+// values are mapped by MapUserProgramStudi and left in place for rollback.
+func convertUserProgramStudi() error {
+	migrator := DB.Migrator()
+	if !migrator.HasTable("users") || !migrator.HasColumn("users", "id_program_studi") {
+		return nil
+	}
+	columns, err := migrator.ColumnTypes("users")
+	if err != nil {
+		return fmt.Errorf("failed to read users columns: %w", err)
+	}
+	for _, column := range columns {
+		if column.Name() != "id_program_studi" {
+			continue
+		}
+		switch strings.ToLower(column.DatabaseTypeName()) {
+		case "varchar", "text", "bpchar":
+		default:
+			return nil
+		}
+	}
+	if migrator.HasColumn("users", legacyProdiColumn) {
+		return fmt.Errorf("users.%s already exists", legacyProdiColumn)
+	}
+	if err := migrator.RenameColumn("users", "id_program_studi", legacyProdiColumn); err != nil {
+		return fmt.Errorf("failed to rename users.id_program_studi: %w", err)
+	}
+	log.Printf("Renamed users.id_program_studi to %s", legacyProdiColumn)
+	return nil
+}
+
+// ResolveProgramStudi finds a program studi by ID, PDDikti code or name
+// (case-insensitive, "Program Studi" prefix ignored), with its Fakultas
+func ResolveProgramStudi(db *gorm.DB, value string) (models.ProgramStudi, error) {
+	var prodi models.ProgramStudi
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return prodi, gorm.ErrRecordNotFound
+	}
+	query := func() *gorm.DB { return db.Preload("Fakultas") }
+
+	if id, err := strconv.ParseUint(value, 10, 32); err == nil {
+		if err := query().First(&prodi, id).Error; err == nil {
+			return prodi, nil
+		}
+	}
+	if err := query().Where("LOWER(TRIM(kode_prodi)) = ?", strings.ToLower(value)).First(&prodi).Error; err == nil {
+		return prodi, nil
+	}
+
+	name := strings.ToLower(strings.Join(strings.Fields(value), " "))
+	for _, prefix := range []string{"program studi ", "prodi "} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	err := query().Where("LOWER(TRIM(nama)) IN ?", []string{name, "program studi " + name}).
+		Order("id ASC").First(&prodi).Error
+	return prodi, err
+}
+
+// UnmatchedProgramStudi is a stored prodi value no program studi matches
+type UnmatchedProgramStudi struct {
+	Value   string `json:"value"`
+	Users   int    `json:"users"`
+	UserIDs []uint `json:"user_ids"`
+}
+
+// ProgramStudiMapping reports a run of MapUserProgramStudi
+type ProgramStudiMapping struct {
+	Mapped    int                     `json:"mapped"`
+	Unmatched []UnmatchedProgramStudi `json:"unmatched"`
+	NoValue   int                     `json:"no_value"` // users without any prodi text
+	Applied   bool                    `json:"applied"`
+}
+
+// MapUserProgramStudi links users without id_program_studi to a program
+// studi using their legacy id_program_studi text, then their program_study
+// name. Values no program studi matches are reported. Without apply nothing
+// is written.
+func MapUserProgramStudi(db *gorm.DB, apply bool) (ProgramStudiMapping, error) {
+	report := ProgramStudiMapping{Unmatched: []UnmatchedProgramStudi{}, Applied: apply}
+
+	columns := "id, program_study"
+	if db.Migrator().HasColumn("users", legacyProdiColumn) {
+		columns += ", " + legacyProdiColumn + " AS legacy"
+	}
+	var users []struct {
+		ID           uint
+		ProgramStudy *string
+		Legacy       *string
+	}
+	err := db.Table("users").Select(columns).
+		Where("id_program_studi IS NULL AND deleted_at IS NULL").
+		Order("id ASC").Scan(&users).Error
+	if err != nil {
+		return report, fmt.Errorf("failed to read users: %w", err)
+	}
+
+	resolved := map[string]*models.ProgramStudi{}
+	resolve := func(value string) *models.ProgramStudi {
+		key := strings.ToLower(strings.TrimSpace(value))
+		if prodi, ok := resolved[key]; ok {
+			return prodi
+		}
+		var found *models.ProgramStudi
+		if prodi, err := ResolveProgramStudi(db, value); err == nil {
+			found = &prodi
+		}
+		resolved[key] = found
+		return found
+	}
+
+	unmatched := map[string]*UnmatchedProgramStudi{}
+	for _, u := range users {
+		var values []string
+		for _, v := range []*string{u.Legacy, u.ProgramStudy} {
+			if v != nil && strings.TrimSpace(*v) != "" {
+				values = append(values, strings.TrimSpace(*v))
+			}
+		}
+		if len(values) == 0 {
+			report.NoValue++
+			continue
+		}
+
+		var prodi *models.ProgramStudi
+		for _, v := range values {
+			if prodi = resolve(v); prodi != nil {
+				break
+			}
+		}
+		if prodi == nil {
+			// Report the name when there is one, it is what admins recognise
+			value := values[len(values)-1]
+			entry, ok := unmatched[value]
+			if !ok {
+				entry = &UnmatchedProgramStudi{Value: value}
+				unmatched[value] = entry
+			}
+			entry.Users++
+			entry.UserIDs = append(entry.UserIDs, u.ID)
+			continue
+		}
+
+		report.Mapped++
+		if !apply {
+			continue
+		}
+		update := map[string]interface{}{
+			"id_program_studi": prodi.ID,
+			"program_study":    prodi.Nama,
+		}
+		if prodi.Fakultas != nil {
+			update["faculty"] = prodi.Fakultas.Nama
+		}
+		if err := db.Table("users").Where("id = ?", u.ID).Updates(update).Error; err != nil {
+			return report, fmt.Errorf("failed to link user %d to program studi %d: %w", u.ID, prodi.ID, err)
+		}
+	}
+
+	for _, entry := range unmatched {
+		report.Unmatched = append(report.Unmatched, *entry)
+	}
+	sort.Slice(report.Unmatched, func(i, j int) bool {
+		if report.Unmatched[i].Users != report.Unmatched[j].Users {
+			return report.Unmatched[i].Users > report.Unmatched[j].Users
+		}
+		return report.Unmatched[i].Value < report.Unmatched[j].Value
+	})
+	return report, nil
+}
+
+// RefreshUserProgramStudi copies the current program studi and fakultas
+// names into program_study and faculty of the users of the given prodi
+func RefreshUserProgramStudi(db *gorm.DB, prodiIDs []uint) error {
+	if len(prodiIDs) == 0 {
+		return nil
+	}
+	return db.Exec(`UPDATE users SET program_study = p.nama, faculty = f.nama
+		FROM program_studi p LEFT JOIN fakultas f ON f.id = p.id_unit_parent
+		WHERE users.id_program_studi = p.id AND p.id IN ?`, prodiIDs).Error
+}
+
+// mapUserProgramStudi runs MapUserProgramStudi after migrating and logs what
+// could not be matched
+func mapUserProgramStudi() error {
+	report, err := MapUserProgramStudi(DB, true)
+	if err != nil {
+		return err
+	}
+	if report.Mapped > 0 {
+		log.Printf("Linked %d users to their program studi", report.Mapped)
+	}
+	for _, entry := range report.Unmatched {
+		log.Printf("No program studi matches %q (%d users)", entry.Value, entry.Users)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package documents
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"mbkm-go/internal/models"
+	"mbkm-go/pkg/pdf"
+)
+
+// ForStudent narrows a placement to one of its students, for documents
+// issued to each student separately
+func (p *Placement) ForStudent(u models.User) {
+	p.StudentName = u.Name
+	p.NIM = deref(u.NIM)
+	p.ProgramStudi, p.Faculty = studyProgram(u)
+}
+
+// CertificateData holds everything printed on a completion certificate. The
+// string fields are also the placeholders available to certificate
+// templates; Grade stays empty until the grade is published.
+type CertificateData struct {
+	Placement
+	ProgramType string
+	Period      string
+	Grade       string
+	FinalScore  string
+	Number      string
+	IssuedDate  string
+	VerifyURL   string
+}
+
+// NewCertificateData collects the certificate of one student of an
+// application loaded with its students, jobs and lecturers. evaluation is
+// the published evaluation, or nil; the period comes from the report when
+// there is one.
+func NewCertificateData(applyJob *models.ApplyJob, student models.User, programType string, evaluation *models.Evaluation, report *models.Report) CertificateData {
+	data := CertificateData{
+		Placement:   NewPlacement(applyJob),
+		ProgramType: programType,
+		Period:      "-",
+	}
+	data.ForStudent(student)
+	if data.ProgramType == "" {
+		data.ProgramType = "MBKM"
+	}
+	if report != nil {
+		data.Period = FormatDate(report.StartDate) + " - " + FormatDate(report.EndDate)
+	}
+	if evaluation != nil {
+		data.Grade = evaluation.Grade
+		data.FinalScore = formatHours(evaluation.FinalScore)
+	}
+	return data
+}
+
+// Issue stamps the certificate with its document number, issue date and
+// verification URL
+func (d *CertificateData) Issue(number string, issuedAt time.Time, verifyURL string) {
+	d.Number = number
+	d.IssuedDate = FormatDate(&issuedAt)
+	d.VerifyURL = verifyURL
+}
+
+// RenderCertificate renders a framed certificate: the student's name, what
+// they completed, signature blocks and a QR code for verification
+func RenderCertificate(tpl models.DocumentTemplate, data CertificateData) []byte {
+	doc := pdf.New()
+	doc.Title = execute(tpl.Title, data)
+	doc.Author = data.StudentName
+
+	flow := pdf.NewFlow(doc, 60)
+	doc.Rect(25, 25, pdf.PageWidth-50, pdf.PageHeight-50, false)
+	doc.Rect(30, 30, pdf.PageWidth-60, pdf.PageHeight-60, false)
+
+	for _, line := range strings.Split(execute(tpl.Header, data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			flow.Centered(true, 11, strings.TrimSpace(line))
+		}
+	}
+	flow.Space(40)
+	flow.Centered(true, 26, doc.Title)
+	flow.Centered(false, 10, "Nomor: "+orDash(data.Number))
+	flow.Space(30)
+
+	flow.Centered(false, 11, "diberikan kepada")
+	flow.Space(8)
+	flow.Centered(true, 20, orDash(data.StudentName))
+	flow.Centered(false, 11, "NIM "+orDash(data.NIM)+" - Program Studi "+orDash(data.ProgramStudi))
+	flow.Space(20)
+
+	if body := strings.TrimSpace(execute(tpl.Body, data)); body != "" {
+		centeredParagraph(flow, 12, body)
+	}
+	flow.Space(30)
+
+	flow.Centered(false, 10, "Diterbitkan pada "+orDash(data.IssuedDate))
+	flow.Space(10)
+	drawSignatures(flow, signatures(tpl.Signatures, data))
+
+	if data.VerifyURL != "" {
+		drawVerification(flow, data.VerifyURL)
+	}
+
+	if footer := strings.TrimSpace(execute(tpl.Footer, data)); footer != "" {
+		flow.Space(10)
+		flow.Paragraph(false, 8, footer)
+	}
+
+	return doc.Bytes()
+}
+
+// centeredParagraph writes wrapped text with every line centred
+func centeredParagraph(flow *pdf.Flow, size float64, text string) {
+	flow.Doc.SetFont(false, size)
+	for _, line := range flow.Doc.Wrap(text, flow.Width()) {
+		flow.Centered(false, size, line)
+	}
+}
+
+// PartnerStudent is one student hosted by a partner company
+type PartnerStudent struct {
+	Name         string `json:"name"`
+	NIM          string `json:"nim"`
+	ProgramStudi string `json:"program_studi"`
+	Position     string `json:"position"`
+}
+
+// PartnerLetterData holds everything printed on the thank-you letter to a
+// partner company. The string fields are also the placeholders available to
+// partner letter templates.
+type PartnerLetterData struct {
+	Company        string
+	CompanyAddress string
+	Period         string
+	StudentCount   string
+	Number         string
+	IssuedDate     string
+	VerifyURL      string
+
+	Students []PartnerStudent
+}
+
+// NewPartnerLetterData collects the letter of a company for the students it
+// hosted between two dates
+func NewPartnerLetterData(company *models.Company, from, to time.Time, students []PartnerStudent) PartnerLetterData {
+	return PartnerLetterData{
+		Company:        company.CompanyName,
+		CompanyAddress: deref(company.CompanyAddress),
+		Period:         FormatDate(&from) + " - " + FormatDate(&to),
+		StudentCount:   strconv.Itoa(len(students)),
+		Students:       students,
+	}
+}
+
+// Issue stamps the letter with its document number, issue date and
+// verification URL
+func (d *PartnerLetterData) Issue(number string, issuedAt time.Time, verifyURL string) {
+	d.Number = number
+	d.IssuedDate = FormatDate(&issuedAt)
+	d.VerifyURL = verifyURL
+}
+
+// RenderPartnerLetter renders the letter: addressee, the thank-you text, the
+// hosted students in a table, signature blocks and a QR code for
+// verification
+func RenderPartnerLetter(tpl models.DocumentTemplate, data PartnerLetterData) []byte {
+	doc := pdf.New()
+	doc.Title = execute(tpl.Title, data)
+	doc.Author = data.Company
+
+	flow := pdf.NewFlow(doc, 50)
+
+	for _, line := range strings.Split(execute(tpl.Header, data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			flow.Centered(true, 11, strings.TrimSpace(line))
+		}
+	}
+	flow.Space(6)
+	flow.Doc.Line(flow.Margin, flow.Y, flow.Margin+flow.Width(), flow.Y)
+	flow.Space(14)
+
+	flow.Fields(10, 60, [][2]string{
+		{"Nomor", orDash(data.Number)},
+		{"Tanggal", orDash(data.IssuedDate)},
+		{"Perihal", doc.Title},
+	})
+	flow.Space(14)
+	flow.Paragraph(false, 10, "Kepada Yth.")
+	flow.Paragraph(true, 10, "Pimpinan "+orDash(data.Company))
+	if data.CompanyAddress != "" {
+		flow.Paragraph(false, 10, data.CompanyAddress)
+	}
+	flow.Space(12)
+
+	if body := strings.TrimSpace(execute(tpl.Body, data)); body != "" {
+		flow.Paragraph(false, 10, body)
+		flow.Space(8)
+	}
+
+	rows := make([][]string, len(data.Students))
+	for i, student := range data.Students {
+		rows[i] = []string{strconv.Itoa(i + 1), student.Name, student.NIM, student.ProgramStudi, student.Position}
+	}
+	width := flow.Width()
+	flow.Table(9, []pdf.Column{
+		{Title: "No", Width: 28},
+		{Title: "Nama", Width: (width - 28 - 80) / 3},
+		{Title: "NIM", Width: 80},
+		{Title: "Program Studi", Width: (width - 28 - 80) / 3},
+		{Title: "Posisi", Width: (width - 28 - 80) / 3},
+	}, rows)
+	flow.Space(20)
+
+	drawSignatures(flow, signatures(tpl.Signatures, data))
+
+	if data.VerifyURL != "" {
+		drawVerification(flow, data.VerifyURL)
+	}
+
+	if footer := strings.TrimSpace(execute(tpl.Footer, data)); footer != "" {
+		flow.Space(10)
+		flow.Paragraph(false, 8, footer)
+	}
+
+	return doc.Bytes()
+}
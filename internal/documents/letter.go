@@ -0,0 +1,116 @@
+package documents
+
+import (
+	"strings"
+	"time"
+
+	"mbkm-go/internal/models"
+	"mbkm-go/pkg/pdf"
+)
+
+// LetterData holds everything printed on an administrative letter (surat
+// pengantar, surat rekomendasi prodi). The string fields are also the
+// placeholders available to letter templates.
+type LetterData struct {
+	Placement
+	CompanyAddress string
+	Purpose        string
+	ProdiHead      string
+	ProdiHeadNIP   string
+	Number         string
+	IssuedDate     string
+	VerifyURL      string
+}
+
+// NewLetterData collects the letter of a student applying for a job, signed
+// by the head of the student's program studi
+func NewLetterData(student models.User, job *models.Job, company *models.Company, purpose, prodiHead, prodiHeadNIP string) LetterData {
+	data := LetterData{
+		Purpose:      purpose,
+		ProdiHead:    prodiHead,
+		ProdiHeadNIP: prodiHeadNIP,
+	}
+	data.ForStudent(student)
+	if job != nil {
+		data.Company = job.Company
+		data.Position = job.Title
+	}
+	if company != nil {
+		data.Company = company.CompanyName
+		data.CompanyAddress = deref(company.CompanyAddress)
+	}
+	return data
+}
+
+// Issue stamps the letter with its document number, issue date and
+// verification URL
+func (d *LetterData) Issue(number string, issuedAt time.Time, verifyURL string) {
+	d.Number = number
+	d.IssuedDate = FormatDate(&issuedAt)
+	d.VerifyURL = verifyURL
+}
+
+// RenderLetter renders a letter addressed to the company of the job: number
+// and subject, the text, the student's identity, the prodi head's signature
+// and a QR code for verification
+func RenderLetter(tpl models.DocumentTemplate, data LetterData) []byte {
+	doc := pdf.New()
+	doc.Title = execute(tpl.Title, data)
+	doc.Author = data.ProgramStudi
+
+	flow := pdf.NewFlow(doc, 50)
+
+	for _, line := range strings.Split(execute(tpl.Header, data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			flow.Centered(true, 11, strings.TrimSpace(line))
+		}
+	}
+	flow.Space(6)
+	flow.Doc.Line(flow.Margin, flow.Y, flow.Margin+flow.Width(), flow.Y)
+	flow.Space(14)
+
+	flow.Fields(10, 60, [][2]string{
+		{"Nomor", orDash(data.Number)},
+		{"Tanggal", orDash(data.IssuedDate)},
+		{"Perihal", doc.Title},
+	})
+	flow.Space(14)
+	flow.Paragraph(false, 10, "Kepada Yth.")
+	flow.Paragraph(true, 10, "Pimpinan "+orDash(data.Company))
+	if data.CompanyAddress != "" {
+		flow.Paragraph(false, 10, data.CompanyAddress)
+	}
+	flow.Space(12)
+
+	if body := strings.TrimSpace(execute(tpl.Body, data)); body != "" {
+		for _, paragraph := range strings.Split(body, "\n") {
+			if strings.TrimSpace(paragraph) != "" {
+				flow.Paragraph(false, 10, strings.TrimSpace(paragraph))
+				flow.Space(6)
+			}
+		}
+	}
+	flow.Space(4)
+
+	flow.Fields(10, 120, [][2]string{
+		{"Nama", orDash(data.StudentName)},
+		{"NIM", orDash(data.NIM)},
+		{"Program Studi", orDash(data.ProgramStudi)},
+		{"Fakultas", orDash(data.Faculty)},
+		{"Posisi yang dilamar", orDash(data.Position)},
+	})
+	flow.Space(20)
+
+	drawSignatures(flow, signatures(tpl.Signatures, data))
+
+	if data.VerifyURL != "" {
+		drawVerification(flow, data.VerifyURL)
+	}
+
+	if footer := strings.TrimSpace(execute(tpl.Footer, data)); footer != "" {
+		flow.Space(10)
+		flow.Paragraph(false, 8, footer)
+	}
+
+	return doc.Bytes()
+}
@@ -0,0 +1,232 @@
+package documents
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"mbkm-go/internal/models"
+	"mbkm-go/pkg/pdf"
+)
+
+// Placement identifies the students of an application and where they were
+// placed. Its fields are placeholders in every template kind.
+type Placement struct {
+	StudentName  string
+	NIM          string
+	ProgramStudi string
+	Faculty      string
+	Company      string
+	Position     string
+	LecturerName string
+	ExaminerName string
+}
+
+// NewPlacement collects the placement of an application loaded with its
+// students, jobs and lecturers
+func NewPlacement(applyJob *models.ApplyJob) Placement {
+	var data Placement
+	if applyJob == nil {
+		return data
+	}
+
+	names := make([]string, 0, len(applyJob.Users))
+	nims := make([]string, 0, len(applyJob.Users))
+	for _, u := range applyJob.Users {
+		names = append(names, u.Name)
+		nims = append(nims, deref(u.NIM))
+		if data.ProgramStudi == "" {
+			data.ProgramStudi, data.Faculty = studyProgram(u)
+		}
+	}
+	data.StudentName = strings.Join(names, ", ")
+	data.NIM = strings.Join(nims, ", ")
+
+	titles := make([]string, 0, len(applyJob.Jobs))
+	for _, job := range applyJob.Jobs {
+		titles = append(titles, job.Title)
+		if data.Company == "" {
+			data.Company = job.Company
+		}
+	}
+	data.Position = strings.Join(titles, ", ")
+
+	if applyJob.ResponsibleLecturer != nil {
+		data.LecturerName = applyJob.ResponsibleLecturer.Name
+	}
+	if applyJob.ExaminerLecturer != nil {
+		data.ExaminerName = applyJob.ExaminerLecturer.Name
+	}
+	return data
+}
+
+// LogbookData holds everything printed on a logbook. The string fields are
+// also the placeholders available to logbook templates.
+type LogbookData struct {
+	Placement
+	Period         string
+	CompanyChecker string
+	ProdiChecker   string
+
+	Report     *models.Report
+	Activities []models.ActivityDetail
+	Attendance []models.AttendanceRecap
+}
+
+// NewLogbookData collects the logbook fields from a report loaded with its
+// application (students, jobs, lecturers), activity details and checkers
+func NewLogbookData(report *models.Report) LogbookData {
+	data := LogbookData{
+		Placement:  NewPlacement(report.ApplyJob),
+		Report:     report,
+		Activities: report.ActivityDetails,
+		Period:     FormatDate(report.StartDate) + " - " + FormatDate(report.EndDate),
+	}
+
+	if report.CompanyChecked != nil {
+		data.CompanyChecker = report.CompanyChecked.Name
+	}
+	if report.ProdiChecked != nil {
+		data.ProdiChecker = report.ProdiChecked.Name
+	}
+	return data
+}
+
+// RenderLogbook renders the logbook: student identity, placement, every
+// activity in a table, review timestamps and signature blocks
+func RenderLogbook(tpl models.DocumentTemplate, data LogbookData) []byte {
+	doc := pdf.New()
+	doc.Title = execute(tpl.Title, data)
+	doc.Author = data.StudentName
+
+	flow := pdf.NewFlow(doc, 50)
+
+	for _, line := range strings.Split(execute(tpl.Header, data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			flow.Centered(true, 11, strings.TrimSpace(line))
+		}
+	}
+	flow.Space(6)
+	flow.Doc.Line(flow.Margin, flow.Y, flow.Margin+flow.Width(), flow.Y)
+	flow.Space(14)
+	flow.Centered(true, 14, doc.Title)
+	flow.Space(12)
+
+	flow.Fields(10, 120, [][2]string{
+		{"Nama Mahasiswa", orDash(data.StudentName)},
+		{"NIM", orDash(data.NIM)},
+		{"Program Studi", orDash(data.ProgramStudi)},
+		{"Tempat Kegiatan", orDash(data.Company)},
+		{"Posisi", orDash(data.Position)},
+		{"Periode", data.Period},
+		{"Dosen Pembimbing", orDash(data.LecturerName)},
+		{"Dosen Penguji", orDash(data.ExaminerName)},
+	})
+	flow.Space(10)
+
+	if body := strings.TrimSpace(execute(tpl.Body, data)); body != "" {
+		flow.Paragraph(false, 10, body)
+		flow.Space(8)
+	}
+
+	rows := make([][]string, len(data.Activities))
+	var total float64
+	for i, activity := range data.Activities {
+		rows[i] = []string{
+			strconv.Itoa(i + 1),
+			FormatDate(activity.Date),
+			activity.ActivityDetails,
+			formatHours(activity.Hours),
+			activity.ApprovalStatus,
+		}
+		total += activity.Hours
+	}
+	width := flow.Width()
+	flow.Table(9, []pdf.Column{
+		{Title: "No", Width: 28},
+		{Title: "Tanggal", Width: 85},
+		{Title: "Kegiatan", Width: width - 28 - 85 - 45 - 95},
+		{Title: "Jam", Width: 45},
+		{Title: "Status", Width: 95},
+	}, rows)
+	flow.Space(4)
+	flow.Paragraph(true, 10, "Total jam kegiatan: "+formatHours(total))
+	flow.Space(12)
+
+	if len(data.Attendance) > 0 {
+		flow.Paragraph(true, 10, "Rekap Kehadiran")
+		rows := make([][]string, len(data.Attendance))
+		for i, recap := range data.Attendance {
+			rows[i] = []string{
+				recap.Month,
+				strconv.Itoa(recap.Present),
+				strconv.Itoa(recap.Excused),
+				strconv.Itoa(recap.Sick),
+				strconv.Itoa(recap.Absent),
+				formatHours(recap.Hours),
+			}
+		}
+		columnWidth := flow.Width() / 6
+		flow.Table(9, []pdf.Column{
+			{Title: "Bulan", Width: columnWidth},
+			{Title: "Hadir", Width: columnWidth},
+			{Title: "Izin", Width: columnWidth},
+			{Title: "Sakit", Width: columnWidth},
+			{Title: "Alpa", Width: columnWidth},
+			{Title: "Jam", Width: columnWidth},
+		}, rows)
+		flow.Space(12)
+	}
+
+	if report := data.Report; report != nil {
+		flow.Paragraph(true, 10, "Riwayat Pemeriksaan")
+		flow.Fields(10, 160, [][2]string{
+			{"Diperiksa Perusahaan", FormatDateTime(report.CompanyCheckedAt)},
+			{"Diperiksa Dosen Pembimbing", FormatDateTime(report.LecturerCheckedAt)},
+			{"Diperiksa Dosen Penguji", FormatDateTime(report.ExaminerCheckedAt)},
+			{"Diperiksa Program Studi", FormatDateTime(report.ProdiCheckedAt)},
+			{"Status Laporan", orDash(report.Status)},
+		})
+		flow.Space(16)
+	}
+
+	drawSignatures(flow, signatures(tpl.Signatures, data))
+
+	if footer := strings.TrimSpace(execute(tpl.Footer, data)); footer != "" {
+		flow.Space(10)
+		flow.Paragraph(false, 8, footer)
+	}
+
+	return doc.Bytes()
+}
+
+func formatHours(hours float64) string {
+	return strconv.FormatFloat(math.Round(hours*100)/100, 'f', -1, 64)
+}
+
+// studyProgram returns the program studi and faculty names of a student,
+// from the ProgramStudi relation when it is loaded
+func studyProgram(u models.User) (string, string) {
+	if u.ProgramStudi != nil {
+		faculty := deref(u.Faculty)
+		if u.ProgramStudi.Fakultas != nil {
+			faculty = u.ProgramStudi.Fakultas.Nama
+		}
+		return u.ProgramStudi.Nama, faculty
+	}
+	return deref(u.ProgramStudy), deref(u.Faculty)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func orDash(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,92 @@
+package documents
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mbkm-go/internal/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func date(year int, month time.Month, day, hour, min int) *time.Time {
+	t := time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	return &t
+}
+
+func str(s string) *string { return &s }
+
+// sampleLogbook is a report of two students with activities, an attendance
+// recap and every review step signed off
+func sampleLogbook() LogbookData {
+	report := &models.Report{
+		StartDate:         date(2024, time.February, 1, 0, 0),
+		EndDate:           date(2024, time.June, 30, 0, 0),
+		Status:            models.ReportStatusCheckedByProdi,
+		CompanyCheckedAt:  date(2024, time.July, 1, 9, 30),
+		LecturerCheckedAt: date(2024, time.July, 3, 14, 5),
+		ExaminerCheckedAt: date(2024, time.July, 4, 10, 0),
+		ProdiCheckedAt:    date(2024, time.July, 8, 16, 45),
+		ApplyJob: &models.ApplyJob{
+			Users: []models.User{
+				{Name: "Siti Rahmawati", NIM: str("2010511001"), ProgramStudy: str("Informatika"), Faculty: str("Ilmu Komputer")},
+				{Name: "Budi Santoso", NIM: str("2010511002"), ProgramStudy: str("Informatika"), Faculty: str("Ilmu Komputer")},
+			},
+			Jobs:                []models.Job{{Title: "Backend Engineer Intern", Company: "PT Contoh Teknologi"}},
+			ResponsibleLecturer: &models.User{Name: "Dr. Andi Wijaya"},
+			ExaminerLecturer:    &models.User{Name: "Dewi Lestari, M.Kom."},
+		},
+		ActivityDetails: []models.ActivityDetail{
+			{Date: date(2024, time.February, 5, 0, 0), ActivityDetails: "Orientasi dan pengenalan tim", Hours: 8, ApprovalStatus: "Disetujui"},
+			{Date: date(2024, time.February, 6, 0, 0), ActivityDetails: "Menyiapkan lingkungan pengembangan dan membaca dokumentasi arsitektur layanan pembayaran yang sudah berjalan", Hours: 7.5, ApprovalStatus: "Disetujui"},
+			{Date: date(2024, time.February, 7, 0, 0), ActivityDetails: "Menulis endpoint laporan transaksi", Hours: 6.25, ApprovalStatus: "Menunggu Persetujuan"},
+		},
+		CompanyChecked: &models.User{Name: "Rina Kurnia"},
+		ProdiChecked:   &models.User{Name: "Prof. Hadi Susanto"},
+	}
+
+	data := NewLogbookData(report)
+	data.Attendance = []models.AttendanceRecap{
+		{Month: "2024-02", Present: 18, Excused: 1, Sick: 1, Hours: 142.5},
+		{Month: "2024-03", Present: 20, Absent: 1, Hours: 160},
+	}
+	return data
+}
+
+func TestRenderLogbookGolden(t *testing.T) {
+	got := RenderLogbook(Default(models.DocumentTemplateLogbook), sampleLogbook())
+
+	golden := filepath.Join("testdata", "logbook.golden.pdf")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden file (run go test -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("logbook PDF differs from %s (%d bytes, want %d); run go test -update if the change is intended", golden, len(got), len(want))
+	}
+}
+
+func TestRenderLogbookDeterministic(t *testing.T) {
+	tpl := Default(models.DocumentTemplateLogbook)
+	first := RenderLogbook(tpl, sampleLogbook())
+	second := RenderLogbook(tpl, sampleLogbook())
+	if !bytes.Equal(first, second) {
+		t.Error("rendering the same logbook twice gives different bytes")
+	}
+	if !bytes.HasPrefix(first, []byte("%PDF-")) {
+		t.Errorf("output does not start with a PDF header: %q", first[:min(len(first), 8)])
+	}
+}
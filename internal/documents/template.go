@@ -0,0 +1,225 @@
+// Package documents renders the PDFs the application hands out, using
+// templates that can be customised per program studi.
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"mbkm-go/internal/models"
+	"mbkm-go/pkg/pdf"
+
+	"gorm.io/gorm"
+)
+
+// defaults are used when no template is stored for a kind
+var defaults = map[string]models.DocumentTemplate{
+	models.DocumentTemplateLogbook: {
+		Kind:   models.DocumentTemplateLogbook,
+		Title:  "LOGBOOK KEGIATAN MBKM",
+		Header: "{{.Faculty}}\nProgram Studi {{.ProgramStudi}}",
+		Body:   "Logbook ini memuat seluruh kegiatan harian mahasiswa selama pelaksanaan program MBKM di {{.Company}}.",
+		Footer: "Dokumen ini dihasilkan oleh sistem MBKM.",
+		Signatures: "Mahasiswa|{{.StudentName}}\n" +
+			"Pembimbing Lapangan|{{.CompanyChecker}}\n" +
+			"Dosen Pembimbing|{{.LecturerName}}\n" +
+			"Koordinator Program Studi|{{.ProdiChecker}}",
+	},
+	models.DocumentTemplateTranscript: {
+		Kind:   models.DocumentTemplateTranscript,
+		Title:  "TRANSKRIP KONVERSI NILAI MBKM",
+		Header: "{{.Faculty}}\nProgram Studi {{.ProgramStudi}}",
+		Body: "Berdasarkan hasil penilaian kegiatan MBKM di {{.Company}}, kegiatan mahasiswa tersebut " +
+			"dikonversi menjadi mata kuliah berikut sebanyak {{.TotalSks}} SKS.",
+		Footer: "Dokumen ini dihasilkan oleh sistem MBKM dan dapat diverifikasi melalui kode QR di atas.",
+		Signatures: "Dosen Pembimbing|{{.LecturerName}}\n" +
+			"Koordinator Program Studi|",
+	},
+	models.DocumentTemplateCertificate: {
+		Kind:   models.DocumentTemplateCertificate,
+		Title:  "SERTIFIKAT",
+		Header: "{{.Faculty}}",
+		Body: "atas keberhasilannya menyelesaikan kegiatan {{.ProgramType}} sebagai {{.Position}} di {{.Company}} " +
+			"pada periode {{.Period}}{{if .Grade}} dengan nilai akhir {{.Grade}}{{end}}.",
+		Footer: "Sertifikat ini dihasilkan oleh sistem MBKM dan dapat diverifikasi melalui kode QR di atas.",
+		Signatures: "Dosen Pembimbing|{{.LecturerName}}\n" +
+			"Koordinator Program Studi|",
+	},
+	models.DocumentTemplatePartnerLetter: {
+		Kind:   models.DocumentTemplatePartnerLetter,
+		Title:  "Ucapan Terima Kasih",
+		Header: "Program Merdeka Belajar Kampus Merdeka",
+		Body: "Dengan hormat, kami mengucapkan terima kasih kepada {{.Company}} yang telah menerima " +
+			"{{.StudentCount}} mahasiswa dalam program MBKM pada periode {{.Period}}. Berikut mahasiswa " +
+			"yang telah menyelesaikan kegiatannya:",
+		Footer:     "Surat ini dihasilkan oleh sistem MBKM dan dapat diverifikasi melalui kode QR di atas.",
+		Signatures: "Koordinator MBKM|",
+	},
+	models.DocumentTemplateSuratPengantar: {
+		Kind:   models.DocumentTemplateSuratPengantar,
+		Title:  "Surat Pengantar Program MBKM",
+		Header: "{{.Faculty}}\nProgram Studi {{.ProgramStudi}}",
+		Body: "Dengan hormat, bersama surat ini kami menerangkan bahwa mahasiswa berikut adalah mahasiswa aktif " +
+			"Program Studi {{.ProgramStudi}} yang bermaksud mengikuti program MBKM di {{.Company}}.\n" +
+			"{{if .Purpose}}{{.Purpose}}\n{{end}}" +
+			"Atas perhatian dan kerja samanya kami ucapkan terima kasih.",
+		Footer:     "Surat ini dihasilkan oleh sistem MBKM dan dapat diverifikasi melalui kode QR di atas.",
+		Signatures: "Ketua Program Studi {{.ProgramStudi}}|{{.ProdiHead}}",
+	},
+	models.DocumentTemplateSuratRekomendasi: {
+		Kind:   models.DocumentTemplateSuratRekomendasi,
+		Title:  "Surat Rekomendasi Program Studi",
+		Header: "{{.Faculty}}\nProgram Studi {{.ProgramStudi}}",
+		Body: "Dengan hormat, Program Studi {{.ProgramStudi}} merekomendasikan mahasiswa berikut untuk mengikuti " +
+			"program MBKM di {{.Company}}. Kegiatan tersebut dapat dikonversi ke dalam mata kuliah program studi.\n" +
+			"{{if .Purpose}}{{.Purpose}}\n{{end}}" +
+			"Atas perhatian dan kerja samanya kami ucapkan terima kasih.",
+		Footer:     "Surat ini dihasilkan oleh sistem MBKM dan dapat diverifikasi melalui kode QR di atas.",
+		Signatures: "Ketua Program Studi {{.ProgramStudi}}|{{.ProdiHead}}",
+	},
+}
+
+// Template returns the template of a kind for a program studi and program
+// type (vacancy type, may be empty). A template for the program type wins,
+// then one for the program studi; stored defaults and then the built-in one
+// are the fallback.
+func Template(db *gorm.DB, kind string, prodiID *uint, programType string) models.DocumentTemplate {
+	type candidate struct {
+		prodi bool
+		typed bool
+	}
+	candidates := []candidate{{true, true}, {false, true}, {true, false}, {false, false}}
+	for _, cand := range candidates {
+		if (cand.prodi && prodiID == nil) || (cand.typed && programType == "") {
+			continue
+		}
+		query := db.Where("kind = ?", kind)
+		if cand.prodi {
+			query = query.Where("id_program_studi = ?", *prodiID)
+		} else {
+			query = query.Where("id_program_studi IS NULL")
+		}
+		if cand.typed {
+			query = query.Where("program_type = ?", programType)
+		} else {
+			query = query.Where("program_type IS NULL")
+		}
+		var tpl models.DocumentTemplate
+		if err := query.First(&tpl).Error; err == nil {
+			return tpl
+		}
+	}
+	return defaults[kind]
+}
+
+// Default returns the built-in template of a kind
+func Default(kind string) models.DocumentTemplate {
+	return defaults[kind]
+}
+
+// Kinds lists the template kinds that can be stored
+func Kinds() []string {
+	kinds := make([]string, 0, len(defaults))
+	for kind := range defaults {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Validate checks that every text of a template parses
+func Validate(tpl models.DocumentTemplate) error {
+	fields := map[string]string{
+		"title":      tpl.Title,
+		"header":     tpl.Header,
+		"body":       tpl.Body,
+		"footer":     tpl.Footer,
+		"signatures": tpl.Signatures,
+	}
+	for name, text := range fields {
+		if _, err := template.New(name).Option("missingkey=zero").Parse(text); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// execute fills the placeholders of text. A broken template is printed as
+// it is rather than failing the whole document.
+func execute(text string, data interface{}) string {
+	t, err := template.New("").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return text
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return text
+	}
+	return buf.String()
+}
+
+// signature is one signature block
+type signature struct {
+	Label string
+	Name  string
+}
+
+func signatures(text string, data interface{}) []signature {
+	var result []signature
+	for _, line := range strings.Split(execute(text, data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		label, name, _ := strings.Cut(line, "|")
+		result = append(result, signature{Label: strings.TrimSpace(label), Name: strings.TrimSpace(name)})
+	}
+	return result
+}
+
+// drawSignatures lays out signature blocks two per row
+func drawSignatures(flow *pdf.Flow, blocks []signature) {
+	const blockHeight = 90
+	columnWidth := flow.Width() / 2
+	for i := 0; i < len(blocks); i += 2 {
+		flow.Ensure(blockHeight)
+		for j := 0; j < 2 && i+j < len(blocks); j++ {
+			center := flow.Margin + columnWidth*float64(j) + columnWidth/2
+			flow.Doc.SetFont(false, 10)
+			flow.Doc.TextCenter(center, flow.Y+12, blocks[i+j].Label)
+			flow.Doc.Line(center-80, flow.Y+70, center+80, flow.Y+70)
+			name := blocks[i+j].Name
+			if name == "" {
+				name = "(...........................)"
+			}
+			flow.Doc.SetFont(true, 10)
+			flow.Doc.TextCenter(center, flow.Y+82, name)
+		}
+		flow.Y += blockHeight
+	}
+}
+
+var months = [...]string{
+	"Januari", "Februari", "Maret", "April", "Mei", "Juni",
+	"Juli", "Agustus", "September", "Oktober", "November", "Desember",
+}
+
+// FormatDate formats a date the Indonesian way, e.g. "2 Januari 2024"
+func FormatDate(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return fmt.Sprintf("%d %s %d", t.Day(), months[t.Month()-1], t.Year())
+}
+
+// FormatDateTime adds the time to FormatDate, e.g. "2 Januari 2024 13:05"
+func FormatDateTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return FormatDate(t) + " " + t.Format("15:04")
+}
@@ -0,0 +1,206 @@
+package documents
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"mbkm-go/internal/models"
+	"mbkm-go/pkg/pdf"
+	"mbkm-go/pkg/qrcode"
+)
+
+// TranscriptCourse is one converted course on a transcript
+type TranscriptCourse struct {
+	Code       string  `json:"code"`
+	Name       string  `json:"name"`
+	Sks        int     `json:"sks"`
+	Score      float64 `json:"score"`
+	Grade      string  `json:"grade"`
+	GradePoint float64 `json:"grade_point"`
+}
+
+// TranscriptData holds everything printed on a konversi nilai transcript.
+// The string fields are also the placeholders available to transcript
+// templates.
+type TranscriptData struct {
+	Placement
+	Period     string
+	FinalScore string
+	FinalGrade string
+	TotalSks   string
+	GPA        string
+	Number     string
+	IssuedDate string
+	VerifyURL  string
+
+	Courses []TranscriptCourse
+}
+
+// NewTranscriptData collects the transcript fields from an application loaded
+// with its students, jobs and lecturers, its evaluation and its converted
+// courses loaded with their mata kuliah. The period comes from the report
+// when there is one.
+func NewTranscriptData(applyJob *models.ApplyJob, evaluation *models.Evaluation, konversi []models.KonversiNilai, report *models.Report) TranscriptData {
+	data := TranscriptData{
+		Placement:  NewPlacement(applyJob),
+		Period:     "-",
+		FinalScore: formatHours(evaluation.FinalScore),
+		FinalGrade: evaluation.Grade,
+	}
+	if report != nil {
+		data.Period = FormatDate(report.StartDate) + " - " + FormatDate(report.EndDate)
+	}
+
+	var sks int
+	var points float64
+	for _, k := range konversi {
+		course := TranscriptCourse{Score: k.Score, Grade: k.Grade, GradePoint: k.GradePoint}
+		if k.MataKuliah != nil {
+			course.Code = k.MataKuliah.KodeMatkul
+			course.Name = k.MataKuliah.NamaMatkul
+			course.Sks = k.MataKuliah.Sks
+		}
+		sks += course.Sks
+		points += course.GradePoint * float64(course.Sks)
+		data.Courses = append(data.Courses, course)
+	}
+	data.TotalSks = strconv.Itoa(sks)
+	data.GPA = "-"
+	if sks > 0 {
+		data.GPA = strconv.FormatFloat(points/float64(sks), 'f', 2, 64)
+	}
+	return data
+}
+
+// Issue stamps the transcript with its document number, issue date and the
+// URL its QR code points to
+func (d *TranscriptData) Issue(number string, issuedAt time.Time, verifyURL string) {
+	d.Number = number
+	d.IssuedDate = FormatDate(&issuedAt)
+	d.VerifyURL = verifyURL
+}
+
+// RenderTranscript renders the transcript: document number, student
+// identity, the converted courses with SKS and grades, the totals, signature
+// blocks and a QR code linking to the verification page
+func RenderTranscript(tpl models.DocumentTemplate, data TranscriptData) []byte {
+	doc := pdf.New()
+	doc.Title = execute(tpl.Title, data)
+	doc.Author = data.StudentName
+
+	flow := pdf.NewFlow(doc, 50)
+
+	for _, line := range strings.Split(execute(tpl.Header, data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			flow.Centered(true, 11, strings.TrimSpace(line))
+		}
+	}
+	flow.Space(6)
+	flow.Doc.Line(flow.Margin, flow.Y, flow.Margin+flow.Width(), flow.Y)
+	flow.Space(14)
+	flow.Centered(true, 14, doc.Title)
+	flow.Centered(false, 10, "Nomor: "+orDash(data.Number))
+	flow.Space(12)
+
+	flow.Fields(10, 120, [][2]string{
+		{"Nama Mahasiswa", orDash(data.StudentName)},
+		{"NIM", orDash(data.NIM)},
+		{"Program Studi", orDash(data.ProgramStudi)},
+		{"Tempat Kegiatan", orDash(data.Company)},
+		{"Posisi", orDash(data.Position)},
+		{"Periode", data.Period},
+		{"Dosen Pembimbing", orDash(data.LecturerName)},
+	})
+	flow.Space(10)
+
+	if body := strings.TrimSpace(execute(tpl.Body, data)); body != "" {
+		flow.Paragraph(false, 10, body)
+		flow.Space(8)
+	}
+
+	rows := make([][]string, len(data.Courses))
+	for i, course := range data.Courses {
+		rows[i] = []string{
+			strconv.Itoa(i + 1),
+			course.Code,
+			course.Name,
+			strconv.Itoa(course.Sks),
+			formatHours(course.Score),
+			course.Grade,
+			strconv.FormatFloat(course.GradePoint, 'f', 2, 64),
+		}
+	}
+	width := flow.Width()
+	flow.Table(9, []pdf.Column{
+		{Title: "No", Width: 28},
+		{Title: "Kode", Width: 65},
+		{Title: "Mata Kuliah", Width: width - 28 - 65 - 35 - 45 - 40 - 45},
+		{Title: "SKS", Width: 35},
+		{Title: "Nilai", Width: 45},
+		{Title: "Huruf", Width: 40},
+		{Title: "Bobot", Width: 45},
+	}, rows)
+	flow.Space(4)
+	flow.Fields(10, 120, [][2]string{
+		{"Total SKS", data.TotalSks},
+		{"IPK Konversi", data.GPA},
+		{"Nilai Akhir MBKM", data.FinalScore + " (" + orDash(data.FinalGrade) + ")"},
+	})
+	flow.Space(16)
+
+	flow.Paragraph(false, 10, "Diterbitkan pada "+orDash(data.IssuedDate))
+	flow.Space(6)
+	drawSignatures(flow, signatures(tpl.Signatures, data))
+
+	if data.VerifyURL != "" {
+		drawVerification(flow, data.VerifyURL)
+	}
+
+	if footer := strings.TrimSpace(execute(tpl.Footer, data)); footer != "" {
+		flow.Space(10)
+		flow.Paragraph(false, 8, footer)
+	}
+
+	return doc.Bytes()
+}
+
+// drawVerification draws the QR code of a verification URL with the URL
+// printed next to it
+func drawVerification(flow *pdf.Flow, url string) {
+	const size = 80
+	code, err := qrcode.Encode(url)
+	if err != nil {
+		flow.Paragraph(false, 8, "Verifikasi dokumen: "+url)
+		return
+	}
+
+	flow.Space(10)
+	flow.Ensure(size)
+	drawQRCode(flow.Doc, flow.Margin, flow.Y, size, code)
+
+	x := flow.Margin + size + 12
+	flow.Doc.SetFont(true, 9)
+	flow.Doc.Text(x, flow.Y+24, "Verifikasi keaslian dokumen")
+	flow.Doc.SetFont(false, 8)
+	y := flow.Y + 38
+	flow.Doc.Text(x, y, "Pindai kode QR atau buka alamat berikut:")
+	for _, line := range flow.Doc.Wrap(url, flow.Width()-size-12) {
+		y += 11
+		flow.Doc.Text(x, y, line)
+	}
+	flow.Y += size
+}
+
+// drawQRCode draws a QR code into a square of the given size, keeping the
+// four module quiet zone inside the square
+func drawQRCode(doc *pdf.Document, x, y, size float64, code *qrcode.Code) {
+	module := size / float64(code.Size+8)
+	for row := 0; row < code.Size; row++ {
+		for col := 0; col < code.Size; col++ {
+			if code.Black(col, row) {
+				doc.Rect(x+float64(col+4)*module, y+float64(row+4)*module, module, module, true)
+			}
+		}
+	}
+}
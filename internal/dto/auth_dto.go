@@ -8,8 +8,8 @@ type RegisterRequest struct {
 	Password           string `json:"password" validate:"required,min=6"`
 	PhoneNumber        string `json:"phone_number,omitempty"`
 	Address            string `json:"address,omitempty"`
-	ProgramStudy       string `json:"program_study,omitempty"`
-	Faculty            string `json:"faculty,omitempty"`
+	IDProgramStudi     uint   `json:"id_program_studi,omitempty"`
+	ProgramStudy       string `json:"program_study,omitempty"` // name or PDDikti code, used without id_program_studi
 	NIM                string `json:"nim,omitempty"`
 	Semester           string `json:"semester,omitempty"`
 	SocialMedia        string `json:"social_media,omitempty"`
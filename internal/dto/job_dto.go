@@ -15,6 +15,20 @@ type JobRequest struct {
 	VacancyType string     `json:"vacancy_type,omitempty"`
 	MataKuliah  string     `json:"mata_kuliah,omitempty"`
 	Deadline    *time.Time `json:"deadline,omitempty"`
+
+	// Courses replaces the job's course mapping when present
+	Courses []JobCourseRequest `json:"courses,omitempty"`
+}
+
+// JobCourseRequest represents a course a job can be converted into
+type JobCourseRequest struct {
+	MataKuliahID uint `json:"mata_kuliah_id"`
+	Sks          int  `json:"sks,omitempty"` // defaults to the course's SKS
+}
+
+// RejectRequest represents a rejection with the reason shown to the owner
+type RejectRequest struct {
+	Reason string `json:"reason" form:"reason"`
 }
 
 // JobListRequest represents job list query parameters
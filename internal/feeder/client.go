@@ -0,0 +1,300 @@
+package feeder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a NIM, NIDN, course code or kode program studi
+// is unknown to the Feeder
+var ErrNotFound = errors.New("feeder: record not found")
+
+// errInvalidToken is the Feeder error code of an expired token
+const errInvalidToken = 100
+
+// Client talks to a Neo Feeder web service (live2.php): every call is a
+// JSON POST with an "act" and the token obtained with GetToken
+type Client struct {
+	URL      string
+	Username string
+	Password string
+	Client   *http.Client
+
+	token string
+}
+
+func NewClient(url, username, password string) (*Client, error) {
+	if url == "" {
+		return nil, errors.New("FEEDER_URL is not configured")
+	}
+	return &Client{
+		URL:      url,
+		Username: username,
+		Password: password,
+		Client:   &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// request is the body of a Feeder call
+type request struct {
+	Act      string      `json:"act"`
+	Token    string      `json:"token,omitempty"`
+	Username string      `json:"username,omitempty"`
+	Password string      `json:"password,omitempty"`
+	Filter   string      `json:"filter,omitempty"`
+	Limit    int         `json:"limit,omitempty"`
+	Key      interface{} `json:"key,omitempty"`
+	Record   interface{} `json:"record,omitempty"`
+}
+
+type response struct {
+	ErrorCode int             `json:"error_code"`
+	ErrorDesc string          `json:"error_desc"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Error is an error reported by the Feeder
+type Error struct {
+	Act  string
+	Code int
+	Desc string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("feeder %s: %d %s", e.Act, e.Code, e.Desc)
+}
+
+func (c *Client) post(ctx context.Context, req request, out interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.Client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("feeder %s: HTTP %d", req.Act, resp.StatusCode)
+	}
+
+	var result response
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("feeder %s: %w", req.Act, err)
+	}
+	if result.ErrorCode != 0 {
+		return &Error{Act: req.Act, Code: result.ErrorCode, Desc: result.ErrorDesc}
+	}
+	if out != nil && len(result.Data) > 0 {
+		return json.Unmarshal(result.Data, out)
+	}
+	return nil
+}
+
+func (c *Client) login(ctx context.Context) error {
+	var data struct {
+		Token string `json:"token"`
+	}
+	if err := c.post(ctx, request{Act: "GetToken", Username: c.Username, Password: c.Password}, &data); err != nil {
+		return err
+	}
+	if data.Token == "" {
+		return errors.New("feeder GetToken: no token returned")
+	}
+	c.token = data.Token
+	return nil
+}
+
+// call runs an act with the token, logging in first and once more when the
+// token has expired
+func (c *Client) call(ctx context.Context, req request, out interface{}) error {
+	if c.token == "" {
+		if err := c.login(ctx); err != nil {
+			return err
+		}
+	}
+	req.Token = c.token
+	err := c.post(ctx, req, out)
+	var feederErr *Error
+	if errors.As(err, &feederErr) && feederErr.Code == errInvalidToken {
+		if err := c.login(ctx); err != nil {
+			return err
+		}
+		req.Token = c.token
+		err = c.post(ctx, req, out)
+	}
+	return err
+}
+
+// lookup returns a field of the first record of a GetList act
+func (c *Client) lookup(ctx context.Context, act, filter, field string) (string, error) {
+	var rows []map[string]interface{}
+	if err := c.call(ctx, request{Act: act, Filter: filter, Limit: 1}, &rows); err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("%w: %s %s", ErrNotFound, act, filter)
+	}
+	value, _ := rows[0][field].(string)
+	if value == "" {
+		return "", fmt.Errorf("%w: %s %s", ErrNotFound, act, filter)
+	}
+	return value, nil
+}
+
+// insert runs an Insert act and returns the ID field of the new record
+func (c *Client) insert(ctx context.Context, act string, record interface{}, field string) (string, error) {
+	var data map[string]interface{}
+	if err := c.call(ctx, request{Act: act, Record: record}, &data); err != nil {
+		return "", err
+	}
+	id, _ := data[field].(string)
+	if id == "" {
+		return "", fmt.Errorf("feeder %s: no %s returned", act, field)
+	}
+	return id, nil
+}
+
+// quote escapes a value of a Feeder filter
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// Push sends an activity with its participants, lecturers and converted
+// grades and returns its Feeder ID. When a step fails the activity is
+// deleted again so it can be sent once the data is fixed.
+func (c *Client) Push(ctx context.Context, activity Activity) (string, error) {
+	prodiID, err := c.lookup(ctx, "GetProdi", "kode_program_studi = "+quote(activity.KodeProdi), "id_prodi")
+	if err != nil {
+		return "", err
+	}
+
+	// Resolve everything before inserting anything
+	registrations := map[string]string{}
+	for _, p := range activity.Participants {
+		id, err := c.lookup(ctx, "GetListRiwayatPendidikanMahasiswa", "nim = "+quote(p.NIM), "id_registrasi_mahasiswa")
+		if err != nil {
+			return "", err
+		}
+		registrations[p.NIM] = id
+	}
+	lecturers := map[string]string{}
+	for _, l := range append(append([]Lecturer(nil), activity.Supervisors...), activity.Examiners...) {
+		id, err := c.lookup(ctx, "GetListDosen", "nidn = "+quote(l.NIDN), "id_dosen")
+		if err != nil {
+			return "", err
+		}
+		lecturers[l.NIDN] = id
+	}
+	courses := map[string]string{}
+	for _, g := range activity.Grades {
+		if _, ok := courses[g.KodeMatkul]; ok {
+			continue
+		}
+		filter := "kode_mata_kuliah = " + quote(g.KodeMatkul) + " AND id_prodi = " + quote(prodiID)
+		id, err := c.lookup(ctx, "GetListMataKuliah", filter, "id_matkul")
+		if err != nil {
+			return "", err
+		}
+		courses[g.KodeMatkul] = id
+	}
+
+	record := map[string]interface{}{
+		"id_prodi":           prodiID,
+		"id_semester":        activity.Semester,
+		"id_jenis_aktivitas": activity.JenisAktivitas,
+		"jenis_anggota":      activity.JenisAnggota,
+		"judul":              activity.Judul,
+		"lokasi":             activity.Lokasi,
+		"keterangan":         activity.Keterangan,
+		"tanggal_mulai":      activity.TanggalMulai,
+		"tanggal_selesai":    activity.TanggalSelesai,
+	}
+	if activity.ProgramMBKM != "" {
+		record["program_mbkm"] = activity.ProgramMBKM
+	}
+	activityID, err := c.insert(ctx, "InsertAktivitasMahasiswa", record, "id_aktivitas")
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.pushMembers(ctx, activityID, activity, registrations, lecturers, courses); err != nil {
+		if deleteErr := c.Delete(ctx, activityID); deleteErr != nil {
+			return "", fmt.Errorf("%w (the activity %s could not be deleted: %v)", err, activityID, deleteErr)
+		}
+		return "", err
+	}
+	return activityID, nil
+}
+
+func (c *Client) pushMembers(ctx context.Context, activityID string, activity Activity, registrations, lecturers, courses map[string]string) error {
+	members := map[string]string{}
+	for _, p := range activity.Participants {
+		id, err := c.insert(ctx, "InsertAnggotaAktivitasMahasiswa", map[string]interface{}{
+			"id_aktivitas":            activityID,
+			"id_registrasi_mahasiswa": registrations[p.NIM],
+			"jenis_peran":             p.JenisPeran,
+		}, "id_anggota")
+		if err != nil {
+			return err
+		}
+		members[p.NIM] = id
+	}
+
+	for _, l := range activity.Supervisors {
+		if _, err := c.insert(ctx, "InsertBimbingMahasiswa", map[string]interface{}{
+			"id_aktivitas":         activityID,
+			"id_kategori_kegiatan": l.Kategori,
+			"id_dosen":             lecturers[l.NIDN],
+			"pembimbing_ke":        l.Urutan,
+		}, "id_bimbing_mahasiswa"); err != nil {
+			return err
+		}
+	}
+	for _, l := range activity.Examiners {
+		if _, err := c.insert(ctx, "InsertUjiMahasiswa", map[string]interface{}{
+			"id_aktivitas":         activityID,
+			"id_kategori_kegiatan": l.Kategori,
+			"id_dosen":             lecturers[l.NIDN],
+			"penguji_ke":           l.Urutan,
+		}, "id_uji"); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range activity.Grades {
+		if _, err := c.insert(ctx, "InsertKonversiKampusMerdeka", map[string]interface{}{
+			"id_aktivitas": activityID,
+			"id_anggota":   members[g.NIM],
+			"id_matkul":    courses[g.KodeMatkul],
+			"nilai_angka":  g.NilaiAngka,
+			"nilai_huruf":  g.NilaiHuruf,
+			"nilai_indeks": g.NilaiIndeks,
+		}, "id_konversi_aktivitas"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes an activity from the Feeder
+func (c *Client) Delete(ctx context.Context, activityID string) error {
+	return c.call(ctx, request{Act: "DeleteAktivitasMahasiswa", Key: map[string]string{"id_aktivitas": activityID}}, nil)
+}
@@ -0,0 +1,305 @@
+package feeder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubFeeder is a Neo Feeder web service answering from canned data. It
+// records every call, hands out token "t1" on the first login and "t2"
+// after, and fails the acts listed in fail with error code 500.
+type stubFeeder struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	calls    []request
+	logins   int
+	expired  map[string]bool // tokens answered with errInvalidToken
+	notFound map[string]bool // filters matching no record
+	fail     map[string]bool
+}
+
+func newStubFeeder(t *testing.T) (*stubFeeder, *Client) {
+	s := &stubFeeder{t: t, expired: map[string]bool{}, notFound: map[string]bool{}, fail: map[string]bool{}}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL, "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, client
+}
+
+func (s *stubFeeder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+		s.t.Errorf("got %s with Content-Type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.t.Errorf("decode request: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, req)
+
+	reply := func(code int, desc string, data interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"error_code": code, "error_desc": desc, "data": data})
+	}
+	if req.Act == "GetToken" {
+		if req.Username != "user" || req.Password != "secret" {
+			reply(103, "wrong username or password", nil)
+			return
+		}
+		s.logins++
+		token := "t1"
+		if s.logins > 1 {
+			token = "t2"
+		}
+		reply(0, "", map[string]string{"token": token})
+		return
+	}
+	if s.expired[req.Token] {
+		reply(errInvalidToken, "invalid token", nil)
+		return
+	}
+	if s.fail[req.Act] {
+		reply(500, "rejected", nil)
+		return
+	}
+
+	switch req.Act {
+	case "GetProdi":
+		s.list(reply, req, "id_prodi", "prodi-1")
+	case "GetListRiwayatPendidikanMahasiswa":
+		s.list(reply, req, "id_registrasi_mahasiswa", "reg-"+value(req.Filter))
+	case "GetListDosen":
+		s.list(reply, req, "id_dosen", "dosen-"+value(req.Filter))
+	case "GetListMataKuliah":
+		s.list(reply, req, "id_matkul", "mk-"+value(req.Filter))
+	case "InsertAktivitasMahasiswa":
+		reply(0, "", map[string]string{"id_aktivitas": "akt-1"})
+	case "InsertAnggotaAktivitasMahasiswa":
+		reply(0, "", map[string]string{"id_anggota": "agt-" + req.Record.(map[string]interface{})["id_registrasi_mahasiswa"].(string)})
+	case "InsertBimbingMahasiswa":
+		reply(0, "", map[string]string{"id_bimbing_mahasiswa": "bmb-1"})
+	case "InsertUjiMahasiswa":
+		reply(0, "", map[string]string{"id_uji": "uji-1"})
+	case "InsertKonversiKampusMerdeka":
+		reply(0, "", map[string]string{"id_konversi_aktivitas": "knv-1"})
+	case "DeleteAktivitasMahasiswa":
+		reply(0, "", nil)
+	default:
+		s.t.Errorf("unexpected act %q", req.Act)
+		reply(999, "unknown act", nil)
+	}
+}
+
+func (s *stubFeeder) list(reply func(int, string, interface{}), req request, field, id string) {
+	if req.Limit != 1 {
+		s.t.Errorf("%s: limit = %d, want 1", req.Act, req.Limit)
+	}
+	if s.notFound[req.Filter] {
+		reply(0, "", []interface{}{})
+		return
+	}
+	reply(0, "", []map[string]string{{field: id}})
+}
+
+// value returns the first quoted value of a filter
+func value(filter string) string {
+	parts := strings.Split(filter, "'")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// acts returns the acts called so far, in order
+func (s *stubFeeder) acts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acts := make([]string, len(s.calls))
+	for i, call := range s.calls {
+		acts[i] = call.Act
+	}
+	return acts
+}
+
+// records returns the records sent with an act
+func (s *stubFeeder) records(act string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var records []map[string]interface{}
+	for _, call := range s.calls {
+		if call.Act == act {
+			records = append(records, call.Record.(map[string]interface{}))
+		}
+	}
+	return records
+}
+
+func sampleActivity() Activity {
+	return Activity{
+		ApplyJobID:     7,
+		Semester:       "20241",
+		KodeProdi:      "55201",
+		JenisAktivitas: "13",
+		JenisAnggota:   JenisAnggotaPersonal,
+		Judul:          "Magang Backend Engineer di PT Contoh",
+		Lokasi:         "Jakarta",
+		TanggalMulai:   "2024-02-01",
+		TanggalSelesai: "2024-06-30",
+		Participants:   []Participant{{NIM: "2010511001", Nama: "Siti", JenisPeran: PeranPersonal}},
+		Supervisors:    []Lecturer{{NIDN: "0011223344", Kategori: "110403", Urutan: 1}},
+		Examiners:      []Lecturer{{NIDN: "0099887766", Kategori: "110501", Urutan: 1}},
+		Grades: []Grade{
+			{NIM: "2010511001", KodeMatkul: "IF401", NilaiAngka: 85, NilaiHuruf: "A", NilaiIndeks: 4},
+			{NIM: "2010511001", KodeMatkul: "IF402", NilaiAngka: 78, NilaiHuruf: "B+", NilaiIndeks: 3.5},
+		},
+	}
+}
+
+func TestPush(t *testing.T) {
+	stub, client := newStubFeeder(t)
+
+	id, err := client.Push(context.Background(), sampleActivity())
+	if err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if id != "akt-1" {
+		t.Errorf("Push returned %q, want akt-1", id)
+	}
+
+	want := []string{
+		"GetToken",
+		"GetProdi",
+		"GetListRiwayatPendidikanMahasiswa",
+		"GetListDosen", "GetListDosen",
+		"GetListMataKuliah", "GetListMataKuliah",
+		"InsertAktivitasMahasiswa",
+		"InsertAnggotaAktivitasMahasiswa",
+		"InsertBimbingMahasiswa",
+		"InsertUjiMahasiswa",
+		"InsertKonversiKampusMerdeka", "InsertKonversiKampusMerdeka",
+	}
+	if got := stub.acts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("acts = %v\nwant %v", got, want)
+	}
+	for _, call := range stub.calls[1:] {
+		if call.Token != "t1" {
+			t.Errorf("%s sent token %q, want t1", call.Act, call.Token)
+		}
+	}
+
+	activity := stub.records("InsertAktivitasMahasiswa")[0]
+	if activity["id_prodi"] != "prodi-1" || activity["id_semester"] != "20241" {
+		t.Errorf("activity record = %v", activity)
+	}
+	if _, ok := activity["program_mbkm"]; ok {
+		t.Errorf("program_mbkm sent without being configured: %v", activity)
+	}
+
+	member := stub.records("InsertAnggotaAktivitasMahasiswa")[0]
+	if member["id_aktivitas"] != "akt-1" || member["id_registrasi_mahasiswa"] != "reg-2010511001" {
+		t.Errorf("member record = %v", member)
+	}
+	if got := stub.records("InsertBimbingMahasiswa")[0]["id_dosen"]; got != "dosen-0011223344" {
+		t.Errorf("supervisor id_dosen = %v", got)
+	}
+	if got := stub.records("InsertUjiMahasiswa")[0]["id_dosen"]; got != "dosen-0099887766" {
+		t.Errorf("examiner id_dosen = %v", got)
+	}
+
+	grades := stub.records("InsertKonversiKampusMerdeka")
+	for i, want := range []struct {
+		matkul string
+		angka  float64
+		huruf  string
+	}{{"mk-IF401", 85, "A"}, {"mk-IF402", 78, "B+"}} {
+		g := grades[i]
+		if g["id_anggota"] != "agt-reg-2010511001" || g["id_matkul"] != want.matkul || g["nilai_angka"] != want.angka || g["nilai_huruf"] != want.huruf {
+			t.Errorf("grade %d = %v", i, g)
+		}
+	}
+	if filter := stub.calls[5].Filter; filter != "kode_mata_kuliah = 'IF401' AND id_prodi = 'prodi-1'" {
+		t.Errorf("course filter = %q", filter)
+	}
+}
+
+func TestPushRenewsExpiredToken(t *testing.T) {
+	stub, client := newStubFeeder(t)
+	stub.expired["t1"] = true
+
+	if _, err := client.Push(context.Background(), sampleActivity()); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if stub.logins != 2 {
+		t.Errorf("logged in %d times, want 2", stub.logins)
+	}
+	last := stub.calls[len(stub.calls)-1]
+	if last.Token != "t2" {
+		t.Errorf("last call sent token %q, want the renewed t2", last.Token)
+	}
+}
+
+func TestPushDeletesActivityWhenAStepFails(t *testing.T) {
+	stub, client := newStubFeeder(t)
+	stub.fail["InsertKonversiKampusMerdeka"] = true
+
+	_, err := client.Push(context.Background(), sampleActivity())
+	var feederErr *Error
+	if !errors.As(err, &feederErr) || feederErr.Act != "InsertKonversiKampusMerdeka" || feederErr.Code != 500 {
+		t.Fatalf("Push error = %v, want the failed InsertKonversiKampusMerdeka", err)
+	}
+
+	acts := stub.acts()
+	if acts[len(acts)-1] != "DeleteAktivitasMahasiswa" {
+		t.Fatalf("last act = %s, want DeleteAktivitasMahasiswa", acts[len(acts)-1])
+	}
+	key, _ := stub.calls[len(stub.calls)-1].Key.(map[string]interface{})
+	if key["id_aktivitas"] != "akt-1" {
+		t.Errorf("deleted key = %v, want id_aktivitas akt-1", key)
+	}
+}
+
+func TestPushUnknownStudentInsertsNothing(t *testing.T) {
+	stub, client := newStubFeeder(t)
+	stub.notFound["nim = '2010511001'"] = true
+
+	_, err := client.Push(context.Background(), sampleActivity())
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Push error = %v, want ErrNotFound", err)
+	}
+	for _, act := range stub.acts() {
+		if strings.HasPrefix(act, "Insert") || strings.HasPrefix(act, "Delete") {
+			t.Errorf("called %s after a lookup failed", act)
+		}
+	}
+}
+
+func TestPushHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, "user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Push(context.Background(), sampleActivity())
+	if err == nil || !strings.Contains(err.Error(), "HTTP 502") {
+		t.Errorf("Push error = %v, want HTTP 502", err)
+	}
+}
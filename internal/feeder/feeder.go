@@ -0,0 +1,315 @@
+// Package feeder maps MBKM placements onto the records of the PDDikti Neo
+// Feeder (aktivitas mahasiswa, anggota, pembimbing, penguji and konversi
+// kampus merdeka), lists the data missing to report them and pushes them to
+// a Feeder web service.
+package feeder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"mbkm-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Feeder codes of anggota aktivitas
+const (
+	JenisAnggotaPersonal = 0
+	JenisAnggotaKelompok = 1
+
+	PeranKetua    = 1
+	PeranAnggota  = 2
+	PeranPersonal = 3
+)
+
+// Activity is one placement as a Feeder aktivitas mahasiswa with its
+// participants, lecturers and converted grades. Students, lecturers, courses
+// and the program studi are identified by NIM, NIDN, course code and kode
+// program studi; the client resolves them to Feeder IDs.
+type Activity struct {
+	ApplyJobID     uint          `json:"apply_job_id"`
+	Semester       string        `json:"id_semester"`
+	KodeProdi      string        `json:"kode_program_studi"`
+	JenisAktivitas string        `json:"id_jenis_aktivitas"`
+	ProgramMBKM    string        `json:"program_mbkm,omitempty"`
+	JenisAnggota   int           `json:"jenis_anggota"`
+	Judul          string        `json:"judul"`
+	Lokasi         string        `json:"lokasi"`
+	Keterangan     string        `json:"keterangan"`
+	TanggalMulai   string        `json:"tanggal_mulai"`
+	TanggalSelesai string        `json:"tanggal_selesai"`
+	Participants   []Participant `json:"anggota"`
+	Supervisors    []Lecturer    `json:"pembimbing"`
+	Examiners      []Lecturer    `json:"penguji"`
+	Grades         []Grade       `json:"konversi"`
+}
+
+// Participant is an anggota aktivitas
+type Participant struct {
+	NIM        string `json:"nim"`
+	Nama       string `json:"nama"`
+	JenisPeran int    `json:"jenis_peran"`
+}
+
+// Lecturer is a pembimbing or penguji; Urutan is pembimbing_ke / penguji_ke
+type Lecturer struct {
+	NIDN     string `json:"nidn"`
+	Nama     string `json:"nama"`
+	Kategori string `json:"id_kategori_kegiatan"`
+	Urutan   int    `json:"urutan"`
+}
+
+// Grade is one konversi kampus merdeka row of a participant
+type Grade struct {
+	NIM         string  `json:"nim"`
+	KodeMatkul  string  `json:"kode_mata_kuliah"`
+	NamaMatkul  string  `json:"nama_mata_kuliah"`
+	Sks         int     `json:"sks_mata_kuliah"`
+	NilaiAngka  float64 `json:"nilai_angka"`
+	NilaiHuruf  string  `json:"nilai_huruf"`
+	NilaiIndeks float64 `json:"nilai_indeks"`
+}
+
+// Issue is data missing to report a placement. Issues without an
+// application concern the configuration.
+type Issue struct {
+	ApplyJobID uint   `json:"apply_job_id,omitempty"`
+	Field      string `json:"field"`
+	Message    string `json:"message"`
+}
+
+// Batch is the result of an export: the activities ready to be sent and
+// the issues of the placements left out
+type Batch struct {
+	Semester   string     `json:"semester,omitempty"`
+	Activities []Activity `json:"activities"`
+	Issues     []Issue    `json:"issues"`
+}
+
+// Options are the Feeder reference codes used for every activity
+type Options struct {
+	JenisAktivitas  string
+	ProgramMBKM     string // optional
+	KategoriBimbing string
+	KategoriUji     string
+}
+
+// Filter narrows an export
+type Filter struct {
+	ProdiID    *uint
+	Semester   string // e.g. 20241
+	ApplyJobID *uint
+}
+
+// Semester returns the Feeder semester of a date: the odd semester starts in
+// August (20241 runs from August 2024 to January 2025), the even one in
+// February (20242)
+func Semester(t time.Time) string {
+	year := t.Year()
+	switch {
+	case t.Month() >= time.August:
+		return fmt.Sprintf("%d1", year)
+	case t.Month() == time.January:
+		return fmt.Sprintf("%d1", year-1)
+	default:
+		return fmt.Sprintf("%d2", year-1)
+	}
+}
+
+// Build maps the placements with a finalized evaluation onto Feeder
+// activities. Placements with missing data are left out and listed as
+// issues.
+func Build(db *gorm.DB, filter Filter, opts Options) (Batch, error) {
+	batch := Batch{Semester: filter.Semester, Activities: []Activity{}, Issues: []Issue{}}
+	if opts.JenisAktivitas == "" {
+		batch.Issues = append(batch.Issues, Issue{Field: "FEEDER_JENIS_AKTIVITAS", Message: "Jenis aktivitas is not configured"})
+	}
+	if opts.KategoriBimbing == "" {
+		batch.Issues = append(batch.Issues, Issue{Field: "FEEDER_KATEGORI_BIMBING", Message: "Kategori kegiatan of supervisors is not configured"})
+	}
+	if opts.KategoriUji == "" {
+		batch.Issues = append(batch.Issues, Issue{Field: "FEEDER_KATEGORI_UJI", Message: "Kategori kegiatan of examiners is not configured"})
+	}
+
+	query := db.Model(&models.ApplyJob{}).
+		Preload("Users").
+		Preload("Jobs").
+		Preload("ResponsibleLecturer").
+		Preload("ExaminerLecturer").
+		Preload("Report").
+		Preload("KonversiNilai.MataKuliah").
+		Where("id IN (?)", db.Model(&models.Evaluation{}).Select("apply_job_id").Where("finalized_at IS NOT NULL"))
+	if filter.ApplyJobID != nil {
+		query = query.Where("id = ?", *filter.ApplyJobID)
+	}
+	if filter.ProdiID != nil {
+		query = query.Where("id IN (?)", db.Table("apply_job_user").
+			Joins("JOIN users ON users.id = apply_job_user.user_id").
+			Select("apply_job_user.apply_job_id").
+			Where("users.id_program_studi = ?", *filter.ProdiID))
+	}
+
+	var applyJobs []models.ApplyJob
+	if err := query.Order("id ASC").Find(&applyJobs).Error; err != nil {
+		return batch, err
+	}
+
+	var prodis []models.ProgramStudi
+	if err := db.Find(&prodis).Error; err != nil {
+		return batch, err
+	}
+	prodiByID := map[uint]models.ProgramStudi{}
+	for _, p := range prodis {
+		prodiByID[p.ID] = p
+	}
+
+	for i := range applyJobs {
+		activity, issues := mapActivity(&applyJobs[i], prodiByID, opts)
+		if filter.Semester != "" && activity.Semester != "" && activity.Semester != filter.Semester {
+			continue
+		}
+		if len(issues) > 0 {
+			batch.Issues = append(batch.Issues, issues...)
+			continue
+		}
+		batch.Activities = append(batch.Activities, activity)
+	}
+	return batch, nil
+}
+
+// mapActivity maps one placement and lists what is missing to report it
+func mapActivity(applyJob *models.ApplyJob, prodis map[uint]models.ProgramStudi, opts Options) (Activity, []Issue) {
+	var issues []Issue
+	missing := func(field, format string, args ...interface{}) {
+		issues = append(issues, Issue{ApplyJobID: applyJob.ID, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	activity := Activity{
+		ApplyJobID:     applyJob.ID,
+		JenisAktivitas: opts.JenisAktivitas,
+		ProgramMBKM:    opts.ProgramMBKM,
+		JenisAnggota:   JenisAnggotaPersonal,
+	}
+
+	var start, end *time.Time
+	if applyJob.Report != nil {
+		start, end = applyJob.Report.StartDate, applyJob.Report.EndDate
+	}
+	if end == nil {
+		end = applyJob.CompletedAt
+	}
+	if start == nil {
+		missing("report.start_date", "The placement has no start date")
+	} else {
+		activity.Semester = Semester(*start)
+		activity.TanggalMulai = start.Format("2006-01-02")
+	}
+	if end != nil {
+		activity.TanggalSelesai = end.Format("2006-01-02")
+	}
+
+	var titles, companies []string
+	for _, job := range applyJob.Jobs {
+		titles = append(titles, job.Title)
+		if job.Company != "" {
+			companies = append(companies, job.Company)
+		}
+	}
+	activity.Lokasi = strings.Join(companies, ", ")
+	activity.Judul = strings.TrimSpace(fmt.Sprintf("MBKM %s di %s", strings.Join(titles, ", "), activity.Lokasi))
+	if len(applyJob.Jobs) == 0 {
+		missing("jobs", "The placement has no job")
+	}
+	activity.Keterangan = fmt.Sprintf("Apply job #%d", applyJob.ID)
+
+	if len(applyJob.Users) == 0 {
+		missing("users", "The placement has no students")
+	}
+	if len(applyJob.Users) > 1 {
+		activity.JenisAnggota = JenisAnggotaKelompok
+	}
+	users := append([]models.User(nil), applyJob.Users...)
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	for i, u := range users {
+		participant := Participant{Nama: u.Name, JenisPeran: PeranPersonal}
+		if len(users) > 1 {
+			participant.JenisPeran = PeranAnggota
+			if (applyJob.CreatedByID != nil && *applyJob.CreatedByID == u.ID) || (applyJob.CreatedByID == nil && i == 0) {
+				participant.JenisPeran = PeranKetua
+			}
+		}
+		if u.NIM == nil || strings.TrimSpace(*u.NIM) == "" {
+			missing("users.nim", "Student %s has no NIM", u.Name)
+		} else {
+			participant.NIM = strings.TrimSpace(*u.NIM)
+		}
+
+		prodi, ok := models.ProgramStudi{}, false
+		if u.IDProgramStudi != nil {
+			prodi, ok = prodis[*u.IDProgramStudi]
+		}
+		switch {
+		case !ok:
+			missing("users.id_program_studi", "Student %s has no program studi", u.Name)
+		case prodi.KodeProdi == nil || strings.TrimSpace(*prodi.KodeProdi) == "":
+			missing("program_studi.kode_prodi", "Program studi %s has no PDDikti code", prodi.Nama)
+		case activity.KodeProdi == "":
+			activity.KodeProdi = strings.TrimSpace(*prodi.KodeProdi)
+		}
+		activity.Participants = append(activity.Participants, participant)
+	}
+
+	if applyJob.ResponsibleLecturer == nil {
+		missing("responsible_lecturer_id", "The placement has no supervising lecturer")
+	} else if lecturer, ok := mapLecturer(applyJob.ResponsibleLecturer, opts.KategoriBimbing); ok {
+		activity.Supervisors = append(activity.Supervisors, lecturer)
+	} else {
+		missing("lecturer.nidn", "Lecturer %s has no NIDN", applyJob.ResponsibleLecturer.Name)
+	}
+	activity.Examiners = []Lecturer{}
+	if applyJob.ExaminerLecturer != nil {
+		if lecturer, ok := mapLecturer(applyJob.ExaminerLecturer, opts.KategoriUji); ok {
+			activity.Examiners = append(activity.Examiners, lecturer)
+		} else {
+			missing("examiner.nidn", "Examiner %s has no NIDN", applyJob.ExaminerLecturer.Name)
+		}
+	}
+
+	if len(applyJob.KonversiNilai) == 0 {
+		missing("konversi_nilai", "The placement has no converted grades")
+	}
+	for _, k := range applyJob.KonversiNilai {
+		if k.MataKuliah == nil {
+			missing("konversi_nilai.matkul_id", "Converted grade #%d has no course", k.ID)
+			continue
+		}
+		code := strings.TrimSpace(k.MataKuliah.KodeMatkul)
+		if code == "" {
+			missing("mata_kuliah.kode_matkul", "Course %s has no course code", k.MataKuliah.NamaMatkul)
+			continue
+		}
+		for _, p := range activity.Participants {
+			activity.Grades = append(activity.Grades, Grade{
+				NIM:         p.NIM,
+				KodeMatkul:  code,
+				NamaMatkul:  k.MataKuliah.NamaMatkul,
+				Sks:         k.MataKuliah.Sks,
+				NilaiAngka:  k.Score,
+				NilaiHuruf:  k.Grade,
+				NilaiIndeks: k.GradePoint,
+			})
+		}
+	}
+
+	return activity, issues
+}
+
+func mapLecturer(u *models.User, kategori string) (Lecturer, bool) {
+	if u.NIDN == nil || strings.TrimSpace(*u.NIDN) == "" {
+		return Lecturer{}, false
+	}
+	return Lecturer{NIDN: strings.TrimSpace(*u.NIDN), Nama: u.Name, Kategori: kategori, Urutan: 1}, true
+}
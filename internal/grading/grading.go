@@ -0,0 +1,166 @@
+// Package grading turns scores into letter grades using the grade scale of a
+// program studi. Evaluations and konversi nilai both grade through it.
+package grading
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"mbkm-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Default is the scale used when none is stored
+func Default() models.GradeScale {
+	return models.GradeScale{
+		Name: "Default",
+		Bands: []models.GradeBand{
+			{Letter: "A", MinScore: 85, GradePoint: 4},
+			{Letter: "B", MinScore: 70, GradePoint: 3},
+			{Letter: "C", MinScore: 55, GradePoint: 2},
+			{Letter: "D", MinScore: 40, GradePoint: 1},
+			{Letter: "E", MinScore: 0, GradePoint: 0},
+		},
+	}
+}
+
+// ScaleFor returns the grade scale of a program studi, falling back to the
+// stored default and then to the built-in one
+func ScaleFor(db *gorm.DB, prodiID *uint) models.GradeScale {
+	var scale models.GradeScale
+	bands := func(db *gorm.DB) *gorm.DB { return db.Order("min_score DESC") }
+	if prodiID != nil {
+		if err := db.Preload("Bands", bands).Where("id_program_studi = ?", *prodiID).First(&scale).Error; err == nil && len(scale.Bands) > 0 {
+			return scale
+		}
+	}
+	if err := db.Preload("Bands", bands).Where("id_program_studi IS NULL").First(&scale).Error; err == nil && len(scale.Bands) > 0 {
+		return scale
+	}
+	return Default()
+}
+
+// Snapshot copies a scale for storing next to a grade
+func Snapshot(scale models.GradeScale) models.GradeScaleSnapshot {
+	snapshot := models.GradeScaleSnapshot{Name: scale.Name}
+	if scale.ID != 0 {
+		id := scale.ID
+		snapshot.GradeScaleID = &id
+	}
+	for _, band := range sorted(scale.Bands) {
+		snapshot.Bands = append(snapshot.Bands, models.GradeBand{
+			Letter:     band.Letter,
+			MinScore:   band.MinScore,
+			GradePoint: band.GradePoint,
+		})
+	}
+	return snapshot
+}
+
+// Grade returns the band a score falls in
+func Grade(bands []models.GradeBand, score float64) models.GradeBand {
+	bands = sorted(bands)
+	for _, band := range bands {
+		if score >= band.MinScore {
+			return band
+		}
+	}
+	if len(bands) == 0 {
+		return models.GradeBand{}
+	}
+	return bands[len(bands)-1]
+}
+
+// Band returns the band of a letter, matched case-insensitively
+func Band(bands []models.GradeBand, letter string) (models.GradeBand, bool) {
+	for _, band := range bands {
+		if strings.EqualFold(band.Letter, strings.TrimSpace(letter)) {
+			return band, true
+		}
+	}
+	return models.GradeBand{}, false
+}
+
+// Validate checks that a scale has bands with distinct letters and minimum
+// scores between 0 and 100, the lowest starting at 0 so every score grades
+func Validate(bands []models.GradeBand) error {
+	if len(bands) == 0 {
+		return errors.New("at least one band is required")
+	}
+	letters := map[string]bool{}
+	minimums := map[float64]bool{}
+	for _, band := range bands {
+		letter := strings.ToUpper(strings.TrimSpace(band.Letter))
+		if letter == "" {
+			return errors.New("every band needs a letter")
+		}
+		if letters[letter] {
+			return fmt.Errorf("letter %s is used twice", band.Letter)
+		}
+		if minimums[band.MinScore] {
+			return fmt.Errorf("minimum score %g is used twice", band.MinScore)
+		}
+		if band.MinScore < 0 || band.MinScore > 100 {
+			return fmt.Errorf("minimum score of %s must be between 0 and 100", band.Letter)
+		}
+		if band.GradePoint < 0 {
+			return fmt.Errorf("grade point of %s cannot be negative", band.Letter)
+		}
+		letters[letter] = true
+		minimums[band.MinScore] = true
+	}
+	if sorted(bands)[len(bands)-1].MinScore != 0 {
+		return errors.New("the lowest band must start at 0")
+	}
+	return nil
+}
+
+// Result is the final grade of an evaluation
+type Result struct {
+	CompanyScore  float64 `json:"company_score"`
+	LecturerScore float64 `json:"lecturer_score"`
+	ExaminerScore float64 `json:"examiner_score"`
+	TotalScore    float64 `json:"total_score"`
+	Grade         string  `json:"grade"`
+	GradePoint    float64 `json:"grade_point"`
+	Complete      bool    `json:"complete"` // every role has graded
+}
+
+// Final weighs the company, lecturer and examiner scores of an evaluation
+// and grades the total on a scale. It returns nil when the weights are not
+// set.
+func Final(e models.Evaluation, b models.BobotNilai, bands []models.GradeBand) *Result {
+	totalBobot := b.BobotNilaiPerusahaan + b.BobotNilaiPembimbing + b.BobotNilaiPenguji
+	if totalBobot == 0 {
+		return nil
+	}
+
+	result := &Result{
+		CompanyScore:  e.CompanyGradeScore * b.BobotNilaiPerusahaan / totalBobot,
+		LecturerScore: e.LecturerGradeScore * b.BobotNilaiPembimbing / totalBobot,
+		ExaminerScore: e.ExaminerGradeScore * b.BobotNilaiPenguji / totalBobot,
+		Complete:      e.CompanyGradeScore > 0 && e.LecturerGradeScore > 0 && e.ExaminerGradeScore > 0,
+	}
+	result.TotalScore = math.Round((result.CompanyScore+result.LecturerScore+result.ExaminerScore)*100) / 100
+
+	result.Grade = "-"
+	if result.Complete {
+		band := Grade(bands, result.TotalScore)
+		result.Grade = band.Letter
+		result.GradePoint = band.GradePoint
+	}
+	return result
+}
+
+// sorted returns the bands highest minimum score first
+func sorted(bands []models.GradeBand) []models.GradeBand {
+	result := append([]models.GradeBand(nil), bands...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].MinScore > result[j].MinScore
+	})
+	return result
+}
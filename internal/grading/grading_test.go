@@ -0,0 +1,289 @@
+package grading
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"mbkm-go/internal/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestGradeBandEdges(t *testing.T) {
+	bands := Default().Bands
+	tests := []struct {
+		score  float64
+		letter string
+		point  float64
+	}{
+		{100, "A", 4},
+		{85, "A", 4},
+		{84.99, "B", 3},
+		{70, "B", 3},
+		{69.99, "C", 2},
+		{55, "C", 2},
+		{54.99, "D", 1},
+		{40, "D", 1},
+		{39.99, "E", 0},
+		{0, "E", 0},
+		{-5, "E", 0},
+	}
+	for _, tt := range tests {
+		band := Grade(bands, tt.score)
+		if band.Letter != tt.letter || band.GradePoint != tt.point {
+			t.Errorf("Grade(%g) = %s (%g), want %s (%g)", tt.score, band.Letter, band.GradePoint, tt.letter, tt.point)
+		}
+	}
+}
+
+func TestGradeUnsortedAndEmpty(t *testing.T) {
+	bands := []models.GradeBand{
+		{Letter: "C", MinScore: 0, GradePoint: 2},
+		{Letter: "A", MinScore: 80, GradePoint: 4},
+		{Letter: "B", MinScore: 60, GradePoint: 3},
+	}
+	if got := Grade(bands, 79.5).Letter; got != "B" {
+		t.Errorf("Grade(79.5) on unsorted bands = %s, want B", got)
+	}
+	if bands[0].Letter != "C" {
+		t.Error("Grade reordered the bands it was given")
+	}
+	if got := Grade(nil, 90); got != (models.GradeBand{}) {
+		t.Errorf("Grade without bands = %+v, want the zero band", got)
+	}
+}
+
+func TestBand(t *testing.T) {
+	bands := Default().Bands
+	tests := []struct {
+		letter string
+		want   string
+		ok     bool
+	}{
+		{"A", "A", true},
+		{"b", "B", true},
+		{" c ", "C", true},
+		{"F", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		band, ok := Band(bands, tt.letter)
+		if ok != tt.ok || band.Letter != tt.want {
+			t.Errorf("Band(%q) = %s, %v, want %s, %v", tt.letter, band.Letter, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		bands []models.GradeBand
+		err   string
+	}{
+		{"default", Default().Bands, ""},
+		{"single band", []models.GradeBand{{Letter: "L", MinScore: 0, GradePoint: 1}}, ""},
+		{"no bands", nil, "at least one band"},
+		{"empty letter", []models.GradeBand{{Letter: " ", MinScore: 0}}, "needs a letter"},
+		{"letter twice", []models.GradeBand{{Letter: "A", MinScore: 50}, {Letter: "a", MinScore: 0}}, "used twice"},
+		{"minimum twice", []models.GradeBand{{Letter: "A", MinScore: 0}, {Letter: "B", MinScore: 0}}, "used twice"},
+		{"minimum above 100", []models.GradeBand{{Letter: "A", MinScore: 101}, {Letter: "B", MinScore: 0}}, "between 0 and 100"},
+		{"negative minimum", []models.GradeBand{{Letter: "A", MinScore: 0}, {Letter: "B", MinScore: -1}}, "between 0 and 100"},
+		{"negative point", []models.GradeBand{{Letter: "A", MinScore: 0, GradePoint: -1}}, "cannot be negative"},
+		{"lowest not at 0", []models.GradeBand{{Letter: "A", MinScore: 80}, {Letter: "B", MinScore: 40}}, "must start at 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.bands)
+			if tt.err == "" && err != nil {
+				t.Errorf("Validate = %v, want nil", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Validate = %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFinal(t *testing.T) {
+	bobot := models.BobotNilai{BobotNilaiPerusahaan: 40, BobotNilaiPembimbing: 30, BobotNilaiPenguji: 30}
+	bands := Default().Bands
+	graded := func(company, lecturer, examiner float64) models.Evaluation {
+		return models.Evaluation{CompanyGradeScore: company, LecturerGradeScore: lecturer, ExaminerGradeScore: examiner}
+	}
+
+	tests := []struct {
+		name       string
+		evaluation models.Evaluation
+		bobot      models.BobotNilai
+		total      float64
+		grade      string
+		point      float64
+		complete   bool
+	}{
+		{"weighted", graded(90, 80, 70), bobot, 81, "B", 3, true},
+		{"on the A edge", graded(85, 85, 85), bobot, 85, "A", 4, true},
+		{"rounded to two decimals", graded(84.996, 84.996, 84.996), bobot, 85, "A", 4, true},
+		{"just below the edge", graded(84.99, 84.99, 84.99), bobot, 84.99, "B", 3, true},
+		{"weights not summing to 100", graded(90, 60, 60), models.BobotNilai{BobotNilaiPerusahaan: 2, BobotNilaiPembimbing: 1, BobotNilaiPenguji: 1}, 75, "B", 3, true},
+		{"rounds a third", graded(70, 70, 71), models.BobotNilai{BobotNilaiPerusahaan: 1, BobotNilaiPembimbing: 1, BobotNilaiPenguji: 1}, 70.33, "B", 3, true},
+		{"examiner missing", graded(90, 80, 0), bobot, 60, "-", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Final(tt.evaluation, tt.bobot, bands)
+			if result == nil {
+				t.Fatal("Final = nil")
+			}
+			if result.TotalScore != tt.total || result.Grade != tt.grade || result.GradePoint != tt.point || result.Complete != tt.complete {
+				t.Errorf("Final = total %g, grade %s (%g), complete %v; want %g, %s (%g), %v",
+					result.TotalScore, result.Grade, result.GradePoint, result.Complete, tt.total, tt.grade, tt.point, tt.complete)
+			}
+		})
+	}
+
+	if result := Final(graded(90, 80, 70), models.BobotNilai{}, bands); result != nil {
+		t.Errorf("Final without weights = %+v, want nil", result)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	scale := models.GradeScale{ID: 3, Name: "Informatika", Bands: []models.GradeBand{
+		{ID: 9, GradeScaleID: 3, Letter: "B", MinScore: 0, GradePoint: 3},
+		{ID: 8, GradeScaleID: 3, Letter: "A", MinScore: 80, GradePoint: 4},
+	}}
+	snapshot := Snapshot(scale)
+	if snapshot.GradeScaleID == nil || *snapshot.GradeScaleID != 3 || snapshot.Name != "Informatika" {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+	want := []models.GradeBand{{Letter: "A", MinScore: 80, GradePoint: 4}, {Letter: "B", MinScore: 0, GradePoint: 3}}
+	if fmt.Sprint(snapshot.Bands) != fmt.Sprint(want) {
+		t.Errorf("snapshot bands = %v, want %v without IDs, highest first", snapshot.Bands, want)
+	}
+	if Snapshot(Default()).GradeScaleID != nil {
+		t.Error("snapshot of the built-in scale has a GradeScaleID")
+	}
+}
+
+// stubScales answers the grade_scales and grade_bands queries of ScaleFor
+// from memory through a database/sql driver
+type stubScales struct {
+	scales []stubScale
+	fail   bool
+}
+
+type stubScale struct {
+	id    int64
+	prodi interface{} // nil for the default scale
+	name  string
+	bands []models.GradeBand
+}
+
+func (s *stubScales) Connect(context.Context) (driver.Conn, error) { return stubConn{s}, nil }
+func (s *stubScales) Driver() driver.Driver                        { return nil }
+
+type stubConn struct{ stub *stubScales }
+
+func (c stubConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c stubConn) Close() error                        { return nil }
+func (c stubConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c stubConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c.stub.fail {
+		return nil, errors.New("connection refused")
+	}
+	switch {
+	case strings.HasPrefix(query, `SELECT * FROM "grade_scales" WHERE id_program_studi = $1`):
+		return c.stub.scaleRows(func(s stubScale) bool { return s.prodi == args[0].Value }), nil
+	case strings.HasPrefix(query, `SELECT * FROM "grade_scales" WHERE id_program_studi IS NULL`):
+		return c.stub.scaleRows(func(s stubScale) bool { return s.prodi == nil }), nil
+	case strings.HasPrefix(query, `SELECT * FROM "grade_bands" WHERE "grade_bands"."grade_scale_id" = $1`):
+		if !strings.Contains(query, "ORDER BY min_score DESC") {
+			return nil, fmt.Errorf("bands are not ordered: %q", query)
+		}
+		rows := &stubRows{columns: []string{"id", "grade_scale_id", "letter", "min_score", "grade_point"}}
+		for _, scale := range c.stub.scales {
+			if scale.id == args[0].Value {
+				for _, band := range sorted(scale.bands) {
+					rows.values = append(rows.values, []driver.Value{int64(band.ID), scale.id, band.Letter, band.MinScore, band.GradePoint})
+				}
+			}
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("unexpected query %q", query)
+}
+
+func (s *stubScales) scaleRows(match func(stubScale) bool) *stubRows {
+	rows := &stubRows{columns: []string{"id", "name", "id_program_studi"}}
+	for _, scale := range s.scales {
+		if match(scale) {
+			rows.values = append(rows.values, []driver.Value{scale.id, scale.name, scale.prodi})
+			break
+		}
+	}
+	return rows
+}
+
+type stubRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *stubRows) Columns() []string { return r.columns }
+func (r *stubRows) Close() error      { return nil }
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestScaleFor(t *testing.T) {
+	prodiBands := []models.GradeBand{{ID: 1, Letter: "A", MinScore: 80, GradePoint: 4}, {ID: 2, Letter: "B", MinScore: 0, GradePoint: 3}}
+	defaultBands := []models.GradeBand{{ID: 3, Letter: "L", MinScore: 60, GradePoint: 1}, {ID: 4, Letter: "T", MinScore: 0, GradePoint: 0}}
+	prodi := func(id uint) *uint { return &id }
+
+	tests := []struct {
+		name   string
+		scales []stubScale
+		fail   bool
+		prodi  *uint
+		want   string
+		letter string // of the highest band
+	}{
+		{"prodi scale", []stubScale{{id: 1, prodi: int64(7), name: "Informatika", bands: prodiBands}, {id: 2, name: "Umum", bands: defaultBands}}, false, prodi(7), "Informatika", "A"},
+		{"stored default for another prodi", []stubScale{{id: 1, prodi: int64(7), name: "Informatika", bands: prodiBands}, {id: 2, name: "Umum", bands: defaultBands}}, false, prodi(8), "Umum", "L"},
+		{"stored default without a prodi", []stubScale{{id: 2, name: "Umum", bands: defaultBands}}, false, nil, "Umum", "L"},
+		{"prodi scale without bands", []stubScale{{id: 1, prodi: int64(7), name: "Kosong"}, {id: 2, name: "Umum", bands: defaultBands}}, false, prodi(7), "Umum", "L"},
+		{"nothing stored", nil, false, prodi(7), "Default", "A"},
+		{"database down", []stubScale{{id: 2, name: "Umum", bands: defaultBands}}, true, nil, "Default", "A"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubScales{scales: tt.scales, fail: tt.fail}
+			db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(stub)}), &gorm.Config{
+				Logger:                 logger.Default.LogMode(logger.Silent),
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			scale := ScaleFor(db, tt.prodi)
+			if scale.Name != tt.want || len(scale.Bands) == 0 || scale.Bands[0].Letter != tt.letter {
+				t.Errorf("ScaleFor = %s %v, want %s starting with %s", scale.Name, scale.Bands, tt.want, tt.letter)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"mbkm-go/database"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// seesAllApplyJobs reports whether the current user sees every application:
+// admin and CDC
+func seesAllApplyJobs(c *fiber.Ctx) bool {
+	return middleware.IsAdmin(c) || middleware.IsCDC(c)
+}
+
+// staffProdiID returns the program studi of prodi staff, or nil for users
+// without the prodi role
+func staffProdiID(c *fiber.Ctx) *uint {
+	user := middleware.GetCurrentUser(c)
+	if user == nil || !middleware.HasRole(c, 6) {
+		return nil
+	}
+	return user.IDProgramStudi
+}
+
+// scopeApplyJobs limits a query on apply_jobs to the applications the current
+// user may see. Admin and CDC see everything; prodi staff the applications of
+// their program's students; lecturers those they supervise or examine;
+// companies those to their jobs; students their own.
+func scopeApplyJobs(c *fiber.Ctx) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		user := middleware.GetCurrentUser(c)
+		if user == nil {
+			return db.Where("1 = 0")
+		}
+		if seesAllApplyJobs(c) {
+			return db
+		}
+
+		visible := database.DB.Where("apply_jobs.created_by_id = ?", user.ID).
+			Or("apply_jobs.id IN (?)", database.DB.Table("apply_job_user").
+				Select("apply_job_id").Where("user_id = ?", user.ID)).
+			Or("apply_jobs.responsible_lecturer_id = ?", user.ID).
+			Or("apply_jobs.examiner_lecturer_id = ?", user.ID)
+
+		if prodiID := staffProdiID(c); prodiID != nil {
+			visible = visible.Or("apply_jobs.id IN (?)", database.DB.Table("apply_job_user").
+				Joins("JOIN users ON users.id = apply_job_user.user_id").
+				Select("apply_job_user.apply_job_id").
+				Where("users.id_program_studi = ?", *prodiID))
+		}
+		if middleware.IsCompany(c) {
+			visible = visible.Or("apply_jobs.id IN (?)", database.DB.Table("apply_job_job").
+				Joins("JOIN jobs ON jobs.id = apply_job_job.job_id").
+				Select("apply_job_job.apply_job_id").
+				Where("jobs.created_by_id = ? OR jobs.company_id IN (?)", user.ID,
+					database.DB.Model(&models.Company{}).Select("id").Where("user_id = ?", user.ID)))
+		}
+		return db.Where(visible)
+	}
+}
+
+// visibleApplyJobIDs selects the IDs of the applications the current user
+// may see, for use as a subquery
+func visibleApplyJobIDs(c *fiber.Ctx) *gorm.DB {
+	return database.DB.Model(&models.ApplyJob{}).Select("apply_jobs.id").Scopes(scopeApplyJobs(c))
+}
+
+// scopeByApplyJob limits a query on records that belong to an application
+// (reports, evaluations, attendance, ...) through their column referencing it
+func scopeByApplyJob(c *fiber.Ctx, column string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if seesAllApplyJobs(c) {
+			return db
+		}
+		return db.Where(column+" IN (?)", visibleApplyJobIDs(c))
+	}
+}
+
+// scopeStudents limits a query on users to the students the current user
+// may see: themselves, the students of the applications they see and, for
+// prodi staff, the students of their program
+func scopeStudents(c *fiber.Ctx) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if seesAllApplyJobs(c) {
+			return db
+		}
+		visible := database.DB.Where("users.id = ?", middleware.GetCurrentUserID(c)).
+			Or("users.id IN (?)", database.DB.Table("apply_job_user").
+				Select("user_id").Where("apply_job_id IN (?)", visibleApplyJobIDs(c)))
+		if prodiID := staffProdiID(c); prodiID != nil {
+			visible = visible.Or("users.id_program_studi = ?", *prodiID)
+		}
+		return db.Where(visible)
+	}
+}
+
+// scopeUsers limits a query on users: accounts other than students (staff,
+// lecturers, companies) are listed to everyone, students as in scopeStudents
+func scopeUsers(c *fiber.Ctx) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if seesAllApplyJobs(c) {
+			return db
+		}
+		students := database.DB.Model(&models.User{}).Select("users.id").
+			Where("users.role = ?", "student").Scopes(scopeStudents(c))
+		return db.Where(database.DB.Where("users.role <> ?", "student").
+			Or("users.id IN (?)", students))
+	}
+}
+
+// canAccessApplyJob reports whether the current user may see an application
+// and the records that belong to it (report, evaluation, files), following
+// scopeApplyJobs
+func canAccessApplyJob(c *fiber.Ctx, applyJobID uint) bool {
+	var count int64
+	database.DB.Model(&models.ApplyJob{}).
+		Scopes(scopeApplyJobs(c)).
+		Where("apply_jobs.id = ?", applyJobID).
+		Count(&count)
+	return count > 0
+}
+
+// canManageApplyJob reports whether the current user may move an
+// application through its statuses, assign its lecturers or delete it:
+// admin and CDC, the company of the job and the prodi of the students
+func canManageApplyJob(c *fiber.Ctx, applyJobID uint) bool {
+	if middleware.IsAdmin(c) || middleware.IsCDC(c) {
+		return true
+	}
+	if !middleware.IsCompany(c) && !middleware.HasRole(c, 6) {
+		return false
+	}
+	return canAccessApplyJob(c, applyJobID)
+}
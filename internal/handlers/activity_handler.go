@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"mbkm-go/internal/database"
+	"mbkm-go/internal/media"
+	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // --- ActivityDetail Handlers ---
@@ -17,17 +20,53 @@ func GetActivityDetails(c *fiber.Ctx) error {
 	limit, _ := strconv.Atoi(c.Query("per_page", "10"))
 	offset := (page - 1) * limit
 	reportID := c.Query("report_job_id")
+	dateFrom := c.Query("date_from") // YYYY-MM-DD
+	dateTo := c.Query("date_to")
+	approvalStatus := c.Query("approval_status")
 
-	query := database.DB.Model(&models.ActivityDetail{}).Preload("Report") // Ensure Report relation exists if needed in models
+	query := database.DB.Model(&models.ActivityDetail{}).Preload("ApprovedBy", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "name", "email")
+	})
+	if !seesAllApplyJobs(c) {
+		query = query.Where("report_job_id IN (?)", database.DB.Model(&models.Report{}).
+			Select("id").Scopes(scopeByApplyJob(c, "apply_job_id")))
+	}
 
 	if reportID != "" {
 		query = query.Where("report_job_id = ?", reportID)
 	}
+	if dateFrom != "" {
+		from, err := time.Parse("2006-01-02", dateFrom)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "date_from must be YYYY-MM-DD"})
+		}
+		query = query.Where("date >= ?", from)
+	}
+	if dateTo != "" {
+		to, err := time.Parse("2006-01-02", dateTo)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "date_to must be YYYY-MM-DD"})
+		}
+		query = query.Where("date < ?", to.AddDate(0, 0, 1))
+	}
+	if approvalStatus != "" {
+		query = query.Where("approval_status = ?", approvalStatus)
+	}
 
 	var total int64
 	query.Count(&total)
 
-	query.Offset(offset).Limit(limit).Find(&activities)
+	query.Order("date ASC, id ASC").Offset(offset).Limit(limit).Find(&activities)
+
+	ids := make([]uint, len(activities))
+	for i := range activities {
+		ids[i] = activities[i].ID
+	}
+	if grouped, err := media.ListFor(database.DB, models.MediaModelActivityDetail, ids, models.MediaCollectionAttachments); err == nil {
+		for i := range activities {
+			activities[i].Attachments = grouped[activities[i].ID]
+		}
+	}
 
 	return c.JSON(fiber.Map{
 		"data":  activities,
@@ -37,14 +76,30 @@ func GetActivityDetails(c *fiber.Ctx) error {
 
 func CreateActivityDetail(c *fiber.Ctx) error {
 	type ActivityInput struct {
-		ReportJobID     uint   `json:"report_job_id"`
-		Date            string `json:"date"` // Expects YYYY-MM-DD
-		ActivityDetails string `json:"activity_details"`
+		ReportJobID     uint    `json:"report_job_id" form:"report_job_id"`
+		Date            string  `json:"date" form:"date"` // Expects YYYY-MM-DD
+		ActivityDetails string  `json:"activity_details" form:"activity_details"`
+		Hours           float64 `json:"hours" form:"hours"`
 	}
 	input := new(ActivityInput)
 	if err := c.BodyParser(input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
+	if msg := validateActivityHours(input.Hours); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+
+	// Photos or documents may be sent as multipart "attachments"
+	var uploads []media.Upload
+	if form, err := c.MultipartForm(); err == nil {
+		for _, fileHeader := range form.File["attachments"] {
+			upload, err := documentUpload(c, fileHeader)
+			if err != nil {
+				return c.Status(422).JSON(fiber.Map{"error": fileHeader.Filename + ": " + err.Error()})
+			}
+			uploads = append(uploads, upload)
+		}
+	}
 
 	// Validate Report Exists
 	var report models.Report
@@ -57,25 +112,35 @@ func CreateActivityDetail(c *fiber.Ctx) error {
 		ReportJobID:     input.ReportJobID,
 		Date:            &parsedDate,
 		ActivityDetails: input.ActivityDetails,
+		Hours:           input.Hours,
+		ApprovalStatus:  models.ActivityStatusPending,
 	}
 
 	if err := database.DB.Create(&activity).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	for _, upload := range uploads {
+		m, err := media.Attach(c.UserContext(), database.DB, models.MediaModelActivityDetail, activity.ID, models.MediaCollectionAttachments, upload)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to store file"})
+		}
+		activity.Attachments = append(activity.Attachments, *m)
+	}
+
 	return c.Status(201).JSON(fiber.Map{"data": activity})
 }
 
 func UpdateActivityDetail(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var activity models.ActivityDetail
-	if err := database.DB.First(&activity, id).Error; err != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	activity, err := findAccessibleActivity(c)
+	if activity == nil {
+		return err
 	}
 
 	type ActivityUpdate struct {
-		Date            string `json:"date"`
-		ActivityDetails string `json:"activity_details"`
+		Date            string   `json:"date"`
+		ActivityDetails string   `json:"activity_details"`
+		Hours           *float64 `json:"hours"`
 	}
 	input := new(ActivityUpdate)
 	if err := c.BodyParser(input); err != nil {
@@ -90,23 +155,260 @@ func UpdateActivityDetail(c *fiber.Ctx) error {
 	if input.ActivityDetails != "" {
 		updates["activity_details"] = input.ActivityDetails
 	}
+	if input.Hours != nil {
+		if msg := validateActivityHours(*input.Hours); msg != "" {
+			return c.Status(422).JSON(fiber.Map{"error": msg})
+		}
+		updates["hours"] = *input.Hours
+	}
 
-	database.DB.Model(&activity).Updates(updates)
+	// A changed entry has to be confirmed again
+	if len(updates) > 0 && activity.ApprovalStatus != models.ActivityStatusPending {
+		updates["approval_status"] = models.ActivityStatusPending
+		updates["approval_note"] = nil
+		updates["approved_by_id"] = nil
+		updates["approved_at"] = nil
+	}
+
+	database.DB.Model(activity).Updates(updates)
 
 	return c.JSON(fiber.Map{"data": activity})
 }
 
 func DeleteActivityDetail(c *fiber.Ctx) error {
-	id := c.Params("id")
-	database.DB.Delete(&models.ActivityDetail{}, id)
+	activity, err := findAccessibleActivity(c)
+	if activity == nil {
+		return err
+	}
+	database.DB.Delete(activity)
+	media.DeleteAll(c.UserContext(), database.DB, models.MediaModelActivityDetail, activity.ID)
 	return c.SendStatus(204)
 }
 
 func GetActivityDetail(c *fiber.Ctx) error {
-	id := c.Params("id")
+	activity, err := findAccessibleActivity(c)
+	if activity == nil {
+		return err
+	}
+	activity.Attachments, _ = media.List(database.DB, models.MediaModelActivityDetail, activity.ID, models.MediaCollectionAttachments)
+	return c.JSON(fiber.Map{"data": activity})
+}
+
+// findAccessibleActivity loads an activity detail the current user may see
+// through its report's application
+func findAccessibleActivity(c *fiber.Ctx) (*models.ActivityDetail, error) {
 	var activity models.ActivityDetail
-	if err := database.DB.First(&activity, id).Error; err != nil {
+	if err := database.DB.First(&activity, c.Params("id")).Error; err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+
+	var report models.Report
+	if err := database.DB.First(&report, activity.ReportJobID).Error; err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Report not found"})
+	}
+	if !canAccessApplyJob(c, report.ApplyJobID) {
+		return nil, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	return &activity, nil
+}
+
+// UploadActivityAttachment adds a file (field "file") to an activity detail
+func UploadActivityAttachment(c *fiber.Ctx) error {
+	activity, err := findAccessibleActivity(c)
+	if activity == nil {
+		return err
+	}
+
+	upload, err := readDocumentUpload(c, "file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	m, err := media.Attach(c.UserContext(), database.DB, models.MediaModelActivityDetail, activity.ID, models.MediaCollectionAttachments, upload)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to store file"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": m})
+}
+
+// DeleteActivityAttachment removes a file from an activity detail
+func DeleteActivityAttachment(c *fiber.Ctx) error {
+	activity, err := findAccessibleActivity(c)
+	if activity == nil {
+		return err
+	}
+
+	var m models.Media
+	err = database.DB.Where("id = ? AND model_type = ? AND model_id = ? AND collection_name = ?",
+		c.Params("media_id"), models.MediaModelActivityDetail, activity.ID, models.MediaCollectionAttachments).
+		First(&m).Error
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+
+	if err := media.Delete(c.UserContext(), database.DB, &m); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete file"})
+	}
+	return c.SendStatus(204)
+}
+
+func validateActivityHours(hours float64) string {
+	if hours < 0 || hours > 24 {
+		return "Hours must be between 0 and 24"
+	}
+	return ""
+}
+
+// canApproveActivities reports whether the current user supervises the
+// application the report belongs to on the company side
+func canApproveActivities(c *fiber.Ctx, report *models.Report) bool {
+	if middleware.IsAdmin(c) {
+		return true
+	}
+	return middleware.IsCompany(c) && canAccessApplyJob(c, report.ApplyJobID)
+}
+
+// setActivityApproval approves or rejects the given pending or rejected
+// entries of a report
+func setActivityApproval(c *fiber.Ctx, query *gorm.DB, status, note string) (int64, error) {
+	updates := map[string]interface{}{
+		"approval_status": status,
+		"approval_note":   nil,
+		"approved_by_id":  middleware.GetCurrentUserID(c),
+		"approved_at":     time.Now(),
+	}
+	if note != "" {
+		updates["approval_note"] = note
+	}
+	result := query.Model(&models.ActivityDetail{}).Updates(updates)
+	return result.RowsAffected, result.Error
+}
+
+type activityApprovalInput struct {
+	Note string `json:"note"`
+}
+
+// ApproveActivityDetail lets the company supervisor confirm a single entry
+func ApproveActivityDetail(c *fiber.Ctx) error {
+	return reviewActivityDetail(c, models.ActivityStatusApproved)
+}
+
+// RejectActivityDetail lets the company supervisor reject a single entry,
+// with a note telling the student what is wrong
+func RejectActivityDetail(c *fiber.Ctx) error {
+	return reviewActivityDetail(c, models.ActivityStatusRejected)
+}
+
+func reviewActivityDetail(c *fiber.Ctx, status string) error {
+	var activity models.ActivityDetail
+	if err := database.DB.First(&activity, c.Params("id")).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
 	}
+	var report models.Report
+	if err := database.DB.First(&report, activity.ReportJobID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Report not found"})
+	}
+	if !canApproveActivities(c, &report) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the company supervisor can review activities"})
+	}
+
+	input := new(activityApprovalInput)
+	c.BodyParser(input)
+	if status == models.ActivityStatusRejected && input.Note == "" {
+		return c.Status(422).JSON(fiber.Map{"error": "A note is required when rejecting an activity"})
+	}
+
+	if _, err := setActivityApproval(c, database.DB.Where("id = ?", activity.ID), status, input.Note); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	database.DB.Preload("ApprovedBy").First(&activity, activity.ID)
+
 	return c.JSON(fiber.Map{"data": activity})
 }
+
+// ApproveActivityWeek approves every pending entry of a report in the week
+// starting at week_start. Body: {"report_job_id": 1, "week_start": "2024-01-01"}
+func ApproveActivityWeek(c *fiber.Ctx) error {
+	var input struct {
+		ReportJobID uint   `json:"report_job_id"`
+		WeekStart   string `json:"week_start"`
+		Note        string `json:"note"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	weekStart, err := time.Parse("2006-01-02", input.WeekStart)
+	if err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": "week_start must be YYYY-MM-DD"})
+	}
+
+	var report models.Report
+	if err := database.DB.First(&report, input.ReportJobID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Report not found"})
+	}
+	if !canApproveActivities(c, &report) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the company supervisor can review activities"})
+	}
+
+	query := database.DB.Where("report_job_id = ? AND approval_status = ? AND date >= ? AND date < ?",
+		report.ID, models.ActivityStatusPending, weekStart, weekStart.AddDate(0, 0, 7))
+	approved, err := setActivityApproval(c, query, models.ActivityStatusApproved, input.Note)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"approved": approved, "week_start": input.WeekStart})
+}
+
+// GetActivityHours sums the logbook hours of a report (route param is the
+// apply_job_id, like the other report routes) and compares the approved
+// hours with the workload of the SKS the placement converts into
+func GetActivityHours(c *fiber.Ctx) error {
+	var report models.Report
+	if err := database.DB.Where("apply_job_id = ?", c.Params("id")).First(&report).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Report not found"})
+	}
+	if !canAccessApplyJob(c, report.ApplyJobID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var rows []struct {
+		ApprovalStatus string
+		Hours          float64
+		Entries        int64
+	}
+	database.DB.Model(&models.ActivityDetail{}).
+		Select("approval_status, COALESCE(SUM(hours), 0) AS hours, COUNT(*) AS entries").
+		Where("report_job_id = ?", report.ID).
+		Group("approval_status").
+		Scan(&rows)
+
+	hours := map[string]float64{}
+	var total float64
+	var entries int64
+	for _, row := range rows {
+		hours[row.ApprovalStatus] = row.Hours
+		total += row.Hours
+		entries += row.Entries
+	}
+
+	requiredHours := 0
+	var applyJob models.ApplyJob
+	if err := database.DB.Preload("Users").Preload("Jobs.Courses").First(&applyJob, report.ApplyJobID).Error; err == nil {
+		requiredHours = convertedSks(&applyJob) * models.HoursPerSks
+	}
+	approved := hours[models.ActivityStatusApproved]
+
+	return c.JSON(fiber.Map{"data": fiber.Map{
+		"report_id":      report.ID,
+		"apply_job_id":   report.ApplyJobID,
+		"entries":        entries,
+		"total_hours":    total,
+		"approved_hours": approved,
+		"pending_hours":  hours[models.ActivityStatusPending],
+		"rejected_hours": hours[models.ActivityStatusRejected],
+		"required_hours": requiredHours,
+		"meets_workload": requiredHours > 0 && approved >= float64(requiredHours),
+	}})
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"strconv"
+	"time"
 
 	"mbkm-go/database"
+	"mbkm-go/internal/media"
 	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 	"mbkm-go/pkg/utils"
@@ -19,7 +21,8 @@ func NewApplyJobHandler() *ApplyJobHandler {
 	return &ApplyJobHandler{}
 }
 
-// Index returns list of apply jobs with pagination
+// Index returns list of apply jobs the current user may see, with
+// pagination
 func (h *ApplyJobHandler) Index(c *fiber.Ctx) error {
 	page := utils.DefaultPage(c.Query("page"))
 	limit := utils.DefaultLimit(c.Query("per_page"))
@@ -29,8 +32,9 @@ func (h *ApplyJobHandler) Index(c *fiber.Ctx) error {
 	companyID := c.Query("company_id")
 
 	query := database.DB.Model(&models.ApplyJob{}).
+		Scopes(scopeApplyJobs(c)).
 		Preload("Users", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "name", "email", "nim", "program_study", "faculty")
+			return db.Select("id", "name", "email", "nim", "program_study", "faculty", "id_program_studi")
 		}).
 		Preload("Jobs").
 		Preload("CreatedBy", func(db *gorm.DB) *gorm.DB {
@@ -60,6 +64,7 @@ func (h *ApplyJobHandler) Index(c *fiber.Ctx) error {
 
 	var applyJobs []models.ApplyJob
 	query.Order("created_at DESC").Offset(skip).Limit(limit).Find(&applyJobs)
+	withApplyJobDocuments(applyJobs)
 
 	return c.JSON(fiber.Map{
 		"data":  applyJobs,
@@ -77,7 +82,7 @@ func (h *ApplyJobHandler) Show(c *fiber.Ctx) error {
 	var applyJob models.ApplyJob
 	result := database.DB.
 		Preload("Users", func(db *gorm.DB) *gorm.DB {
-			return db.Select("id", "name", "email", "nim", "program_study", "faculty")
+			return db.Select("id", "name", "email", "nim", "program_study", "faculty", "id_program_studi")
 		}).
 		Preload("Jobs").
 		Preload("CreatedBy", func(db *gorm.DB) *gorm.DB {
@@ -85,11 +90,13 @@ func (h *ApplyJobHandler) Show(c *fiber.Ctx) error {
 		}).
 		Preload("ResponsibleLecturer").
 		Preload("ExaminerLecturer").
+		Scopes(scopeApplyJobs(c)).
 		First(&applyJob, id)
 
 	if result.Error != nil {
 		return utils.NotFoundError(c, "Apply job not found")
 	}
+	withApplyJobDocument(&applyJob)
 
 	return c.JSON(fiber.Map{
 		"data": applyJob,
@@ -165,6 +172,12 @@ func (h *ApplyJobHandler) Store(c *fiber.Ctx) error {
 		return utils.NotFoundError(c, "Job not found")
 	}
 
+	// Documents may be sent along with a multipart application
+	documents, errs := readApplyJobDocuments(c)
+	if len(errs) > 0 {
+		return utils.ValidationError(c, errs)
+	}
+
 	// Create apply job
 	jobUserUUID := uuid.New().String()
 	status := "Melamar"
@@ -186,12 +199,20 @@ func (h *ApplyJobHandler) Store(c *fiber.Ctx) error {
 	database.DB.Exec("INSERT INTO apply_job_job (apply_job_id, job_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
 		applyJob.ID, jobIDInt)
 
+	if err := storeApplyJobDocuments(c, applyJob.ID, documents); err != nil {
+		return utils.InternalServerError(c, "Failed to store documents")
+	}
+	if err := attachApprovedLetters(c, applyJob.ID, user.ID, uint(jobIDInt)); err != nil {
+		return utils.InternalServerError(c, "Failed to attach approved letters")
+	}
+
 	// Reload with relations
 	database.DB.
 		Preload("Users").
 		Preload("Jobs").
 		Preload("CreatedBy").
 		First(&applyJob, applyJob.ID)
+	withApplyJobDocument(&applyJob)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
@@ -211,15 +232,21 @@ func (h *ApplyJobHandler) Update(c *fiber.Ctx) error {
 	if err := database.DB.First(&applyJob, id).Error; err != nil {
 		return utils.NotFoundError(c, "Apply job not found")
 	}
+	if !canManageApplyJob(c, applyJob.ID) {
+		return utils.ForbiddenError(c, "")
+	}
 
 	// Parse update data
 	status := c.FormValue("status")
 	lecturerID := c.FormValue("responsible_lecturer_id")
 
-	updates := map[string]interface{}{}
-	if status != "" {
-		updates["status"] = status
+	// Status changes go through approve, reject, activate and done, which
+	// carry their side effects (konversi rows, certificates)
+	if status != "" && (applyJob.Status == nil || status != *applyJob.Status) {
+		return utils.ValidationError(c, map[string]string{"status": "Change the status with the approve, reject, activate or done endpoints"})
 	}
+
+	updates := map[string]interface{}{}
 	if lecturerID != "" {
 		if lid, err := strconv.Atoi(lecturerID); err == nil {
 			updates["responsible_lecturer_id"] = lid
@@ -262,6 +289,9 @@ func (h *ApplyJobHandler) Approve(c *fiber.Ctx) error {
 	if err := database.DB.First(&applyJob, id).Error; err != nil {
 		return utils.NotFoundError(c, "Apply job not found")
 	}
+	if !canManageApplyJob(c, applyJob.ID) {
+		return utils.ForbiddenError(c, "")
+	}
 
 	if applyJob.Status == nil || *applyJob.Status != "Melamar" {
 		return utils.ValidationError(c, map[string]string{"status": "Can only approve applications with status 'Melamar'"})
@@ -287,6 +317,9 @@ func (h *ApplyJobHandler) Reject(c *fiber.Ctx) error {
 	if err := database.DB.First(&applyJob, id).Error; err != nil {
 		return utils.NotFoundError(c, "Apply job not found")
 	}
+	if !canManageApplyJob(c, applyJob.ID) {
+		return utils.ForbiddenError(c, "")
+	}
 
 	if applyJob.Status == nil || *applyJob.Status != "Melamar" {
 		return utils.ValidationError(c, map[string]string{"status": "Can only reject applications with status 'Melamar'"})
@@ -312,12 +345,23 @@ func (h *ApplyJobHandler) Activate(c *fiber.Ctx) error {
 	if err := database.DB.First(&applyJob, id).Error; err != nil {
 		return utils.NotFoundError(c, "Apply job not found")
 	}
+	if !canManageApplyJob(c, applyJob.ID) {
+		return utils.ForbiddenError(c, "")
+	}
 
 	if applyJob.Status == nil || *applyJob.Status != "Disetujui" {
 		return utils.ValidationError(c, map[string]string{"status": "Can only activate applications with status 'Disetujui'"})
 	}
 
-	database.DB.Model(&applyJob).Update("status", "Aktif")
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&applyJob).Update("status", "Aktif").Error; err != nil {
+			return err
+		}
+		return prepopulateKonversiNilai(tx, applyJob.ID)
+	})
+	if err != nil {
+		return utils.InternalServerError(c, "Failed to prepare konversi nilai")
+	}
 
 	return c.JSON(fiber.Map{
 		"success": true,
@@ -337,18 +381,30 @@ func (h *ApplyJobHandler) Done(c *fiber.Ctx) error {
 	if err := database.DB.First(&applyJob, id).Error; err != nil {
 		return utils.NotFoundError(c, "Apply job not found")
 	}
+	if !canManageApplyJob(c, applyJob.ID) {
+		return utils.ForbiddenError(c, "")
+	}
 
 	if applyJob.Status == nil || *applyJob.Status != "Aktif" {
 		return utils.ValidationError(c, map[string]string{"status": "Can only mark 'Aktif' applications as done"})
 	}
 
-	database.DB.Model(&applyJob).Update("status", "Selesai")
+	now := time.Now()
+	database.DB.Model(&applyJob).Updates(map[string]interface{}{"status": "Selesai", "completed_at": &now})
 
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"success": true,
 		"message": "Application completed",
 		"data":    applyJob,
-	})
+	}
+	// The placement is complete either way; certificates can be issued again
+	// later through the batch generation
+	if certificates, err := issueCertificates(middleware.GetCurrentUserID(c), applyJob.ID, nil); err != nil {
+		response["certificate_error"] = err.Error()
+	} else {
+		response["certificates"] = certificates
+	}
+	return c.JSON(response)
 }
 
 // SetLecturer assigns a responsible lecturer to an application
@@ -362,6 +418,9 @@ func (h *ApplyJobHandler) SetLecturer(c *fiber.Ctx) error {
 	if err := database.DB.First(&applyJob, id).Error; err != nil {
 		return utils.NotFoundError(c, "Apply job not found")
 	}
+	if !canManageApplyJob(c, applyJob.ID) {
+		return utils.ForbiddenError(c, "")
+	}
 
 	lecturerID := c.FormValue("lecturer_id")
 
@@ -385,7 +444,18 @@ func (h *ApplyJobHandler) SetLecturer(c *fiber.Ctx) error {
 	}
 
 	if len(updates) > 0 {
-		database.DB.Model(&applyJob).Updates(updates)
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&applyJob).Updates(updates).Error; err != nil {
+				return err
+			}
+			if updates["status"] == "Aktif" {
+				return prepopulateKonversiNilai(tx, applyJob.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			return utils.InternalServerError(c, "Failed to prepare konversi nilai")
+		}
 	}
 
 	database.DB.
@@ -401,7 +471,8 @@ func (h *ApplyJobHandler) SetLecturer(c *fiber.Ctx) error {
 	})
 }
 
-// Destroy deletes an apply job
+// Destroy deletes an apply job (admin, CDC, the company or prodi of the
+// application, or its student while the application is undecided)
 func (h *ApplyJobHandler) Destroy(c *fiber.Ctx) error {
 	id, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
@@ -409,11 +480,18 @@ func (h *ApplyJobHandler) Destroy(c *fiber.Ctx) error {
 	}
 
 	var applyJob models.ApplyJob
-	if err := database.DB.First(&applyJob, id).Error; err != nil {
+	if err := database.DB.Preload("Users").First(&applyJob, id).Error; err != nil {
 		return utils.NotFoundError(c, "Apply job not found")
 	}
+	// Students may withdraw an application that has not been decided yet
+	withdrawing := applyJob.Status != nil && *applyJob.Status == "Melamar" &&
+		isApplicationStudent(&applyJob, middleware.GetCurrentUserID(c))
+	if !withdrawing && !canManageApplyJob(c, applyJob.ID) {
+		return utils.ForbiddenError(c, "")
+	}
 
 	database.DB.Delete(&applyJob)
+	removeMedia(c, models.MediaModelApplyJob, applyJob.ID)
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
@@ -437,11 +515,140 @@ func (h *ApplyJobHandler) GetByUser(c *fiber.Ctx) error {
 		Preload("CreatedBy").
 		Preload("ResponsibleLecturer").
 		Preload("ExaminerLecturer").
+		Scopes(scopeApplyJobs(c)).
 		Where("id IN ?", applyJobIDs).
 		Find(&applyJobs)
+	withApplyJobDocuments(applyJobs)
 
 	return c.JSON(fiber.Map{
 		"data":  applyJobs,
 		"count": len(applyJobs),
 	})
 }
+
+// UploadDocuments stores the application documents (DHS, KTM, CV, surat
+// lamaran, surat rekomendasi prodi, surat pengantar) sent as multipart fields
+func (h *ApplyJobHandler) UploadDocuments(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return utils.ValidationError(c, map[string]string{"id": "Invalid ID"})
+	}
+
+	var applyJob models.ApplyJob
+	if err := database.DB.First(&applyJob, id).Error; err != nil {
+		return utils.NotFoundError(c, "Apply job not found")
+	}
+	if !canAccessApplyJob(c, applyJob.ID) {
+		return utils.ForbiddenError(c, "You do not have access to this application")
+	}
+
+	documents, errs := readApplyJobDocuments(c)
+	if len(errs) > 0 {
+		return utils.ValidationError(c, errs)
+	}
+	if len(documents) == 0 {
+		return utils.ValidationError(c, map[string]string{"documents": "At least one document is required"})
+	}
+	if err := storeApplyJobDocuments(c, applyJob.ID, documents); err != nil {
+		return utils.InternalServerError(c, "Failed to store documents")
+	}
+
+	withApplyJobDocument(&applyJob)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Documents uploaded successfully",
+		"data":    applyJob,
+	})
+}
+
+// applyJobDocuments are the document collections of an application, keyed
+// by their multipart field name
+var applyJobDocuments = []string{
+	models.MediaCollectionDHS,
+	models.MediaCollectionKTM,
+	models.MediaCollectionCV,
+	models.MediaCollectionSuratLamaran,
+	models.MediaCollectionSuratRekomendasiProdi,
+	models.MediaCollectionSuratPengantar,
+}
+
+// readApplyJobDocuments reads every document field present in the request
+func readApplyJobDocuments(c *fiber.Ctx) (map[string]media.Upload, map[string]string) {
+	documents := map[string]media.Upload{}
+	errs := map[string]string{}
+	form, err := c.MultipartForm()
+	if err != nil {
+		return documents, errs
+	}
+
+	for _, field := range applyJobDocuments {
+		if len(form.File[field]) == 0 {
+			continue
+		}
+		upload, err := readDocumentUpload(c, field)
+		if err != nil {
+			errs[field] = err.Error()
+			continue
+		}
+		documents[field] = upload
+	}
+	return documents, errs
+}
+
+// storeApplyJobDocuments stores the documents, replacing the previous file
+// of each collection
+func storeApplyJobDocuments(c *fiber.Ctx, applyJobID uint, documents map[string]media.Upload) error {
+	for collection, upload := range documents {
+		if _, err := media.Replace(c.UserContext(), database.DB, models.MediaModelApplyJob, applyJobID, collection, upload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withApplyJobDocuments fills the document URLs of a list of applications
+func withApplyJobDocuments(applyJobs []models.ApplyJob) {
+	ids := make([]uint, len(applyJobs))
+	for i := range applyJobs {
+		ids[i] = applyJobs[i].ID
+	}
+
+	grouped, err := media.ListFor(database.DB, models.MediaModelApplyJob, ids, "")
+	if err != nil {
+		return
+	}
+	for i := range applyJobs {
+		setApplyJobDocuments(&applyJobs[i], grouped[applyJobs[i].ID])
+	}
+}
+
+// withApplyJobDocument fills the document URLs of a single application
+func withApplyJobDocument(applyJob *models.ApplyJob) {
+	list, err := media.List(database.DB, models.MediaModelApplyJob, applyJob.ID, "")
+	if err != nil {
+		return
+	}
+	setApplyJobDocuments(applyJob, list)
+}
+
+func setApplyJobDocuments(applyJob *models.ApplyJob, list []models.Media) {
+	// Later uploads come last, so they win
+	for i := range list {
+		url := list[i].URL
+		switch list[i].CollectionName {
+		case models.MediaCollectionDHS:
+			applyJob.DHS = &url
+		case models.MediaCollectionKTM:
+			applyJob.KTM = &url
+		case models.MediaCollectionCV:
+			applyJob.CV = &url
+		case models.MediaCollectionSuratLamaran:
+			applyJob.SuratLamaran = &url
+		case models.MediaCollectionSuratRekomendasiProdi:
+			applyJob.SuratRekomendasiProdi = &url
+		case models.MediaCollectionSuratPengantar:
+			applyJob.SuratPengantar = &url
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"strconv"
 
 	"mbkm-go/database"
+	"mbkm-go/internal/media"
+	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 	"mbkm-go/pkg/utils"
 
@@ -27,6 +29,7 @@ func (h *ArticleHandler) Index(c *fiber.Ctx) error {
 	var articles []models.Article
 	offset := utils.GetSkipNumber(page, perPage)
 	database.DB.Offset(offset).Limit(perPage).Order("created_at DESC").Find(&articles)
+	withArticlePictures(articles)
 
 	return c.JSON(fiber.Map{
 		"data":  articles,
@@ -48,6 +51,7 @@ func (h *ArticleHandler) Show(c *fiber.Ctx) error {
 
 	// Increment views
 	database.DB.Model(&article).Update("views", article.Views+1)
+	withArticlePicture(&article)
 
 	return c.JSON(fiber.Map{
 		"data": article,
@@ -111,6 +115,7 @@ func (h *ArticleHandler) Update(c *fiber.Ctx) error {
 	}
 
 	database.DB.Model(&article).Updates(updates)
+	withArticlePicture(&article)
 
 	return c.JSON(fiber.Map{
 		"data": article,
@@ -130,8 +135,55 @@ func (h *ArticleHandler) Destroy(c *fiber.Ctx) error {
 	}
 
 	database.DB.Delete(&article)
+	removeMedia(c, models.MediaModelArticle, article.ID)
 
 	return c.JSON(fiber.Map{
 		"message": "Article deleted successfully",
 	})
 }
+
+// UploadPicture stores the picture of an article. Articles have no author,
+// so only admin and CDC may change it.
+func (h *ArticleHandler) UploadPicture(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return utils.NotFoundError(c, "Article not found")
+	}
+
+	var article models.Article
+	if err := database.DB.First(&article, id).Error; err != nil {
+		return utils.NotFoundError(c, "Article not found")
+	}
+	if !middleware.IsAdmin(c) && !middleware.IsCDC(c) {
+		return utils.ForbiddenError(c, "")
+	}
+
+	picture, err := storeImageUpload(c, "picture", models.MediaModelArticle, article.ID, models.MediaCollectionPicture, imageRules(200, 200))
+	if err != nil {
+		return utils.ValidationError(c, map[string]string{"picture": err.Error()})
+	}
+
+	article.Picture, article.PictureThumbnails = imageURLs(picture)
+
+	return c.JSON(fiber.Map{
+		"data": article,
+	})
+}
+
+// withArticlePictures fills the virtual picture fields of articles
+func withArticlePictures(articles []models.Article) {
+	ids := make([]uint, len(articles))
+	for i := range articles {
+		ids[i] = articles[i].ID
+	}
+
+	images, _ := media.ListFor(database.DB, models.MediaModelArticle, ids, models.MediaCollectionPicture)
+	for i := range articles {
+		articles[i].Picture, articles[i].PictureThumbnails = imageURLs(latestMedia(images, articles[i].ID))
+	}
+}
+
+// withArticlePicture fills the virtual picture fields of a article
+func withArticlePicture(article *models.Article) {
+	article.Picture, article.PictureThumbnails = imageURLs(media.First(database.DB, models.MediaModelArticle, article.ID, models.MediaCollectionPicture))
+}
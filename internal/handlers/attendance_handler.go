@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+	"mbkm-go/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type AttendanceHandler struct{}
+
+func NewAttendanceHandler() *AttendanceHandler {
+	return &AttendanceHandler{}
+}
+
+// attendanceLocation is the timezone attendance days are counted in
+var attendanceLocation = func() *time.Location {
+	loc, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}()
+
+// attendanceDay returns midnight of the day t falls on
+func attendanceDay(t time.Time) time.Time {
+	t = t.In(attendanceLocation)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, attendanceLocation)
+}
+
+// CheckInRequest is the body of check-in and check-out
+type CheckInRequest struct {
+	ApplyJobID uint     `json:"apply_job_id"`
+	Latitude   *float64 `json:"latitude"`
+	Longitude  *float64 `json:"longitude"`
+}
+
+// activeApplyJob returns the active placement of the current student. When
+// the student has several, apply_job_id picks one.
+func activeApplyJob(userID, applyJobID uint) (*models.ApplyJob, string) {
+	query := database.DB.Model(&models.ApplyJob{}).
+		Joins("JOIN apply_job_user ON apply_job_user.apply_job_id = apply_jobs.id").
+		Where("apply_job_user.user_id = ? AND apply_jobs.status = ?", userID, "Aktif")
+	if applyJobID != 0 {
+		query = query.Where("apply_jobs.id = ?", applyJobID)
+	}
+
+	var applyJobs []models.ApplyJob
+	query.Preload("Jobs").Find(&applyJobs)
+	switch len(applyJobs) {
+	case 0:
+		return nil, "You have no active placement"
+	case 1:
+		return &applyJobs[0], ""
+	}
+	return nil, "You have several active placements, apply_job_id is required"
+}
+
+// placementCompany returns the company of the first job of a placement
+func placementCompany(applyJob *models.ApplyJob) *models.Company {
+	for _, job := range applyJob.Jobs {
+		if job.CompanyID == nil {
+			continue
+		}
+		var company models.Company
+		if err := database.DB.First(&company, *job.CompanyID).Error; err == nil {
+			return &company
+		}
+	}
+	return nil
+}
+
+// checkGeofence validates the coordinates of a check and measures them
+// against the company's geofence. Distance and result are nil when either
+// side has no coordinates.
+func checkGeofence(company *models.Company, lat, lng *float64) (*float64, *bool, map[string]string) {
+	if (lat == nil) != (lng == nil) {
+		return nil, nil, map[string]string{"latitude": "Latitude and longitude must be sent together"}
+	}
+	if lat == nil {
+		return nil, nil, nil
+	}
+	if !utils.ValidCoordinates(*lat, *lng) {
+		return nil, nil, map[string]string{"latitude": "Invalid coordinates"}
+	}
+	if company == nil || company.Latitude == nil || company.Longitude == nil {
+		return nil, nil, nil
+	}
+
+	distance := utils.DistanceMeters(*company.Latitude, *company.Longitude, *lat, *lng)
+	if company.GeofenceRadius == nil {
+		return &distance, nil, nil
+	}
+	within := distance <= float64(*company.GeofenceRadius)
+	return &distance, &within, nil
+}
+
+// CheckIn records the start of today's attendance
+func (h *AttendanceHandler) CheckIn(c *fiber.Ctx) error {
+	userID := middleware.GetCurrentUserID(c)
+
+	var req CheckInRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", nil)
+	}
+
+	applyJob, msg := activeApplyJob(userID, req.ApplyJobID)
+	if applyJob == nil {
+		return utils.ValidationError(c, map[string]string{"apply_job_id": msg})
+	}
+	distance, within, errs := checkGeofence(placementCompany(applyJob), req.Latitude, req.Longitude)
+	if len(errs) > 0 {
+		return utils.ValidationError(c, errs)
+	}
+
+	now := time.Now()
+	attendance := models.Attendance{
+		ApplyJobID: applyJob.ID,
+		UserID:     userID,
+		Date:       attendanceDay(now),
+	}
+	if err := database.DB.Where(attendance).FirstOrInit(&attendance).Error; err != nil {
+		return utils.InternalServerError(c, "Failed to record attendance")
+	}
+	if attendance.CheckInAt != nil {
+		return utils.ValidationError(c, map[string]string{"check_in": "You have already checked in today"})
+	}
+	if attendance.ID != 0 && attendance.Status != models.AttendanceStatusPresent {
+		return utils.ValidationError(c, map[string]string{"check_in": "Today is recorded as " + attendance.Status})
+	}
+
+	attendance.Status = models.AttendanceStatusPresent
+	attendance.CheckInAt = &now
+	attendance.CheckInLatitude = req.Latitude
+	attendance.CheckInLongitude = req.Longitude
+	attendance.CheckInDistance = distance
+	attendance.CheckInWithinGeofence = within
+	if err := database.DB.Save(&attendance).Error; err != nil {
+		return utils.InternalServerError(c, "Failed to record attendance")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"message": "Checked in",
+		"data":    attendance,
+	})
+}
+
+// CheckOut records the end of today's attendance
+func (h *AttendanceHandler) CheckOut(c *fiber.Ctx) error {
+	userID := middleware.GetCurrentUserID(c)
+
+	var req CheckInRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", nil)
+	}
+
+	applyJob, msg := activeApplyJob(userID, req.ApplyJobID)
+	if applyJob == nil {
+		return utils.ValidationError(c, map[string]string{"apply_job_id": msg})
+	}
+	distance, within, errs := checkGeofence(placementCompany(applyJob), req.Latitude, req.Longitude)
+	if len(errs) > 0 {
+		return utils.ValidationError(c, errs)
+	}
+
+	now := time.Now()
+	var attendance models.Attendance
+	err := database.DB.Where("apply_job_id = ? AND user_id = ? AND date = ?", applyJob.ID, userID, attendanceDay(now)).
+		First(&attendance).Error
+	if err != nil || attendance.CheckInAt == nil {
+		return utils.ValidationError(c, map[string]string{"check_out": "You have not checked in today"})
+	}
+	if attendance.CheckOutAt != nil {
+		return utils.ValidationError(c, map[string]string{"check_out": "You have already checked out today"})
+	}
+
+	attendance.CheckOutAt = &now
+	attendance.CheckOutLatitude = req.Latitude
+	attendance.CheckOutLongitude = req.Longitude
+	attendance.CheckOutDistance = distance
+	attendance.CheckOutWithinGeofence = within
+	if err := database.DB.Save(&attendance).Error; err != nil {
+		return utils.InternalServerError(c, "Failed to record attendance")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Checked out",
+		"data":    attendance,
+	})
+}
+
+// canSuperviseAttendance reports whether the current user may override the
+// attendance of a placement: admin, the company supervisor or the
+// responsible lecturer
+func canSuperviseAttendance(c *fiber.Ctx, applyJob *models.ApplyJob) bool {
+	if middleware.IsAdmin(c) {
+		return true
+	}
+	userID := middleware.GetCurrentUserID(c)
+	if applyJob.ResponsibleLecturerID != nil && *applyJob.ResponsibleLecturerID == userID {
+		return true
+	}
+	return middleware.IsCompany(c) && canAccessApplyJob(c, applyJob.ID)
+}
+
+// OverrideAttendanceRequest sets the attendance of a day by a supervisor
+type OverrideAttendanceRequest struct {
+	ApplyJobID uint       `json:"apply_job_id"`
+	UserID     uint       `json:"user_id"`
+	Date       string     `json:"date"` // YYYY-MM-DD
+	Status     string     `json:"status"`
+	Note       string     `json:"note"`
+	CheckInAt  *time.Time `json:"check_in_at"`
+	CheckOutAt *time.Time `json:"check_out_at"`
+}
+
+// Override records or corrects a day, e.g. an excuse (Izin/Sakit) or a
+// forgotten check-out
+func (h *AttendanceHandler) Override(c *fiber.Ctx) error {
+	var req OverrideAttendanceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", nil)
+	}
+
+	errs := map[string]string{}
+	date, err := time.ParseInLocation("2006-01-02", req.Date, attendanceLocation)
+	if err != nil {
+		errs["date"] = "Date must be YYYY-MM-DD"
+	}
+	switch req.Status {
+	case models.AttendanceStatusPresent, models.AttendanceStatusExcused, models.AttendanceStatusSick, models.AttendanceStatusAbsent:
+	default:
+		errs["status"] = "Status must be Hadir, Izin, Sakit or Alpa"
+	}
+	if req.Status != models.AttendanceStatusPresent && req.Note == "" {
+		errs["note"] = "A note is required for absences"
+	}
+	if req.CheckInAt != nil && req.CheckOutAt != nil && req.CheckOutAt.Before(*req.CheckInAt) {
+		errs["check_out_at"] = "Check-out must be after check-in"
+	}
+	if len(errs) > 0 {
+		return utils.ValidationError(c, errs)
+	}
+
+	var applyJob models.ApplyJob
+	if err := database.DB.Preload("Users").First(&applyJob, req.ApplyJobID).Error; err != nil {
+		return utils.NotFoundError(c, "Apply job not found")
+	}
+	if !canSuperviseAttendance(c, &applyJob) {
+		return utils.ForbiddenError(c, "Only the supervisor can override attendance")
+	}
+
+	isParticipant := false
+	for _, u := range applyJob.Users {
+		if u.ID == req.UserID {
+			isParticipant = true
+		}
+	}
+	if !isParticipant {
+		return utils.ValidationError(c, map[string]string{"user_id": "User is not a participant of this placement"})
+	}
+
+	attendance := models.Attendance{ApplyJobID: applyJob.ID, UserID: req.UserID, Date: date}
+	if err := database.DB.Where(attendance).FirstOrInit(&attendance).Error; err != nil {
+		return utils.InternalServerError(c, "Failed to record attendance")
+	}
+
+	now := time.Now()
+	overriddenBy := middleware.GetCurrentUserID(c)
+	attendance.Status = req.Status
+	attendance.Note = utils.StringPtr(req.Note)
+	attendance.OverriddenByID = &overriddenBy
+	attendance.OverriddenAt = &now
+	if req.CheckInAt != nil {
+		attendance.CheckInAt = req.CheckInAt
+	}
+	if req.CheckOutAt != nil {
+		attendance.CheckOutAt = req.CheckOutAt
+	}
+	if req.Status != models.AttendanceStatusPresent {
+		attendance.CheckInAt = nil
+		attendance.CheckOutAt = nil
+	}
+
+	if err := database.DB.Save(&attendance).Error; err != nil {
+		return utils.InternalServerError(c, "Failed to record attendance")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Attendance updated",
+		"data":    attendance,
+	})
+}
+
+// attendanceQuery filters attendance by apply_job_id, user_id and month
+// (YYYY-MM), within the placements the current user may see
+func attendanceQuery(c *fiber.Ctx) (*gorm.DB, map[string]string) {
+	query := database.DB.Model(&models.Attendance{}).Scopes(scopeByApplyJob(c, "apply_job_id"))
+
+	applyJobID, _ := strconv.Atoi(c.Query("apply_job_id"))
+	if applyJobID != 0 {
+		if !canAccessApplyJob(c, uint(applyJobID)) {
+			return nil, map[string]string{"apply_job_id": "You do not have access to this placement"}
+		}
+		query = query.Where("apply_job_id = ?", applyJobID)
+	}
+
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	if month := c.Query("month"); month != "" {
+		start, err := time.ParseInLocation("2006-01", month, attendanceLocation)
+		if err != nil {
+			return nil, map[string]string{"month": "Month must be YYYY-MM"}
+		}
+		query = query.Where("date >= ? AND date < ?", start, start.AddDate(0, 1, 0))
+	}
+	return query, nil
+}
+
+// Index lists attendance records
+func (h *AttendanceHandler) Index(c *fiber.Ctx) error {
+	page := utils.DefaultPage(c.Query("page"))
+	limit := utils.DefaultLimit(c.Query("per_page"))
+	skip := utils.GetSkipNumber(page, limit)
+
+	query, errs := attendanceQuery(c)
+	if query == nil {
+		return utils.ValidationError(c, errs)
+	}
+
+	var count int64
+	query.Count(&count)
+
+	var attendances []models.Attendance
+	query.Preload("User", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id", "name", "email", "nim")
+	}).Order("date DESC, user_id ASC").Offset(skip).Limit(limit).Find(&attendances)
+
+	return c.JSON(fiber.Map{
+		"data":  attendances,
+		"count": count,
+	})
+}
+
+// Recap returns the attendance recap per student and month
+func (h *AttendanceHandler) Recap(c *fiber.Ctx) error {
+	query, errs := attendanceQuery(c)
+	if query == nil {
+		return utils.ValidationError(c, errs)
+	}
+
+	var attendances []models.Attendance
+	query.Find(&attendances)
+	recaps := recapAttendance(attendances)
+
+	return c.JSON(fiber.Map{
+		"data":  recaps,
+		"count": len(recaps),
+	})
+}
+
+// recapAttendance groups attendance records per placement, student and
+// month, ordered by month
+func recapAttendance(attendances []models.Attendance) []models.AttendanceRecap {
+	type key struct {
+		applyJobID, userID uint
+		month              string
+	}
+	recaps := map[key]*models.AttendanceRecap{}
+	var keys []key
+
+	for _, a := range attendances {
+		k := key{a.ApplyJobID, a.UserID, a.Date.Format("2006-01")}
+		recap, ok := recaps[k]
+		if !ok {
+			recap = &models.AttendanceRecap{ApplyJobID: a.ApplyJobID, UserID: a.UserID, Month: k.month}
+			recaps[k] = recap
+			keys = append(keys, k)
+		}
+
+		switch a.Status {
+		case models.AttendanceStatusPresent:
+			recap.Present++
+		case models.AttendanceStatusExcused:
+			recap.Excused++
+		case models.AttendanceStatusSick:
+			recap.Sick++
+		case models.AttendanceStatusAbsent:
+			recap.Absent++
+		}
+		if (a.CheckInWithinGeofence != nil && !*a.CheckInWithinGeofence) ||
+			(a.CheckOutWithinGeofence != nil && !*a.CheckOutWithinGeofence) {
+			recap.OutsideGeofence++
+		}
+		if a.Status == models.AttendanceStatusPresent && a.CheckInAt != nil {
+			if a.CheckOutAt == nil {
+				recap.MissingCheckOut++
+			} else {
+				recap.Hours += a.CheckOutAt.Sub(*a.CheckInAt).Hours()
+			}
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].month != keys[j].month {
+			return keys[i].month < keys[j].month
+		}
+		if keys[i].applyJobID != keys[j].applyJobID {
+			return keys[i].applyJobID < keys[j].applyJobID
+		}
+		return keys[i].userID < keys[j].userID
+	})
+	result := make([]models.AttendanceRecap, len(keys))
+	for i, k := range keys {
+		result[i] = *recaps[k]
+		result[i].Hours = math.Round(result[i].Hours*100) / 100
+	}
+	return result
+}
+
+// applyJobAttendanceRecap returns the monthly recaps of a placement
+func applyJobAttendanceRecap(applyJobID uint) []models.AttendanceRecap {
+	var attendances []models.Attendance
+	database.DB.Where("apply_job_id = ?", applyJobID).Find(&attendances)
+	return recapAttendance(attendances)
+}
@@ -53,6 +53,24 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		return utils.ValidationError(c, errors)
 	}
 
+	// Resolve the program studi from its ID, or its name or code
+	var prodi *models.ProgramStudi
+	if req.IDProgramStudi != 0 || req.ProgramStudy != "" {
+		var found models.ProgramStudi
+		var err error
+		if req.IDProgramStudi != 0 {
+			err = database.DB.Preload("Fakultas").First(&found, req.IDProgramStudi).Error
+		} else {
+			found, err = database.ResolveProgramStudi(database.DB, req.ProgramStudy)
+		}
+		if err != nil {
+			return utils.ValidationError(c, map[string]string{
+				"program_study": "Program studi not found",
+			})
+		}
+		prodi = &found
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -74,8 +92,6 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		Role:               role,
 		PhoneNumber:        utils.StringPtr(req.PhoneNumber),
 		Address:            utils.StringPtr(req.Address),
-		ProgramStudy:       utils.StringPtr(req.ProgramStudy),
-		Faculty:            utils.StringPtr(req.Faculty),
 		NIM:                utils.StringPtr(req.NIM),
 		SocialMedia:        utils.StringPtr(req.SocialMedia),
 		EmergencyContact:   utils.StringPtr(req.EmergencyContact),
@@ -83,6 +99,9 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		Position:           utils.StringPtr(req.Position),
 		Semester:           utils.StringPtr(req.Semester),
 	}
+	if prodi != nil {
+		user.SetProgramStudi(prodi)
+	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
 		return utils.InternalServerError(c, "Failed to create user")
@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/documents"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+	"mbkm-go/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// --- Certificates & Partner Letters ---
+
+// canIssueCertificates reports whether the current user may generate
+// certificates and partner letters: admin, CDC and prodi
+func canIssueCertificates(c *fiber.Ctx) bool {
+	return middleware.IsAdmin(c) || middleware.IsCDC(c) || middleware.HasRole(c, 6)
+}
+
+// certificateDraft collects the completion certificate of one student of a
+// completed application. The grade is only printed once it is published.
+func certificateDraft(applyJob *models.ApplyJob, student models.User) (documents.CertificateData, models.IssuedDocument) {
+	var published *models.Evaluation
+	var evaluation models.Evaluation
+	if err := database.DB.Where("apply_job_id = ?", applyJob.ID).First(&evaluation).Error; err == nil && gradePublished(&evaluation) {
+		published = &evaluation
+	}
+
+	data := documents.NewCertificateData(applyJob, student, placementProgramType(applyJob), published, placementReport(applyJob.ID))
+	return data, models.IssuedDocument{
+		Kind:       models.IssuedDocumentCertificate,
+		Subject:    fmt.Sprintf("apply_job:%d:user:%d", applyJob.ID, student.ID),
+		ApplyJobID: &applyJob.ID,
+		UserID:     &student.ID,
+		Summary: models.DocumentSummary{
+			"student_name":  data.StudentName,
+			"nim":           data.NIM,
+			"program_studi": data.ProgramStudi,
+			"program_type":  data.ProgramType,
+			"company":       data.Company,
+			"period":        data.Period,
+			"grade":         data.Grade,
+		},
+	}
+}
+
+// issueCertificate issues (or returns the unchanged) completion certificate
+// of one student of a completed application. Once the grade is published
+// the certificate issued before is replaced.
+func issueCertificate(issuedByID uint, applyJob *models.ApplyJob, student models.User) (*models.IssuedDocument, error) {
+	_, draft := certificateDraft(applyJob, student)
+	return issueDocument(issuedByID, draft, nil)
+}
+
+// issueCertificates issues the certificates of every student of a completed
+// application, or only of the students of prodiID when it is set
+func issueCertificates(issuedByID uint, applyJobID uint, prodiID *uint) ([]models.IssuedDocument, error) {
+	applyJob, err := findPlacement(applyJobID)
+	if err != nil {
+		return nil, err
+	}
+	if applyJob.Status == nil || *applyJob.Status != "Selesai" {
+		return nil, fmt.Errorf("apply job %d is not completed", applyJob.ID)
+	}
+
+	issued := make([]models.IssuedDocument, 0, len(applyJob.Users))
+	for _, student := range applyJob.Users {
+		if prodiID != nil && (student.IDProgramStudi == nil || *student.IDProgramStudi != *prodiID) {
+			continue
+		}
+		document, err := issueCertificate(issuedByID, applyJob, student)
+		if err != nil {
+			return issued, err
+		}
+		issued = append(issued, *document)
+	}
+	return issued, nil
+}
+
+// certificateStudent loads a completed application (route param "id" is
+// the apply_job_id) and the student whose certificate is asked for. Students
+// get their own; others pick the student with user_id when the application
+// has several. A nil application means the response was sent.
+func certificateStudent(c *fiber.Ctx) (*models.ApplyJob, *models.User, error) {
+	applyJob, err := findPlacement(c.Params("id"))
+	if err != nil {
+		return nil, nil, c.Status(404).JSON(fiber.Map{"error": "Apply Job not found"})
+	}
+	if !canAccessApplyJob(c, applyJob.ID) {
+		return nil, nil, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	if applyJob.Status == nil || *applyJob.Status != "Selesai" {
+		return nil, nil, c.Status(409).JSON(fiber.Map{"error": "Certificates are issued once the placement is completed"})
+	}
+
+	// Students always get their own certificate
+	userID := middleware.GetCurrentUserID(c)
+	var student *models.User
+	for i, u := range applyJob.Users {
+		if u.ID == userID {
+			student = &applyJob.Users[i]
+		}
+	}
+	if student == nil {
+		requested, err := strconv.ParseUint(c.Query("user_id"), 10, 32)
+		for i, u := range applyJob.Users {
+			if (err == nil && u.ID == uint(requested)) || (c.Query("user_id") == "" && len(applyJob.Users) == 1) {
+				student = &applyJob.Users[i]
+			}
+		}
+	}
+	if student == nil {
+		return nil, nil, c.Status(422).JSON(fiber.Map{"error": "user_id must be one of the students of this application"})
+	}
+	return applyJob, student, nil
+}
+
+// IssueCertificate issues the completion certificate of a student of a
+// completed application, or returns the one already issued while its content
+// is unchanged
+func IssueCertificate(c *fiber.Ctx) error {
+	applyJob, student, err := certificateStudent(c)
+	if applyJob == nil {
+		return err
+	}
+	document, err := issueCertificate(middleware.GetCurrentUserID(c), applyJob, *student)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue the certificate"})
+	}
+	return c.JSON(fiber.Map{"data": document})
+}
+
+// ExportCertificatePDF renders the issued completion certificate of a
+// student. It has to be issued (again) with IssueCertificate when there is
+// none or its content changed, e.g. once the grade is published.
+func ExportCertificatePDF(c *fiber.Ctx) error {
+	applyJob, student, err := certificateStudent(c)
+	if applyJob == nil {
+		return err
+	}
+
+	data, draft := certificateDraft(applyJob, *student)
+	document, err := findIssuedDocument(draft, nil)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load the certificate"})
+	}
+	if document == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "The certificate has not been issued for its current content; issue it first"})
+	}
+	data.Issue(document.Number, document.IssuedAt, documentVerifyURL(document.Code))
+
+	tpl := documents.Template(database.DB, models.DocumentTemplateCertificate, firstProdiID(applyJob), placementProgramType(applyJob))
+	output := documents.RenderCertificate(tpl, data)
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="sertifikat-%d-%d.pdf"`, applyJob.ID, student.ID))
+	return c.Send(output)
+}
+
+// parsePeriod reads the date_from and date_to (YYYY-MM-DD) a batch or
+// letter covers, both required
+func parsePeriod(dateFrom, dateTo string) (time.Time, time.Time, string) {
+	from, err := time.Parse("2006-01-02", dateFrom)
+	if err != nil {
+		return from, from, "date_from must be YYYY-MM-DD"
+	}
+	to, err := time.Parse("2006-01-02", dateTo)
+	if err != nil {
+		return from, to, "date_to must be YYYY-MM-DD"
+	}
+	if to.Before(from) {
+		return from, to, "date_to must not be before date_from"
+	}
+	return from, to, ""
+}
+
+// completedBetween limits apply jobs to those completed within a period;
+// placements completed before completed_at was recorded fall back to their
+// last update
+func completedBetween(from, to time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? AND COALESCE(completed_at, updated_at) >= ? AND COALESCE(completed_at, updated_at) < ?",
+			"Selesai", from, to.AddDate(0, 0, 1))
+	}
+}
+
+// partnerLetterDraft collects the thank-you letter of a company for the
+// students it hosted in a period
+func partnerLetterDraft(company *models.Company, from, to time.Time) (documents.PartnerLetterData, models.IssuedDocument, []documents.PartnerStudent, error) {
+	var applyJobs []models.ApplyJob
+	database.DB.Preload("Users.ProgramStudi.Fakultas").Preload("Jobs").
+		Scopes(completedBetween(from, to)).
+		Where("id IN (?)", database.DB.Table("apply_job_job").Select("apply_job_id").
+			Where("job_id IN (?)", database.DB.Model(&models.Job{}).Select("id").Where("company_id = ?", company.ID))).
+		Order("id ASC").
+		Find(&applyJobs)
+
+	students := make([]documents.PartnerStudent, 0)
+	for i := range applyJobs {
+		placement := documents.NewPlacement(&applyJobs[i])
+		for _, u := range applyJobs[i].Users {
+			placement.ForStudent(u)
+			students = append(students, documents.PartnerStudent{
+				Name:         placement.StudentName,
+				NIM:          placement.NIM,
+				ProgramStudi: placement.ProgramStudi,
+				Position:     placement.Position,
+			})
+		}
+	}
+
+	data := documents.NewPartnerLetterData(company, from, to, students)
+	if len(students) == 0 {
+		return data, models.IssuedDocument{}, nil, fmt.Errorf("%s hosted no completed placements in this period", company.CompanyName)
+	}
+	return data, models.IssuedDocument{
+		Kind:      models.IssuedDocumentPartnerLetter,
+		Subject:   fmt.Sprintf("company:%d:%s:%s", company.ID, from.Format("2006-01-02"), to.Format("2006-01-02")),
+		CompanyID: &company.ID,
+		Summary: models.DocumentSummary{
+			"company":       data.Company,
+			"period":        data.Period,
+			"student_count": data.StudentCount,
+		},
+	}, students, nil
+}
+
+// issuePartnerLetter issues (or returns the unchanged) thank-you letter of a
+// company for the students it hosted in a period
+func issuePartnerLetter(issuedByID uint, company *models.Company, from, to time.Time) (*models.IssuedDocument, error) {
+	_, draft, students, err := partnerLetterDraft(company, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return issueDocument(issuedByID, draft, students)
+}
+
+// partnerLetterRequest loads the company (route param "id") and the period
+// (date_from, date_to) of a thank-you letter. Admin, CDC, prodi and the
+// company's own account may get it. A nil company means the response was
+// sent.
+func partnerLetterRequest(c *fiber.Ctx, dateFrom, dateTo string) (*models.Company, time.Time, time.Time, error) {
+	var company models.Company
+	if err := database.DB.First(&company, c.Params("id")).Error; err != nil {
+		return nil, time.Time{}, time.Time{}, c.Status(404).JSON(fiber.Map{"error": "Company not found"})
+	}
+	isOwner := company.UserID != nil && *company.UserID == middleware.GetCurrentUserID(c)
+	if !canIssueCertificates(c) && !isOwner {
+		return nil, time.Time{}, time.Time{}, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	from, to, msg := parsePeriod(dateFrom, dateTo)
+	if msg != "" {
+		return nil, from, to, c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+	return &company, from, to, nil
+}
+
+// IssuePartnerLetter issues the thank-you letter of a company for the
+// placements completed between date_from and date_to, or returns the one
+// already issued while its content is unchanged
+func IssuePartnerLetter(c *fiber.Ctx) error {
+	var input certificateBatch
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	company, from, to, err := partnerLetterRequest(c, input.DateFrom, input.DateTo)
+	if company == nil {
+		return err
+	}
+
+	_, draft, students, err := partnerLetterDraft(company, from, to)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	document, err := issueDocument(middleware.GetCurrentUserID(c), draft, students)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue the letter"})
+	}
+	return c.JSON(fiber.Map{"data": document})
+}
+
+// ExportPartnerLetterPDF renders the issued thank-you letter of a company
+// for the placements completed between date_from and date_to. It has to be
+// issued (again) with IssuePartnerLetter when there is none or its content
+// changed.
+func ExportPartnerLetterPDF(c *fiber.Ctx) error {
+	company, from, to, err := partnerLetterRequest(c, c.Query("date_from"), c.Query("date_to"))
+	if company == nil {
+		return err
+	}
+
+	data, draft, students, err := partnerLetterDraft(company, from, to)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	document, err := findIssuedDocument(draft, students)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load the letter"})
+	}
+	if document == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "The letter has not been issued for its current content; issue it first"})
+	}
+	data.Issue(document.Number, document.IssuedAt, documentVerifyURL(document.Code))
+
+	tpl := documents.Template(database.DB, models.DocumentTemplatePartnerLetter, nil, "")
+	output := documents.RenderPartnerLetter(tpl, data)
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="surat-apresiasi-%d.pdf"`, company.ID))
+	return c.Send(output)
+}
+
+// GenerateCertificates queues the issuing of the certificates of every
+// placement completed between date_from and date_to, and of a thank-you
+// letter for each company that hosted them (admin, CDC and prodi). A prodi
+// batch only issues the certificates of the program's students. Documents
+// whose content did not change keep their number. Returns 202 with the queue
+// job; GET /jobs-queue/:id reports its progress and the documents issued.
+func GenerateCertificates(c *fiber.Ctx) error {
+	if !canIssueCertificates(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var input certificateBatch
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, _, msg := parsePeriod(input.DateFrom, input.DateTo); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+
+	scope := "all"
+	if !seesAllApplyJobs(c) {
+		input.ProdiID = staffProdiID(c)
+		if input.ProdiID == nil {
+			return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		scope = fmt.Sprintf("prodi:%d", *input.ProdiID)
+	}
+
+	return enqueueJob(c, jobGenerateCertificates, input, queue.Options{
+		UniqueKey: fmt.Sprintf("%s:%s:%s:%s", jobGenerateCertificates, scope, input.DateFrom, input.DateTo),
+	})
+}
+
+// certificateBatch is the payload of a certificate generation job
+type certificateBatch struct {
+	DateFrom string `json:"date_from"`
+	DateTo   string `json:"date_to"`
+	// ProdiID limits the batch to one program's students; set from the
+	// enqueuing user, never from the request
+	ProdiID *uint `json:"prodi_id,omitempty"`
+}
+
+// generateCertificatesJob issues the documents of a certificate batch
+func generateCertificatesJob(ctx context.Context, job *queue.Job) error {
+	var input certificateBatch
+	if err := job.Decode(&input); err != nil {
+		return err
+	}
+	from, to, msg := parsePeriod(input.DateFrom, input.DateTo)
+	if msg != "" {
+		return queue.Permanent(errors.New(msg))
+	}
+	var issuedByID uint
+	if job.CreatedByID != nil {
+		issuedByID = *job.CreatedByID
+	}
+
+	placements := database.DB.Model(&models.ApplyJob{}).Scopes(completedBetween(from, to))
+	if input.ProdiID != nil {
+		placements = placements.Where("id IN (?)", database.DB.Table("apply_job_user").
+			Joins("JOIN users ON users.id = apply_job_user.user_id").
+			Select("apply_job_user.apply_job_id").
+			Where("users.id_program_studi = ?", *input.ProdiID))
+	}
+	var applyJobIDs []uint
+	placements.Order("id ASC").Pluck("id", &applyJobIDs)
+
+	// Partner letters list the students of every program, so only admin and
+	// CDC batches issue them
+	var companies []models.Company
+	if len(applyJobIDs) > 0 && input.ProdiID == nil {
+		database.DB.Where("id IN (?)", database.DB.Model(&models.Job{}).Select("company_id").
+			Where("id IN (?)", database.DB.Table("apply_job_job").Select("job_id").Where("apply_job_id IN ?", applyJobIDs))).
+			Order("id ASC").
+			Find(&companies)
+	}
+
+	total := len(applyJobIDs) + len(companies)
+	problems := make([]string, 0)
+	certificates := make([]models.IssuedDocument, 0)
+	for i, id := range applyJobIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		issued, err := issueCertificates(issuedByID, id, input.ProdiID)
+		certificates = append(certificates, issued...)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Apply job %d: %s", id, err.Error()))
+		}
+		job.SetProgress((i+1)*100/total, fmt.Sprintf("%d of %d placements", i+1, len(applyJobIDs)))
+	}
+
+	letters := make([]models.IssuedDocument, 0, len(companies))
+	for i := range companies {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		document, err := issuePartnerLetter(issuedByID, &companies[i], from, to)
+		job.SetProgress((len(applyJobIDs)+i+1)*100/total, fmt.Sprintf("%d of %d partner letters", i+1, len(companies)))
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		letters = append(letters, *document)
+	}
+
+	job.SetResult(fiber.Map{
+		"certificates":    certificates,
+		"partner_letters": letters,
+		"placements":      len(applyJobIDs),
+		"errors":          problems,
+	})
+	return nil
+}
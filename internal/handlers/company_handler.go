@@ -4,6 +4,7 @@ import (
 	"strconv"
 
 	"mbkm-go/database"
+	"mbkm-go/internal/media"
 	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 	"mbkm-go/pkg/utils"
@@ -29,6 +30,7 @@ func (h *CompanyHandler) Index(c *fiber.Ctx) error {
 	offset := utils.GetSkipNumber(page, perPage)
 	database.DB.Preload("User").Preload("CreatedBy").
 		Offset(offset).Limit(perPage).Order("created_at DESC").Find(&companies)
+	withCompanyLogos(companies)
 
 	return c.JSON(fiber.Map{
 		"data":  companies,
@@ -47,6 +49,7 @@ func (h *CompanyHandler) Show(c *fiber.Ctx) error {
 	if err := database.DB.Preload("User").Preload("CreatedBy").First(&company, id).Error; err != nil {
 		return utils.NotFoundError(c, "Company not found")
 	}
+	withCompanyLogo(&company)
 
 	return c.JSON(fiber.Map{
 		"data": company,
@@ -61,19 +64,25 @@ func (h *CompanyHandler) Store(c *fiber.Ctx) error {
 	}
 
 	type CompanyRequest struct {
-		CompanyName               string `json:"company_name"`
-		BusinessFields            string `json:"business_fields"`
-		CompanySize               string `json:"company_size"`
-		CompanyWebsite            string `json:"company_website"`
-		CompanyProfileDescription string `json:"company_profile_description"`
-		CompanyPhoneNumber        string `json:"company_phone_number"`
-		CompanyAddress            string `json:"company_address"`
+		CompanyName               string   `json:"company_name"`
+		BusinessFields            string   `json:"business_fields"`
+		CompanySize               string   `json:"company_size"`
+		CompanyWebsite            string   `json:"company_website"`
+		CompanyProfileDescription string   `json:"company_profile_description"`
+		CompanyPhoneNumber        string   `json:"company_phone_number"`
+		CompanyAddress            string   `json:"company_address"`
+		Latitude                  *float64 `json:"latitude"`
+		Longitude                 *float64 `json:"longitude"`
+		GeofenceRadius            *int     `json:"geofence_radius"`
 	}
 
 	var req CompanyRequest
 	if err := c.BodyParser(&req); err != nil {
 		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", nil)
 	}
+	if errs := validateGeofence(req.Latitude, req.Longitude, req.GeofenceRadius); len(errs) > 0 {
+		return utils.ValidationError(c, errs)
+	}
 
 	company := models.Company{
 		CompanyName:               req.CompanyName,
@@ -83,6 +92,9 @@ func (h *CompanyHandler) Store(c *fiber.Ctx) error {
 		CompanyProfileDescription: utils.StringPtr(req.CompanyProfileDescription),
 		CompanyPhoneNumber:        utils.StringPtr(req.CompanyPhoneNumber),
 		CompanyAddress:            utils.StringPtr(req.CompanyAddress),
+		Latitude:                  req.Latitude,
+		Longitude:                 req.Longitude,
+		GeofenceRadius:            req.GeofenceRadius,
 		UserID:                    &user.ID,
 		CreatedByID:               &user.ID,
 	}
@@ -109,19 +121,25 @@ func (h *CompanyHandler) Update(c *fiber.Ctx) error {
 	}
 
 	type CompanyRequest struct {
-		CompanyName               string `json:"company_name"`
-		BusinessFields            string `json:"business_fields"`
-		CompanySize               string `json:"company_size"`
-		CompanyWebsite            string `json:"company_website"`
-		CompanyProfileDescription string `json:"company_profile_description"`
-		CompanyPhoneNumber        string `json:"company_phone_number"`
-		CompanyAddress            string `json:"company_address"`
+		CompanyName               string   `json:"company_name"`
+		BusinessFields            string   `json:"business_fields"`
+		CompanySize               string   `json:"company_size"`
+		CompanyWebsite            string   `json:"company_website"`
+		CompanyProfileDescription string   `json:"company_profile_description"`
+		CompanyPhoneNumber        string   `json:"company_phone_number"`
+		CompanyAddress            string   `json:"company_address"`
+		Latitude                  *float64 `json:"latitude"`
+		Longitude                 *float64 `json:"longitude"`
+		GeofenceRadius            *int     `json:"geofence_radius"`
 	}
 
 	var req CompanyRequest
 	if err := c.BodyParser(&req); err != nil {
 		return utils.ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body", nil)
 	}
+	if errs := validateGeofence(req.Latitude, req.Longitude, req.GeofenceRadius); len(errs) > 0 {
+		return utils.ValidationError(c, errs)
+	}
 
 	updates := map[string]interface{}{}
 	if req.CompanyName != "" {
@@ -145,8 +163,18 @@ func (h *CompanyHandler) Update(c *fiber.Ctx) error {
 	if req.CompanyAddress != "" {
 		updates["company_address"] = req.CompanyAddress
 	}
+	if req.Latitude != nil {
+		updates["latitude"] = *req.Latitude
+	}
+	if req.Longitude != nil {
+		updates["longitude"] = *req.Longitude
+	}
+	if req.GeofenceRadius != nil {
+		updates["geofence_radius"] = *req.GeofenceRadius
+	}
 
 	database.DB.Model(&company).Updates(updates)
+	withCompanyLogo(&company)
 
 	return c.JSON(fiber.Map{
 		"data": company,
@@ -166,8 +194,72 @@ func (h *CompanyHandler) Destroy(c *fiber.Ctx) error {
 	}
 
 	database.DB.Delete(&company)
+	removeMedia(c, models.MediaModelCompany, company.ID)
 
 	return c.JSON(fiber.Map{
 		"message": "Company deleted successfully",
 	})
 }
+
+// UploadLogo stores the logo of a company
+func (h *CompanyHandler) UploadLogo(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return utils.NotFoundError(c, "Company not found")
+	}
+
+	var company models.Company
+	if err := database.DB.First(&company, id).Error; err != nil {
+		return utils.NotFoundError(c, "Company not found")
+	}
+
+	userID := middleware.GetCurrentUserID(c)
+	isOwner := company.UserID != nil && *company.UserID == userID
+	if !isOwner && !middleware.IsAdmin(c) && !middleware.IsCDC(c) {
+		return utils.ForbiddenError(c, "")
+	}
+
+	logo, err := storeImageUpload(c, "company_logo", models.MediaModelCompany, company.ID, models.MediaCollectionCompanyLogo, imageRules(64, 64))
+	if err != nil {
+		return utils.ValidationError(c, map[string]string{"company_logo": err.Error()})
+	}
+
+	company.CompanyLogo, company.CompanyLogoThumbnails = imageURLs(logo)
+
+	return c.JSON(fiber.Map{
+		"data": company,
+	})
+}
+
+// withCompanyLogos fills the virtual logo fields of companies
+func withCompanyLogos(companies []models.Company) {
+	ids := make([]uint, len(companies))
+	for i := range companies {
+		ids[i] = companies[i].ID
+	}
+
+	images, _ := media.ListFor(database.DB, models.MediaModelCompany, ids, models.MediaCollectionCompanyLogo)
+	for i := range companies {
+		companies[i].CompanyLogo, companies[i].CompanyLogoThumbnails = imageURLs(latestMedia(images, companies[i].ID))
+	}
+}
+
+// withCompanyLogo fills the virtual logo fields of a company
+func withCompanyLogo(company *models.Company) {
+	company.CompanyLogo, company.CompanyLogoThumbnails = imageURLs(media.First(database.DB, models.MediaModelCompany, company.ID, models.MediaCollectionCompanyLogo))
+}
+
+// validateGeofence checks the optional office coordinates and radius
+func validateGeofence(lat, lng *float64, radius *int) map[string]string {
+	errs := map[string]string{}
+	if (lat == nil) != (lng == nil) {
+		errs["latitude"] = "Latitude and longitude must be set together"
+	}
+	if lat != nil && lng != nil && !utils.ValidCoordinates(*lat, *lng) {
+		errs["latitude"] = "Invalid coordinates"
+	}
+	if radius != nil && *radius <= 0 {
+		errs["geofence_radius"] = "Geofence radius must be positive"
+	}
+	return errs
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"strconv"
 	"time"
 
 	"mbkm-go/database"
+	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 
 	"github.com/gofiber/fiber/v2"
@@ -41,31 +43,76 @@ type DashboardOverview struct {
 	TotalJob         int64      `json:"total_job"`
 	TotalStudent     int64      `json:"total_student"`
 	TotalAktifMagang int64      `json:"total_aktif_magang"`
+	TotalHadirToday  int64      `json:"total_hadir_today"`
 	ChartData        ChartData  `json:"chart_data"`
 	LatestData       LatestData `json:"latest_data"`
 }
 
-// Overview returns dashboard overview data
+// dashboardProdi returns the program studi the dashboard is limited to: the
+// own program studi of prodi staff, prodi_id when given, or nil for all
+func dashboardProdi(c *fiber.Ctx) *uint {
+	if !seesAllApplyJobs(c) && middleware.HasRole(c, 6) {
+		if prodiID := staffProdiID(c); prodiID != nil {
+			return prodiID
+		}
+		none := uint(0)
+		return &none
+	}
+	if v, err := strconv.ParseUint(c.Query("prodi_id"), 10, 32); err == nil && v > 0 {
+		id := uint(v)
+		return &id
+	}
+	return nil
+}
+
+// prodiApplyJobs limits apply jobs to those with a student of a program
+// studi, when one is given
+func prodiApplyJobs(prodiID *uint) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if prodiID == nil {
+			return db
+		}
+		return db.Where("id IN (?)", database.DB.Table("apply_job_user").
+			Joins("JOIN users ON users.id = apply_job_user.user_id").
+			Select("apply_job_user.apply_job_id").
+			Where("users.id_program_studi = ?", *prodiID))
+	}
+}
+
+// Overview returns dashboard overview data, limited to the students of a
+// program studi for prodi staff or with prodi_id
 func (h *DashboardHandler) Overview(c *fiber.Ctx) error {
-	var totalCompany, totalJob, totalStudent, totalAktifMagang int64
+	var totalCompany, totalJob, totalStudent, totalAktifMagang, totalHadirToday int64
+	prodiID := dashboardProdi(c)
 
 	// Count totals
 	database.DB.Model(&models.Company{}).Count(&totalCompany)
 	database.DB.Model(&models.Job{}).Count(&totalJob)
-	database.DB.Model(&models.User{}).Where("role = ?", "student").Count(&totalStudent)
-	database.DB.Model(&models.ApplyJob{}).Where("status = ?", "Aktif").Count(&totalAktifMagang)
+	students := database.DB.Model(&models.User{}).Where("role = ?", "student")
+	if prodiID != nil {
+		students = students.Where("id_program_studi = ?", *prodiID)
+	}
+	students.Count(&totalStudent)
+	database.DB.Model(&models.ApplyJob{}).Scopes(prodiApplyJobs(prodiID)).Where("status = ?", "Aktif").Count(&totalAktifMagang)
+	present := database.DB.Model(&models.Attendance{}).
+		Where("date = ? AND status = ?", attendanceDay(time.Now()), models.AttendanceStatusPresent)
+	if prodiID != nil {
+		present = present.Where("user_id IN (?)", database.DB.Model(&models.User{}).Select("id").Where("id_program_studi = ?", *prodiID))
+	}
+	present.Count(&totalHadirToday)
 
 	// Get chart data
-	chartData := h.getChartData()
+	chartData := h.getChartData(prodiID)
 
 	// Get latest data
-	latestData := h.getLatestData()
+	latestData := h.getLatestData(prodiID)
 
 	data := DashboardOverview{
 		TotalCompany:     totalCompany,
 		TotalJob:         totalJob,
 		TotalStudent:     totalStudent,
 		TotalAktifMagang: totalAktifMagang,
+		TotalHadirToday:  totalHadirToday,
 		ChartData:        chartData,
 		LatestData:       latestData,
 	}
@@ -73,7 +120,7 @@ func (h *DashboardHandler) Overview(c *fiber.Ctx) error {
 	return c.JSON(data)
 }
 
-func (h *DashboardHandler) getChartData() ChartData {
+func (h *DashboardHandler) getChartData(prodiID *uint) ChartData {
 	labels := []string{"Jan", "Feb", "Mar", "Apr", "Mei", "Jun", "Jul", "Agu", "Sep", "Okt", "Nov", "Des"}
 	statusList := []string{"Melamar", "Disetujui", "Aktif", "Selesai", "Ditolak"}
 
@@ -81,7 +128,7 @@ func (h *DashboardHandler) getChartData() ChartData {
 	for _, status := range statusList {
 		datasets = append(datasets, ChartDataset{
 			Label: status,
-			Data:  h.getChartDataByStatus(status),
+			Data:  h.getChartDataByStatus(status, prodiID),
 		})
 	}
 
@@ -91,7 +138,7 @@ func (h *DashboardHandler) getChartData() ChartData {
 	}
 }
 
-func (h *DashboardHandler) getChartDataByStatus(status string) []int {
+func (h *DashboardHandler) getChartDataByStatus(status string, prodiID *uint) []int {
 	type MonthCount struct {
 		Month int
 		Count int
@@ -101,6 +148,7 @@ func (h *DashboardHandler) getChartDataByStatus(status string) []int {
 	currentYear := time.Now().Year()
 
 	database.DB.Model(&models.ApplyJob{}).
+		Scopes(prodiApplyJobs(prodiID)).
 		Select("EXTRACT(MONTH FROM created_at) as month, COUNT(id) as count").
 		Where("status = ?", status).
 		Where("EXTRACT(YEAR FROM created_at) = ?", currentYear).
@@ -118,7 +166,7 @@ func (h *DashboardHandler) getChartDataByStatus(status string) []int {
 	return data
 }
 
-func (h *DashboardHandler) getLatestData() LatestData {
+func (h *DashboardHandler) getLatestData(prodiID *uint) LatestData {
 	var jobs []models.Job
 	var companies []models.Company
 	var applyJobs []models.ApplyJob
@@ -136,12 +184,16 @@ func (h *DashboardHandler) getLatestData() LatestData {
 
 	// Get latest 5 apply jobs with users
 	database.DB.Preload("Users", func(db *gorm.DB) *gorm.DB {
-		return db.Select("id", "name", "email", "nim", "program_study", "faculty")
+		return db.Select("id", "name", "email", "nim", "program_study", "faculty", "id_program_studi")
 	}).
+		Scopes(prodiApplyJobs(prodiID)).
 		Order("created_at DESC").
 		Limit(5).
 		Find(&applyJobs)
 
+	withJobImages(jobs)
+	withCompanyLogos(companies)
+
 	return LatestData{
 		Jobs:             jobs,
 		Companies:        companies,
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"strings"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/documents"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- Document Template Handlers ---
+
+// canManageTemplates reports whether the current user may edit document
+// templates: admin, CDC and prodi
+func canManageTemplates(c *fiber.Ctx) bool {
+	return middleware.IsAdmin(c) || middleware.IsCDC(c) || middleware.HasRole(c, 6)
+}
+
+// GetDocumentTemplates lists stored templates, filterable by kind and
+// id_program_studi, together with the built-in defaults
+func GetDocumentTemplates(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.DocumentTemplate{}).Preload("ProgramStudi")
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if prodiID := c.Query("id_program_studi"); prodiID != "" {
+		query = query.Where("id_program_studi = ?", prodiID)
+	}
+	if programType := c.Query("program_type"); programType != "" {
+		query = query.Where("program_type = ?", programType)
+	}
+
+	var templates []models.DocumentTemplate
+	if err := query.Order("kind ASC, id ASC").Find(&templates).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+
+	defaults := make([]models.DocumentTemplate, 0)
+	for _, kind := range documents.Kinds() {
+		defaults = append(defaults, documents.Default(kind))
+	}
+
+	return c.JSON(fiber.Map{
+		"data":     templates,
+		"count":    len(templates),
+		"defaults": defaults,
+	})
+}
+
+type documentTemplateInput struct {
+	Kind           string  `json:"kind"`
+	IDProgramStudi *uint   `json:"id_program_studi"`
+	ProgramType    *string `json:"program_type"`
+	Title          string  `json:"title"`
+	Header         string  `json:"header"`
+	Body           string  `json:"body"`
+	Footer         string  `json:"footer"`
+	Signatures     string  `json:"signatures"`
+}
+
+func (in documentTemplateInput) apply(tpl *models.DocumentTemplate) {
+	tpl.Kind = in.Kind
+	tpl.IDProgramStudi = in.IDProgramStudi
+	tpl.ProgramType = nil
+	if in.ProgramType != nil && strings.TrimSpace(*in.ProgramType) != "" {
+		programType := strings.TrimSpace(*in.ProgramType)
+		tpl.ProgramType = &programType
+	}
+	tpl.Title = in.Title
+	tpl.Header = in.Header
+	tpl.Body = in.Body
+	tpl.Footer = in.Footer
+	tpl.Signatures = in.Signatures
+}
+
+// validateDocumentTemplate checks the kind, that the template parses and that
+// no other template covers the same kind, program studi and program type
+func validateDocumentTemplate(tpl *models.DocumentTemplate) string {
+	known := false
+	for _, kind := range documents.Kinds() {
+		if kind == tpl.Kind {
+			known = true
+		}
+	}
+	if !known {
+		return "Unknown template kind"
+	}
+	if err := documents.Validate(*tpl); err != nil {
+		return "Invalid template: " + err.Error()
+	}
+
+	query := database.DB.Model(&models.DocumentTemplate{}).Where("kind = ? AND id <> ?", tpl.Kind, tpl.ID)
+	if tpl.IDProgramStudi != nil {
+		query = query.Where("id_program_studi = ?", *tpl.IDProgramStudi)
+	} else {
+		query = query.Where("id_program_studi IS NULL")
+	}
+	if tpl.ProgramType != nil {
+		query = query.Where("program_type = ?", *tpl.ProgramType)
+	} else {
+		query = query.Where("program_type IS NULL")
+	}
+	var count int64
+	query.Count(&count)
+	if count > 0 {
+		return "A template for this kind, program studi and program type already exists"
+	}
+	return ""
+}
+
+func CreateDocumentTemplate(c *fiber.Ctx) error {
+	if !canManageTemplates(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var input documentTemplateInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var tpl models.DocumentTemplate
+	input.apply(&tpl)
+	if msg := validateDocumentTemplate(&tpl); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := database.DB.Create(&tpl).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(fiber.Map{"data": tpl})
+}
+
+func UpdateDocumentTemplate(c *fiber.Ctx) error {
+	if !canManageTemplates(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var tpl models.DocumentTemplate
+	if err := database.DB.First(&tpl, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+
+	var input documentTemplateInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	input.apply(&tpl)
+	if msg := validateDocumentTemplate(&tpl); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := database.DB.Save(&tpl).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"data": tpl})
+}
+
+func DeleteDocumentTemplate(c *fiber.Ctx) error {
+	if !canManageTemplates(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	database.DB.Delete(&models.DocumentTemplate{}, c.Params("id"))
+	return c.SendStatus(204)
+}
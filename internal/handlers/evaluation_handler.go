@@ -1,13 +1,17 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"mbkm-go/internal/database"
+	"mbkm-go/internal/grading"
+	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // --- Evaluation Handlers ---
@@ -31,11 +35,19 @@ func GetEvaluations(c *fiber.Ctx) error {
 		query = query.Where("status = ?", status)
 	}
 
+	query = query.Scopes(scopeByApplyJob(c, "apply_job_id"))
+
 	var total int64
 	query.Count(&total)
 
 	query.Offset(offset).Limit(limit).Find(&evaluations)
 
+	if !seesUnpublishedGrades(c) {
+		for i := range evaluations {
+			hideUnpublishedGrade(&evaluations[i])
+		}
+	}
+
 	return c.JSON(fiber.Map{
 		"data":  evaluations,
 		"count": total,
@@ -48,6 +60,7 @@ func GetEvaluationDetail(c *fiber.Ctx) error {
 
 	if err := database.DB.
 		Preload("ApplyJob.Jobs").
+		Preload("ApplyJob.Users").
 		Preload("CompanyPersonnel").
 		Preload("Lecturer").
 		Preload("Examiner").
@@ -56,59 +69,108 @@ func GetEvaluationDetail(c *fiber.Ctx) error {
 		First(&evaluation).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Evaluation not found"})
 	}
+	if !canAccessApplyJob(c, evaluation.ApplyJobID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	// Students see nothing but the status until the grade is published
+	if !seesUnpublishedGrades(c) && !gradePublished(&evaluation) {
+		hideUnpublishedGrade(&evaluation)
+		return c.JSON(fiber.Map{"data": evaluation})
+	}
 
 	// Calculate Final Grade
-	var bobot models.BobotNilai
-	database.DB.Where("id_program_studi IS NOT NULL").First(&bobot) // Naive fetch first
+	result := grading.Final(evaluation, evaluationBobot(&evaluation), evaluationBands(&evaluation))
 
-	result := calculateFinalGrade(evaluation, bobot)
+	var appeals []models.GradeAppeal
+	database.DB.Preload("Evaluator").Where("evaluation_id = ?", evaluation.ID).Order("created_at ASC").Find(&appeals)
 
-	return c.JSON(fiber.Map{
-		"data": evaluation,
-		"meta": result, // Include calculated breakdown
-	})
+	response := fiber.Map{
+		"data":    evaluation,
+		"meta":    result, // Include calculated breakdown
+		"rubrics": evaluationBreakdown(&evaluation),
+		"appeals": appeals,
+	}
+	if seesUnpublishedGrades(c) {
+		var logs []models.EvaluationLog
+		database.DB.Preload("User").Where("evaluation_id = ?", evaluation.ID).Order("created_at ASC, id ASC").Find(&logs)
+		response["logs"] = logs
+	}
+	return c.JSON(response)
 }
 
 func UpdateEvaluation(c *fiber.Ctx) error {
 	// Handles grading by Company, Lecturer, Examiner, Prodi
 	type GradeInput struct {
-		ApplyJobID       uint    `json:"apply_job_id"`
-		Grade            string  `json:"grade"` // Letter grade
-		GradeScore       float64 `json:"grade_score"`
-		GradeDescription string  `json:"grade_description"`
-		IsExaminer       bool    `json:"is_examiner"`
+		ApplyJobID       uint                  `json:"apply_job_id"`
+		Grade            string                `json:"grade"` // Letter grade
+		GradeScore       float64               `json:"grade_score"`
+		GradeDescription string                `json:"grade_description"`
+		IsExaminer       bool                  `json:"is_examiner"`
+		Scores           []criterionScoreInput `json:"scores"` // Per-criterion rubric scores
 	}
 	input := new(GradeInput)
 	if err := c.BodyParser(input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
+	var applyJob models.ApplyJob
+	if err := database.DB.Preload("Users").First(&applyJob, input.ApplyJobID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Apply Job not found"})
+	}
+	if !canAccessApplyJob(c, applyJob.ID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
 	var evaluation models.Evaluation
 	if err := database.DB.Where("apply_job_id = ?", input.ApplyJobID).First(&evaluation).Error; err != nil {
 		// Create if not exists (though Report usually creates it)
 		evaluation = models.Evaluation{
 			ApplyJobID: input.ApplyJobID,
-			Status:     "Draft",
+			Status:     models.EvalStatusNotGraded,
 		}
 		database.DB.Create(&evaluation)
 	}
+	evaluation.ApplyJob = &applyJob
 
-	// Calculate Grade from Score
-	// gradeChar := "E"
-	if input.GradeScore >= 85 {
-		// gradeChar = "A"
-	} else if input.GradeScore >= 70 {
-		// gradeChar = "B"
-	} else if input.GradeScore >= 50 {
-		// gradeChar = "C"
-	} else if input.GradeScore >= 40 {
-		// gradeChar = "D"
+	if evaluation.FinalizedAt != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Evaluation is finalized; it must be unlocked before grading"})
+	}
+
+	bands := evaluationBands(&evaluation)
+	if input.Grade != "" {
+		if _, ok := grading.Band(bands, input.Grade); !ok {
+			return c.Status(422).JSON(fiber.Map{"error": "Grade " + input.Grade + " is not on the grade scale"})
+		}
 	}
 
 	// Auth User
-	userID := 1 // TODO: Real auth ID
-	if u := c.Locals("user_id"); u != nil {
-		userID, _ = strconv.Atoi(fmt.Sprintf("%v", u))
+	userID := middleware.GetCurrentUserID(c)
+
+	// Rubric scores replace the single grade score of the evaluator's role
+	var rubricRole string
+	if len(input.Scores) > 0 {
+		rubricRole = evaluatorRole(c, &applyJob)
+		if rubricRole == "" {
+			return c.Status(403).JSON(fiber.Map{"error": "You do not grade this application"})
+		}
+		rubric := evaluationRubric(evaluation.ID, rubricRole, firstProdiID(&applyJob))
+		if rubric == nil {
+			return c.Status(422).JSON(fiber.Map{"error": "No rubric configured for " + rubricRole})
+		}
+		score, err := scoreRubric(rubric, input.Scores)
+		if err != nil {
+			return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := saveEvaluationScores(database.DB, evaluation.ID, rubric, rubricRole, userID, input.Scores); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		input.GradeScore = score
+		input.IsExaminer = rubricRole == models.RubricRoleExaminer
+	}
+
+	if input.Grade == "" {
+		input.Grade = grading.Grade(bands, input.GradeScore).Letter
 	}
 
 	// Determine Role
@@ -121,13 +183,17 @@ func UpdateEvaluation(c *fiber.Ctx) error {
 
 	now := time.Now()
 	updates := map[string]interface{}{}
-	updates["status"] = "Sudah Dinilai"
+	updates["status"] = models.EvalStatusGraded
 
 	// Role logic
 	for _, rid := range roleIDs {
+		// Rubric scores only grade the role the rubric was filled in as
+		if rubricRole != "" && (rid == 6 || (rid == 4) != (rubricRole == models.RubricRoleCompany)) {
+			continue
+		}
 		if rid == 4 { // Company
 			updates["company_personnel_id"] = userID
-			updates["company_grade"] = input.Grade // or gradeChar
+			updates["company_grade"] = input.Grade
 			updates["company_grade_score"] = input.GradeScore
 			updates["company_grade_description"] = input.GradeDescription
 			updates["company_grade_date"] = &now
@@ -154,49 +220,302 @@ func UpdateEvaluation(c *fiber.Ctx) error {
 		}
 	}
 
+	if len(updates) == 1 {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the company, lecturers and prodi can grade"})
+	}
+
 	database.DB.Model(&evaluation).Updates(updates)
 
 	return c.JSON(fiber.Map{"data": evaluation, "status": true})
 }
 
+// findEvaluationForProdi loads the evaluation of an application (route param
+// "id" is the apply_job_id) for finalizing, publishing or unlocking, which
+// only prodi and admins may do
+func findEvaluationForProdi(c *fiber.Ctx) (*models.Evaluation, error) {
+	if !middleware.IsAdmin(c) && !middleware.HasRole(c, 6) {
+		return nil, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var evaluation models.Evaluation
+	if err := database.DB.Preload("ApplyJob.Users").Where("apply_job_id = ?", c.Params("id")).First(&evaluation).Error; err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Evaluation not found"})
+	}
+	if !canAccessApplyJob(c, evaluation.ApplyJobID) {
+		return nil, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	return &evaluation, nil
+}
+
+// parsePublishDate accepts a date (2006-01-02) or an RFC 3339 timestamp
+func parsePublishDate(value string) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return &t, true
+	}
+	return nil, false
+}
+
+func logEvaluation(db *gorm.DB, c *fiber.Ctx, evaluation *models.Evaluation, action, reason string) error {
+	return db.Create(&models.EvaluationLog{
+		EvaluationID: evaluation.ID,
+		UserID:       middleware.GetCurrentUserID(c),
+		Action:       action,
+		Reason:       reason,
+		Grade:        evaluation.Grade,
+		FinalScore:   evaluation.FinalScore,
+		PublishedAt:  evaluation.PublishedAt,
+	}).Error
+}
+
+// FinalizeEvaluation computes the final grade from the company, lecturer and
+// examiner scores with the program studi's weights and grade scale, stores
+// it and locks the evaluation. An optional published_at schedules when
+// students see the grade.
+func FinalizeEvaluation(c *fiber.Ctx) error {
+	evaluation, err := findEvaluationForProdi(c)
+	if evaluation == nil {
+		return err
+	}
+	if evaluation.FinalizedAt != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Evaluation is already finalized"})
+	}
+	// One grade is computed with one prodi's weights and scale
+	if evaluation.ApplyJob != nil && len(studentProdiIDs(evaluation.ApplyJob)) > 1 {
+		return c.Status(422).JSON(fiber.Map{"error": "The students of this application belong to more than one program studi and cannot share one grade"})
+	}
+
+	var input struct {
+		PublishedAt string `json:"published_at"`
+	}
+	c.BodyParser(&input)
+	publishedAt, ok := parsePublishDate(input.PublishedAt)
+	if !ok {
+		return c.Status(422).JSON(fiber.Map{"error": "published_at must be a date (YYYY-MM-DD) or RFC 3339 time"})
+	}
+
+	scale := evaluationScale(evaluation.ApplyJob)
+	bobot := evaluationBobot(evaluation)
+	result := grading.Final(*evaluation, bobot, scale.Bands)
+	if result == nil {
+		return c.Status(422).JSON(fiber.Map{"error": "Grade weights (bobot nilai) are not set"})
+	}
+	if !result.Complete {
+		return c.Status(422).JSON(fiber.Map{"error": "Company, lecturer and examiner must all grade first"})
+	}
+
+	now := time.Now()
+	userID := middleware.GetCurrentUserID(c)
+	snapshot := grading.Snapshot(scale)
+	finalized := *evaluation
+	finalized.Status = models.EvalStatusFinalized
+	finalized.Grade = result.Grade
+	finalized.FinalScore = result.TotalScore
+	finalized.GradePoint = result.GradePoint
+	finalized.GradeScale = &snapshot
+	finalized.FinalizedAt = &now
+	finalized.FinalizedByID = &userID
+	finalized.PublishedAt = publishedAt
+	finalized.BobotNilaiID = &bobot.ID
+
+	// The grade, the lock and the log entry are stored together; finalizing
+	// twice at once finds the evaluation locked
+	errFinalized := errors.New("already finalized")
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		update := tx.Model(evaluation).Where("finalized_at IS NULL").Updates(map[string]interface{}{
+			"status":          finalized.Status,
+			"grade":           finalized.Grade,
+			"final_score":     finalized.FinalScore,
+			"grade_point":     finalized.GradePoint,
+			"grade_scale":     snapshot,
+			"finalized_at":    &now,
+			"finalized_by_id": userID,
+			"published_at":    publishedAt,
+			"bobot_nilai_id":  bobot.ID,
+		})
+		if update.Error != nil {
+			return update.Error
+		}
+		if update.RowsAffected == 0 {
+			return errFinalized
+		}
+		return logEvaluation(tx, c, &finalized, models.EvaluationLogFinalize, "")
+	})
+	if errors.Is(err, errFinalized) {
+		return c.Status(409).JSON(fiber.Map{"error": "Evaluation is already finalized"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to finalize the evaluation"})
+	}
+	*evaluation = finalized
+
+	return c.JSON(fiber.Map{"data": evaluation, "meta": result})
+}
+
+// PublishEvaluation sets when students see a finalized grade, now when no
+// published_at is given
+func PublishEvaluation(c *fiber.Ctx) error {
+	evaluation, err := findEvaluationForProdi(c)
+	if evaluation == nil {
+		return err
+	}
+	if evaluation.FinalizedAt == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Only finalized evaluations can be published"})
+	}
+
+	var input struct {
+		PublishedAt string `json:"published_at"`
+	}
+	c.BodyParser(&input)
+	publishedAt, ok := parsePublishDate(input.PublishedAt)
+	if !ok {
+		return c.Status(422).JSON(fiber.Map{"error": "published_at must be a date (YYYY-MM-DD) or RFC 3339 time"})
+	}
+	if publishedAt == nil {
+		now := time.Now()
+		publishedAt = &now
+	}
+
+	database.DB.Model(evaluation).Update("published_at", publishedAt)
+	evaluation.PublishedAt = publishedAt
+	logEvaluation(database.DB, c, evaluation, models.EvaluationLogPublish, "")
+
+	return c.JSON(fiber.Map{"data": evaluation})
+}
+
+// UnlockEvaluation reopens a finalized evaluation for grading. The final
+// grade is cleared and the reason is kept in the evaluation log.
+func UnlockEvaluation(c *fiber.Ctx) error {
+	evaluation, err := findEvaluationForProdi(c)
+	if evaluation == nil {
+		return err
+	}
+	if evaluation.FinalizedAt == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Evaluation is not finalized"})
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	c.BodyParser(&input)
+	if strings.TrimSpace(input.Reason) == "" {
+		return c.Status(422).JSON(fiber.Map{"error": "A reason is required to unlock an evaluation"})
+	}
+
+	// Log the grade being withdrawn before clearing it
+	logEvaluation(database.DB, c, evaluation, models.EvaluationLogUnlock, strings.TrimSpace(input.Reason))
+	revokeDocuments(database.DB, c, evaluation.ApplyJobID, "Penilaian dibuka kembali: "+strings.TrimSpace(input.Reason))
+	database.DB.Model(evaluation).Updates(map[string]interface{}{
+		"status":          models.EvalStatusGraded,
+		"grade":           "",
+		"final_score":     0,
+		"grade_point":     0,
+		"grade_scale":     nil,
+		"finalized_at":    nil,
+		"finalized_by_id": nil,
+		"published_at":    nil,
+		"bobot_nilai_id":  nil,
+	})
+	database.DB.First(evaluation, evaluation.ID)
+
+	return c.JSON(fiber.Map{"data": evaluation})
+}
+
 // Helpers
 
-func calculateFinalGrade(e models.Evaluation, b models.BobotNilai) map[string]interface{} {
-	totalBobot := b.BobotNilaiPerusahaan + b.BobotNilaiPembimbing + b.BobotNilaiPenguji
-	if totalBobot == 0 {
-		return nil
+// seesUnpublishedGrades reports whether the current user grades or manages
+// evaluations; everyone else only sees published grades
+func seesUnpublishedGrades(c *fiber.Ctx) bool {
+	return middleware.IsAdmin(c) || middleware.IsCDC(c) || middleware.IsCompany(c) ||
+		middleware.HasRole(c, 5) || middleware.HasRole(c, 6)
+}
+
+// gradePublished reports whether the final grade of an evaluation is out
+func gradePublished(e *models.Evaluation) bool {
+	return e.FinalizedAt != nil && e.PublishedAt != nil && !e.PublishedAt.After(time.Now())
+}
+
+// hideUnpublishedGrade strips the grades of an evaluation that is not
+// published yet, leaving it "in progress"
+func hideUnpublishedGrade(e *models.Evaluation) {
+	if gradePublished(e) {
+		return
+	}
+	*e = models.Evaluation{
+		ID:         e.ID,
+		ApplyJobID: e.ApplyJobID,
+		ApplyJob:   e.ApplyJob,
+		Status:     models.EvalStatusUnpublished,
+		CreatedAt:  e.CreatedAt,
+		UpdatedAt:  e.UpdatedAt,
 	}
+}
 
-	pPerusahaan := b.BobotNilaiPerusahaan / totalBobot
-	pPembimbing := b.BobotNilaiPembimbing / totalBobot
-	pPenguji := b.BobotNilaiPenguji / totalBobot
+// evaluationBobot returns the weights an evaluation is graded with: the
+// version its final grade was computed with, otherwise the version of the
+// students' program studi in effect when the placement started. Without one
+// the weights are empty and grading.Final reports nothing.
+func evaluationBobot(e *models.Evaluation) models.BobotNilai {
+	var bobot models.BobotNilai
+	if e.BobotNilaiID != nil {
+		if err := database.DB.First(&bobot, *e.BobotNilaiID).Error; err == nil {
+			return bobot
+		}
+	}
 
-	cScore := e.CompanyGradeScore * pPerusahaan
-	lScore := e.LecturerGradeScore * pPembimbing
-	eScore := e.ExaminerGradeScore * pPenguji
+	if applyJob := e.ApplyJob; applyJob != nil {
+		if prodiID := firstProdiID(applyJob); prodiID != nil {
+			if found, err := resolveBobotNilai(*prodiID, placementProgramType(applyJob), placementStart(applyJob)); err == nil {
+				return found
+			}
+		}
+	}
+	return bobot
+}
 
-	totalScore := cScore + lScore + eScore
+// placementStart returns the start date of the report of an application,
+// or when it was applied for
+func placementStart(applyJob *models.ApplyJob) time.Time {
+	var report models.Report
+	if err := database.DB.Where("apply_job_id = ?", applyJob.ID).First(&report).Error; err == nil && report.StartDate != nil {
+		return *report.StartDate
+	}
+	return applyJob.CreatedAt
+}
 
-	hasGrade := e.CompanyGradeScore > 0 && e.LecturerGradeScore > 0 && e.ExaminerGradeScore > 0
+// placementProgramType returns the vacancy type of the first job of an
+// application
+func placementProgramType(applyJob *models.ApplyJob) string {
+	jobs := applyJob.Jobs
+	if len(jobs) == 0 {
+		database.DB.Model(applyJob).Association("Jobs").Find(&jobs)
+	}
+	for _, job := range jobs {
+		if job.VacancyType != nil && *job.VacancyType != "" {
+			return *job.VacancyType
+		}
+	}
+	return ""
+}
 
-	finalGrade := "E"
-	if !hasGrade {
-		finalGrade = "-"
-	} else if totalScore >= 85 {
-		finalGrade = "A"
-	} else if totalScore >= 70 {
-		finalGrade = "B"
-	} else if totalScore >= 55 {
-		finalGrade = "C"
-	} else if totalScore >= 40 {
-		finalGrade = "D"
+// evaluationScale returns the grade scale of the students' program studi
+func evaluationScale(applyJob *models.ApplyJob) models.GradeScale {
+	var prodiID *uint
+	if applyJob != nil {
+		prodiID = firstProdiID(applyJob)
 	}
+	return grading.ScaleFor(database.DB, prodiID)
+}
 
-	return map[string]interface{}{
-		"company_score":  cScore,
-		"lecturer_score": lScore,
-		"examiner_score": eScore,
-		"total_score":    totalScore,
-		"grade":          finalGrade,
+// evaluationBands returns the bands an evaluation is graded with: its stored
+// snapshot once finalized, otherwise the current scale
+func evaluationBands(e *models.Evaluation) []models.GradeBand {
+	if e.GradeScale != nil && len(e.GradeScale.Bands) > 0 {
+		return e.GradeScale.Bands
 	}
+	return evaluationScale(e.ApplyJob).Bands
 }
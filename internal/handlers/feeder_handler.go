@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"mbkm-go/config"
+	"mbkm-go/database"
+	"mbkm-go/internal/feeder"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+	"mbkm-go/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// --- PDDikti Neo Feeder Export Handlers ---
+
+func feederOptions() feeder.Options {
+	return feeder.Options{
+		JenisAktivitas:  config.AppConfig.FeederJenisAktivitas,
+		ProgramMBKM:     config.AppConfig.FeederProgramMBKM,
+		KategoriBimbing: config.AppConfig.FeederKategoriBimbing,
+		KategoriUji:     config.AppConfig.FeederKategoriUji,
+	}
+}
+
+// feederFilter reads id_program_studi, semester and apply_job_id from the
+// query string
+func feederFilter(c *fiber.Ctx) (feeder.Filter, error) {
+	filter := feeder.Filter{Semester: c.Query("semester")}
+	if filter.Semester != "" {
+		if _, err := strconv.Atoi(filter.Semester); err != nil || len(filter.Semester) != 5 {
+			return filter, fmt.Errorf("semester must look like 20241")
+		}
+	}
+	if v := c.Query("id_program_studi"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return filter, fmt.Errorf("invalid id_program_studi")
+		}
+		prodiID := uint(id)
+		filter.ProdiID = &prodiID
+	}
+	if v := c.Query("apply_job_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return filter, fmt.Errorf("invalid apply_job_id")
+		}
+		applyJobID := uint(id)
+		filter.ApplyJobID = &applyJobID
+	}
+	return filter, nil
+}
+
+// feederRequestFilter checks access and reads the filter of an export. Prodi
+// staff only report their own program studi.
+func feederRequestFilter(c *fiber.Ctx) (*feeder.Filter, error) {
+	if !middleware.IsAdmin(c) && !middleware.HasRole(c, 6) {
+		return nil, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	filter, err := feederFilter(c)
+	if err != nil {
+		return nil, c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !middleware.IsAdmin(c) {
+		prodiID := uint(0)
+		if own := staffProdiID(c); own != nil {
+			prodiID = *own
+		}
+		filter.ProdiID = &prodiID
+	}
+	return &filter, nil
+}
+
+func buildFeederBatch(c *fiber.Ctx) (*feeder.Batch, error) {
+	filter, err := feederRequestFilter(c)
+	if filter == nil {
+		return nil, err
+	}
+	batch, err := feeder.Build(database.DB, *filter, feederOptions())
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": "Failed to build the export"})
+	}
+	return &batch, nil
+}
+
+// feederSynced returns the applications already sent to the Feeder
+func feederSynced() map[uint]models.FeederSync {
+	var syncs []models.FeederSync
+	database.DB.Where("status = ?", models.FeederSyncSent).Find(&syncs)
+	synced := map[uint]models.FeederSync{}
+	for _, s := range syncs {
+		synced[s.ApplyJobID] = s
+	}
+	return synced
+}
+
+// ValidateFeederExport lists the placements ready to be reported to PDDikti
+// and the data missing for the others (lecturer NIDN, course codes, ...)
+func ValidateFeederExport(c *fiber.Ctx) error {
+	batch, err := buildFeederBatch(c)
+	if batch == nil {
+		return err
+	}
+
+	synced := feederSynced()
+	ready := make([]fiber.Map, 0, len(batch.Activities))
+	for _, a := range batch.Activities {
+		_, sent := synced[a.ApplyJobID]
+		ready = append(ready, fiber.Map{
+			"apply_job_id": a.ApplyJobID,
+			"semester":     a.Semester,
+			"judul":        a.Judul,
+			"participants": len(a.Participants),
+			"grades":       len(a.Grades),
+			"sent":         sent,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": fiber.Map{
+			"ready":  ready,
+			"issues": batch.Issues,
+		},
+		"valid": len(batch.Issues) == 0,
+	})
+}
+
+// ExportFeeder downloads the records that would be sent to the Feeder as a
+// JSON file, without sending anything (dry run)
+func ExportFeeder(c *fiber.Ctx) error {
+	batch, err := buildFeederBatch(c)
+	if batch == nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(batch, "", "  ")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to build the export"})
+	}
+	name := "feeder-mbkm.json"
+	if batch.Semester != "" {
+		name = fmt.Sprintf("feeder-mbkm-%s.json", batch.Semester)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, name))
+	return c.Send(output)
+}
+
+// PushFeeder queues sending the ready placements to the configured Feeder.
+// Placements already sent are skipped unless resend=true, which deletes and
+// sends them again. Every attempt is recorded in feeder_syncs. Returns 202
+// with the queue job, whose result lists what was sent.
+func PushFeeder(c *fiber.Ctx) error {
+	filter, err := feederRequestFilter(c)
+	if filter == nil {
+		return err
+	}
+	if _, err := feeder.NewClient(config.AppConfig.FeederURL, config.AppConfig.FeederUsername, config.AppConfig.FeederPassword); err != nil {
+		return c.Status(503).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return enqueueJob(c, jobPushFeeder, feederPush{Filter: *filter, Resend: c.QueryBool("resend")},
+		queue.Options{UniqueKey: jobPushFeeder})
+}
+
+// feederPush is the payload of a Feeder push job
+type feederPush struct {
+	Filter feeder.Filter `json:"filter"`
+	Resend bool          `json:"resend"`
+}
+
+// pushFeederJob sends the placements of a Feeder push
+func pushFeederJob(ctx context.Context, job *queue.Job) error {
+	var input feederPush
+	if err := job.Decode(&input); err != nil {
+		return err
+	}
+	batch, err := feeder.Build(database.DB, input.Filter, feederOptions())
+	if err != nil {
+		return err
+	}
+	for _, issue := range batch.Issues {
+		if issue.ApplyJobID == 0 {
+			return queue.Permanent(errors.New(issue.Message))
+		}
+	}
+
+	client, err := feeder.NewClient(config.AppConfig.FeederURL, config.AppConfig.FeederUsername, config.AppConfig.FeederPassword)
+	if err != nil {
+		return queue.Permanent(err)
+	}
+
+	synced := feederSynced()
+	results := make([]models.FeederSync, 0, len(batch.Activities))
+	skipped := []uint{}
+	for i, activity := range batch.Activities {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		job.SetProgress(i*100/len(batch.Activities), fmt.Sprintf("%d of %d placements", i, len(batch.Activities)))
+
+		previous, sent := synced[activity.ApplyJobID]
+		if sent && !input.Resend {
+			skipped = append(skipped, activity.ApplyJobID)
+			continue
+		}
+
+		now := time.Now()
+		sync := models.FeederSync{
+			ApplyJobID: activity.ApplyJobID,
+			Semester:   activity.Semester,
+			Status:     models.FeederSyncSent,
+			PushedByID: job.CreatedByID,
+			PushedAt:   &now,
+		}
+		var pushErr error
+		if sent && previous.IDAktivitas != "" {
+			// Keep the old ID while it is still in the Feeder
+			sync.IDAktivitas = previous.IDAktivitas
+			pushErr = client.Delete(ctx, previous.IDAktivitas)
+		}
+		if pushErr == nil {
+			sync.IDAktivitas, pushErr = client.Push(ctx, activity)
+		}
+		if pushErr != nil {
+			message := pushErr.Error()
+			sync.Status = models.FeederSyncFailed
+			sync.Error = &message
+		}
+
+		var existing models.FeederSync
+		if err := database.DB.Where("apply_job_id = ?", activity.ApplyJobID).First(&existing).Error; err == nil {
+			sync.ID = existing.ID
+			sync.CreatedAt = existing.CreatedAt
+		}
+		database.DB.Save(&sync)
+		results = append(results, sync)
+	}
+
+	job.SetResult(fiber.Map{
+		"data":    results,
+		"skipped": skipped,
+		"issues":  batch.Issues,
+	})
+	return nil
+}
+
+// GetFeederSyncs lists what was sent to the Feeder (status, semester,
+// apply_job_id)
+func GetFeederSyncs(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) && !middleware.HasRole(c, 6) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	query := database.DB.Model(&models.FeederSync{}).Scopes(scopeByApplyJob(c, "apply_job_id")).Preload("PushedBy")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if semester := c.Query("semester"); semester != "" {
+		query = query.Where("semester = ?", semester)
+	}
+	if applyJobID := c.Query("apply_job_id"); applyJobID != "" {
+		query = query.Where("apply_job_id = ?", applyJobID)
+	}
+
+	var syncs []models.FeederSync
+	if err := query.Order("pushed_at DESC").Find(&syncs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+	return c.JSON(fiber.Map{"data": syncs, "count": len(syncs)})
+}
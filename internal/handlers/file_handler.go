@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/url"
+	"path"
+
+	"mbkm-go/internal/storage"
+	"mbkm-go/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DownloadFile streams a stored file addressed by a signed URL. Access to the
+// owning record is checked when the URL is issued, so the signature is all
+// that is verified here.
+func DownloadFile(c *fiber.Ctx) error {
+	key, err := url.PathUnescape(c.Params("*"))
+	if err != nil || key == "" {
+		return utils.NotFoundError(c, "File not found")
+	}
+
+	if !storage.Verify(key, c.Query("expires"), c.Query("signature")) {
+		return utils.ForbiddenError(c, "Invalid or expired link")
+	}
+
+	reader, err := storage.Default.Get(c.UserContext(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return utils.NotFoundError(c, "File not found")
+	}
+	if err != nil {
+		return utils.InternalServerError(c, "Failed to read file")
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = fiber.MIMEOctetStream
+	}
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, "private, max-age=300")
+
+	return c.SendStream(reader)
+}
@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mbkm-go/config"
+	"mbkm-go/database"
+	"mbkm-go/internal/grading"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// --- Grade Appeal Handlers ---
+
+// appealComponents maps an appealable component to the evaluation columns
+// holding its score and letter
+var appealComponents = map[string]string{
+	models.RubricRoleCompany:  "company_grade",
+	models.RubricRoleLecturer: "lecturer_grade",
+	models.RubricRoleExaminer: "examiner_grade",
+}
+
+func componentScore(e *models.Evaluation, component string) float64 {
+	switch component {
+	case models.RubricRoleCompany:
+		return e.CompanyGradeScore
+	case models.RubricRoleLecturer:
+		return e.LecturerGradeScore
+	case models.RubricRoleExaminer:
+		return e.ExaminerGradeScore
+	}
+	return 0
+}
+
+// componentEvaluator returns who graded a component, falling back to the
+// lecturer assigned to the application
+func componentEvaluator(e *models.Evaluation, component string) *uint {
+	switch component {
+	case models.RubricRoleCompany:
+		return e.CompanyPersonnelID
+	case models.RubricRoleLecturer:
+		if e.LecturerID == nil && e.ApplyJob != nil {
+			return e.ApplyJob.ResponsibleLecturerID
+		}
+		return e.LecturerID
+	case models.RubricRoleExaminer:
+		if e.ExaminerID == nil && e.ApplyJob != nil {
+			return e.ApplyJob.ExaminerLecturerID
+		}
+		return e.ExaminerID
+	}
+	return nil
+}
+
+// FileGradeAppeal lets a student appeal one component of their published
+// grade (route param "id" is the apply_job_id) within APPEAL_WINDOW of
+// publication
+func FileGradeAppeal(c *fiber.Ctx) error {
+	userID := middleware.GetCurrentUserID(c)
+
+	var evaluation models.Evaluation
+	if err := database.DB.Preload("ApplyJob.Users").Where("apply_job_id = ?", c.Params("id")).First(&evaluation).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Evaluation not found"})
+	}
+
+	isStudent := false
+	for _, u := range evaluation.ApplyJob.Users {
+		if u.ID == userID {
+			isStudent = true
+		}
+	}
+	if !isStudent {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the student of this application can appeal"})
+	}
+	if !gradePublished(&evaluation) {
+		return c.Status(409).JSON(fiber.Map{"error": "The grade has not been published"})
+	}
+	if deadline := evaluation.PublishedAt.Add(config.AppConfig.AppealWindow); time.Now().After(deadline) {
+		return c.Status(409).JSON(fiber.Map{"error": "The appeal period ended on " + deadline.Format("2006-01-02 15:04")})
+	}
+
+	var input struct {
+		Component string `json:"component"`
+		Reason    string `json:"reason"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !isRubricRole(input.Component) {
+		return c.Status(422).JSON(fiber.Map{"error": "Component must be company, lecturer or examiner"})
+	}
+	if strings.TrimSpace(input.Reason) == "" {
+		return c.Status(422).JSON(fiber.Map{"error": "Reason is required"})
+	}
+
+	var open int64
+	database.DB.Model(&models.GradeAppeal{}).
+		Where("evaluation_id = ? AND component = ? AND status IN ?", evaluation.ID, input.Component,
+			[]string{models.AppealStatusSubmitted, models.AppealStatusRouted}).
+		Count(&open)
+	if open > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "An appeal on this component is already open"})
+	}
+
+	appeal := models.GradeAppeal{
+		EvaluationID:  evaluation.ID,
+		StudentID:     userID,
+		Component:     input.Component,
+		Reason:        strings.TrimSpace(input.Reason),
+		Status:        models.AppealStatusSubmitted,
+		PreviousScore: componentScore(&evaluation, input.Component),
+	}
+	if err := database.DB.Create(&appeal).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	logEvaluation(database.DB, c, &evaluation, models.EvaluationLogAppeal, input.Component+": "+appeal.Reason)
+
+	return c.Status(201).JSON(fiber.Map{"data": appeal})
+}
+
+// GetGradeAppeals lists appeals: everything for admin and prodi, the appeals
+// routed to them for evaluators and their own for students. Filterable by
+// status and apply_job_id.
+func GetGradeAppeals(c *fiber.Ctx) error {
+	userID := middleware.GetCurrentUserID(c)
+	query := database.DB.Model(&models.GradeAppeal{}).
+		Preload("Evaluation.ApplyJob.Users").
+		Preload("Student").
+		Preload("Evaluator")
+
+	switch {
+	case middleware.IsAdmin(c):
+	case middleware.HasRole(c, 6):
+		query = query.Where("evaluation_id IN (?)", database.DB.Model(&models.Evaluation{}).
+			Select("id").Scopes(scopeByApplyJob(c, "apply_job_id")))
+	default:
+		query = query.Where("evaluator_id = ? OR student_id = ?", userID, userID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if applyJobID := c.Query("apply_job_id"); applyJobID != "" {
+		query = query.Where("evaluation_id IN (?)", database.DB.Model(&models.Evaluation{}).
+			Select("id").Where("apply_job_id = ?", applyJobID))
+	}
+
+	var appeals []models.GradeAppeal
+	if err := query.Order("created_at DESC").Find(&appeals).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  appeals,
+		"count": len(appeals),
+	})
+}
+
+func findGradeAppeal(c *fiber.Ctx) (*models.GradeAppeal, error) {
+	var appeal models.GradeAppeal
+	if err := database.DB.Preload("Evaluation.ApplyJob.Users").First(&appeal, c.Params("id")).Error; err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Appeal not found"})
+	}
+	if appeal.Evaluation == nil {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Evaluation not found"})
+	}
+	if !canAccessApplyJob(c, appeal.Evaluation.ApplyJobID) {
+		return nil, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	return &appeal, nil
+}
+
+// RouteGradeAppeal sends a submitted appeal to the evaluator of the appealed
+// component (prodi and admin)
+func RouteGradeAppeal(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) && !middleware.HasRole(c, 6) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	appeal, err := findGradeAppeal(c)
+	if appeal == nil {
+		return err
+	}
+	if appeal.Status != models.AppealStatusSubmitted {
+		return c.Status(409).JSON(fiber.Map{"error": "Only submitted appeals can be routed"})
+	}
+
+	evaluatorID := componentEvaluator(appeal.Evaluation, appeal.Component)
+	if evaluatorID == nil {
+		return c.Status(422).JSON(fiber.Map{"error": "No evaluator is recorded for the " + appeal.Component + " grade"})
+	}
+
+	now := time.Now()
+	userID := middleware.GetCurrentUserID(c)
+	database.DB.Model(appeal).Updates(map[string]interface{}{
+		"status":       models.AppealStatusRouted,
+		"routed_by_id": userID,
+		"routed_at":    &now,
+		"evaluator_id": *evaluatorID,
+	})
+	database.DB.Preload("Evaluator").First(appeal, appeal.ID)
+
+	return c.JSON(fiber.Map{"data": appeal})
+}
+
+// DecideGradeAppeal lets the evaluator an appeal was routed to revise the
+// component score (decision "revise" with score) or uphold it (decision
+// "uphold"), always with a justification. A revision recomputes the final
+// grade on the scale the evaluation was finalized with, revokes the documents
+// issued with the old grade and generates the konversi nilai again.
+func DecideGradeAppeal(c *fiber.Ctx) error {
+	appeal, err := findGradeAppeal(c)
+	if appeal == nil {
+		return err
+	}
+	if appeal.Status != models.AppealStatusRouted {
+		return c.Status(409).JSON(fiber.Map{"error": "Only routed appeals can be decided"})
+	}
+	userID := middleware.GetCurrentUserID(c)
+	if appeal.EvaluatorID == nil || *appeal.EvaluatorID != userID {
+		return c.Status(403).JSON(fiber.Map{"error": "This appeal is routed to another evaluator"})
+	}
+
+	var input struct {
+		Decision      string   `json:"decision"`
+		Score         *float64 `json:"score"`
+		Justification string   `json:"justification"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if strings.TrimSpace(input.Justification) == "" {
+		return c.Status(422).JSON(fiber.Map{"error": "Justification is required"})
+	}
+
+	evaluation := appeal.Evaluation
+	now := time.Now()
+	updates := map[string]interface{}{
+		"justification": strings.TrimSpace(input.Justification),
+		"decided_at":    &now,
+	}
+	reason := appeal.Component + ": " + strings.TrimSpace(input.Justification)
+
+	switch input.Decision {
+	case "uphold":
+		updates["status"] = models.AppealStatusUpheld
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(appeal).Updates(updates).Error; err != nil {
+				return err
+			}
+			return logEvaluation(tx, c, evaluation, models.EvaluationLogAppealUpheld, reason)
+		})
+
+	case "revise":
+		if input.Score == nil || *input.Score < 0 || *input.Score > 100 {
+			return c.Status(422).JSON(fiber.Map{"error": "A score between 0 and 100 is required to revise"})
+		}
+		bands := evaluationBands(evaluation)
+		switch appeal.Component {
+		case models.RubricRoleCompany:
+			evaluation.CompanyGradeScore = *input.Score
+		case models.RubricRoleLecturer:
+			evaluation.LecturerGradeScore = *input.Score
+		case models.RubricRoleExaminer:
+			evaluation.ExaminerGradeScore = *input.Score
+		}
+		result := grading.Final(*evaluation, evaluationBobot(evaluation), bands)
+		if result == nil {
+			return c.Status(422).JSON(fiber.Map{"error": "Grade weights (bobot nilai) are not set"})
+		}
+		evaluation.Grade = result.Grade
+		evaluation.FinalScore = result.TotalScore
+		evaluation.GradePoint = result.GradePoint
+
+		// The documents printed with the old grade no longer hold, and the
+		// converted course grades follow the new one
+		column := appealComponents[appeal.Component]
+		updates["status"] = models.AppealStatusRevised
+		updates["revised_score"] = *input.Score
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			err := tx.Model(evaluation).Updates(map[string]interface{}{
+				column + "_score": *input.Score,
+				column:            grading.Grade(bands, *input.Score).Letter,
+				"grade":           result.Grade,
+				"final_score":     result.TotalScore,
+				"grade_point":     result.GradePoint,
+			}).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(appeal).Updates(updates).Error; err != nil {
+				return err
+			}
+			if err := logEvaluation(tx, c, evaluation, models.EvaluationLogAppealRevised,
+				fmt.Sprintf("%s (%g -> %g)", reason, appeal.PreviousScore, *input.Score)); err != nil {
+				return err
+			}
+			if err := revokeDocuments(tx, c, evaluation.ApplyJobID, "Banding nilai direvisi: "+reason); err != nil {
+				return err
+			}
+			return regenerateKonversiNilai(tx, evaluation)
+		})
+
+	default:
+		return c.Status(422).JSON(fiber.Map{"error": "Decision must be revise or uphold"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save the decision"})
+	}
+
+	database.DB.First(appeal, appeal.ID)
+	return c.JSON(fiber.Map{"data": appeal, "evaluation": evaluation})
+}
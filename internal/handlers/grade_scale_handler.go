@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"strings"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/grading"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// --- Grade Scale Handlers ---
+
+func preloadBands(db *gorm.DB) *gorm.DB {
+	return db.Order("min_score DESC")
+}
+
+// GetGradeScales lists stored scales, filterable by id_program_studi,
+// together with the built-in default
+func GetGradeScales(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.GradeScale{}).Preload("Bands", preloadBands).Preload("ProgramStudi")
+	if prodiID := c.Query("id_program_studi"); prodiID != "" {
+		query = query.Where("id_program_studi = ?", prodiID)
+	}
+
+	var scales []models.GradeScale
+	if err := query.Order("id ASC").Find(&scales).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":    scales,
+		"count":   len(scales),
+		"default": grading.Default(),
+	})
+}
+
+func GetGradeScale(c *fiber.Ctx) error {
+	var scale models.GradeScale
+	if err := database.DB.Preload("Bands", preloadBands).Preload("ProgramStudi").First(&scale, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+	return c.JSON(fiber.Map{"data": scale})
+}
+
+type gradeScaleInput struct {
+	Name           string             `json:"name"`
+	IDProgramStudi *uint              `json:"id_program_studi"`
+	Bands          []models.GradeBand `json:"bands"`
+}
+
+// validate checks the bands and that no other scale covers the same
+// program studi
+func (in gradeScaleInput) validate(id uint) string {
+	if strings.TrimSpace(in.Name) == "" {
+		return "Name is required"
+	}
+	if err := grading.Validate(in.Bands); err != nil {
+		return "Invalid bands: " + err.Error()
+	}
+
+	query := database.DB.Model(&models.GradeScale{}).Where("id <> ?", id)
+	if in.IDProgramStudi != nil {
+		query = query.Where("id_program_studi = ?", *in.IDProgramStudi)
+	} else {
+		query = query.Where("id_program_studi IS NULL")
+	}
+	var count int64
+	query.Count(&count)
+	if count > 0 {
+		return "A grade scale for this program studi already exists"
+	}
+	return ""
+}
+
+func (in gradeScaleInput) bands() []models.GradeBand {
+	bands := make([]models.GradeBand, len(in.Bands))
+	for i, band := range in.Bands {
+		bands[i] = models.GradeBand{
+			Letter:     strings.ToUpper(strings.TrimSpace(band.Letter)),
+			MinScore:   band.MinScore,
+			GradePoint: band.GradePoint,
+		}
+	}
+	return bands
+}
+
+func CreateGradeScale(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var input gradeScaleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if msg := input.validate(0); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+
+	scale := models.GradeScale{
+		Name:           strings.TrimSpace(input.Name),
+		IDProgramStudi: input.IDProgramStudi,
+		Bands:          input.bands(),
+	}
+	if err := database.DB.Create(&scale).Error; err != nil {
+		// A scale for the same program studi created in the meantime
+		if msg := input.validate(0); msg != "" {
+			return c.Status(422).JSON(fiber.Map{"error": msg})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(fiber.Map{"data": scale})
+}
+
+// UpdateGradeScale replaces the bands of a scale. Finalized evaluations keep
+// the snapshot they were graded with.
+func UpdateGradeScale(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var scale models.GradeScale
+	if err := database.DB.First(&scale, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+
+	var input gradeScaleInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if msg := input.validate(scale.ID); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("grade_scale_id = ?", scale.ID).Delete(&models.GradeBand{}).Error; err != nil {
+			return err
+		}
+		scale.Name = strings.TrimSpace(input.Name)
+		scale.IDProgramStudi = input.IDProgramStudi
+		scale.Bands = input.bands()
+		return tx.Save(&scale).Error
+	})
+	if err != nil {
+		if msg := input.validate(scale.ID); msg != "" {
+			return c.Status(422).JSON(fiber.Map{"error": msg})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	database.DB.Preload("Bands", preloadBands).First(&scale, scale.ID)
+	return c.JSON(fiber.Map{"data": scale})
+}
+
+func DeleteGradeScale(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("grade_scale_id = ?", c.Params("id")).Delete(&models.GradeBand{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.GradeScale{}, c.Params("id")).Error
+	})
+	return c.SendStatus(204)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"mbkm-go/config"
+	"mbkm-go/database"
+	"mbkm-go/internal/media"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+	"mbkm-go/pkg/imaging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// imageRules returns the upload rules for images, with a custom minimum size
+func imageRules(minWidth, minHeight int) imaging.Rules {
+	return imaging.Rules{
+		MaxBytes:  config.AppConfig.MaxImageSize,
+		MinWidth:  minWidth,
+		MinHeight: minHeight,
+		MaxWidth:  config.AppConfig.MaxImageWidth,
+		MaxHeight: config.AppConfig.MaxImageHeight,
+	}
+}
+
+// readUpload reads the file uploaded in the given form field, up to maxBytes
+func readUpload(c *fiber.Ctx, field string, maxBytes int64) ([]byte, string, error) {
+	fileHeader, err := c.FormFile(field)
+	if err != nil {
+		return nil, "", errors.New("File is required")
+	}
+	return readFileHeader(fileHeader, maxBytes)
+}
+
+// readFileHeader reads one uploaded file, up to maxBytes
+func readFileHeader(fileHeader *multipart.FileHeader, maxBytes int64) ([]byte, string, error) {
+	if maxBytes > 0 && fileHeader.Size > maxBytes {
+		return nil, "", imaging.ErrTooLarge
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		return nil, "", errors.New("Failed to open file")
+	}
+	defer f.Close()
+
+	var reader io.Reader = f
+	if maxBytes > 0 {
+		reader = io.LimitReader(f, maxBytes+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", errors.New("Failed to read file")
+	}
+	return data, fileHeader.Filename, nil
+}
+
+// storeImageUpload validates the image uploaded in the given form field and
+// stores it, together with its resized variants, as the only file in the
+// model's media collection
+func storeImageUpload(c *fiber.Ctx, field, modelType string, modelID uint, collection string, rules imaging.Rules) (*models.Media, error) {
+	data, filename, err := readUpload(c, field, rules.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType, err := imaging.Validate(data, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	conversions := map[string]media.Conversion{}
+	for _, variant := range imaging.DefaultVariants {
+		resized, resizedMime, err := imaging.Resize(data, variant)
+		if err != nil {
+			return nil, err
+		}
+		conversions[variant.Name] = media.Conversion{Data: resized, MimeType: resizedMime}
+	}
+
+	userID := middleware.GetCurrentUserID(c)
+	return media.Replace(c.UserContext(), database.DB, modelType, modelID, collection, media.Upload{
+		Data:         data,
+		FileName:     strings.TrimSuffix(filename, path.Ext(filename)) + imaging.Extension(mimeType),
+		MimeType:     mimeType,
+		UploadedByID: &userID,
+		Conversions:  conversions,
+	})
+}
+
+// imageURLs returns the signed URLs of an image and of its resized variants
+func imageURLs(m *models.Media) (*string, map[string]string) {
+	if m == nil {
+		return nil, nil
+	}
+	url := m.URL
+	return &url, m.ConversionURLs
+}
+
+// latestMedia returns the most recent media of a model from a grouped list
+func latestMedia(grouped map[uint][]models.Media, modelID uint) *models.Media {
+	list := grouped[modelID]
+	if len(list) == 0 {
+		return nil
+	}
+	return &list[len(list)-1]
+}
+
+// removeMedia deletes every file attached to a model
+func removeMedia(c *fiber.Ctx, modelType string, modelID uint) {
+	media.DeleteAll(c.UserContext(), database.DB, modelType, modelID)
+}
+
+// documentTypes are the file types accepted for documents and attachments
+var documentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+}
+
+const maxDocumentSize = 5 << 20
+
+// readDocumentUpload reads a PDF or image uploaded in the given form field,
+// checking its type by content
+func readDocumentUpload(c *fiber.Ctx, field string) (media.Upload, error) {
+	fileHeader, err := c.FormFile(field)
+	if err != nil {
+		return media.Upload{}, errors.New("File is required")
+	}
+	return documentUpload(c, fileHeader)
+}
+
+// documentUpload reads and checks one uploaded document
+func documentUpload(c *fiber.Ctx, fileHeader *multipart.FileHeader) (media.Upload, error) {
+	data, filename, err := readFileHeader(fileHeader, maxDocumentSize)
+	if err != nil {
+		return media.Upload{}, err
+	}
+	if int64(len(data)) > maxDocumentSize {
+		return media.Upload{}, imaging.ErrTooLarge
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !documentTypes[mimeType] {
+		return media.Upload{}, errors.New("File must be a PDF, JPEG or PNG")
+	}
+
+	userID := middleware.GetCurrentUserID(c)
+	return media.Upload{
+		Data:         data,
+		FileName:     filename,
+		MimeType:     mimeType,
+		UploadedByID: &userID,
+	}, nil
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"mbkm-go/config"
+	"mbkm-go/database"
+	"mbkm-go/internal/documents"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// --- Issued Documents & Verification ---
+
+// documentNumberCodes is the part of the document number naming each kind,
+// e.g. 00012/MBKM-TRANSKRIP/2024
+var documentNumberCodes = map[string]string{
+	models.IssuedDocumentTranscript:    "MBKM-TRANSKRIP",
+	models.IssuedDocumentCertificate:   "MBKM-SERTIFIKAT",
+	models.IssuedDocumentPartnerLetter: "MBKM-APRESIASI",
+	models.LetterTypeSuratPengantar:    "MBKM-PENGANTAR",
+	models.LetterTypeSuratRekomendasi:  "MBKM-REKOMENDASI",
+}
+
+// documentVerifyURL is the public address a document's QR code points to
+func documentVerifyURL(code string) string {
+	return config.AppConfig.AppURL + "/api/v1/verify/" + code
+}
+
+// documentHash fingerprints what a document states: its summary and the
+// content printed on it
+func documentHash(draft models.IssuedDocument, content interface{}) (string, error) {
+	body, err := json.Marshal(struct {
+		Summary models.DocumentSummary `json:"summary"`
+		Content interface{}            `json:"content"`
+	}{draft.Summary, content})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// validDocument returns the valid document of a kind and subject, or nil
+func validDocument(db *gorm.DB, kind, subject string) (*models.IssuedDocument, error) {
+	var current models.IssuedDocument
+	err := db.Where("kind = ? AND subject = ? AND revoked_at IS NULL", kind, subject).
+		Order("issued_at DESC").First(&current).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &current, nil
+}
+
+// findIssuedDocument returns the valid document of the draft's kind and
+// subject when it still states the given content, or nil when the document
+// has to be issued (again) first
+func findIssuedDocument(draft models.IssuedDocument, content interface{}) (*models.IssuedDocument, error) {
+	hash, err := documentHash(draft, content)
+	if err != nil {
+		return nil, err
+	}
+	current, err := validDocument(database.DB, draft.Kind, draft.Subject)
+	if err != nil || current == nil || current.ContentHash != hash {
+		return nil, err
+	}
+	return current, nil
+}
+
+// documentNumberLock is the advisory lock serializing the numbering of a
+// document kind
+func documentNumberLock(kind string) int32 {
+	h := fnv.New32a()
+	h.Write([]byte(kind))
+	return int32(h.Sum32())
+}
+
+// issueDocument returns the valid document of the draft's kind and subject,
+// issuing a new number and verification code only when the summary or
+// content changed since the last one. The document it replaces is revoked as
+// superseded. Issuing holds a lock per kind and year, so concurrent
+// issuances never get the same number.
+func issueDocument(issuedByID uint, draft models.IssuedDocument, content interface{}) (*models.IssuedDocument, error) {
+	hash, err := documentHash(draft, content)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	document := draft
+	document.Year = now.Year()
+	document.Code = strings.ReplaceAll(uuid.New().String(), "-", "")
+	document.ContentHash = hash
+	document.IssuedByID = issuedByID
+	document.IssuedAt = now
+
+	var unchanged *models.IssuedDocument
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", documentNumberLock(document.Kind), document.Year).Error; err != nil {
+			return err
+		}
+
+		current, err := validDocument(tx, document.Kind, document.Subject)
+		if err != nil {
+			return err
+		}
+		if current != nil && current.ContentHash == hash {
+			unchanged = current
+			return nil
+		}
+
+		var last int
+		err = tx.Model(&models.IssuedDocument{}).Where("kind = ? AND year = ?", document.Kind, document.Year).
+			Select("COALESCE(MAX(sequence), 0)").Scan(&last).Error
+		if err != nil {
+			return err
+		}
+		document.Sequence = last + 1
+		document.Number = fmt.Sprintf("%05d/%s/%d", document.Sequence, documentNumberCodes[document.Kind], document.Year)
+		if err := tx.Create(&document).Error; err != nil {
+			return err
+		}
+
+		if current != nil {
+			return tx.Model(current).Updates(map[string]interface{}{
+				"revoked_at":    &now,
+				"revoked_by_id": issuedByID,
+				"revoke_reason": "Digantikan oleh dokumen " + document.Number,
+			}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unchanged != nil {
+		return unchanged, nil
+	}
+	return &document, nil
+}
+
+// revokeDocuments revokes every valid document issued for an application,
+// e.g. when its grade is reopened or revised
+func revokeDocuments(db *gorm.DB, c *fiber.Ctx, applyJobID uint, reason string) error {
+	now := time.Now()
+	return db.Model(&models.IssuedDocument{}).
+		Where("apply_job_id = ? AND revoked_at IS NULL", applyJobID).
+		Updates(map[string]interface{}{
+			"revoked_at":    &now,
+			"revoked_by_id": middleware.GetCurrentUserID(c),
+			"revoke_reason": reason,
+		}).Error
+}
+
+// findPlacement loads an application with everything printed about its
+// placement: students, jobs and lecturers
+func findPlacement(id interface{}) (*models.ApplyJob, error) {
+	var applyJob models.ApplyJob
+	err := database.DB.Preload("Users.ProgramStudi.Fakultas").
+		Preload("Jobs").
+		Preload("ResponsibleLecturer").
+		Preload("ExaminerLecturer").
+		First(&applyJob, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &applyJob, nil
+}
+
+// placementReport returns the report of an application, or nil
+func placementReport(applyJobID uint) *models.Report {
+	var report models.Report
+	if err := database.DB.Where("apply_job_id = ?", applyJobID).First(&report).Error; err != nil {
+		return nil
+	}
+	return &report
+}
+
+// placementTranscript loads the transcript of an application (route param
+// "id" is the apply_job_id) for the current user, with the document it is
+// issued as. Students get it once their grade is published. A nil
+// application means the response was sent.
+func placementTranscript(c *fiber.Ctx) (*models.ApplyJob, *documents.TranscriptData, models.IssuedDocument, error) {
+	var draft models.IssuedDocument
+	applyJob, err := findPlacement(c.Params("id"))
+	if err != nil {
+		return nil, nil, draft, c.Status(404).JSON(fiber.Map{"error": "Apply Job not found"})
+	}
+	if !canAccessApplyJob(c, applyJob.ID) {
+		return nil, nil, draft, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var evaluation models.Evaluation
+	if err := database.DB.Where("apply_job_id = ?", applyJob.ID).First(&evaluation).Error; err != nil {
+		return nil, nil, draft, c.Status(404).JSON(fiber.Map{"error": "Evaluation not found"})
+	}
+	if evaluation.FinalizedAt == nil {
+		return nil, nil, draft, c.Status(409).JSON(fiber.Map{"error": "The evaluation must be finalized first"})
+	}
+	if !seesUnpublishedGrades(c) && !gradePublished(&evaluation) {
+		return nil, nil, draft, c.Status(409).JSON(fiber.Map{"error": "The grade has not been published"})
+	}
+
+	var konversi []models.KonversiNilai
+	database.DB.Preload("MataKuliah").Where("apply_job_id = ?", applyJob.ID).Order("id ASC").Find(&konversi)
+	if len(konversi) == 0 {
+		return nil, nil, draft, c.Status(409).JSON(fiber.Map{"error": "No konversi nilai has been recorded for this application"})
+	}
+
+	data := documents.NewTranscriptData(applyJob, &evaluation, konversi, placementReport(applyJob.ID))
+	draft = models.IssuedDocument{
+		Kind:       models.IssuedDocumentTranscript,
+		Subject:    fmt.Sprintf("apply_job:%d", applyJob.ID),
+		ApplyJobID: &applyJob.ID,
+		Summary: models.DocumentSummary{
+			"student_name":  data.StudentName,
+			"nim":           data.NIM,
+			"program_studi": data.ProgramStudi,
+			"company":       data.Company,
+			"total_sks":     data.TotalSks,
+			"gpa":           data.GPA,
+			"final_grade":   data.FinalGrade,
+		},
+	}
+	return applyJob, &data, draft, nil
+}
+
+// IssueTranscript issues the konversi nilai transcript of an application,
+// or returns the one already issued while its content is unchanged
+func IssueTranscript(c *fiber.Ctx) error {
+	applyJob, data, draft, err := placementTranscript(c)
+	if applyJob == nil {
+		return err
+	}
+	document, err := issueDocument(middleware.GetCurrentUserID(c), draft, data.Courses)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to issue the transcript"})
+	}
+	return c.JSON(fiber.Map{"data": document})
+}
+
+// ExportTranscriptPDF renders the issued konversi nilai transcript of an
+// application, stamped with its document number and a QR code for
+// verification. It has to be issued (again) with IssueTranscript when there
+// is none or its content changed.
+func ExportTranscriptPDF(c *fiber.Ctx) error {
+	applyJob, data, draft, err := placementTranscript(c)
+	if applyJob == nil {
+		return err
+	}
+	document, err := findIssuedDocument(draft, data.Courses)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to load the transcript"})
+	}
+	if document == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "The transcript has not been issued for its current content; issue it first"})
+	}
+	data.Issue(document.Number, document.IssuedAt, documentVerifyURL(document.Code))
+
+	tpl := documents.Template(database.DB, models.DocumentTemplateTranscript, firstProdiID(applyJob), placementProgramType(applyJob))
+	output := documents.RenderTranscript(tpl, *data)
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="transkrip-%d.pdf"`, applyJob.ID))
+	return c.Send(output)
+}
+
+// VerifyDocument is the public page behind a document's QR code. It confirms
+// the document was issued here and shows its summary, or reports that it was
+// revoked.
+func VerifyDocument(c *fiber.Ctx) error {
+	var document models.IssuedDocument
+	if err := database.DB.Where("code = ?", c.Params("code")).First(&document).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"valid": false, "error": "Document not found"})
+	}
+
+	result := fiber.Map{
+		"valid":     document.RevokedAt == nil,
+		"status":    "valid",
+		"kind":      document.Kind,
+		"number":    document.Number,
+		"issued_at": document.IssuedAt,
+		"summary":   document.Summary,
+	}
+	if document.RevokedAt != nil {
+		result["status"] = "revoked"
+		result["revoked_at"] = document.RevokedAt
+		result["revoke_reason"] = document.RevokeReason
+	}
+	return c.JSON(result)
+}
+
+// GetIssuedDocuments lists issued documents (admin and prodi), filterable by
+// kind, apply_job_id, user_id, company_id, number and status (valid or
+// revoked)
+func GetIssuedDocuments(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) && !middleware.HasRole(c, 6) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	query := database.DB.Model(&models.IssuedDocument{}).Preload("IssuedBy").Preload("RevokedBy")
+	if !middleware.IsAdmin(c) {
+		// Prodi staff see the documents of their program's placements
+		query = query.Scopes(scopeByApplyJob(c, "apply_job_id"))
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if applyJobID := c.Query("apply_job_id"); applyJobID != "" {
+		query = query.Where("apply_job_id = ?", applyJobID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		query = query.Where("company_id = ?", companyID)
+	}
+	if number := c.Query("number"); number != "" {
+		query = query.Where("number = ?", number)
+	}
+	switch c.Query("status") {
+	case "valid":
+		query = query.Where("revoked_at IS NULL")
+	case "revoked":
+		query = query.Where("revoked_at IS NOT NULL")
+	}
+
+	var issued []models.IssuedDocument
+	if err := query.Order("issued_at DESC").Find(&issued).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+	return c.JSON(fiber.Map{"data": issued, "count": len(issued)})
+}
+
+// RevokeIssuedDocument revokes a document (admin and prodi, reason
+// required); verification reports it as revoked from then on
+func RevokeIssuedDocument(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) && !middleware.HasRole(c, 6) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var document models.IssuedDocument
+	if err := database.DB.First(&document, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Document not found"})
+	}
+	if !middleware.IsAdmin(c) && (document.ApplyJobID == nil || !canAccessApplyJob(c, *document.ApplyJobID)) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	if document.RevokedAt != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Document is already revoked"})
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	c.BodyParser(&input)
+	if strings.TrimSpace(input.Reason) == "" {
+		return c.Status(422).JSON(fiber.Map{"error": "A reason is required to revoke a document"})
+	}
+
+	now := time.Now()
+	userID := middleware.GetCurrentUserID(c)
+	database.DB.Model(&document).Updates(map[string]interface{}{
+		"revoked_at":    &now,
+		"revoked_by_id": userID,
+		"revoke_reason": strings.TrimSpace(input.Reason),
+	})
+
+	return c.JSON(fiber.Map{"data": document})
+}
@@ -1,15 +1,20 @@
 package handlers
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
+	"time"
 
 	"mbkm-go/database"
 	"mbkm-go/internal/dto"
+	"mbkm-go/internal/media"
 	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 	"mbkm-go/pkg/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type JobHandler struct{}
@@ -69,6 +74,7 @@ func (h *JobHandler) Index(c *fiber.Ctx) error {
 	var jobs []models.Job
 	offset := utils.GetSkipNumber(page, perPage)
 	query.Offset(offset).Limit(perPage).Order("updated_at DESC").Find(&jobs)
+	withJobImages(jobs)
 
 	return c.JSON(fiber.Map{
 		"data":  jobs,
@@ -84,9 +90,12 @@ func (h *JobHandler) Show(c *fiber.Ctx) error {
 	}
 
 	var job models.Job
-	if err := database.DB.Preload("CreatedBy").First(&job, id).Error; err != nil {
+	if err := database.DB.Preload("CreatedBy").
+		Preload("Courses.MataKuliah.ProgramStudi").
+		First(&job, id).Error; err != nil {
 		return utils.NotFoundError(c, "Job not found")
 	}
+	withJobImage(&job)
 
 	return c.JSON(fiber.Map{
 		"data": job,
@@ -127,6 +136,14 @@ func (h *JobHandler) Store(c *fiber.Ctx) error {
 		}
 	}
 
+	courses, errs, err := buildJobCourses(req.Courses)
+	if err != nil {
+		return utils.InternalServerError(c, "Failed to load mata kuliah")
+	}
+	if errs != nil {
+		return utils.ValidationError(c, errs)
+	}
+
 	job := models.Job{
 		Title:       req.Title,
 		Company:     req.Company,
@@ -142,13 +159,15 @@ func (h *JobHandler) Store(c *fiber.Ctx) error {
 		Status:      models.JobStatusPending,
 		CreatedByID: user.ID,
 		CompanyID:   companyID,
+		Courses:     courses,
 	}
 
 	if err := database.DB.Create(&job).Error; err != nil {
 		return utils.InternalServerError(c, "Failed to create job")
 	}
 
-	database.DB.Preload("CreatedBy").First(&job, job.ID)
+	database.DB.Preload("CreatedBy").Preload("Courses.MataKuliah").First(&job, job.ID)
+	withJobImage(&job)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"data": job,
@@ -166,6 +185,9 @@ func (h *JobHandler) Update(c *fiber.Ctx) error {
 	if err := database.DB.First(&job, id).Error; err != nil {
 		return utils.NotFoundError(c, "Job not found")
 	}
+	if !canEditJob(c, &job) {
+		return utils.ForbiddenError(c, "")
+	}
 
 	var req dto.JobRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -207,8 +229,69 @@ func (h *JobHandler) Update(c *fiber.Ctx) error {
 		updates["deadline"] = req.Deadline
 	}
 
-	database.DB.Model(&job).Updates(updates)
-	database.DB.Preload("CreatedBy").First(&job, job.ID)
+	if req.Courses != nil {
+		courses, errs, err := buildJobCourses(req.Courses)
+		if err != nil {
+			return utils.InternalServerError(c, "Failed to load mata kuliah")
+		}
+		if errs != nil {
+			return utils.ValidationError(c, errs)
+		}
+		updates["courses"] = courseChangeValue(courses)
+	}
+
+	database.DB.Preload("Courses").First(&job, job.ID)
+	changes := diffJob(&job, updates)
+	if len(changes) == 0 {
+		return c.JSON(fiber.Map{
+			"data": job,
+		})
+	}
+
+	user := middleware.GetCurrentUser(c)
+	revision := models.JobRevision{
+		JobID:       job.ID,
+		Status:      models.JobRevisionStatusPending,
+		Changes:     changes,
+		CreatedByID: user.ID,
+	}
+
+	// Published jobs edited by the company wait for CDC review
+	if job.Status == models.JobStatusAvailable && !middleware.IsAdmin(c) && !middleware.IsCDC(c) {
+		if hasPendingRevision(job.ID) {
+			return utils.ValidationError(c, map[string]string{
+				"job": "A previous revision of this job is still waiting for review",
+			})
+		}
+
+		if err := database.DB.Create(&revision).Error; err != nil {
+			return utils.InternalServerError(c, "Failed to create job revision")
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message":  "Perubahan menunggu persetujuan CDC",
+			"data":     job,
+			"revision": revision,
+		})
+	}
+
+	now := time.Now()
+	revision.Status = models.JobRevisionStatusApproved
+	revision.ReviewedByID = &user.ID
+	revision.ReviewedAt = &now
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyJobChanges(tx, &job, changes); err != nil {
+			return err
+		}
+		return tx.Create(&revision).Error
+	})
+	if err != nil {
+		return utils.InternalServerError(c, "Failed to update job")
+	}
+
+	database.DB.Preload("CreatedBy").Preload("Courses.MataKuliah").First(&job, job.ID)
+	withJobImage(&job)
 
 	return c.JSON(fiber.Map{
 		"data": job,
@@ -226,14 +309,112 @@ func (h *JobHandler) Destroy(c *fiber.Ctx) error {
 	if err := database.DB.First(&job, id).Error; err != nil {
 		return utils.NotFoundError(c, "Job not found")
 	}
+	if !canEditJob(c, &job) {
+		return utils.ForbiddenError(c, "")
+	}
 
 	database.DB.Delete(&job)
+	removeMedia(c, models.MediaModelJob, job.ID)
 
 	return c.JSON(fiber.Map{
 		"message": "Data berhasil dihapus",
 	})
 }
 
+// UploadImage stores the vacancy image of a job
+func (h *JobHandler) UploadImage(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return utils.NotFoundError(c, "Job not found")
+	}
+
+	var job models.Job
+	if err := database.DB.First(&job, id).Error; err != nil {
+		return utils.NotFoundError(c, "Job not found")
+	}
+
+	if !canEditJob(c, &job) {
+		return utils.ForbiddenError(c, "")
+	}
+	if job.Status == models.JobStatusAvailable && !middleware.IsAdmin(c) && !middleware.IsCDC(c) {
+		return h.proposeImage(c, &job)
+	}
+
+	image, err := storeImageUpload(c, "job_vacancy_image", models.MediaModelJob, job.ID, models.MediaCollectionJobVacancyImage, imageRules(200, 200))
+	if err != nil {
+		return utils.ValidationError(c, map[string]string{"job_vacancy_image": err.Error()})
+	}
+
+	job.JobVacancyImage, job.JobVacancyImageThumbnails = imageURLs(image)
+
+	return c.JSON(fiber.Map{
+		"data": job,
+	})
+}
+
+// proposeImage stores a new vacancy image of a published job on a pending
+// revision; it replaces the live image once CDC approves the revision
+func (h *JobHandler) proposeImage(c *fiber.Ctx, job *models.Job) error {
+	if hasPendingRevision(job.ID) {
+		return utils.ValidationError(c, map[string]string{
+			"job": "A previous revision of this job is still waiting for review",
+		})
+	}
+
+	revision := models.JobRevision{
+		JobID:       job.ID,
+		Status:      models.JobRevisionStatusPending,
+		CreatedByID: middleware.GetCurrentUserID(c),
+	}
+	if err := database.DB.Create(&revision).Error; err != nil {
+		return utils.InternalServerError(c, "Failed to create job revision")
+	}
+
+	image, err := storeImageUpload(c, "job_vacancy_image", models.MediaModelJobRevision, revision.ID, models.MediaCollectionJobVacancyImage, imageRules(200, 200))
+	if err != nil {
+		database.DB.Delete(&revision)
+		return utils.ValidationError(c, map[string]string{"job_vacancy_image": err.Error()})
+	}
+
+	var current interface{}
+	if live := media.First(database.DB, models.MediaModelJob, job.ID, models.MediaCollectionJobVacancyImage); live != nil {
+		current = live.ID
+	}
+	revision.Changes = models.JobFieldChanges{{Field: "job_vacancy_image", Old: current, New: image.ID}}
+	if err := database.DB.Model(&revision).Update("changes", revision.Changes).Error; err != nil {
+		removeMedia(c, models.MediaModelJobRevision, revision.ID)
+		database.DB.Delete(&revision)
+		return utils.InternalServerError(c, "Failed to create job revision")
+	}
+
+	withJobImage(job)
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":  "Perubahan menunggu persetujuan CDC",
+		"data":     job,
+		"revision": revision,
+		"image":    image,
+	})
+}
+
+// canEditJob reports whether the current user may change a job and see its
+// revisions: admin, CDC, the user who posted it and the account of its
+// company
+func canEditJob(c *fiber.Ctx, job *models.Job) bool {
+	if middleware.IsAdmin(c) || middleware.IsCDC(c) {
+		return true
+	}
+	userID := middleware.GetCurrentUserID(c)
+	if job.CreatedByID == userID {
+		return true
+	}
+	if job.CompanyID == nil || !middleware.IsCompany(c) {
+		return false
+	}
+	var count int64
+	database.DB.Model(&models.Company{}).Where("id = ? AND user_id = ?", *job.CompanyID, userID).Count(&count)
+	return count > 0
+}
+
 // Approve approves a pending job
 func (h *JobHandler) Approve(c *fiber.Ctx) error {
 	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
@@ -249,6 +430,7 @@ func (h *JobHandler) Approve(c *fiber.Ctx) error {
 	result := false
 	if job.Status == models.JobStatusPending {
 		job.Status = models.JobStatusAvailable
+		job.RejectionReason = nil
 		database.DB.Save(&job)
 		result = true
 	}
@@ -273,9 +455,15 @@ func (h *JobHandler) Reject(c *fiber.Ctx) error {
 		return utils.NotFoundError(c, "Job not found")
 	}
 
+	var req dto.RejectRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		return utils.ValidationError(c, map[string]string{"reason": "Rejection reason is required"})
+	}
+
 	result := false
 	if job.Status == models.JobStatusPending {
 		job.Status = models.JobStatusRejected
+		job.RejectionReason = utils.StringPtr(strings.TrimSpace(req.Reason))
 		database.DB.Save(&job)
 		result = true
 	}
@@ -349,3 +537,107 @@ func (h *JobHandler) ListCandidate(c *fiber.Ctx) error {
 		"data": candidates,
 	})
 }
+
+// buildJobCourses validates the requested course mapping and returns the rows
+// to store. The SKS of the mapped courses must not exceed models.MaxSksMBKM
+// for any single program studi. err is set when the courses could not be
+// loaded.
+func buildJobCourses(reqs []dto.JobCourseRequest) ([]models.JobMataKuliah, map[string]string, error) {
+	if len(reqs) == 0 {
+		return nil, nil, nil
+	}
+
+	ids := make([]uint, 0, len(reqs))
+	for _, r := range reqs {
+		ids = append(ids, r.MataKuliahID)
+	}
+
+	var matkuls []models.MataKuliah
+	if err := database.DB.Where("id IN ?", ids).Find(&matkuls).Error; err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[uint]models.MataKuliah, len(matkuls))
+	for _, m := range matkuls {
+		byID[m.ID] = m
+	}
+
+	errs := map[string]string{}
+	seen := map[uint]bool{}
+	totalSks := map[uint]int{}
+	courses := make([]models.JobMataKuliah, 0, len(reqs))
+
+	for i, r := range reqs {
+		key := fmt.Sprintf("courses.%d", i)
+		matkul, ok := byID[r.MataKuliahID]
+		if !ok {
+			errs[key] = "Mata kuliah not found"
+			continue
+		}
+		if seen[matkul.ID] {
+			errs[key] = "Mata kuliah is listed more than once"
+			continue
+		}
+		seen[matkul.ID] = true
+
+		sks := r.Sks
+		if sks == 0 {
+			sks = matkul.Sks
+		}
+		if sks < 0 {
+			errs[key] = "SKS must be positive"
+			continue
+		}
+
+		totalSks[matkul.IDProgramStudi] += sks
+		courses = append(courses, models.JobMataKuliah{
+			MataKuliahID:   matkul.ID,
+			IDProgramStudi: matkul.IDProgramStudi,
+			Sks:            sks,
+		})
+	}
+
+	for prodiID, total := range totalSks {
+		if total > models.MaxSksMBKM {
+			errs[fmt.Sprintf("courses.prodi.%d", prodiID)] = fmt.Sprintf(
+				"Total SKS %d exceeds the MBKM limit of %d SKS", total, models.MaxSksMBKM)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs, nil
+	}
+	return courses, nil, nil
+}
+
+// replaceJobCourses swaps the course mapping of a job for the given rows
+func replaceJobCourses(tx *gorm.DB, jobID uint, courses []models.JobMataKuliah) error {
+	if err := tx.Where("job_id = ?", jobID).Delete(&models.JobMataKuliah{}).Error; err != nil {
+		return err
+	}
+	if len(courses) == 0 {
+		return nil
+	}
+	for i := range courses {
+		courses[i].ID = 0
+		courses[i].JobID = jobID
+	}
+	return tx.Create(&courses).Error
+}
+
+// withJobImages fills the virtual vacancy image fields of jobs
+func withJobImages(jobs []models.Job) {
+	ids := make([]uint, len(jobs))
+	for i := range jobs {
+		ids[i] = jobs[i].ID
+	}
+
+	images, _ := media.ListFor(database.DB, models.MediaModelJob, ids, models.MediaCollectionJobVacancyImage)
+	for i := range jobs {
+		jobs[i].JobVacancyImage, jobs[i].JobVacancyImageThumbnails = imageURLs(latestMedia(images, jobs[i].ID))
+	}
+}
+
+// withJobImage fills the virtual vacancy image fields of a job
+func withJobImage(job *models.Job) {
+	job.JobVacancyImage, job.JobVacancyImageThumbnails = imageURLs(media.First(database.DB, models.MediaModelJob, job.ID, models.MediaCollectionJobVacancyImage))
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/dto"
+	"mbkm-go/internal/media"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+	"mbkm-go/pkg/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ListRevisions lists all revisions of a job, newest first
+func (h *JobHandler) ListRevisions(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return utils.NotFoundError(c, "Job not found")
+	}
+
+	var job models.Job
+	if err := database.DB.First(&job, id).Error; err != nil {
+		return utils.NotFoundError(c, "Job not found")
+	}
+	if !canEditJob(c, &job) {
+		return utils.ForbiddenError(c, "")
+	}
+
+	var revisions []models.JobRevision
+	database.DB.Where("job_id = ?", job.ID).
+		Preload("CreatedBy").
+		Preload("ReviewedBy").
+		Order("created_at DESC").
+		Find(&revisions)
+
+	return c.JSON(fiber.Map{
+		"data":  revisions,
+		"count": len(revisions),
+	})
+}
+
+// CompareRevision shows a revision side by side with the live job
+func (h *JobHandler) CompareRevision(c *fiber.Ctx) error {
+	job, revision, err := h.findRevision(c)
+	if err != nil {
+		return utils.NotFoundError(c, err.Error())
+	}
+	if !canEditJob(c, job) {
+		return utils.ForbiddenError(c, "")
+	}
+
+	current := jobValues(job)
+	comparison := make([]fiber.Map, 0, len(revision.Changes))
+	for _, change := range revision.Changes {
+		comparison = append(comparison, fiber.Map{
+			"field":   change.Field,
+			"current": current[change.Field],
+			"old":     change.Old,
+			"new":     change.New,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":       revision,
+		"job":        job,
+		"comparison": comparison,
+	})
+}
+
+// ApproveRevision applies a pending revision to the live job
+func (h *JobHandler) ApproveRevision(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) && !middleware.IsCDC(c) {
+		return utils.ForbiddenError(c, "")
+	}
+
+	job, revision, err := h.findRevision(c)
+	if err != nil {
+		return utils.NotFoundError(c, err.Error())
+	}
+
+	if revision.Status != models.JobRevisionStatusPending {
+		return utils.ValidationError(c, map[string]string{"status": "Can only approve revisions that are waiting for review"})
+	}
+
+	userID := middleware.GetCurrentUserID(c)
+	now := time.Now()
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := applyJobChanges(tx, job, revision.Changes); err != nil {
+			return err
+		}
+		return tx.Model(revision).Updates(map[string]interface{}{
+			"status":         models.JobRevisionStatusApproved,
+			"reviewed_by_id": userID,
+			"reviewed_at":    &now,
+		}).Error
+	})
+	if err != nil {
+		return utils.ValidationError(c, map[string]string{"revision": err.Error()})
+	}
+
+	database.DB.Preload("CreatedBy").Preload("Courses.MataKuliah").First(job, job.ID)
+
+	return c.JSON(fiber.Map{
+		"status":   true,
+		"data":     job,
+		"revision": revision,
+	})
+}
+
+// RejectRevision discards a pending revision, keeping the live job unchanged
+func (h *JobHandler) RejectRevision(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) && !middleware.IsCDC(c) {
+		return utils.ForbiddenError(c, "")
+	}
+
+	_, revision, err := h.findRevision(c)
+	if err != nil {
+		return utils.NotFoundError(c, err.Error())
+	}
+
+	var req dto.RejectRequest
+	if err := c.BodyParser(&req); err != nil || strings.TrimSpace(req.Reason) == "" {
+		return utils.ValidationError(c, map[string]string{"reason": "Rejection reason is required"})
+	}
+
+	if revision.Status != models.JobRevisionStatusPending {
+		return utils.ValidationError(c, map[string]string{"status": "Can only reject revisions that are waiting for review"})
+	}
+
+	userID := middleware.GetCurrentUserID(c)
+	now := time.Now()
+	removeMedia(c, models.MediaModelJobRevision, revision.ID)
+	database.DB.Model(revision).Updates(map[string]interface{}{
+		"status":           models.JobRevisionStatusRejected,
+		"rejection_reason": strings.TrimSpace(req.Reason),
+		"reviewed_by_id":   userID,
+		"reviewed_at":      &now,
+	})
+
+	return c.JSON(fiber.Map{
+		"status": true,
+		"data":   revision,
+	})
+}
+
+// hasPendingRevision reports whether a revision of the job is waiting for
+// review
+func hasPendingRevision(jobID uint) bool {
+	var pending int64
+	database.DB.Model(&models.JobRevision{}).
+		Where("job_id = ? AND status = ?", jobID, models.JobRevisionStatusPending).
+		Count(&pending)
+	return pending > 0
+}
+
+func (h *JobHandler) findRevision(c *fiber.Ctx) (*models.Job, *models.JobRevision, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, nil, errors.New("Job not found")
+	}
+	revisionID, err := strconv.ParseUint(c.Params("revision_id"), 10, 32)
+	if err != nil {
+		return nil, nil, errors.New("Revision not found")
+	}
+
+	var job models.Job
+	if err := database.DB.Preload("Courses").First(&job, id).Error; err != nil {
+		return nil, nil, errors.New("Job not found")
+	}
+
+	var revision models.JobRevision
+	if err := database.DB.Where("job_id = ?", job.ID).
+		Preload("CreatedBy").
+		Preload("ReviewedBy").
+		First(&revision, revisionID).Error; err != nil {
+		return nil, nil, errors.New("Revision not found")
+	}
+
+	return &job, &revision, nil
+}
+
+// jobValues returns the job's editable values keyed by their JSON field name.
+// The job's courses must be preloaded.
+func jobValues(job *models.Job) map[string]interface{} {
+	values := map[string]interface{}{}
+	b, _ := json.Marshal(job)
+	json.Unmarshal(b, &values)
+	values["courses"] = normalizeJSON(courseChangeValue(job.Courses))
+	return values
+}
+
+// diffJob compares the requested updates with the job and returns the fields
+// that actually change
+func diffJob(job *models.Job, updates map[string]interface{}) models.JobFieldChanges {
+	current := jobValues(job)
+
+	fields := make([]string, 0, len(updates))
+	for field := range updates {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var changes models.JobFieldChanges
+	for _, field := range fields {
+		oldValue := current[field]
+		newValue := normalizeJSON(updates[field])
+
+		oldJSON, _ := json.Marshal(oldValue)
+		newJSON, _ := json.Marshal(newValue)
+		if string(oldJSON) == string(newJSON) {
+			continue
+		}
+
+		changes = append(changes, models.JobFieldChange{
+			Field: field,
+			Old:   oldValue,
+			New:   newValue,
+		})
+	}
+	return changes
+}
+
+// applyJobChanges writes the new values of a set of field changes to the job
+func applyJobChanges(tx *gorm.DB, job *models.Job, changes models.JobFieldChanges) error {
+	updates := map[string]interface{}{}
+	for _, change := range changes {
+		switch change.Field {
+		case "courses":
+			var reqs []dto.JobCourseRequest
+			if err := remarshal(change.New, &reqs); err != nil {
+				return err
+			}
+			courses, errs, err := buildJobCourses(reqs)
+			if err != nil {
+				return err
+			}
+			if errs != nil {
+				return errors.New("The course mapping of this revision is no longer valid")
+			}
+			if err := replaceJobCourses(tx, job.ID, courses); err != nil {
+				return err
+			}
+		case "job_vacancy_image":
+			var mediaID uint
+			if err := remarshal(change.New, &mediaID); err != nil {
+				return err
+			}
+			if err := applyJobImage(tx, job, mediaID); err != nil {
+				return err
+			}
+		case "deadline":
+			var deadline *time.Time
+			if err := remarshal(change.New, &deadline); err != nil {
+				return err
+			}
+			updates["deadline"] = deadline
+		default:
+			updates[change.Field] = change.New
+		}
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+	return tx.Model(job).Updates(updates).Error
+}
+
+// applyJobImage makes the image staged on a revision the vacancy image of
+// the job, replacing the current one
+func applyJobImage(tx *gorm.DB, job *models.Job, mediaID uint) error {
+	var staged models.Media
+	if err := tx.Where("model_type = ?", models.MediaModelJobRevision).First(&staged, mediaID).Error; err != nil {
+		return errors.New("The image of this revision no longer exists")
+	}
+	if _, err := media.Link(context.Background(), tx, &staged, models.MediaModelJob, job.ID, models.MediaCollectionJobVacancyImage); err != nil {
+		return err
+	}
+	// The job's row now holds the stored file
+	return tx.Delete(&staged).Error
+}
+
+// courseChangeValue converts a course mapping to the shape stored in revisions
+func courseChangeValue(courses []models.JobMataKuliah) []dto.JobCourseRequest {
+	value := make([]dto.JobCourseRequest, 0, len(courses))
+	for _, course := range courses {
+		value = append(value, dto.JobCourseRequest{
+			MataKuliahID: course.MataKuliahID,
+			Sks:          course.Sks,
+		})
+	}
+	sort.Slice(value, func(i, j int) bool {
+		return value[i].MataKuliahID < value[j].MataKuliahID
+	})
+	return value
+}
+
+func normalizeJSON(v interface{}) interface{} {
+	var out interface{}
+	if err := remarshal(v, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func remarshal(in interface{}, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
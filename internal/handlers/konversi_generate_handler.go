@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// --- Konversi Rules & Generation ---
+
+// konversiRule returns the rule of a program studi, falling back to the
+// stored default and then to a uniform conversion
+func konversiRule(prodiID uint) models.KonversiRule {
+	var rule models.KonversiRule
+	if err := database.DB.Preload("Criteria").Where("id_program_studi = ?", prodiID).First(&rule).Error; err == nil {
+		return rule
+	}
+	if err := database.DB.Preload("Criteria").Where("id_program_studi IS NULL").First(&rule).Error; err == nil {
+		return rule
+	}
+	return models.KonversiRule{Mode: models.KonversiModeUniform, MaxSks: models.MaxSksMBKM}
+}
+
+func GetKonversiRules(c *fiber.Ctx) error {
+	var rules []models.KonversiRule
+	if err := database.DB.Preload("Criteria").Preload("ProgramStudi").Order("id ASC").Find(&rules).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+	return c.JSON(fiber.Map{"data": rules, "count": len(rules)})
+}
+
+// SaveKonversiRule creates or replaces the rule of a program studi (or the
+// default rule when id_program_studi is empty)
+func SaveKonversiRule(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) && !middleware.HasRole(c, 6) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var input struct {
+		IDProgramStudi *uint                      `json:"id_program_studi"`
+		Mode           string                     `json:"mode"`
+		MaxSks         int                        `json:"max_sks"`
+		Criteria       []models.KonversiCriterion `json:"criteria"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !middleware.IsAdmin(c) {
+		// Prodi staff only set the rule of their own program studi
+		own := staffProdiID(c)
+		if own == nil || input.IDProgramStudi == nil || *input.IDProgramStudi != *own {
+			return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+		}
+	}
+	if input.Mode != models.KonversiModeUniform && input.Mode != models.KonversiModeCriteria {
+		return c.Status(422).JSON(fiber.Map{"error": "Mode must be uniform or criteria"})
+	}
+	if input.MaxSks <= 0 {
+		input.MaxSks = models.MaxSksMBKM
+	}
+	criteria := make([]models.KonversiCriterion, 0, len(input.Criteria))
+	for i, criterion := range input.Criteria {
+		if !isRubricRole(criterion.Role) || criterion.MataKuliahID == 0 || strings.TrimSpace(criterion.CriterionName) == "" {
+			return c.Status(422).JSON(fiber.Map{"error": fmt.Sprintf("Criterion %d needs mata_kuliah_id, role and criterion_name", i+1)})
+		}
+		if criterion.Weight <= 0 {
+			criterion.Weight = 1
+		}
+		criteria = append(criteria, models.KonversiCriterion{
+			MataKuliahID:  criterion.MataKuliahID,
+			Role:          criterion.Role,
+			CriterionName: strings.TrimSpace(criterion.CriterionName),
+			Weight:        criterion.Weight,
+		})
+	}
+	if input.Mode == models.KonversiModeCriteria && len(criteria) == 0 {
+		return c.Status(422).JSON(fiber.Map{"error": "The criteria mode needs at least one criterion mapping"})
+	}
+
+	var rule models.KonversiRule
+	query := database.DB.Model(&models.KonversiRule{})
+	if input.IDProgramStudi != nil {
+		query = query.Where("id_program_studi = ?", *input.IDProgramStudi)
+	} else {
+		query = query.Where("id_program_studi IS NULL")
+	}
+	query.First(&rule)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if rule.ID != 0 {
+			if err := tx.Where("konversi_rule_id = ?", rule.ID).Delete(&models.KonversiCriterion{}).Error; err != nil {
+				return err
+			}
+		}
+		rule.IDProgramStudi = input.IDProgramStudi
+		rule.Mode = input.Mode
+		rule.MaxSks = input.MaxSks
+		rule.Criteria = criteria
+		return tx.Save(&rule).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"data": rule})
+}
+
+func DeleteKonversiRule(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) && !middleware.HasRole(c, 6) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var rule models.KonversiRule
+	if err := database.DB.First(&rule, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Rule not found"})
+	}
+	if !middleware.IsAdmin(c) {
+		own := staffProdiID(c)
+		if own == nil || rule.IDProgramStudi == nil || *rule.IDProgramStudi != *own {
+			return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+		}
+	}
+	database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("konversi_rule_id = ?", rule.ID).Delete(&models.KonversiCriterion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&rule).Error
+	})
+	return c.SendStatus(204)
+}
+
+// konversiPreview is one course grade a generation would write
+type konversiPreview struct {
+	MataKuliahID   uint               `json:"mata_kuliah_id"`
+	MataKuliah     *models.MataKuliah `json:"mata_kuliah,omitempty"`
+	IDProgramStudi uint               `json:"id_program_studi"`
+	Sks            int                `json:"sks"`
+	Score          float64            `json:"score"`
+	Grade          string             `json:"grade"`
+	GradePoint     float64            `json:"grade_point"`
+	Source         string             `json:"source"` // final_score or criteria
+}
+
+// criterionScores returns the rubric scores of an evaluation scaled to
+// 0-100, keyed by role and lower-cased criterion name
+func criterionScores(evaluationID uint) map[string]float64 {
+	var scores []models.EvaluationScore
+	database.DB.Preload("Criterion").Where("evaluation_id = ?", evaluationID).Find(&scores)
+
+	result := map[string]float64{}
+	for _, score := range scores {
+		criterion := score.Criterion
+		if criterion == nil || criterion.MaxScore <= criterion.MinScore {
+			continue
+		}
+		key := score.Role + "|" + strings.ToLower(criterion.Name)
+		result[key] = (score.Score - criterion.MinScore) / (criterion.MaxScore - criterion.MinScore) * 100
+	}
+	return result
+}
+
+// GenerateKonversiNilai converts the finalized evaluation of an application
+// into grades for the courses mapped to its jobs, following the rule of each
+// course's program studi. With dry_run the grades are only returned.
+func GenerateKonversiNilai(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) && !middleware.HasRole(c, 6) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var input struct {
+		DryRun bool `json:"dry_run"`
+	}
+	c.BodyParser(&input)
+	if c.Query("dry_run") == "true" {
+		input.DryRun = true
+	}
+
+	var applyJob models.ApplyJob
+	if err := database.DB.Preload("Users").Preload("Jobs.Courses.MataKuliah").First(&applyJob, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Apply Job not found"})
+	}
+	if !canAccessApplyJob(c, applyJob.ID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var evaluation models.Evaluation
+	if err := database.DB.Where("apply_job_id = ?", applyJob.ID).First(&evaluation).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Evaluation not found"})
+	}
+	if evaluation.FinalizedAt == nil {
+		return c.Status(409).JSON(fiber.Map{"error": "The evaluation must be finalized first"})
+	}
+
+	preview, totalSks, problems := konversiGrades(&applyJob, &evaluation)
+	response := fiber.Map{
+		"data":        preview,
+		"total_sks":   totalSks,
+		"final_score": evaluation.FinalScore,
+		"dry_run":     input.DryRun,
+		"errors":      problems,
+	}
+	if input.DryRun {
+		return c.JSON(response)
+	}
+	if len(problems) > 0 {
+		return c.Status(422).JSON(response)
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return saveKonversiGrades(tx, applyJob.ID, preview)
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(response)
+}
+
+// konversiGrades converts the final grade of an application into grades for
+// the courses mapped to its jobs, returning them with their total SKS and
+// the problems that keep them from being saved. applyJob needs its Users and
+// Jobs.Courses.MataKuliah.
+func konversiGrades(applyJob *models.ApplyJob, evaluation *models.Evaluation) ([]konversiPreview, int, []string) {
+	prodiIDs := studentProdiIDs(applyJob)
+	criteria := criterionScores(evaluation.ID)
+	rules := map[uint]models.KonversiRule{}
+	sksPerProdi := map[uint]int{}
+	seen := map[uint]bool{}
+
+	preview := make([]konversiPreview, 0)
+	for _, job := range applyJob.Jobs {
+		for _, course := range job.Courses {
+			if len(prodiIDs) > 0 && !prodiIDs[course.IDProgramStudi] {
+				continue
+			}
+			if seen[course.MataKuliahID] {
+				continue
+			}
+			seen[course.MataKuliahID] = true
+
+			rule, ok := rules[course.IDProgramStudi]
+			if !ok {
+				rule = konversiRule(course.IDProgramStudi)
+				rules[course.IDProgramStudi] = rule
+			}
+
+			row := konversiPreview{
+				MataKuliahID:   course.MataKuliahID,
+				MataKuliah:     course.MataKuliah,
+				IDProgramStudi: course.IDProgramStudi,
+				Sks:            course.Sks,
+				Score:          evaluation.FinalScore,
+				Source:         "final_score",
+			}
+			if rule.Mode == models.KonversiModeCriteria {
+				var total, weights float64
+				for _, mapping := range rule.Criteria {
+					if mapping.MataKuliahID != course.MataKuliahID {
+						continue
+					}
+					if score, ok := criteria[mapping.Role+"|"+strings.ToLower(mapping.CriterionName)]; ok {
+						total += score * mapping.Weight
+						weights += mapping.Weight
+					}
+				}
+				if weights > 0 {
+					row.Score = total / weights
+					row.Source = "criteria"
+				}
+			}
+			row.Score = math.Round(row.Score*100) / 100
+
+			konversi := models.KonversiNilai{MatkulID: course.MataKuliahID, Score: row.Score}
+			gradeKonversi(&konversi)
+			row.Grade = konversi.Grade
+			row.GradePoint = konversi.GradePoint
+
+			sksPerProdi[course.IDProgramStudi] += course.Sks
+			preview = append(preview, row)
+		}
+	}
+
+	problems := make([]string, 0)
+	if len(preview) == 0 {
+		problems = append(problems, "No courses are mapped to the jobs of this application")
+	}
+	prodis := make([]uint, 0, len(sksPerProdi))
+	for prodiID := range sksPerProdi {
+		prodis = append(prodis, prodiID)
+	}
+	sort.Slice(prodis, func(i, j int) bool { return prodis[i] < prodis[j] })
+	for _, prodiID := range prodis {
+		if sks, limit := sksPerProdi[prodiID], rules[prodiID].MaxSks; limit > 0 && sks > limit {
+			problems = append(problems, fmt.Sprintf("Program studi %d: %d SKS exceeds the maximum of %d", prodiID, sks, limit))
+		}
+	}
+
+	totalSks := 0
+	for _, sks := range sksPerProdi {
+		totalSks += sks
+	}
+	return preview, totalSks, problems
+}
+
+// saveKonversiGrades writes generated grades over the application's
+// converted grades of the same courses
+func saveKonversiGrades(tx *gorm.DB, applyJobID uint, preview []konversiPreview) error {
+	for _, row := range preview {
+		var konversi models.KonversiNilai
+		tx.Where("apply_job_id = ? AND matkul_id = ?", applyJobID, row.MataKuliahID).First(&konversi)
+		konversi.ApplyJobID = applyJobID
+		konversi.MatkulID = row.MataKuliahID
+		konversi.Score = row.Score
+		konversi.Grade = row.Grade
+		konversi.GradePoint = row.GradePoint
+		if err := tx.Save(&konversi).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// regenerateKonversiNilai generates the converted grades of an application
+// again after its final grade changed. Nothing is written when the
+// generation has problems, as GenerateKonversiNilai would refuse it too.
+func regenerateKonversiNilai(tx *gorm.DB, evaluation *models.Evaluation) error {
+	var applyJob models.ApplyJob
+	if err := tx.Preload("Users").Preload("Jobs.Courses.MataKuliah").First(&applyJob, evaluation.ApplyJobID).Error; err != nil {
+		return err
+	}
+	preview, _, problems := konversiGrades(&applyJob, evaluation)
+	if len(problems) > 0 {
+		return nil
+	}
+	return saveKonversiGrades(tx, applyJob.ID, preview)
+}
@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"mbkm-go/internal/database"
+	"mbkm-go/internal/grading"
+	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // --- Konversi Nilai Handlers ---
@@ -19,9 +23,21 @@ func GetKonversiNilai(c *fiber.Ctx) error {
 		query = query.Where("apply_job_id = ?", applyJobID)
 	}
 
+	query = query.Scopes(scopeByApplyJob(c, "apply_job_id"))
+
 	if err := query.Find(&konversi).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
 	}
+	if !seesUnpublishedGrades(c) {
+		ids := make([]uint, len(konversi))
+		for i := range konversi {
+			ids[i] = konversi[i].ApplyJobID
+		}
+		published := publishedApplyJobs(ids)
+		for i := range konversi {
+			hideUnpublishedKonversi(&konversi[i], published)
+		}
+	}
 
 	return c.JSON(fiber.Map{"data": konversi})
 }
@@ -37,6 +53,9 @@ func CreateKonversiNilai(c *fiber.Ctx) error {
 	if err := c.BodyParser(input); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
+	if ok, err := canWriteKonversi(c, input.ApplyJobID); !ok {
+		return err
+	}
 
 	// Check if exists to update or create (Laravel logic uses find-or-create style in store)
 	var konversi models.KonversiNilai
@@ -44,6 +63,9 @@ func CreateKonversiNilai(c *fiber.Ctx) error {
 		// Update
 		konversi.Grade = input.Grade
 		konversi.Score = input.Score
+		if err := gradeKonversi(&konversi); err != nil {
+			return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+		}
 		database.DB.Save(&konversi)
 		return c.Status(200).JSON(fiber.Map{"data": konversi, "status": true})
 	}
@@ -55,6 +77,9 @@ func CreateKonversiNilai(c *fiber.Ctx) error {
 		Grade:      input.Grade,
 		Score:      input.Score,
 	}
+	if err := gradeKonversi(&konversi); err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	if err := database.DB.Create(&konversi).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
@@ -69,6 +94,12 @@ func GetKonversiNilaiDetail(c *fiber.Ctx) error {
 	if err := database.DB.Preload("MataKuliah").First(&konversi, id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
 	}
+	if !canAccessApplyJob(c, konversi.ApplyJobID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	if !seesUnpublishedGrades(c) {
+		hideUnpublishedKonversi(&konversi, publishedApplyJobs([]uint{konversi.ApplyJobID}))
+	}
 	return c.JSON(fiber.Map{"data": konversi})
 }
 
@@ -78,6 +109,9 @@ func UpdateKonversiNilai(c *fiber.Ctx) error {
 	if err := database.DB.First(&konversi, id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
 	}
+	if ok, err := canWriteKonversi(c, konversi.ApplyJobID); !ok {
+		return err
+	}
 
 	type UpdateInput struct {
 		Grade string  `json:"grade"`
@@ -90,6 +124,9 @@ func UpdateKonversiNilai(c *fiber.Ctx) error {
 
 	konversi.Grade = input.Grade
 	konversi.Score = input.Score
+	if err := gradeKonversi(&konversi); err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
 	database.DB.Save(&konversi)
 
 	return c.JSON(fiber.Map{"data": konversi})
@@ -97,6 +134,166 @@ func UpdateKonversiNilai(c *fiber.Ctx) error {
 
 func DeleteKonversiNilai(c *fiber.Ctx) error {
 	id := c.Params("id")
-	database.DB.Delete(&models.KonversiNilai{}, id)
+	var konversi models.KonversiNilai
+	if err := database.DB.First(&konversi, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+	if ok, err := canWriteKonversi(c, konversi.ApplyJobID); !ok {
+		return err
+	}
+	database.DB.Delete(&konversi)
 	return c.SendStatus(204)
 }
+
+// canWriteKonversi reports whether the current user may change the
+// converted grades of an application: admin or prodi staff who can see it,
+// while its evaluation is not finalized (or unlocked again). Otherwise the
+// error response has been sent.
+func canWriteKonversi(c *fiber.Ctx, applyJobID uint) (bool, error) {
+	if !middleware.IsAdmin(c) && !middleware.HasRole(c, 6) {
+		return false, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	if applyJobID == 0 {
+		return false, c.Status(422).JSON(fiber.Map{"error": "apply_job_id is required"})
+	}
+	if !canAccessApplyJob(c, applyJobID) {
+		return false, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var evaluation models.Evaluation
+	if err := database.DB.Where("apply_job_id = ?", applyJobID).First(&evaluation).Error; err == nil && evaluation.FinalizedAt != nil {
+		return false, c.Status(409).JSON(fiber.Map{"error": "Evaluation is finalized; it must be unlocked before changing converted grades"})
+	}
+	return true, nil
+}
+
+// publishedApplyJobs returns which of the given applications have a
+// published evaluation, loading their evaluations in one query
+func publishedApplyJobs(applyJobIDs []uint) map[uint]bool {
+	distinct := map[uint]bool{}
+	ids := make([]uint, 0, len(applyJobIDs))
+	for _, id := range applyJobIDs {
+		if !distinct[id] {
+			distinct[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	published := map[uint]bool{}
+	if len(ids) == 0 {
+		return published
+	}
+	var evaluations []models.Evaluation
+	database.DB.Where("apply_job_id IN ?", ids).Find(&evaluations)
+	for i := range evaluations {
+		if gradePublished(&evaluations[i]) {
+			published[evaluations[i].ApplyJobID] = true
+		}
+	}
+	return published
+}
+
+// hideUnpublishedKonversi blanks a converted grade until the evaluation of
+// its application is published
+func hideUnpublishedKonversi(konversi *models.KonversiNilai, published map[uint]bool) {
+	if published[konversi.ApplyJobID] {
+		return
+	}
+	konversi.Grade = ""
+	konversi.Score = 0
+	konversi.GradePoint = 0
+}
+
+// gradeKonversi grades a converted course on the scale of the course's
+// program studi: the letter is derived from the score when not given, and
+// the grade point always comes from the scale
+func gradeKonversi(konversi *models.KonversiNilai) error {
+	var prodiID *uint
+	var course models.MataKuliah
+	if err := database.DB.First(&course, konversi.MatkulID).Error; err == nil {
+		prodiID = &course.IDProgramStudi
+	}
+	bands := grading.ScaleFor(database.DB, prodiID).Bands
+
+	if konversi.Grade == "" {
+		band := grading.Grade(bands, konversi.Score)
+		konversi.Grade = band.Letter
+		konversi.GradePoint = band.GradePoint
+		return nil
+	}
+	band, ok := grading.Band(bands, konversi.Grade)
+	if !ok {
+		return errors.New("Grade " + konversi.Grade + " is not on the grade scale")
+	}
+	konversi.Grade = band.Letter
+	konversi.GradePoint = band.GradePoint
+	return nil
+}
+
+// prepopulateKonversiNilai creates empty KonversiNilai rows for every course
+// mapped to the jobs of an application, limited to the students' program
+// studi when it is known. Existing rows are left untouched.
+func prepopulateKonversiNilai(tx *gorm.DB, applyJobID uint) error {
+	var applyJob models.ApplyJob
+	if err := tx.Preload("Users").Preload("Jobs.Courses").First(&applyJob, applyJobID).Error; err != nil {
+		return err
+	}
+
+	prodiIDs := studentProdiIDs(&applyJob)
+
+	for _, job := range applyJob.Jobs {
+		for _, course := range job.Courses {
+			if len(prodiIDs) > 0 && !prodiIDs[course.IDProgramStudi] {
+				continue
+			}
+			konversi := models.KonversiNilai{
+				ApplyJobID: applyJob.ID,
+				MatkulID:   course.MataKuliahID,
+			}
+			if err := tx.Where("apply_job_id = ? AND matkul_id = ?", applyJob.ID, course.MataKuliahID).
+				FirstOrCreate(&konversi).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// studentProdiIDs returns the program studi of the students of an application
+func studentProdiIDs(applyJob *models.ApplyJob) map[uint]bool {
+	prodiIDs := map[uint]bool{}
+	for i := range applyJob.Users {
+		if pid := applyJob.Users[i].IDProgramStudi; pid != nil {
+			prodiIDs[*pid] = true
+		}
+	}
+	return prodiIDs
+}
+
+// firstProdiID returns the lowest program studi ID among the students of an
+// application, used to pick per-prodi templates
+func firstProdiID(applyJob *models.ApplyJob) *uint {
+	var first *uint
+	for id := range studentProdiIDs(applyJob) {
+		if first == nil || id < *first {
+			id := id
+			first = &id
+		}
+	}
+	return first
+}
+
+// convertedSks returns the SKS the courses of an application's jobs add up
+// to for its students' program studi
+func convertedSks(applyJob *models.ApplyJob) int {
+	prodiIDs := studentProdiIDs(applyJob)
+	sks := 0
+	for _, job := range applyJob.Jobs {
+		for _, course := range job.Courses {
+			if len(prodiIDs) > 0 && !prodiIDs[course.IDProgramStudi] {
+				continue
+			}
+			sks += course.Sks
+		}
+	}
+	return sks
+}
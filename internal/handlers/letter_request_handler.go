@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/documents"
+	"mbkm-go/internal/media"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// --- Letter Request Handlers ---
+
+func isLetterType(letterType string) bool {
+	return letterType == models.LetterTypeSuratPengantar || letterType == models.LetterTypeSuratRekomendasi
+}
+
+// canReviewLetters reports whether the current user approves letter
+// requests: admin and prodi
+func canReviewLetters(c *fiber.Ctx) bool {
+	return middleware.IsAdmin(c) || middleware.HasRole(c, 6)
+}
+
+// scopeLetterRequests limits letter requests to those of the current user,
+// and for prodi staff to those of their program's students. Admin and CDC
+// see every request.
+func scopeLetterRequests(c *fiber.Ctx) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if seesAllApplyJobs(c) {
+			return db
+		}
+		userID := middleware.GetCurrentUserID(c)
+		if prodiID := staffProdiID(c); prodiID != nil {
+			return db.Where("student_id = ? OR id_program_studi = ?", userID, *prodiID)
+		}
+		return db.Where("student_id = ?", userID)
+	}
+}
+
+// withLetterFile fills the signed URL of the rendered letter
+func withLetterFile(request *models.LetterRequest) {
+	if m := media.First(database.DB, models.MediaModelLetterRequest, request.ID, request.Type); m != nil {
+		request.File = &m.URL
+	}
+}
+
+// studentApplyJobID returns the latest application of a student for a job
+func studentApplyJobID(studentID, jobID uint) *uint {
+	var ids []uint
+	database.DB.Model(&models.ApplyJob{}).
+		Where("id IN (?)", database.DB.Table("apply_job_user").Select("apply_job_id").Where("user_id = ?", studentID)).
+		Where("id IN (?)", database.DB.Table("apply_job_job").Select("apply_job_id").Where("job_id = ?", jobID)).
+		Order("id DESC").
+		Pluck("id", &ids)
+	if len(ids) == 0 {
+		return nil
+	}
+	return &ids[0]
+}
+
+// RequestLetter lets a student request a surat pengantar or surat
+// rekomendasi prodi for a job (type, job_id, optional purpose)
+func RequestLetter(c *fiber.Ctx) error {
+	user := middleware.GetCurrentUser(c)
+	if user == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+
+	var input struct {
+		Type    string `json:"type"`
+		JobID   uint   `json:"job_id"`
+		Purpose string `json:"purpose"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !isLetterType(input.Type) {
+		return c.Status(422).JSON(fiber.Map{"error": "Type must be surat_pengantar or surat_rekomendasi_prodi"})
+	}
+	var job models.Job
+	if err := database.DB.First(&job, input.JobID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Job not found"})
+	}
+
+	var existing int64
+	database.DB.Model(&models.LetterRequest{}).
+		Where("student_id = ? AND job_id = ? AND type = ? AND status IN ?", user.ID, job.ID, input.Type,
+			[]string{models.LetterStatusRequested, models.LetterStatusApproved}).
+		Count(&existing)
+	if existing > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "This letter has already been requested for this job"})
+	}
+
+	request := models.LetterRequest{
+		Type:           input.Type,
+		StudentID:      user.ID,
+		JobID:          job.ID,
+		ApplyJobID:     studentApplyJobID(user.ID, job.ID),
+		IDProgramStudi: user.IDProgramStudi,
+		Purpose:        strings.TrimSpace(input.Purpose),
+		Status:         models.LetterStatusRequested,
+	}
+	if err := database.DB.Create(&request).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(fiber.Map{"data": request})
+}
+
+// GetLetterRequests lists letter requests: students see their own, admin,
+// CDC and prodi everything. Filterable by status, type, job_id and
+// student_id.
+func GetLetterRequests(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.LetterRequest{}).
+		Preload("Student").
+		Preload("Job").
+		Preload("ReviewedBy").
+		Preload("IssuedDocument")
+
+	query = query.Scopes(scopeLetterRequests(c))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if letterType := c.Query("type"); letterType != "" {
+		query = query.Where("type = ?", letterType)
+	}
+	if jobID := c.Query("job_id"); jobID != "" {
+		query = query.Where("job_id = ?", jobID)
+	}
+	if studentID := c.Query("student_id"); studentID != "" {
+		query = query.Where("student_id = ?", studentID)
+	}
+
+	var requests []models.LetterRequest
+	if err := query.Order("created_at DESC").Find(&requests).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+	for i := range requests {
+		withLetterFile(&requests[i])
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  requests,
+		"count": len(requests),
+	})
+}
+
+func findLetterRequest(c *fiber.Ctx) (*models.LetterRequest, error) {
+	var request models.LetterRequest
+	if err := database.DB.Preload("Student").Preload("Job").First(&request, c.Params("id")).Error; err != nil {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Letter request not found"})
+	}
+	var visible int64
+	database.DB.Model(&models.LetterRequest{}).Scopes(scopeLetterRequests(c)).Where("id = ?", request.ID).Count(&visible)
+	if visible == 0 {
+		return nil, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	return &request, nil
+}
+
+func GetLetterRequest(c *fiber.Ctx) error {
+	request, err := findLetterRequest(c)
+	if request == nil {
+		return err
+	}
+	database.DB.Preload("ReviewedBy").Preload("IssuedDocument").First(request, request.ID)
+	withLetterFile(request)
+	return c.JSON(fiber.Map{"data": request})
+}
+
+// ApproveLetterRequest approves a request (prodi and admin): the letter is
+// rendered from the template of its type, numbered, signed with the name of
+// the head of the student's program studi (or signer_name/signer_nip) and
+// attached to the student's application for the job when there is one
+func ApproveLetterRequest(c *fiber.Ctx) error {
+	if !canReviewLetters(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	request, err := findLetterRequest(c)
+	if request == nil {
+		return err
+	}
+	if request.Status != models.LetterStatusRequested {
+		return c.Status(409).JSON(fiber.Map{"error": "Only requested letters can be approved"})
+	}
+
+	var input struct {
+		SignerName string `json:"signer_name"`
+		SignerNIP  string `json:"signer_nip"`
+	}
+	c.BodyParser(&input)
+	if input.SignerName == "" && request.IDProgramStudi != nil {
+		var prodi models.ProgramStudi
+		if err := database.DB.First(&prodi, *request.IDProgramStudi).Error; err == nil && prodi.NamaKaprodi != nil {
+			input.SignerName = *prodi.NamaKaprodi
+			if input.SignerNIP == "" && prodi.NIPKaprodi != nil {
+				input.SignerNIP = *prodi.NIPKaprodi
+			}
+		}
+	}
+	if input.SignerName == "" {
+		if reviewer := middleware.GetCurrentUser(c); reviewer != nil {
+			input.SignerName = reviewer.Name
+		}
+	}
+
+	var company *models.Company
+	programType := ""
+	if job := request.Job; job != nil {
+		if job.CompanyID != nil {
+			var found models.Company
+			if err := database.DB.First(&found, *job.CompanyID).Error; err == nil {
+				company = &found
+			}
+		}
+		if job.VacancyType != nil {
+			programType = *job.VacancyType
+		}
+	}
+
+	var student models.User
+	if request.Student != nil {
+		student = *request.Student
+	}
+	data := documents.NewLetterData(student, request.Job, company, request.Purpose, input.SignerName, input.SignerNIP)
+	document, err := issueDocument(middleware.GetCurrentUserID(c), models.IssuedDocument{
+		Kind:       request.Type,
+		Subject:    fmt.Sprintf("letter_request:%d", request.ID),
+		ApplyJobID: request.ApplyJobID,
+		UserID:     &request.StudentID,
+		Summary: models.DocumentSummary{
+			"student_name":  data.StudentName,
+			"nim":           data.NIM,
+			"program_studi": data.ProgramStudi,
+			"company":       data.Company,
+			"position":      data.Position,
+			"signer":        data.ProdiHead,
+		},
+	}, request.Purpose)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	data.Issue(document.Number, document.IssuedAt, documentVerifyURL(document.Code))
+
+	tpl := documents.Template(database.DB, request.Type, request.IDProgramStudi, programType)
+	userID := middleware.GetCurrentUserID(c)
+	file, err := media.Replace(c.UserContext(), database.DB, models.MediaModelLetterRequest, request.ID, request.Type, media.Upload{
+		Data:         documents.RenderLetter(tpl, data),
+		FileName:     fmt.Sprintf("%s-%d.pdf", request.Type, request.ID),
+		MimeType:     "application/pdf",
+		UploadedByID: &userID,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to store the letter"})
+	}
+	if request.ApplyJobID != nil {
+		if _, err := media.Link(c.UserContext(), database.DB, file, models.MediaModelApplyJob, *request.ApplyJobID, request.Type); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to attach the letter to the application"})
+		}
+	}
+
+	now := time.Now()
+	database.DB.Model(request).Updates(map[string]interface{}{
+		"status":             models.LetterStatusApproved,
+		"signer_name":        input.SignerName,
+		"signer_nip":         input.SignerNIP,
+		"reviewed_by_id":     userID,
+		"reviewed_at":        &now,
+		"issued_document_id": document.ID,
+	})
+	database.DB.Preload("IssuedDocument").First(request, request.ID)
+	withLetterFile(request)
+
+	return c.JSON(fiber.Map{"data": request})
+}
+
+// RejectLetterRequest rejects a request with a reason (prodi and admin)
+func RejectLetterRequest(c *fiber.Ctx) error {
+	if !canReviewLetters(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	request, err := findLetterRequest(c)
+	if request == nil {
+		return err
+	}
+	if request.Status != models.LetterStatusRequested {
+		return c.Status(409).JSON(fiber.Map{"error": "Only requested letters can be rejected"})
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	c.BodyParser(&input)
+	reason := strings.TrimSpace(input.Reason)
+	if reason == "" {
+		return c.Status(422).JSON(fiber.Map{"error": "A reason is required to reject a letter request"})
+	}
+
+	now := time.Now()
+	database.DB.Model(request).Updates(map[string]interface{}{
+		"status":           models.LetterStatusRejected,
+		"rejection_reason": reason,
+		"reviewed_by_id":   middleware.GetCurrentUserID(c),
+		"reviewed_at":      &now,
+	})
+	database.DB.First(request, request.ID)
+
+	return c.JSON(fiber.Map{"data": request})
+}
+
+// attachApprovedLetters attaches the letters a student was given for a job
+// before applying to their new application. Documents the student uploaded
+// themselves are kept.
+func attachApprovedLetters(c *fiber.Ctx, applyJobID, studentID, jobID uint) error {
+	var requests []models.LetterRequest
+	database.DB.Where("student_id = ? AND job_id = ? AND status = ? AND apply_job_id IS NULL",
+		studentID, jobID, models.LetterStatusApproved).Find(&requests)
+
+	for _, request := range requests {
+		database.DB.Model(&request).Update("apply_job_id", applyJobID)
+		if request.IssuedDocumentID != nil {
+			database.DB.Model(&models.IssuedDocument{}).Where("id = ?", *request.IssuedDocumentID).
+				Update("apply_job_id", applyJobID)
+		}
+
+		file := media.First(database.DB, models.MediaModelLetterRequest, request.ID, request.Type)
+		if file == nil || media.First(database.DB, models.MediaModelApplyJob, applyJobID, request.Type) != nil {
+			continue
+		}
+		if _, err := media.Link(c.UserContext(), database.DB, file, models.MediaModelApplyJob, applyJobID, request.Type); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,13 +1,55 @@
 package handlers
 
 import (
+	"errors"
 	"mbkm-go/internal/database"
+	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
+// masterList applies the list options shared by the master data endpoints:
+// search (case-insensitive match on the searchable columns), sort (a
+// sortable column, "-" first for descending) and trashed ("with" to include
+// soft-deleted rows, "only" for just those, e.g. to restore them)
+func masterList(c *fiber.Ctx, query *gorm.DB, searchable []string, sortable map[string]bool, defaultSort string) (*gorm.DB, error) {
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		conditions := make([]string, len(searchable))
+		args := make([]interface{}, len(searchable))
+		for i, column := range searchable {
+			conditions[i] = column + " ILIKE ?"
+			args[i] = "%" + search + "%"
+		}
+		query = query.Where(strings.Join(conditions, " OR "), args...)
+	}
+
+	switch c.Query("trashed") {
+	case "with":
+		query = query.Unscoped()
+	case "only":
+		query = query.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+
+	order := c.Query("sort", defaultSort)
+	column := strings.TrimPrefix(order, "-")
+	if !sortable[column] {
+		return nil, errors.New("sort must be one of the list columns")
+	}
+	if strings.HasPrefix(order, "-") {
+		column += " DESC"
+	}
+	return query.Order(column + ", id"), nil
+}
+
+// trashed finds a soft-deleted row to restore
+func trashed(c *fiber.Ctx, row interface{}) bool {
+	return database.DB.Unscoped().Where("deleted_at IS NOT NULL").First(row, c.Params("id")).Error == nil
+}
+
 // --- Fakultas Handlers ---
 
 func GetFakultas(c *fiber.Ctx) error {
@@ -18,10 +60,16 @@ func GetFakultas(c *fiber.Ctx) error {
 	limit, _ := strconv.Atoi(c.Query("per_page", "10"))
 	offset := (page - 1) * limit
 
+	query, err := masterList(c, database.DB.Model(&models.Fakultas{}),
+		[]string{"nama"}, map[string]bool{"nama": true, "created_at": true, "updated_at": true}, "nama")
+	if err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	var total int64
-	database.DB.Model(&models.Fakultas{}).Count(&total)
+	query.Count(&total)
 
-	err := database.DB.Offset(offset).Limit(limit).Find(&fakultas).Error
+	err = query.Offset(offset).Limit(limit).Find(&fakultas).Error
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
 	}
@@ -32,6 +80,88 @@ func GetFakultas(c *fiber.Ctx) error {
 	})
 }
 
+type fakultasInput struct {
+	Nama *string `json:"nama"`
+}
+
+// CreateFakultas adds a faculty (admin)
+func CreateFakultas(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var input fakultasInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.Nama == nil || strings.TrimSpace(*input.Nama) == "" {
+		return c.Status(422).JSON(fiber.Map{"error": "nama is required"})
+	}
+
+	fakultas := models.Fakultas{Nama: strings.TrimSpace(*input.Nama)}
+	if err := database.DB.Create(&fakultas).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(fiber.Map{"data": fakultas})
+}
+
+// UpdateFakultas renames a faculty (admin)
+func UpdateFakultas(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var fakultas models.Fakultas
+	if err := database.DB.First(&fakultas, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Fakultas not found"})
+	}
+	var input fakultasInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if input.Nama != nil {
+		if strings.TrimSpace(*input.Nama) == "" {
+			return c.Status(422).JSON(fiber.Map{"error": "nama cannot be empty"})
+		}
+		database.DB.Model(&fakultas).Update("nama", strings.TrimSpace(*input.Nama))
+
+		var prodiIDs []uint
+		database.DB.Model(&models.ProgramStudi{}).Where("id_unit_parent = ?", fakultas.ID).Pluck("id", &prodiIDs)
+		database.RefreshUserProgramStudi(database.DB, prodiIDs)
+	}
+	return c.JSON(fiber.Map{"data": fakultas})
+}
+
+// DeleteFakultas soft-deletes a faculty without program studi (admin)
+func DeleteFakultas(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var fakultas models.Fakultas
+	if err := database.DB.First(&fakultas, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Fakultas not found"})
+	}
+	var prodis int64
+	database.DB.Model(&models.ProgramStudi{}).Where("id_unit_parent = ?", fakultas.ID).Count(&prodis)
+	if prodis > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "The fakultas still has program studi"})
+	}
+	database.DB.Delete(&fakultas)
+	return c.SendStatus(204)
+}
+
+// RestoreFakultas brings back a deleted faculty (admin)
+func RestoreFakultas(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var fakultas models.Fakultas
+	if !trashed(c, &fakultas) {
+		return c.Status(404).JSON(fiber.Map{"error": "Deleted fakultas not found"})
+	}
+	database.DB.Unscoped().Model(&fakultas).Update("deleted_at", nil)
+	fakultas.DeletedAt = gorm.DeletedAt{}
+	return c.JSON(fiber.Map{"data": fakultas})
+}
+
 // --- Program Studi Handlers ---
 
 func GetProgramStudi(c *fiber.Ctx) error {
@@ -48,11 +178,16 @@ func GetProgramStudi(c *fiber.Ctx) error {
 	if fakultasID := c.Query("fakultas_id"); fakultasID != "" {
 		query = query.Where("id_unit_parent = ?", fakultasID)
 	}
+	query, err := masterList(c, query, []string{"nama", "kode_prodi", "nama_kaprodi"},
+		map[string]bool{"nama": true, "kode_prodi": true, "created_at": true, "updated_at": true}, "nama")
+	if err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	var total int64
 	query.Count(&total)
 
-	err := query.Offset(offset).Limit(limit).Find(&prodi).Error
+	err = query.Offset(offset).Limit(limit).Find(&prodi).Error
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
 	}
@@ -63,6 +198,145 @@ func GetProgramStudi(c *fiber.Ctx) error {
 	})
 }
 
+type programStudiInput struct {
+	Nama         *string `json:"nama"`
+	IDUnitParent *uint   `json:"id_unit_parent"`
+	KodeProdi    *string `json:"kode_prodi"`
+	NamaKaprodi  *string `json:"nama_kaprodi"`
+	NIPKaprodi   *string `json:"nip_kaprodi"`
+}
+
+// validateProgramStudi checks that the fakultas exists and that the PDDikti
+// code is not used by another program studi
+func validateProgramStudi(prodi *models.ProgramStudi) string {
+	if strings.TrimSpace(prodi.Nama) == "" {
+		return "nama is required"
+	}
+	var fakultas models.Fakultas
+	if err := database.DB.First(&fakultas, prodi.IDUnitParent).Error; err != nil {
+		return "Fakultas not found"
+	}
+	if prodi.KodeProdi != nil && *prodi.KodeProdi != "" {
+		var count int64
+		database.DB.Model(&models.ProgramStudi{}).
+			Where("kode_prodi = ? AND id <> ?", *prodi.KodeProdi, prodi.ID).
+			Count(&count)
+		if count > 0 {
+			return "kode_prodi is already used by another program studi"
+		}
+	}
+	return ""
+}
+
+func (input programStudiInput) apply(prodi *models.ProgramStudi) {
+	if input.Nama != nil {
+		prodi.Nama = strings.TrimSpace(*input.Nama)
+	}
+	if input.IDUnitParent != nil {
+		prodi.IDUnitParent = *input.IDUnitParent
+	}
+	if input.KodeProdi != nil {
+		code := strings.TrimSpace(*input.KodeProdi)
+		prodi.KodeProdi = &code
+	}
+	if input.NamaKaprodi != nil {
+		prodi.NamaKaprodi = input.NamaKaprodi
+	}
+	if input.NIPKaprodi != nil {
+		prodi.NIPKaprodi = input.NIPKaprodi
+	}
+}
+
+// CreateProgramStudi adds a program studi under a fakultas (admin)
+func CreateProgramStudi(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var input programStudiInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var prodi models.ProgramStudi
+	input.apply(&prodi)
+	if msg := validateProgramStudi(&prodi); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+	if err := database.DB.Create(&prodi).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	database.DB.Preload("Fakultas").First(&prodi, prodi.ID)
+	return c.Status(201).JSON(fiber.Map{"data": prodi})
+}
+
+// UpdateProgramStudi changes a program studi (admin)
+func UpdateProgramStudi(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var prodi models.ProgramStudi
+	if err := database.DB.First(&prodi, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Program studi not found"})
+	}
+	var input programStudiInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	input.apply(&prodi)
+	if msg := validateProgramStudi(&prodi); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+	if err := database.DB.Save(&prodi).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	database.RefreshUserProgramStudi(database.DB, []uint{prodi.ID})
+	database.DB.Preload("Fakultas").First(&prodi, prodi.ID)
+	return c.JSON(fiber.Map{"data": prodi})
+}
+
+// DeleteProgramStudi soft-deletes a program studi without courses or users
+// (admin)
+func DeleteProgramStudi(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var prodi models.ProgramStudi
+	if err := database.DB.First(&prodi, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Program studi not found"})
+	}
+	var courses int64
+	database.DB.Model(&models.MataKuliah{}).Where("id_program_studi = ?", prodi.ID).Count(&courses)
+	if courses > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "The program studi still has courses"})
+	}
+	var users int64
+	database.DB.Model(&models.User{}).Where("id_program_studi = ?", prodi.ID).Count(&users)
+	if users > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "The program studi still has users"})
+	}
+	database.DB.Delete(&prodi)
+	return c.SendStatus(204)
+}
+
+// RestoreProgramStudi brings back a deleted program studi whose fakultas
+// still exists (admin)
+func RestoreProgramStudi(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var prodi models.ProgramStudi
+	if !trashed(c, &prodi) {
+		return c.Status(404).JSON(fiber.Map{"error": "Deleted program studi not found"})
+	}
+	if msg := validateProgramStudi(&prodi); msg != "" {
+		return c.Status(409).JSON(fiber.Map{"error": msg})
+	}
+	database.DB.Unscoped().Model(&prodi).Update("deleted_at", nil)
+	database.DB.Preload("Fakultas").First(&prodi, prodi.ID)
+	return c.JSON(fiber.Map{"data": prodi})
+}
+
 // --- Mata Kuliah Handlers ---
 
 func GetMatkul(c *fiber.Ctx) error {
@@ -79,11 +353,19 @@ func GetMatkul(c *fiber.Ctx) error {
 	if prodiID := c.Query("prodi_id"); prodiID != "" {
 		query = query.Where("id_program_studi = ?", prodiID)
 	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query, err := masterList(c, query, []string{"kode_matkul", "nama_matkul"},
+		map[string]bool{"kode_matkul": true, "nama_matkul": true, "sks": true, "created_at": true, "updated_at": true}, "kode_matkul")
+	if err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
 
 	var total int64
 	query.Count(&total)
 
-	err := query.Offset(offset).Limit(limit).Find(&matkul).Error
+	err = query.Offset(offset).Limit(limit).Find(&matkul).Error
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
 	}
@@ -94,6 +376,167 @@ func GetMatkul(c *fiber.Ctx) error {
 	})
 }
 
+type mataKuliahInput struct {
+	KodeMatkul     *string `json:"kode_matkul"`
+	NamaMatkul     *string `json:"nama_matkul"`
+	Sks            *int    `json:"sks"`
+	IDProgramStudi *uint   `json:"id_program_studi"`
+	Status         *string `json:"status"`
+}
+
+func (input mataKuliahInput) apply(course *models.MataKuliah) {
+	if input.KodeMatkul != nil {
+		course.KodeMatkul = strings.TrimSpace(*input.KodeMatkul)
+	}
+	if input.NamaMatkul != nil {
+		course.NamaMatkul = strings.TrimSpace(*input.NamaMatkul)
+	}
+	if input.Sks != nil {
+		course.Sks = *input.Sks
+	}
+	if input.IDProgramStudi != nil {
+		course.IDProgramStudi = *input.IDProgramStudi
+	}
+	if input.Status != nil {
+		course.Status = *input.Status
+	}
+}
+
+// validateMataKuliah checks the fields, that the program studi exists and
+// that the course code is unique within it
+func validateMataKuliah(course *models.MataKuliah) string {
+	switch {
+	case course.KodeMatkul == "":
+		return "kode_matkul is required"
+	case course.NamaMatkul == "":
+		return "nama_matkul is required"
+	case course.Sks <= 0:
+		return "sks must be a positive number"
+	case course.Status != "Aktif" && course.Status != "Tidak Aktif":
+		return "status must be Aktif or Tidak Aktif"
+	}
+	var prodi models.ProgramStudi
+	if err := database.DB.First(&prodi, course.IDProgramStudi).Error; err != nil {
+		return "Program studi not found"
+	}
+	var count int64
+	database.DB.Model(&models.MataKuliah{}).
+		Where("kode_matkul = ? AND id_program_studi = ? AND id <> ?", course.KodeMatkul, course.IDProgramStudi, course.ID).
+		Count(&count)
+	if count > 0 {
+		return "kode_matkul is already used in this program studi"
+	}
+	return ""
+}
+
+// canManageCourses reports whether the current user edits the course: admin
+// any course, prodi those of their own program studi
+func canManageCourses(c *fiber.Ctx, course *models.MataKuliah) bool {
+	if middleware.IsAdmin(c) {
+		return true
+	}
+	prodiID := staffProdiID(c)
+	return prodiID != nil && *prodiID == course.IDProgramStudi
+}
+
+// CreateMatkul adds a course to a program studi (admin, prodi)
+func CreateMatkul(c *fiber.Ctx) error {
+	var input mataKuliahInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	course := models.MataKuliah{Status: "Aktif"}
+	input.apply(&course)
+	if !canManageCourses(c, &course) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	if msg := validateMataKuliah(&course); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+	if err := database.DB.Create(&course).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	database.DB.Preload("ProgramStudi").First(&course, course.ID)
+	return c.Status(201).JSON(fiber.Map{"data": course})
+}
+
+// UpdateMatkul changes a course (admin, prodi)
+func UpdateMatkul(c *fiber.Ctx) error {
+	var course models.MataKuliah
+	if err := database.DB.First(&course, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Mata kuliah not found"})
+	}
+	if !canManageCourses(c, &course) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	var input mataKuliahInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	input.apply(&course)
+	if !canManageCourses(c, &course) {
+		return c.Status(403).JSON(fiber.Map{"error": "Cannot move the course to another program studi"})
+	}
+	if msg := validateMataKuliah(&course); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+	if err := database.DB.Save(&course).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	database.DB.Preload("ProgramStudi").First(&course, course.ID)
+	return c.JSON(fiber.Map{"data": course})
+}
+
+// DeleteMatkul soft-deletes a course no konversi nilai, konversi rule or
+// job refers to (admin, prodi); such courses can be set Tidak Aktif instead
+func DeleteMatkul(c *fiber.Ctx) error {
+	var course models.MataKuliah
+	if err := database.DB.First(&course, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Mata kuliah not found"})
+	}
+	if !canManageCourses(c, &course) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var konversi, criteria, jobs int64
+	database.DB.Model(&models.KonversiNilai{}).Where("matkul_id = ?", course.ID).Count(&konversi)
+	database.DB.Model(&models.KonversiCriterion{}).Where("mata_kuliah_id = ?", course.ID).Count(&criteria)
+	database.DB.Model(&models.JobMataKuliah{}).Where("mata_kuliah_id = ?", course.ID).Count(&jobs)
+	if konversi > 0 || criteria > 0 || jobs > 0 {
+		return c.Status(409).JSON(fiber.Map{
+			"error":          "The course is used by konversi nilai or jobs; set its status to Tidak Aktif instead",
+			"konversi_nilai": konversi,
+			"konversi_rules": criteria,
+			"jobs":           jobs,
+		})
+	}
+	database.DB.Delete(&course)
+	return c.SendStatus(204)
+}
+
+// RestoreMatkul brings back a deleted course when its program studi exists
+// and its code is still free (admin, prodi)
+func RestoreMatkul(c *fiber.Ctx) error {
+	var course models.MataKuliah
+	if !trashed(c, &course) {
+		return c.Status(404).JSON(fiber.Map{"error": "Deleted mata kuliah not found"})
+	}
+	if !canManageCourses(c, &course) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	if course.Status == "" {
+		course.Status = "Aktif"
+	}
+	if msg := validateMataKuliah(&course); msg != "" {
+		return c.Status(409).JSON(fiber.Map{"error": msg})
+	}
+	database.DB.Unscoped().Model(&course).Update("deleted_at", nil)
+	database.DB.Preload("ProgramStudi").First(&course, course.ID)
+	return c.JSON(fiber.Map{"data": course})
+}
+
 // --- Perusahaan Handlers ---
 
 func GetPerusahaan(c *fiber.Ctx) error {
@@ -166,3 +609,32 @@ func DeletePerusahaan(c *fiber.Ctx) error {
 	database.DB.Delete(&perusahaan)
 	return c.SendStatus(204)
 }
+
+// --- User Program Studi Mapping ---
+
+// GetProgramStudiMapping reports which users without a program studi could
+// be linked from their stored prodi text and which values match nothing
+// (admin)
+func GetProgramStudiMapping(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	report, err := database.MapUserProgramStudi(database.DB, false)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"data": report})
+}
+
+// MapProgramStudi links the users that can be matched, e.g. after adding the
+// program studi or codes the report listed as unmatched (admin)
+func MapProgramStudi(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	report, err := database.MapUserProgramStudi(database.DB, true)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"data": report})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+	"mbkm-go/internal/queue"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// --- Background Job Queue Handlers ---
+
+// Job types run by the queue workers
+const (
+	jobImportStudents       = "students.import"
+	jobPushFeeder           = "feeder.push"
+	jobSiakadSync           = "siakad.sync"
+	jobGenerateCertificates = "certificates.generate"
+)
+
+// RegisterJobs sets the handlers of the job types queued by the API
+func RegisterJobs(w *queue.Worker) {
+	w.Register(jobImportStudents, importStudentsJob)
+	w.Register(jobPushFeeder, pushFeederJob)
+	w.Register(jobSiakadSync, siakadSyncJob)
+	w.Register(jobGenerateCertificates, generateCertificatesJob)
+}
+
+// enqueueJob queues a job for the current user and answers 202 with it, or
+// 409 with the unfinished job of the same unique key
+func enqueueJob(c *fiber.Ctx, jobType string, payload interface{}, opts queue.Options) error {
+	userID := middleware.GetCurrentUserID(c)
+	opts.CreatedByID = &userID
+
+	job, err := queue.Enqueue(database.DB, jobType, payload, opts)
+	if errors.Is(err, queue.ErrDuplicate) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error(), "data": job})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to queue the job"})
+	}
+	return c.Status(202).JSON(fiber.Map{"data": job})
+}
+
+// queueJobsQuery returns the jobs the current user may see: all for admin,
+// the ones they queued for others
+func queueJobsQuery(c *fiber.Ctx) *gorm.DB {
+	query := database.DB.Model(&models.QueueJob{})
+	if !middleware.IsAdmin(c) {
+		query = query.Where("created_by_id = ?", middleware.GetCurrentUserID(c))
+	}
+	return query
+}
+
+// GetQueueJobs lists queued jobs, latest first (status, type). Failed jobs
+// are the dead letters.
+func GetQueueJobs(c *fiber.Ctx) error {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("per_page", "10"))
+	offset := (page - 1) * limit
+
+	query := queueJobsQuery(c).Preload("CreatedBy")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType := c.Query("type"); jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var jobs []models.QueueJob
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&jobs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+	return c.JSON(fiber.Map{"data": jobs, "count": total})
+}
+
+// GetQueueJob shows the status, progress and, once finished, the result of
+// a job
+func GetQueueJob(c *fiber.Ctx) error {
+	var job models.QueueJob
+	if err := queueJobsQuery(c).Preload("CreatedBy").First(&job, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Job not found"})
+	}
+	return c.JSON(fiber.Map{"data": job})
+}
+
+// RetryQueueJob queues a failed job again with a fresh set of attempts
+// (admin)
+func RetryQueueJob(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	job, err := queue.Retry(database.DB, uint(id))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": "Job not found"})
+	case errors.Is(err, queue.ErrNotRetryable), errors.Is(err, queue.ErrDuplicate):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error(), "data": job})
+	case err != nil:
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to retry the job"})
+	}
+	return c.Status(202).JSON(fiber.Map{"data": job})
+}
@@ -2,16 +2,22 @@ package handlers
 
 import (
 	"fmt"
+	"mbkm-go/config"
 	"mbkm-go/internal/database"
+	"mbkm-go/internal/documents"
+	"mbkm-go/internal/media"
+	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 	"strconv"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // --- Report Handlers ---
 
+const maxReportFileSize = 10 << 20
+
 func GetReports(c *fiber.Ctx) error {
 	var reports []models.Report
 	page, _ := strconv.Atoi(c.Query("page", "1"))
@@ -20,6 +26,7 @@ func GetReports(c *fiber.Ctx) error {
 	status := c.Query("status")
 
 	query := database.DB.Model(&models.Report{}).
+		Scopes(scopeByApplyJob(c, "apply_job_id")).
 		Preload("ApplyJob.Jobs").
 		Preload("ApplyJob.Users"). // CreatedBy -> Users
 		Preload("CompanyChecked").
@@ -57,14 +64,19 @@ func CreateReport(c *fiber.Ctx) error {
 	if err := database.DB.Preload("Jobs").First(&applyJob, applyJobID).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Apply Job not found"})
 	}
+	if !canAccessApplyJob(c, applyJob.ID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
 
 	// TX Start
 	tx := database.DB.Begin()
 
 	report := models.Report{
-		ApplyJobID:    uint(applyJobID),
-		ReportJobUser: *applyJob.JobUser, // Assumed available
-		Status:        "Draft",
+		ApplyJobID: uint(applyJobID),
+		Status:     models.ReportStatusDraft,
+	}
+	if applyJob.JobUser != nil {
+		report.ReportJobUser = *applyJob.JobUser
 	}
 	if applyJob.CreatedAt.IsZero() == false {
 		report.StartDate = &applyJob.CreatedAt
@@ -78,30 +90,40 @@ func CreateReport(c *fiber.Ctx) error {
 	// Create Evaluation stub
 	evaluation := models.Evaluation{
 		ApplyJobID: uint(applyJobID),
-		Status:     "Belum Dinilai",
+		Status:     models.EvalStatusNotGraded,
 	}
 	if err := tx.Create(&evaluation).Error; err != nil {
 		tx.Rollback()
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to create evaluation stub"})
 	}
 
-	// Handle File Upload
-	file, err := c.FormFile("file")
-	if err == nil {
-		// Save file
-		filename := fmt.Sprintf("report_%d_%s", report.ID, file.Filename)
-		path := fmt.Sprintf("./uploads/%s", filename) // Ensure uploads dir exists
-		if err := c.SaveFile(file, path); err != nil {
+	// Handle File Upload as the first version
+	var version *models.ReportVersion
+	if _, err := c.FormFile("file"); err == nil {
+		data, filename, err := readUpload(c, "file", maxReportFileSize)
+		if err != nil {
+			tx.Rollback()
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		userID := middleware.GetCurrentUserID(c)
+		version, err = createReportVersion(c, tx, &report, media.Upload{
+			Data:         data,
+			FileName:     filename,
+			UploadedByID: &userID,
+		}, c.FormValue("note"))
+		if err != nil {
 			tx.Rollback()
 			return c.Status(500).JSON(fiber.Map{"error": "Failed to save file"})
 		}
-		// Update report file path/url
-		// Assuming simple path storage for now. Laravel uses MediaLibrary.
-		updateFile := fmt.Sprintf("/uploads/%s", filename)
-		tx.Model(&report).Update("file_laporan", updateFile)
+		report.FileLaporan = version.File.URL
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		if version != nil {
+			discardReportVersion(version)
+		}
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create report"})
+	}
 
 	return c.Status(201).JSON(fiber.Map{"data": report})
 }
@@ -118,85 +140,115 @@ func GetReportDetail(c *fiber.Ctx) error {
 		First(&report).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Report not found"})
 	}
+
+	if !canAccessApplyJob(c, report.ApplyJobID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	if file := reportFile(report.ID); file != nil {
+		report.FileLaporan = file.URL
+	}
 	return c.JSON(fiber.Map{"data": report})
 }
 
-func CheckReport(c *fiber.Ctx) error {
+// GetReportFile returns a short-lived download URL for the report file
+func GetReportFile(c *fiber.Ctx) error {
 	id := c.Params("id") // apply_job_id
 	var report models.Report
 	if err := database.DB.Where("apply_job_id = ?", id).First(&report).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Report not found"})
 	}
 
-	var applyJob models.ApplyJob
-	database.DB.First(&applyJob, id)
-
-	userID := 1 // TODO: Get actual auth user ID
-	// Dummy Auth User ID Retrieval
-	//In real app: userID := c.Locals("user").(*jwt.Token).Claims.(jwt.MapClaims)["id"] etc.
-	// For now we assume we can get it from context or pass it (but usually from token).
-	// We'll rely on a helper if available or placeholder.
-	// We'll trust the user passed it in body for testing or fetch from middleware.
-	// Let's try to get from Locals if set by middleware, else fail safe.
-	if u := c.Locals("user_id"); u != nil {
-		userID, _ = strconv.Atoi(fmt.Sprintf("%v", u))
-	}
-
-	// Get User Roles
-	var user models.User
-	database.DB.Preload("Roles").First(&user, userID)
-
-	roleIDs := []uint{}
-	for _, r := range user.Roles {
-		roleIDs = append(roleIDs, r.ID)
-	}
-
-	isExaminer := false
-	if applyJob.ExaminerLecturerID != nil && *applyJob.ExaminerLecturerID == uint(userID) {
-		isExaminer = true
-	}
-
-	now := time.Now()
-	updates := map[string]interface{}{}
-
-	// Role 4: Company, 5: Dosen, 6: Prodi
-	// Check logic matching Laravel
-	for _, rid := range roleIDs {
-		if rid == 4 { // Company
-			updates["company_checked_id"] = userID
-			updates["company_checked_at"] = &now
-		} else if rid == 5 { // Dosen
-			if isExaminer {
-				updates["examiner_checked_id"] = userID
-				updates["examiner_checked_at"] = &now
-			} else {
-				updates["lecturer_checked_id"] = userID
-				updates["lecturer_checked_at"] = &now
-			}
-		} else if rid == 6 { // Prodi
-			updates["prodi_checked_id"] = userID
-			updates["prodi_checked_at"] = &now
-		}
+	if !canAccessApplyJob(c, report.ApplyJobID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
 	}
 
-	// Update DB first
-	database.DB.Model(&report).Updates(updates)
+	file := reportFile(report.ID)
+	if file == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Report has no file"})
+	}
+
+	return c.JSON(fiber.Map{"data": fiber.Map{
+		"url":        file.URL,
+		"file_name":  file.FileName,
+		"mime_type":  file.MimeType,
+		"size":       file.Size,
+		"expires_in": int(config.AppConfig.SignedURLTTL.Seconds()),
+	}})
+}
+
+// ExportReportPDF renders the printable logbook of a report, using the
+// logbook template of the student's program studi
+func ExportReportPDF(c *fiber.Ctx) error {
+	id := c.Params("id") // apply_job_id
+	var report models.Report
+	err := database.DB.Where("apply_job_id = ?", id).
+		Preload("ApplyJob.Users.ProgramStudi.Fakultas").
+		Preload("ApplyJob.Jobs").
+		Preload("ApplyJob.ResponsibleLecturer").
+		Preload("ApplyJob.ExaminerLecturer").
+		Preload("ActivityDetails", func(db *gorm.DB) *gorm.DB {
+			return db.Order("date ASC, id ASC")
+		}).
+		Preload("CompanyChecked").
+		Preload("ProdiChecked").
+		First(&report).Error
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Report not found"})
+	}
 
-	// Refetch to check completeness
-	database.DB.First(&report, report.ID)
+	if !canAccessApplyJob(c, report.ApplyJobID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
 
-	status := "Berjalan"
-	if report.CompanyCheckedID != nil && report.LecturerCheckedID != nil && report.ExaminerCheckedID != nil {
-		status = "Selesai"
+	var prodiID *uint
+	if report.ApplyJob != nil {
+		prodiID = firstProdiID(report.ApplyJob)
 	}
-	database.DB.Model(&report).Update("status", status)
-	report.Status = status // Update struct for response
+	tpl := documents.Template(database.DB, models.DocumentTemplateLogbook, prodiID, "")
+	data := documents.NewLogbookData(&report)
+	data.Attendance = applyJobAttendanceRecap(report.ApplyJobID)
+	output := documents.RenderLogbook(tpl, data)
 
-	return c.JSON(fiber.Map{"data": report, "status": true})
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="logbook-%d.pdf"`, report.ApplyJobID))
+	return c.Send(output)
 }
 
+// CheckReport approves the current report version, kept for clients of the
+// old sign-off endpoint. Use ReviewReport to request changes.
+func CheckReport(c *fiber.Ctx) error {
+	return reviewReport(c, models.ReportReviewApproved, "")
+}
+
+// DeleteReport removes a report with its versions, reviews, comments and
+// files. Admin may delete any report, the students of the application
+// only their own while it is still a draft.
 func DeleteReport(c *fiber.Ctx) error {
-	id := c.Params("id")
-	database.DB.Delete(&models.Report{}, id)
+	var report models.Report
+	if err := database.DB.Preload("ApplyJob.Users").First(&report, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Report not found"})
+	}
+
+	if !middleware.IsAdmin(c) {
+		if report.ApplyJob == nil || !canAccessApplyJob(c, report.ApplyJobID) ||
+			!isApplicationStudent(report.ApplyJob, middleware.GetCurrentUserID(c)) {
+			return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+		}
+		if report.Status != models.ReportStatusDraft {
+			return c.Status(422).JSON(fiber.Map{"error": "Only a draft report can be deleted"})
+		}
+	}
+
+	media.DeleteAll(c.UserContext(), database.DB, models.MediaModelReport, report.ID)
+
+	var versionIDs []uint
+	database.DB.Model(&models.ReportVersion{}).Where("report_id = ?", report.ID).Pluck("id", &versionIDs)
+	for _, versionID := range versionIDs {
+		media.DeleteAll(c.UserContext(), database.DB, models.MediaModelReportVersion, versionID)
+	}
+	database.DB.Where("report_id = ?", report.ID).Delete(&models.ReportComment{})
+	database.DB.Where("report_id = ?", report.ID).Delete(&models.ReportReview{})
+	database.DB.Where("report_id = ?", report.ID).Delete(&models.ReportVersion{})
+	database.DB.Delete(&report)
 	return c.SendStatus(204)
 }
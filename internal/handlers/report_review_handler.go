@@ -0,0 +1,463 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/media"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+	"mbkm-go/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// --- Report Versions & Reviews ---
+
+// findReportForUser loads the report of an application (route param "id" is
+// the apply_job_id) together with the application, checking access
+func findReportForUser(c *fiber.Ctx) (*models.Report, *models.ApplyJob, error) {
+	var report models.Report
+	if err := database.DB.Where("apply_job_id = ?", c.Params("id")).First(&report).Error; err != nil {
+		return nil, nil, c.Status(404).JSON(fiber.Map{"error": "Report not found"})
+	}
+	if !canAccessApplyJob(c, report.ApplyJobID) {
+		return nil, nil, c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var applyJob models.ApplyJob
+	if err := database.DB.Preload("Users").First(&applyJob, report.ApplyJobID).Error; err != nil {
+		return nil, nil, c.Status(404).JSON(fiber.Map{"error": "Apply Job not found"})
+	}
+	return &report, &applyJob, nil
+}
+
+// latestReportVersion returns the current version of a report, or nil when
+// nothing has been submitted yet
+func latestReportVersion(db *gorm.DB, reportID uint) *models.ReportVersion {
+	var version models.ReportVersion
+	if err := db.Where("report_id = ?", reportID).Order("version DESC").First(&version).Error; err != nil {
+		return nil
+	}
+	return &version
+}
+
+// reportFile returns the file of the current report version. Reports from
+// before versioning keep their file on the report itself.
+func reportFile(reportID uint) *models.Media {
+	if version := latestReportVersion(database.DB, reportID); version != nil {
+		if file := media.First(database.DB, models.MediaModelReportVersion, version.ID, models.MediaCollectionFileLaporan); file != nil {
+			return file
+		}
+	}
+	return media.First(database.DB, models.MediaModelReport, reportID, models.MediaCollectionFileLaporan)
+}
+
+// createReportVersion stores the uploaded file as the next version of the
+// report and starts a new review round. The file is written to storage
+// before tx commits: a caller that rolls tx back after a successful call
+// must pass the version to discardReportVersion.
+func createReportVersion(c *fiber.Ctx, tx *gorm.DB, report *models.Report, upload media.Upload, note string) (_ *models.ReportVersion, err error) {
+	number := 1
+	if latest := latestReportVersion(tx, report.ID); latest != nil {
+		number = latest.Version + 1
+	}
+
+	version := models.ReportVersion{
+		ReportID:      report.ID,
+		Version:       number,
+		SubmittedByID: upload.UploadedByID,
+	}
+	if note != "" {
+		version.Note = &note
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return nil, err
+	}
+
+	file, err := media.Attach(c.UserContext(), tx, models.MediaModelReportVersion, version.ID, models.MediaCollectionFileLaporan, upload)
+	if err != nil {
+		return nil, err
+	}
+	version.File = file
+	defer func() {
+		if err != nil {
+			discardReportVersion(&version)
+		}
+	}()
+
+	// Earlier sign-offs were given on the previous version
+	updates := map[string]interface{}{
+		"status":              models.ReportStatusCreatedByStudent,
+		"company_checked_id":  nil,
+		"company_checked_at":  nil,
+		"lecturer_checked_id": nil,
+		"lecturer_checked_at": nil,
+		"examiner_checked_id": nil,
+		"examiner_checked_at": nil,
+		"prodi_checked_id":    nil,
+		"prodi_checked_at":    nil,
+	}
+	if err := tx.Model(report).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	report.Status = models.ReportStatusCreatedByStudent
+	report.CompanyCheckedID, report.CompanyCheckedAt = nil, nil
+	report.LecturerCheckedID, report.LecturerCheckedAt = nil, nil
+	report.ExaminerCheckedID, report.ExaminerCheckedAt = nil, nil
+	report.ProdiCheckedID, report.ProdiCheckedAt = nil, nil
+
+	return &version, nil
+}
+
+// discardReportVersion removes the stored file of a version whose
+// transaction was rolled back
+func discardReportVersion(version *models.ReportVersion) {
+	if version.File == nil {
+		return
+	}
+	if err := media.Discard(context.Background(), version.File); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Report version %d: delete %s: %v", version.ID, version.File.Path, err)
+	}
+}
+
+// isApplicationStudent reports whether the user is one of the students of
+// an application loaded with its users
+func isApplicationStudent(applyJob *models.ApplyJob, userID uint) bool {
+	if applyJob.CreatedByID != nil && *applyJob.CreatedByID == userID {
+		return true
+	}
+	for _, u := range applyJob.Users {
+		if u.ID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// SubmitReportVersion uploads a new version of the report file (multipart
+// "file", optional "note"). Only the students of the application may submit.
+func SubmitReportVersion(c *fiber.Ctx) error {
+	report, applyJob, err := findReportForUser(c)
+	if report == nil {
+		return err
+	}
+
+	userID := middleware.GetCurrentUserID(c)
+	if !isApplicationStudent(applyJob, userID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Only the student can submit the report"})
+	}
+	if report.Status == models.ReportStatusCheckedByProdi {
+		return c.Status(422).JSON(fiber.Map{"error": "Report has already been approved by prodi"})
+	}
+
+	data, filename, err := readUpload(c, "file", maxReportFileSize)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	tx := database.DB.Begin()
+	version, err := createReportVersion(c, tx, report, media.Upload{
+		Data:         data,
+		FileName:     filename,
+		UploadedByID: &userID,
+	}, strings.TrimSpace(c.FormValue("note")))
+	if err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save report version"})
+	}
+	if err := tx.Commit().Error; err != nil {
+		discardReportVersion(version)
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save report version"})
+	}
+
+	return c.Status(201).JSON(fiber.Map{"data": version, "report": report})
+}
+
+// reportReviewerRole returns the role the current user reviews the report
+// in, or "" when they are not a reviewer of the application
+func reportReviewerRole(c *fiber.Ctx, applyJob *models.ApplyJob) string {
+	userID := middleware.GetCurrentUserID(c)
+
+	if middleware.IsCompany(c) && canAccessApplyJob(c, applyJob.ID) {
+		return models.ReportReviewerCompany
+	}
+	if middleware.HasRole(c, 5) {
+		if applyJob.ExaminerLecturerID != nil && *applyJob.ExaminerLecturerID == userID {
+			return models.ReportReviewerExaminer
+		}
+		if applyJob.ResponsibleLecturerID != nil && *applyJob.ResponsibleLecturerID == userID {
+			return models.ReportReviewerLecturer
+		}
+	}
+	if middleware.HasRole(c, 6) && canAccessApplyJob(c, applyJob.ID) {
+		return models.ReportReviewerProdi
+	}
+	return ""
+}
+
+// reportDecisions returns the latest decision of each reviewer role on a
+// report version
+func reportDecisions(versionID uint) map[string]string {
+	var reviews []models.ReportReview
+	database.DB.Where("report_version_id = ?", versionID).Order("created_at ASC, id ASC").Find(&reviews)
+
+	decisions := map[string]string{}
+	for _, review := range reviews {
+		decisions[review.Role] = review.Decision
+	}
+	return decisions
+}
+
+// reportStatus derives the report status from the reviews of its current
+// version. Review goes company -> lecturer (and examiner, when assigned) ->
+// prodi; any open change request sends the report back to the student.
+func reportStatus(applyJob *models.ApplyJob, decisions map[string]string) string {
+	for _, decision := range decisions {
+		if decision == models.ReportReviewChangesRequested {
+			return models.ReportStatusChangesRequested
+		}
+	}
+	if decisions[models.ReportReviewerProdi] == models.ReportReviewApproved {
+		return models.ReportStatusCheckedByProdi
+	}
+	if lecturersApproved(applyJob, decisions) {
+		return models.ReportStatusCheckedByLecturer
+	}
+	if decisions[models.ReportReviewerCompany] == models.ReportReviewApproved {
+		return models.ReportStatusCheckedByCompany
+	}
+	return models.ReportStatusCreatedByStudent
+}
+
+func lecturersApproved(applyJob *models.ApplyJob, decisions map[string]string) bool {
+	if decisions[models.ReportReviewerLecturer] != models.ReportReviewApproved {
+		return false
+	}
+	return applyJob.ExaminerLecturerID == nil || decisions[models.ReportReviewerExaminer] == models.ReportReviewApproved
+}
+
+// reviewReport records the current user's decision on the current version
+func reviewReport(c *fiber.Ctx, decision, comment string) error {
+	report, applyJob, err := findReportForUser(c)
+	if report == nil {
+		return err
+	}
+
+	role := reportReviewerRole(c, applyJob)
+	if role == "" {
+		return c.Status(403).JSON(fiber.Map{"error": "You are not a reviewer of this report"})
+	}
+	if decision != models.ReportReviewApproved && decision != models.ReportReviewChangesRequested {
+		return c.Status(422).JSON(fiber.Map{"error": "Decision must be approved or changes_requested"})
+	}
+	if decision == models.ReportReviewChangesRequested && comment == "" {
+		return c.Status(422).JSON(fiber.Map{"error": "A comment is required when requesting changes"})
+	}
+
+	version := latestReportVersion(database.DB, report.ID)
+	if version == nil {
+		return c.Status(422).JSON(fiber.Map{"error": "The student has not submitted the report yet"})
+	}
+
+	// Approvals follow the review order
+	decisions := reportDecisions(version.ID)
+	if decision == models.ReportReviewApproved {
+		switch role {
+		case models.ReportReviewerLecturer, models.ReportReviewerExaminer:
+			if decisions[models.ReportReviewerCompany] != models.ReportReviewApproved {
+				return c.Status(422).JSON(fiber.Map{"error": "The company has not approved this version yet"})
+			}
+		case models.ReportReviewerProdi:
+			if !lecturersApproved(applyJob, decisions) {
+				return c.Status(422).JSON(fiber.Map{"error": "The lecturers have not approved this version yet"})
+			}
+		}
+	}
+
+	userID := middleware.GetCurrentUserID(c)
+	review := models.ReportReview{
+		ReportID:        report.ID,
+		ReportVersionID: version.ID,
+		ReviewerID:      userID,
+		Role:            role,
+		Decision:        decision,
+	}
+	if comment != "" {
+		review.Comment = &comment
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Create(&review).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// The review comment opens a thread on the version
+	if comment != "" {
+		if err := tx.Create(&models.ReportComment{
+			ReportID:        report.ID,
+			ReportVersionID: version.ID,
+			UserID:          userID,
+			Body:            comment,
+		}).Error; err != nil {
+			tx.Rollback()
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+
+	decisions[role] = decision
+	updates := map[string]interface{}{"status": reportStatus(applyJob, decisions)}
+	checkedID, checkedAt := role+"_checked_id", role+"_checked_at"
+	if decision == models.ReportReviewApproved {
+		updates[checkedID] = userID
+		updates[checkedAt] = time.Now()
+	} else {
+		updates[checkedID] = nil
+		updates[checkedAt] = nil
+	}
+	if err := tx.Model(report).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	tx.Commit()
+
+	database.DB.First(report, report.ID)
+	return c.JSON(fiber.Map{"data": report, "review": review, "status": true})
+}
+
+// ReviewReport approves the current report version or requests changes.
+// Body: {"decision": "approved"|"changes_requested", "comment": "..."}
+func ReviewReport(c *fiber.Ctx) error {
+	var input struct {
+		Decision string `json:"decision"`
+		Comment  string `json:"comment"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return reviewReport(c, input.Decision, strings.TrimSpace(input.Comment))
+}
+
+// AddReportComment adds a comment, or a reply when parent_id is set, to a
+// report version (the current one by default)
+func AddReportComment(c *fiber.Ctx) error {
+	report, _, err := findReportForUser(c)
+	if report == nil {
+		return err
+	}
+
+	var input struct {
+		Body            string `json:"body"`
+		ParentID        *uint  `json:"parent_id"`
+		ReportVersionID *uint  `json:"report_version_id"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	input.Body = strings.TrimSpace(input.Body)
+	if input.Body == "" {
+		return c.Status(422).JSON(fiber.Map{"error": "Comment body is required"})
+	}
+
+	comment := models.ReportComment{
+		ReportID: report.ID,
+		ParentID: input.ParentID,
+		UserID:   middleware.GetCurrentUserID(c),
+		Body:     input.Body,
+	}
+
+	if input.ParentID != nil {
+		// Replies stay on the parent's version
+		var parent models.ReportComment
+		if err := database.DB.Where("id = ? AND report_id = ?", *input.ParentID, report.ID).First(&parent).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Parent comment not found"})
+		}
+		comment.ReportVersionID = parent.ReportVersionID
+	} else if input.ReportVersionID != nil {
+		var version models.ReportVersion
+		if err := database.DB.Where("id = ? AND report_id = ?", *input.ReportVersionID, report.ID).First(&version).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Report version not found"})
+		}
+		comment.ReportVersionID = version.ID
+	} else {
+		version := latestReportVersion(database.DB, report.ID)
+		if version == nil {
+			return c.Status(422).JSON(fiber.Map{"error": "The student has not submitted the report yet"})
+		}
+		comment.ReportVersionID = version.ID
+	}
+
+	if err := database.DB.Create(&comment).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	database.DB.Preload("User").First(&comment, comment.ID)
+
+	return c.Status(201).JSON(fiber.Map{"data": comment})
+}
+
+// GetReportHistory lists every version of a report, newest first, with its
+// file, reviews and comment threads
+func GetReportHistory(c *fiber.Ctx) error {
+	report, _, err := findReportForUser(c)
+	if report == nil {
+		return err
+	}
+
+	var versions []models.ReportVersion
+	database.DB.Where("report_id = ?", report.ID).
+		Preload("SubmittedBy").
+		Preload("Reviews", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC, id ASC")
+		}).
+		Preload("Reviews.Reviewer").
+		Preload("Comments", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC, id ASC")
+		}).
+		Preload("Comments.User").
+		Order("version DESC").
+		Find(&versions)
+
+	ids := make([]uint, len(versions))
+	for i := range versions {
+		ids[i] = versions[i].ID
+	}
+	files, _ := media.ListFor(database.DB, models.MediaModelReportVersion, ids, models.MediaCollectionFileLaporan)
+	for i := range versions {
+		versions[i].File = latestMedia(files, versions[i].ID)
+		versions[i].Comments = commentThreads(versions[i].Comments)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":   versions,
+		"report": report,
+		"count":  len(versions),
+	})
+}
+
+// commentThreads nests replies under their parent comment
+func commentThreads(comments []models.ReportComment) []models.ReportComment {
+	children := map[uint][]models.ReportComment{}
+	var roots []models.ReportComment
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+		} else {
+			children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+		}
+	}
+
+	var attach func(list []models.ReportComment) []models.ReportComment
+	attach = func(list []models.ReportComment) []models.ReportComment {
+		for i := range list {
+			list[i].Replies = attach(children[list[i].ID])
+		}
+		return list
+	}
+	return attach(roots)
+}
@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// --- Rubric Handlers ---
+
+var rubricRoles = []string{models.RubricRoleCompany, models.RubricRoleLecturer, models.RubricRoleExaminer}
+
+func isRubricRole(role string) bool {
+	for _, r := range rubricRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func preloadCriteria(db *gorm.DB) *gorm.DB {
+	return db.Order("position ASC, id ASC")
+}
+
+func GetRubrics(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.Rubric{}).
+		Preload("Criteria", preloadCriteria).
+		Preload("ProgramStudi")
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if prodiID := c.Query("id_program_studi"); prodiID != "" {
+		query = query.Where("id_program_studi = ?", prodiID)
+	}
+	if c.Query("all") != "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var rubrics []models.Rubric
+	if err := query.Order("role ASC, id_program_studi ASC, version DESC").Find(&rubrics).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":  rubrics,
+		"count": len(rubrics),
+	})
+}
+
+func GetRubric(c *fiber.Ctx) error {
+	var rubric models.Rubric
+	if err := database.DB.Preload("Criteria", preloadCriteria).Preload("ProgramStudi").First(&rubric, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+	return c.JSON(fiber.Map{"data": rubric})
+}
+
+type rubricInput struct {
+	Name           string `json:"name"`
+	Role           string `json:"role"`
+	IDProgramStudi *uint  `json:"id_program_studi"`
+	Criteria       []struct {
+		Name        string  `json:"name"`
+		Description string  `json:"description"`
+		Weight      float64 `json:"weight"`
+		MinScore    float64 `json:"min_score"`
+		MaxScore    float64 `json:"max_score"`
+	} `json:"criteria"`
+}
+
+// validate checks the role and that every criterion has a name, a positive
+// weight and a score range
+func (in rubricInput) validate() string {
+	if strings.TrimSpace(in.Name) == "" {
+		return "Name is required"
+	}
+	if !isRubricRole(in.Role) {
+		return "Role must be company, lecturer or examiner"
+	}
+	if len(in.Criteria) == 0 {
+		return "At least one criterion is required"
+	}
+	for i, criterion := range in.Criteria {
+		if strings.TrimSpace(criterion.Name) == "" {
+			return fmt.Sprintf("Criterion %d: name is required", i+1)
+		}
+		if criterion.Weight <= 0 {
+			return fmt.Sprintf("Criterion %d: weight must be positive", i+1)
+		}
+		if criterion.MaxScore <= criterion.MinScore {
+			return fmt.Sprintf("Criterion %d: max_score must be greater than min_score", i+1)
+		}
+	}
+	return ""
+}
+
+func (in rubricInput) criteria() []models.RubricCriterion {
+	criteria := make([]models.RubricCriterion, len(in.Criteria))
+	for i, criterion := range in.Criteria {
+		criteria[i] = models.RubricCriterion{
+			Name:        strings.TrimSpace(criterion.Name),
+			Description: criterion.Description,
+			Weight:      criterion.Weight,
+			MinScore:    criterion.MinScore,
+			MaxScore:    criterion.MaxScore,
+			Position:    i + 1,
+		}
+	}
+	return criteria
+}
+
+// scopedRubrics narrows a query to the rubrics of a role and program studi
+func scopedRubrics(db *gorm.DB, role string, prodiID *uint) *gorm.DB {
+	db = db.Model(&models.Rubric{}).Where("role = ?", role)
+	if prodiID != nil {
+		return db.Where("id_program_studi = ?", *prodiID)
+	}
+	return db.Where("id_program_studi IS NULL")
+}
+
+// createRubricVersion stores a rubric as the next version of its scope and
+// deactivates the versions before it
+func createRubricVersion(c *fiber.Ctx, tx *gorm.DB, in rubricInput) (*models.Rubric, error) {
+	userID := middleware.GetCurrentUserID(c)
+	rubric := models.Rubric{
+		Name:           strings.TrimSpace(in.Name),
+		Role:           in.Role,
+		IDProgramStudi: in.IDProgramStudi,
+		Version:        1,
+		IsActive:       true,
+		CreatedByID:    &userID,
+		Criteria:       in.criteria(),
+	}
+
+	var latest models.Rubric
+	if err := scopedRubrics(tx, in.Role, in.IDProgramStudi).Order("version DESC").First(&latest).Error; err == nil {
+		rubric.Version = latest.Version + 1
+		rubric.PreviousID = &latest.ID
+	}
+	if err := scopedRubrics(tx, in.Role, in.IDProgramStudi).Where("is_active = ?", true).Update("is_active", false).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&rubric).Error; err != nil {
+		return nil, err
+	}
+	return &rubric, nil
+}
+
+// CreateRubric adds a rubric; an existing rubric for the same role and
+// program studi is superseded by it
+func CreateRubric(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var input rubricInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if msg := input.validate(); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+
+	var rubric *models.Rubric
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		rubric, err = createRubricVersion(c, tx, input)
+		return err
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(fiber.Map{"data": rubric})
+}
+
+// UpdateRubric edits a rubric in place while nothing has been scored with
+// it; otherwise the changes become a new version so existing scores keep
+// the criteria they were given on
+func UpdateRubric(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var rubric models.Rubric
+	if err := database.DB.First(&rubric, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+
+	var input rubricInput
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	// A rubric stays in its scope; a different scope is a new rubric
+	input.Role = rubric.Role
+	input.IDProgramStudi = rubric.IDProgramStudi
+	if msg := input.validate(); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
+
+	var used int64
+	database.DB.Model(&models.EvaluationScore{}).Where("rubric_id = ?", rubric.ID).Count(&used)
+
+	result := &rubric
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if used > 0 {
+			var err error
+			result, err = createRubricVersion(c, tx, input)
+			return err
+		}
+
+		if err := tx.Where("rubric_id = ?", rubric.ID).Delete(&models.RubricCriterion{}).Error; err != nil {
+			return err
+		}
+		rubric.Name = strings.TrimSpace(input.Name)
+		rubric.Criteria = input.criteria()
+		return tx.Save(&rubric).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	database.DB.Preload("Criteria", preloadCriteria).First(result, result.ID)
+	return c.JSON(fiber.Map{"data": result, "new_version": used > 0})
+}
+
+// DeleteRubric removes an unused rubric and deactivates a used one, so
+// graded evaluations keep their breakdown
+func DeleteRubric(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var rubric models.Rubric
+	if err := database.DB.First(&rubric, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+
+	var used int64
+	database.DB.Model(&models.EvaluationScore{}).Where("rubric_id = ?", rubric.ID).Count(&used)
+	if used > 0 {
+		database.DB.Model(&rubric).Update("is_active", false)
+		return c.SendStatus(204)
+	}
+
+	database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("rubric_id = ?", rubric.ID).Delete(&models.RubricCriterion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&rubric).Error
+	})
+	return c.SendStatus(204)
+}
+
+// activeRubric returns the active rubric of a role for a program studi,
+// falling back to the default rubric of the role
+func activeRubric(role string, prodiID *uint) *models.Rubric {
+	var rubric models.Rubric
+	if prodiID != nil {
+		if err := scopedRubrics(database.DB, role, prodiID).Where("is_active = ?", true).
+			Preload("Criteria", preloadCriteria).Order("version DESC").First(&rubric).Error; err == nil {
+			return &rubric
+		}
+	}
+	if err := scopedRubrics(database.DB, role, nil).Where("is_active = ?", true).
+		Preload("Criteria", preloadCriteria).Order("version DESC").First(&rubric).Error; err == nil {
+		return &rubric
+	}
+	return nil
+}
+
+// evaluationRubric returns the rubric a role grades an evaluation with: the
+// version it was already scored with, or the active one
+func evaluationRubric(evaluationID uint, role string, prodiID *uint) *models.Rubric {
+	var score models.EvaluationScore
+	if evaluationID != 0 {
+		if err := database.DB.Where("evaluation_id = ? AND role = ?", evaluationID, role).First(&score).Error; err == nil {
+			var rubric models.Rubric
+			if err := database.DB.Preload("Criteria", preloadCriteria).First(&rubric, score.RubricID).Error; err == nil {
+				return &rubric
+			}
+		}
+	}
+	return activeRubric(role, prodiID)
+}
+
+// evaluatorRole returns the rubric role the current user grades an
+// application as, or "" when they do not grade it with a rubric
+func evaluatorRole(c *fiber.Ctx, applyJob *models.ApplyJob) string {
+	switch reportReviewerRole(c, applyJob) {
+	case models.ReportReviewerCompany:
+		return models.RubricRoleCompany
+	case models.ReportReviewerLecturer:
+		return models.RubricRoleLecturer
+	case models.ReportReviewerExaminer:
+		return models.RubricRoleExaminer
+	}
+	return ""
+}
+
+type criterionScoreInput struct {
+	CriterionID uint    `json:"criterion_id"`
+	Score       float64 `json:"score"`
+	Note        *string `json:"note"`
+}
+
+// scoreRubric checks that every criterion of the rubric is scored within its
+// range and rolls the scores up into a 0-100 grade score: each score is
+// scaled to its range and weighted
+func scoreRubric(rubric *models.Rubric, scores []criterionScoreInput) (float64, error) {
+	given := map[uint]float64{}
+	for _, score := range scores {
+		given[score.CriterionID] = score.Score
+	}
+	if len(given) != len(scores) {
+		return 0, errors.New("each criterion can only be scored once")
+	}
+
+	var total, weights float64
+	for _, criterion := range rubric.Criteria {
+		score, ok := given[criterion.ID]
+		if !ok {
+			return 0, fmt.Errorf("criterion %q is not scored", criterion.Name)
+		}
+		if score < criterion.MinScore || score > criterion.MaxScore {
+			return 0, fmt.Errorf("score for %q must be between %g and %g", criterion.Name, criterion.MinScore, criterion.MaxScore)
+		}
+		delete(given, criterion.ID)
+
+		total += (score - criterion.MinScore) / (criterion.MaxScore - criterion.MinScore) * 100 * criterion.Weight
+		weights += criterion.Weight
+	}
+	if len(given) > 0 {
+		return 0, errors.New("scores contain criteria outside the rubric")
+	}
+	if weights == 0 {
+		return 0, errors.New("rubric has no weighted criteria")
+	}
+	return math.Round(total/weights*100) / 100, nil
+}
+
+// saveEvaluationScores replaces the scores a role gave on an evaluation
+func saveEvaluationScores(tx *gorm.DB, evaluationID uint, rubric *models.Rubric, role string, evaluatorID uint, scores []criterionScoreInput) error {
+	if err := tx.Where("evaluation_id = ? AND role = ?", evaluationID, role).Delete(&models.EvaluationScore{}).Error; err != nil {
+		return err
+	}
+	for _, score := range scores {
+		row := models.EvaluationScore{
+			EvaluationID:      evaluationID,
+			RubricID:          rubric.ID,
+			RubricCriterionID: score.CriterionID,
+			Role:              role,
+			Score:             score.Score,
+			Note:              score.Note,
+			EvaluatorID:       evaluatorID,
+		}
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rubricBreakdown is the per-criterion grading of one role
+type rubricBreakdown struct {
+	Role   string                   `json:"role"`
+	Rubric *models.Rubric           `json:"rubric"`
+	Scores []models.EvaluationScore `json:"scores"`
+	Total  float64                  `json:"total"`
+}
+
+// evaluationBreakdown returns the rubric scores of an evaluation per role
+func evaluationBreakdown(evaluation *models.Evaluation) []rubricBreakdown {
+	var scores []models.EvaluationScore
+	database.DB.Preload("Criterion").Where("evaluation_id = ?", evaluation.ID).
+		Joins("JOIN rubric_criteria ON rubric_criteria.id = evaluation_scores.rubric_criterion_id").
+		Order("rubric_criteria.position ASC, evaluation_scores.id ASC").
+		Find(&scores)
+
+	totals := map[string]float64{
+		models.RubricRoleCompany:  evaluation.CompanyGradeScore,
+		models.RubricRoleLecturer: evaluation.LecturerGradeScore,
+		models.RubricRoleExaminer: evaluation.ExaminerGradeScore,
+	}
+
+	breakdown := make([]rubricBreakdown, 0)
+	for _, role := range rubricRoles {
+		entry := rubricBreakdown{Role: role, Scores: []models.EvaluationScore{}, Total: totals[role]}
+		for _, score := range scores {
+			if score.Role != role {
+				continue
+			}
+			if entry.Rubric == nil {
+				var rubric models.Rubric
+				if err := database.DB.First(&rubric, score.RubricID).Error; err == nil {
+					entry.Rubric = &rubric
+				}
+			}
+			entry.Scores = append(entry.Scores, score)
+		}
+		if len(entry.Scores) > 0 {
+			breakdown = append(breakdown, entry)
+		}
+	}
+	return breakdown
+}
+
+// GetEvaluationRubric returns the rubric the current user grades an
+// application with (route param "id" is the apply_job_id). Admins may pick
+// the role with ?role=.
+func GetEvaluationRubric(c *fiber.Ctx) error {
+	var applyJob models.ApplyJob
+	if err := database.DB.Preload("Users").First(&applyJob, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Apply Job not found"})
+	}
+	if !canAccessApplyJob(c, applyJob.ID) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	role := evaluatorRole(c, &applyJob)
+	if middleware.IsAdmin(c) && c.Query("role") != "" {
+		role = c.Query("role")
+	}
+	if role == "" {
+		return c.Status(403).JSON(fiber.Map{"error": "You do not grade this application"})
+	}
+
+	var evaluation models.Evaluation
+	database.DB.Where("apply_job_id = ?", applyJob.ID).First(&evaluation)
+
+	rubric := evaluationRubric(evaluation.ID, role, firstProdiID(&applyJob))
+	if rubric == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "No rubric configured for " + role})
+	}
+
+	var scores []models.EvaluationScore
+	if evaluation.ID != 0 {
+		database.DB.Where("evaluation_id = ? AND role = ?", evaluation.ID, role).Find(&scores)
+	}
+
+	return c.JSON(fiber.Map{
+		"role":   role,
+		"data":   rubric,
+		"scores": scores,
+	})
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+	"mbkm-go/internal/queue"
+	"mbkm-go/internal/siakad"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// --- SIAKAD Sync Handlers ---
+
+// StartSiakadSync queues a sync from the configured SIAKAD source (admin).
+// Optional entities limits it to students, lecturers and/or courses. Returns
+// 202 with the queue job, whose result names the sync run.
+func StartSiakadSync(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+	if siakad.Default == nil {
+		return c.Status(503).JSON(fiber.Map{"error": "SIAKAD_SOURCE is not configured"})
+	}
+
+	var input siakadSyncRequest
+	c.BodyParser(&input)
+	if err := siakad.ValidateEntities(input.Entities); err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return enqueueJob(c, jobSiakadSync, input, queue.Options{UniqueKey: jobSiakadSync})
+}
+
+// siakadSyncRequest is the payload of a SIAKAD sync job
+type siakadSyncRequest struct {
+	Entities []string `json:"entities"`
+	Trigger  string   `json:"trigger,omitempty"` // manual (default) or scheduled
+}
+
+// ScheduleSiakadSync queues a full SIAKAD sync at the start of every
+// interval, from the first one after it starts, until ctx is done. Every
+// server runs the schedule: the job of an interval is queued once, and
+// skipped while another sync is queued or running.
+func ScheduleSiakadSync(ctx context.Context, interval time.Duration) {
+	check := time.Minute
+	if interval < check {
+		check = interval
+	}
+	ticker := time.NewTicker(check)
+	defer ticker.Stop()
+
+	last := time.Now().Truncate(interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			slot := now.Truncate(interval)
+			if !slot.After(last) {
+				continue
+			}
+			last = slot
+
+			var queued int64
+			database.DB.Model(&models.QueueJob{}).Where("type = ? AND run_at = ?", jobSiakadSync, slot).Count(&queued)
+			if queued > 0 {
+				continue
+			}
+			_, err := queue.Enqueue(database.DB, jobSiakadSync, siakadSyncRequest{Trigger: "scheduled"},
+				queue.Options{UniqueKey: jobSiakadSync, RunAt: slot})
+			if errors.Is(err, queue.ErrDuplicate) {
+				log.Printf("SIAKAD sync: scheduled run skipped, another sync is queued or running")
+			} else if err != nil {
+				log.Printf("SIAKAD sync: %v", err)
+			}
+		}
+	}
+}
+
+// siakadSyncJob runs a manual or scheduled SIAKAD sync. A run that fails, or finds
+// another one running, is tried again later.
+func siakadSyncJob(ctx context.Context, job *queue.Job) error {
+	var input siakadSyncRequest
+	if err := job.Decode(&input); err != nil {
+		return err
+	}
+	if siakad.Default == nil {
+		return queue.Permanent(errors.New("SIAKAD_SOURCE is not configured"))
+	}
+
+	trigger := input.Trigger
+	if trigger == "" {
+		trigger = "manual"
+	}
+	run, err := siakad.Default.Run(ctx, trigger, input.Entities, job.CreatedByID)
+	if err != nil {
+		return err
+	}
+	job.SetResult(run)
+	if run.Status == models.SyncRunFailed {
+		return fmt.Errorf("sync run #%d failed: %s", run.ID, *run.Error)
+	}
+	return nil
+}
+
+// GetSyncRuns lists SIAKAD sync runs, latest first (admin; status)
+func GetSyncRuns(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("per_page", "10"))
+	offset := (page - 1) * limit
+
+	query := database.DB.Model(&models.SyncRun{}).Preload("TriggeredBy")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var runs []models.SyncRun
+	if err := query.Order("started_at DESC").Offset(offset).Limit(limit).Find(&runs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+	return c.JSON(fiber.Map{"data": runs, "count": total})
+}
+
+// GetSyncRun shows a run with the records it could not apply (admin;
+// entity filters the errors)
+func GetSyncRun(c *fiber.Ctx) error {
+	if !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var run models.SyncRun
+	errorsQuery := func(db *gorm.DB) *gorm.DB {
+		if entity := c.Query("entity"); entity != "" {
+			db = db.Where("entity = ?", entity)
+		}
+		return db.Order("id ASC")
+	}
+	if err := database.DB.Preload("TriggeredBy").Preload("Errors", errorsQuery).First(&run, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Sync run not found"})
+	}
+	return c.JSON(fiber.Map{"data": run})
+}
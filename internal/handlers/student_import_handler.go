@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/importer"
+	"mbkm-go/internal/middleware"
+	"mbkm-go/internal/models"
+	"mbkm-go/internal/queue"
+	"mbkm-go/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// --- Student Import Handlers ---
+
+// canImportStudents reports whether the current user may import students:
+// admin, or prodi staff for their own program studi
+func canImportStudents(c *fiber.Ctx) bool {
+	return middleware.IsAdmin(c) || staffProdiID(c) != nil
+}
+
+// importErrorsCSV writes one line per problem of the rows of an import
+func importErrorsCSV(c *fiber.Ctx, name string, errors []models.StudentImportError) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"row", "nim", "column", "message"})
+	for _, e := range errors {
+		w.Write([]string{strconv.Itoa(e.Row), e.NIM, e.Column, e.Message})
+	}
+	w.Flush()
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, name))
+	return c.Send(buf.Bytes())
+}
+
+// ImportStudents imports students from a CSV or XLSX file (multipart file).
+// Columns are found by header (name, nim, birthdate, program_studi, status,
+// email, semester, phone_number) or by mapping, a JSON object of field to
+// header. Students are upserted by NIM in the background: the response is
+// 202 with the queue job, whose result names the import. With dry_run
+// nothing is written and the per-row outcome is returned right away;
+// format=csv returns the rows with errors as CSV instead.
+func ImportStudents(c *fiber.Ctx) error {
+	if !canImportStudents(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "File required"})
+	}
+	f, err := file.Open()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to open file"})
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to read file"})
+	}
+
+	table, err := importer.Read(file.Filename, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	userID := middleware.GetCurrentUserID(c)
+	opts := importer.Options{
+		FileName:     file.Filename,
+		DryRun:       c.QueryBool("dry_run") || c.FormValue("dry_run") == "true",
+		ImportedByID: &userID,
+	}
+	if mapping := c.FormValue("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &opts.Mapping); err != nil {
+			return c.Status(422).JSON(fiber.Map{"error": "mapping must be a JSON object of field to column header"})
+		}
+	}
+	if _, err := importer.Columns(table.Header, opts.Mapping); err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !middleware.IsAdmin(c) {
+		opts.ProdiID = staffProdiID(c)
+	}
+
+	if !opts.DryRun {
+		key := path.Join("imports", uuid.New().String()+path.Ext(strings.ToLower(file.Filename)))
+		if err := storage.Default.Put(c.UserContext(), key, data, file.Header.Get(fiber.HeaderContentType)); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Failed to store file"})
+		}
+		return enqueueJob(c, jobImportStudents, studentImportFile{
+			Key:      key,
+			FileName: file.Filename,
+			Mapping:  opts.Mapping,
+			ProdiID:  opts.ProdiID,
+		}, queue.Options{MaxAttempts: 3})
+	}
+
+	record, results, err := importer.Run(database.DB, table, opts)
+	if err != nil {
+		return c.Status(422).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if c.Query("format") == "csv" {
+		var problems []models.StudentImportError
+		for _, r := range results {
+			for _, e := range r.Errors {
+				problems = append(problems, models.StudentImportError{Row: r.Row, NIM: r.NIM, Column: e.Column, Message: e.Message})
+			}
+		}
+		return importErrorsCSV(c, "import-errors.csv", problems)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":    record,
+		"rows":    results,
+		"valid":   record.Failed == 0,
+		"dry_run": true,
+	})
+}
+
+// studentImportFile is the payload of a student import job: the upload kept
+// in storage until the import is done
+type studentImportFile struct {
+	Key      string            `json:"key"`
+	FileName string            `json:"file_name"`
+	Mapping  map[string]string `json:"mapping,omitempty"`
+	ProdiID  *uint             `json:"prodi_id,omitempty"`
+}
+
+// importStudentsJob runs a queued student import. Its attempts share one
+// import record, and the upload is deleted once the job succeeds or fails
+// for good.
+func importStudentsJob(ctx context.Context, job *queue.Job) (err error) {
+	var input studentImportFile
+	if err := job.Decode(&input); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil && !queue.IsPermanent(err) && (!job.LastAttempt() || ctx.Err() != nil) {
+			return // tried again
+		}
+		if err := storage.Default.Delete(context.Background(), input.Key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Student import job #%d: delete %s: %v", job.ID, input.Key, err)
+		}
+	}()
+
+	reader, err := storage.Default.Get(ctx, input.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return queue.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+	table, err := importer.Read(input.FileName, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return queue.Permanent(err)
+	}
+
+	record, _, err := importer.Run(database.DB, table, importer.Options{
+		FileName:     input.FileName,
+		Mapping:      input.Mapping,
+		ProdiID:      input.ProdiID,
+		ImportedByID: job.CreatedByID,
+		QueueJobID:   &job.ID,
+		Progress: func(done, total int) {
+			job.SetProgress(done*100/total, fmt.Sprintf("%d of %d rows written", done, total))
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	job.SetResult(fiber.Map{
+		"student_import_id": record.ID,
+		"total_rows":        record.TotalRows,
+		"created":           record.Created,
+		"updated":           record.Updated,
+		"failed":            record.Failed,
+	})
+	return nil
+}
+
+// studentImportsQuery returns the imports the current user may see: all for
+// admin, their own for prodi staff
+func studentImportsQuery(c *fiber.Ctx) *gorm.DB {
+	query := database.DB.Model(&models.StudentImport{})
+	if !middleware.IsAdmin(c) {
+		query = query.Where("imported_by_id = ?", middleware.GetCurrentUserID(c))
+	}
+	return query
+}
+
+// GetStudentImports lists past imports, latest first (status)
+func GetStudentImports(c *fiber.Ctx) error {
+	if !canImportStudents(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+	limit, _ := strconv.Atoi(c.Query("per_page", "10"))
+	offset := (page - 1) * limit
+
+	query := studentImportsQuery(c).Preload("ImportedBy")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var imports []models.StudentImport
+	if err := query.Order("started_at DESC").Offset(offset).Limit(limit).Find(&imports).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+	return c.JSON(fiber.Map{"data": imports, "count": total})
+}
+
+// GetStudentImport shows an import with the rows it could not apply
+func GetStudentImport(c *fiber.Ctx) error {
+	if !canImportStudents(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var record models.StudentImport
+	errorsQuery := func(db *gorm.DB) *gorm.DB { return db.Order(`"row" ASC, id ASC`) }
+	if err := studentImportsQuery(c).Preload("ImportedBy").Preload("Errors", errorsQuery).First(&record, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Import not found"})
+	}
+	return c.JSON(fiber.Map{"data": record})
+}
+
+// GetStudentImportErrors downloads the rows an import could not apply as CSV
+func GetStudentImportErrors(c *fiber.Ctx) error {
+	if !canImportStudents(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Forbidden"})
+	}
+
+	var record models.StudentImport
+	if err := studentImportsQuery(c).First(&record, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Import not found"})
+	}
+	var errors []models.StudentImportError
+	database.DB.Where("student_import_id = ?", record.ID).Order(`"row" ASC, id ASC`).Find(&errors)
+	return importErrorsCSV(c, fmt.Sprintf("import-%d-errors.csv", record.ID), errors)
+}
@@ -11,16 +11,31 @@ import (
 
 // --- User Handlers ---
 
+// findProgramStudi loads the program studi a user is linked to, with its
+// fakultas
+func findProgramStudi(id uint) (*models.ProgramStudi, error) {
+	var prodi models.ProgramStudi
+	if err := database.DB.Preload("Fakultas").First(&prodi, id).Error; err != nil {
+		return nil, err
+	}
+	return &prodi, nil
+}
+
 func GetUsers(c *fiber.Ctx) error {
 	var users []models.User
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 	limit, _ := strconv.Atoi(c.Query("per_page", "10"))
 	offset := (page - 1) * limit
 
+	query := database.DB.Model(&models.User{}).Scopes(scopeUsers(c))
+	if prodiID := c.Query("id_program_studi"); prodiID != "" {
+		query = query.Where("id_program_studi = ?", prodiID)
+	}
+
 	var total int64
-	database.DB.Model(&models.User{}).Count(&total)
+	query.Count(&total)
 
-	database.DB.Preload("Roles").Offset(offset).Limit(limit).Find(&users)
+	query.Preload("Roles").Preload("ProgramStudi").Offset(offset).Limit(limit).Find(&users)
 	return c.JSON(fiber.Map{
 		"data":  users,
 		"count": total,
@@ -34,6 +49,8 @@ func CreateUser(c *fiber.Ctx) error {
 		Password string `json:"password"`
 		Role     string `json:"role"`
 		Roles    []uint `json:"roles"`
+
+		IDProgramStudi *uint `json:"id_program_studi"`
 	}
 	input := new(UserInput)
 	if err := c.BodyParser(input); err != nil {
@@ -47,6 +64,13 @@ func CreateUser(c *fiber.Ctx) error {
 		Password: string(hash),
 		Role:     input.Role, // Default 'student' if empty, handled by DB default usually
 	}
+	if input.IDProgramStudi != nil {
+		prodi, err := findProgramStudi(*input.IDProgramStudi)
+		if err != nil {
+			return c.Status(422).JSON(fiber.Map{"error": "Program studi not found"})
+		}
+		user.SetProgramStudi(prodi)
+	}
 
 	if result := database.DB.Create(&user); result.Error != nil {
 		return c.Status(500).JSON(fiber.Map{"error": result.Error.Error()})
@@ -64,7 +88,7 @@ func CreateUser(c *fiber.Ctx) error {
 func GetUserDetail(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var user models.User
-	if err := database.DB.Preload("Roles").First(&user, id).Error; err != nil {
+	if err := database.DB.Preload("Roles").Preload("ProgramStudi.Fakultas").Scopes(scopeUsers(c)).First(&user, id).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 	}
 	return c.JSON(fiber.Map{"data": user})
@@ -78,10 +102,13 @@ func UpdateUser(c *fiber.Ctx) error {
 	}
 
 	type UserUpdateInput struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		Roles    []uint `json:"roles"`
+		Name     string  `json:"name"`
+		Email    string  `json:"email"`
+		Password string  `json:"password"`
+		NIDN     *string `json:"nidn"`
+		Roles    []uint  `json:"roles"`
+
+		IDProgramStudi *uint `json:"id_program_studi"`
 		// Add other fields as necessary
 	}
 	input := new(UserUpdateInput)
@@ -92,11 +119,19 @@ func UpdateUser(c *fiber.Ctx) error {
 	updates := models.User{
 		Name:  input.Name,
 		Email: input.Email,
+		NIDN:  input.NIDN,
 	}
 	if input.Password != "" {
 		hash, _ := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 		updates.Password = string(hash)
 	}
+	if input.IDProgramStudi != nil {
+		prodi, err := findProgramStudi(*input.IDProgramStudi)
+		if err != nil {
+			return c.Status(422).JSON(fiber.Map{"error": "Program studi not found"})
+		}
+		updates.SetProgramStudi(prodi)
+	}
 
 	database.DB.Model(&user).Updates(updates)
 
@@ -180,7 +215,7 @@ func GetStudents(c *fiber.Ctx) error {
 	offset := (page - 1) * limit
 	status := c.Query("status")
 
-	query := database.DB.Model(&models.User{}).Where("role = ?", "student").Preload("Roles")
+	query := database.DB.Model(&models.User{}).Where("role = ?", "student").Scopes(scopeStudents(c)).Preload("Roles")
 
 	switch status {
 	case "Aktif":
@@ -1,45 +1,111 @@
 package handlers
 
 import (
-	"encoding/csv"
 	"fmt"
-	"io"
+	"math"
 	"mbkm-go/internal/database"
+	"mbkm-go/internal/middleware"
 	"mbkm-go/internal/models"
 	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // --- Settings (Bobot Nilai) ---
 
+// resolveBobotNilai returns the weights version of a program studi that
+// applies to a placement of a program type starting on date: a version for
+// the program type wins over a general one, the latest effective date wins
+// among those
+func resolveBobotNilai(prodiID uint, programType string, date time.Time) (models.BobotNilai, error) {
+	var bobot models.BobotNilai
+	query := database.DB.Where("id_program_studi = ?", prodiID).
+		Where("effective_from IS NULL OR effective_from <= ?", date)
+	if programType != "" {
+		query = query.Where("program_type = ? OR program_type IS NULL", programType).
+			Order("program_type IS NULL ASC")
+	} else {
+		query = query.Where("program_type IS NULL")
+	}
+	err := query.Order("effective_from DESC NULLS LAST, id DESC").First(&bobot).Error
+	return bobot, err
+}
+
+// validateBobotNilai checks that the weights are not negative and add up to 100
+func validateBobotNilai(perusahaan, pembimbing, penguji float64) string {
+	if perusahaan < 0 || pembimbing < 0 || penguji < 0 {
+		return "Weights cannot be negative"
+	}
+	if total := perusahaan + pembimbing + penguji; math.Abs(total-100) > 0.001 {
+		return fmt.Sprintf("Weights must add up to 100, got %g", total)
+	}
+	return ""
+}
+
+// GetBobotNilai returns the weights version in effect for prodi_id (default
+// the program studi of the current user, required without one), optionally
+// for a program_type and on a date (YYYY-MM-DD, default today)
 func GetBobotNilai(c *fiber.Ctx) error {
-	// Logic from Laravel: get_id_program_studi() usually fetches from auth user's prodi if applicable, or general.
-	// We'll simplisticly list all or filter by query `prodi_id`.
 	prodiID, _ := strconv.Atoi(c.Query("prodi_id"))
+	if user := middleware.GetCurrentUser(c); prodiID == 0 && user != nil && user.IDProgramStudi != nil {
+		prodiID = int(*user.IDProgramStudi)
+	}
 
-	var bobot models.BobotNilai
-	query := database.DB.Model(&models.BobotNilai{})
-
-	if prodiID != 0 {
-		query = query.Where("id_program_studi = ?", prodiID)
-	} else {
-		// Try fetch where id_program_studi is NOT NULL if no specific filter (mimicking Laravel's behavior often picking first available)
-		query = query.Where("id_program_studi IS NOT NULL")
+	if prodiID == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "prodi_id is required"})
 	}
 
-	if err := query.First(&bobot).Error; err != nil {
+	date := time.Now()
+	if d := c.Query("date"); d != "" {
+		parsed, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "date must be YYYY-MM-DD"})
+		}
+		date = parsed
+	}
+	bobot, err := resolveBobotNilai(uint(prodiID), c.Query("program_type"), date)
+	if err != nil {
 		return c.Status(404).JSON(fiber.Map{"data": nil}) // Return null data if not set
 	}
 
 	return c.JSON(fiber.Map{"data": bobot})
 }
 
+// GetBobotNilaiHistory lists every weights version, filterable by prodi_id
+// and program_type, newest first
+func GetBobotNilaiHistory(c *fiber.Ctx) error {
+	query := database.DB.Model(&models.BobotNilai{})
+	if prodiID := c.Query("prodi_id"); prodiID != "" {
+		query = query.Where("id_program_studi = ?", prodiID)
+	}
+	if programType := c.Query("program_type"); programType != "" {
+		query = query.Where("program_type = ?", programType)
+	}
+
+	var versions []models.BobotNilai
+	if err := query.Order("id_program_studi ASC, program_type ASC NULLS FIRST, effective_from DESC NULLS LAST, id DESC").Find(&versions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch data"})
+	}
+
+	// Count the finalized evaluations graded with each version
+	for i := range versions {
+		var used int64
+		database.DB.Model(&models.Evaluation{}).Where("bobot_nilai_id = ?", versions[i].ID).Count(&used)
+		versions[i].EvaluationCount = used
+	}
+
+	return c.JSON(fiber.Map{"data": versions, "count": len(versions)})
+}
+
+// UpdateBobotNilai adds a weights version. Earlier versions are kept so
+// grades computed with them do not change; a version starting on the same
+// date for the same scope is replaced while no evaluation used it.
 func UpdateBobotNilai(c *fiber.Ctx) error {
 	type BobotInput struct {
 		IDProgramStudi       uint    `json:"id_program_studi"`
+		ProgramType          string  `json:"program_type"`
+		EffectiveFrom        string  `json:"effective_from"` // YYYY-MM-DD, default today
 		BobotNilaiPerusahaan float64 `json:"bobot_nilai_perusahaan"`
 		BobotNilaiPembimbing float64 `json:"bobot_nilai_pembimbing"`
 		BobotNilaiPenguji    float64 `json:"bobot_nilai_penguji"`
@@ -50,131 +116,57 @@ func UpdateBobotNilai(c *fiber.Ctx) error {
 	}
 
 	if input.IDProgramStudi == 0 {
-		// Attempt to get from Auth user if missing? Or require it.
-		// For now require it or default to 1 for testing.
 		return c.Status(400).JSON(fiber.Map{"error": "id_program_studi is required"})
 	}
+	if msg := validateBobotNilai(input.BobotNilaiPerusahaan, input.BobotNilaiPembimbing, input.BobotNilaiPenguji); msg != "" {
+		return c.Status(422).JSON(fiber.Map{"error": msg})
+	}
 
-	var bobot models.BobotNilai
-	if err := database.DB.Where("id_program_studi = ?", input.IDProgramStudi).First(&bobot).Error; err != nil {
-		// Create
-		bobot = models.BobotNilai{
-			IDProgramStudi:       input.IDProgramStudi,
-			BobotNilaiPerusahaan: input.BobotNilaiPerusahaan,
-			BobotNilaiPembimbing: input.BobotNilaiPembimbing,
-			BobotNilaiPenguji:    input.BobotNilaiPenguji,
+	now := time.Now()
+	effectiveFrom := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if input.EffectiveFrom != "" {
+		parsed, err := time.Parse("2006-01-02", input.EffectiveFrom)
+		if err != nil {
+			return c.Status(422).JSON(fiber.Map{"error": "effective_from must be YYYY-MM-DD"})
 		}
-		database.DB.Create(&bobot)
-		return c.Status(201).JSON(fiber.Map{"status": true, "data": bobot})
-	} else {
-		// Update
-		database.DB.Model(&bobot).Updates(map[string]interface{}{
-			"bobot_nilai_perusahaan": input.BobotNilaiPerusahaan,
-			"bobot_nilai_pembimbing": input.BobotNilaiPembimbing,
-			"bobot_nilai_penguji":    input.BobotNilaiPenguji,
-		})
-		return c.Status(200).JSON(fiber.Map{"status": true, "data": bobot})
+		effectiveFrom = parsed
 	}
-}
 
-// --- Import Handlers ---
-
-func ImportStudents(c *fiber.Ctx) error {
-	// Parse file
-	file, err := c.FormFile("file")
-	if err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "File required"})
+	bobot := models.BobotNilai{
+		IDProgramStudi:       input.IDProgramStudi,
+		EffectiveFrom:        &effectiveFrom,
+		BobotNilaiPerusahaan: input.BobotNilaiPerusahaan,
+		BobotNilaiPembimbing: input.BobotNilaiPembimbing,
+		BobotNilaiPenguji:    input.BobotNilaiPenguji,
 	}
-
-	f, err := file.Open()
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to open file"})
+	if input.ProgramType != "" {
+		bobot.ProgramType = &input.ProgramType
 	}
-	defer f.Close()
-
-	reader := csv.NewReader(f)
-	var users []models.User
-	// var roles []models.RoleUserStub
-
-	// Fetch 'student' role ID
-	var studentRole models.Role
-	database.DB.Where("title = ?", "student").First(&studentRole)
-	if studentRole.ID == 0 {
-		// Fallback id 2 based on seeder assumption
-		studentRole.ID = 2
+	if userID := middleware.GetCurrentUserID(c); userID != 0 {
+		bobot.CreatedByID = &userID
 	}
 
-	rowNum := 0
-	inserted := 0
-	for {
-		record, err := reader.Read()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			break
-		}
-		rowNum++
-		if rowNum == 1 { // Skip header
-			continue
-		}
-
-		if len(record) < 5 {
-			continue
-		}
-
-		// CSV Format: Name, NIM, Birthdate (m/d/Y), ProgramStudy, Status
-		name := record[0]
-		nim := record[1]
-		birthdateStr := record[2]
-		prodi := record[3]
-		status := record[4]
-
-		birthdate, _ := time.Parse("01/02/2006", birthdateStr)
-		if birthdate.IsZero() {
-			// Try other format?
-			birthdate, _ = time.Parse("2006-01-02", birthdateStr)
-		}
-
-		// Password: YYYYMMDD from birthdate
-		passwordRaw := birthdate.Format("20060102")
-		hash, _ := bcrypt.GenerateFromPassword([]byte(passwordRaw), bcrypt.DefaultCost)
-
-		email := fmt.Sprintf("%s@mbkm.ulbi.ac.id", nim)
-
-		user := models.User{
-			Name:         name,
-			Email:        email,
-			Username:     nim,
-			Password:     string(hash),
-			NIM:          &nim,
-			ProgramStudy: &prodi,
-			Status:       &status,
-			Role:         "student",
-			Birthdate:    &birthdate,
-			Verified:     false,
-			Approved:     false,
-		}
-
-		if err := database.DB.Create(&user).Error; err == nil {
-			users = append(users, user)
-			inserted++
-
-			// Attach Role
-			// Direct DB insert for Pivot might be faster or use Association
-			// Using Association:
-			database.DB.Model(&user).Association("Roles").Append(&models.Role{ID: studentRole.ID})
+	var existing models.BobotNilai
+	query := database.DB.Where("id_program_studi = ? AND effective_from = ?", input.IDProgramStudi, effectiveFrom)
+	if bobot.ProgramType != nil {
+		query = query.Where("program_type = ?", *bobot.ProgramType)
+	} else {
+		query = query.Where("program_type IS NULL")
+	}
+	if err := query.First(&existing).Error; err == nil {
+		var used int64
+		database.DB.Model(&models.Evaluation{}).Where("bobot_nilai_id = ?", existing.ID).Count(&used)
+		if used > 0 {
+			return c.Status(409).JSON(fiber.Map{"error": "The version starting on this date already graded evaluations; choose a later effective_from"})
 		}
+		bobot.ID = existing.ID
+		bobot.CreatedAt = existing.CreatedAt
+		database.DB.Save(&bobot)
+		return c.Status(200).JSON(fiber.Map{"status": true, "data": bobot})
 	}
 
-	return c.JSON(fiber.Map{
-		"status":       inserted > 0,
-		"total_import": inserted,
-	})
-}
-
-// Temporary Type for Pivot if needed, though GORM handles it via Association
-type RoleUserStub struct {
-	UserID uint
-	RoleID uint
+	if err := database.DB.Create(&bobot).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(fiber.Map{"status": true, "data": bobot})
 }
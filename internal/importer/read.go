@@ -0,0 +1,142 @@
+// Package importer imports student lists uploaded as CSV or XLSX. Columns
+// are found by their header, every row is validated before anything is
+// written, and students are upserted by NIM in chunked transactions. A dry
+// run returns the per-row outcome without writing.
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"mbkm-go/pkg/xlsx"
+)
+
+// Formats of an uploaded file
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Table is the content of an uploaded file: its header and the data rows,
+// with rows that could not be read kept as errors
+type Table struct {
+	Format string
+	Header []string
+	Rows   []Line
+	Broken []Result // unreadable lines, e.g. CSV quoting errors
+}
+
+// Line is a data row and its line number in the file (the header is 1)
+type Line struct {
+	Number int
+	Cells  []string
+}
+
+// Read reads an upload by its file extension (.csv or .xlsx). Blank lines
+// are skipped.
+func Read(name string, r io.ReaderAt, size int64) (*Table, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".xlsx":
+		rows, err := xlsx.Read(r, size)
+		if err != nil {
+			return nil, err
+		}
+		table := &Table{Format: FormatXLSX}
+		for i, cells := range rows {
+			table.add(i+1, cells)
+		}
+		return table, table.check()
+	case ".csv", ".txt", "":
+		return readCSV(io.NewSectionReader(r, 0, size))
+	default:
+		return nil, fmt.Errorf("unsupported file type %s, upload a .csv or .xlsx file", filepath.Ext(name))
+	}
+}
+
+// maxRecordLines bounds how many lines a quoted CSV field may span
+const maxRecordLines = 20
+
+// readCSV reads a comma or semicolon separated file line by line, so a line
+// that cannot be parsed is reported without stopping the import. A line
+// with an unclosed quote is joined with the following ones, as quoted
+// fields may hold line breaks.
+func readCSV(r io.Reader) (*Table, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n")
+
+	// Spreadsheets set to Indonesian locales export with semicolons
+	comma := ','
+	if strings.Count(lines[0], ";") > strings.Count(lines[0], ",") {
+		comma = ';'
+	}
+
+	table := &Table{Format: FormatCSV}
+	for i := 0; i < len(lines); i++ {
+		start := i
+		text := lines[i]
+		for strings.Count(text, `"`)%2 == 1 && i+1 < len(lines) && i-start < maxRecordLines {
+			i++
+			text += "\n" + lines[i]
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		reader := csv.NewReader(strings.NewReader(text))
+		reader.Comma = comma
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		record, err := reader.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			message := err.Error()
+			if errors.As(err, &parseErr) {
+				message = parseErr.Err.Error()
+			}
+			table.Broken = append(table.Broken, Result{
+				Row:    start + 1,
+				Action: ActionError,
+				Errors: []FieldError{{Message: message}},
+			})
+			continue
+		}
+		table.add(start+1, record)
+	}
+	return table, table.check()
+}
+
+// add keeps the first non-blank line as the header and the others as rows
+func (t *Table) add(number int, cells []string) {
+	blank := true
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+		if cells[i] != "" {
+			blank = false
+		}
+	}
+	if blank {
+		return
+	}
+	if t.Header == nil {
+		if len(cells) > 0 {
+			cells[0] = strings.TrimPrefix(cells[0], "\ufeff")
+		}
+		t.Header = cells
+		return
+	}
+	t.Rows = append(t.Rows, Line{Number: number, Cells: cells})
+}
+
+func (t *Table) check() error {
+	if t.Header == nil {
+		return errors.New("the file is empty")
+	}
+	return nil
+}
@@ -0,0 +1,544 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"mbkm-go/database"
+	"mbkm-go/internal/models"
+	"mbkm-go/pkg/xlsx"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Fields of a student row
+const (
+	FieldName         = "name"
+	FieldNIM          = "nim"
+	FieldBirthdate    = "birthdate"
+	FieldProgramStudi = "program_studi"
+	FieldStatus       = "status"
+	FieldEmail        = "email"
+	FieldSemester     = "semester"
+	FieldPhoneNumber  = "phone_number"
+)
+
+// Outcome of a row
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionError  = "error"
+)
+
+// chunkSize is the number of rows written per transaction
+const chunkSize = 100
+
+// headers are the column names recognised for each field, compared after
+// normalizeHeader
+var headers = map[string][]string{
+	FieldName:         {"name", "nama", "nama mahasiswa", "nama lengkap"},
+	FieldNIM:          {"nim", "npm", "nomor induk mahasiswa"},
+	FieldBirthdate:    {"birthdate", "tanggal lahir", "tgl lahir"},
+	FieldProgramStudi: {"program studi", "program study", "prodi", "kode prodi", "id program studi"},
+	FieldStatus:       {"status", "status mahasiswa"},
+	FieldEmail:        {"email", "e-mail"},
+	FieldSemester:     {"semester"},
+	FieldPhoneNumber:  {"phone number", "phone", "no hp", "nomor hp", "telepon"},
+}
+
+// Required are the fields every file must have a column for
+var Required = []string{FieldName, FieldNIM, FieldBirthdate, FieldProgramStudi}
+
+// Statuses are the student statuses accepted; empty cells mean Aktif
+var Statuses = []string{"Aktif", "Tidak Aktif", "Drop Out / Dikeluarkan", "Mengundurkan Diri / Keluar", "Transfer"}
+
+// FieldError is a problem with one cell, or the whole row when Column is
+// empty
+type FieldError struct {
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Result is the outcome of one row
+type Result struct {
+	Row    int          `json:"row"`
+	NIM    string       `json:"nim,omitempty"`
+	Name   string       `json:"name,omitempty"`
+	Action string       `json:"action"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// Options controls an import
+type Options struct {
+	FileName     string
+	Mapping      map[string]string // field -> header, overriding the recognised names
+	ProdiID      *uint             // when set, rows must belong to this program studi
+	DryRun       bool
+	ImportedByID *uint
+	QueueJobID   *uint                 // an attempt of this job again replaces the import it recorded
+	Progress     func(done, total int) // called after each chunk is written
+}
+
+func normalizeHeader(s string) string {
+	s = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), "_", " "))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Columns finds the column of each field in a header. mapping names the
+// header of a field explicitly; an error lists the required fields without
+// a column.
+func Columns(header []string, mapping map[string]string) (map[string]int, error) {
+	index := map[string]int{}
+	for i, h := range header {
+		if _, seen := index[normalizeHeader(h)]; !seen {
+			index[normalizeHeader(h)] = i
+		}
+	}
+
+	columns := map[string]int{}
+	for field, names := range headers {
+		if name, ok := mapping[field]; ok {
+			i, found := index[normalizeHeader(name)]
+			if !found {
+				return nil, fmt.Errorf("column %q mapped to %s is not in the file", name, field)
+			}
+			columns[field] = i
+			continue
+		}
+		for _, name := range names {
+			if i, found := index[name]; found {
+				columns[field] = i
+				break
+			}
+		}
+	}
+	for field := range mapping {
+		if _, known := headers[field]; !known {
+			return nil, fmt.Errorf("unknown field %q in mapping", field)
+		}
+	}
+
+	var missing []string
+	for _, field := range Required {
+		if _, ok := columns[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing columns: %s", strings.Join(missing, ", "))
+	}
+	return columns, nil
+}
+
+// student is a validated row
+type student struct {
+	result    *Result
+	name      string
+	nim       string
+	birthdate time.Time
+	prodi     *models.ProgramStudi
+	status    string
+	email     string
+	semester  string
+	phone     string
+	existing  *models.User
+}
+
+// parseBirthdate accepts m/d/Y (the original template), Y-m-d, d-m-Y and
+// spreadsheet date serials
+func parseBirthdate(value string) (time.Time, error) {
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 && serial < 100000 {
+		t := xlsx.SerialTime(serial)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	if len(value) > 10 {
+		value = strings.TrimSpace(value[:10]) // drop a time part
+	}
+	for _, layout := range []string{"01/02/2006", "2006-01-02", "02-01-2006", "2006/01/02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("birthdate must be MM/DD/YYYY or YYYY-MM-DD")
+}
+
+// Run validates every row of a table and, unless opts.DryRun, writes the
+// valid ones and records the import with the rows that failed
+func Run(db *gorm.DB, table *Table, opts Options) (models.StudentImport, []Result, error) {
+	record := models.StudentImport{
+		FileName:     opts.FileName,
+		Format:       table.Format,
+		Status:       models.StudentImportRunning,
+		TotalRows:    len(table.Rows) + len(table.Broken),
+		ImportedByID: opts.ImportedByID,
+		QueueJobID:   opts.QueueJobID,
+		StartedAt:    time.Now(),
+	}
+
+	columns, err := Columns(table.Header, opts.Mapping)
+	if err != nil {
+		return record, nil, err
+	}
+
+	students, err := validate(db, table.Rows, columns, opts)
+	if err != nil {
+		return record, nil, err
+	}
+	if !opts.DryRun {
+		if opts.QueueJobID != nil {
+			var previous models.StudentImport
+			if err := db.Where("queue_job_id = ?", *opts.QueueJobID).First(&previous).Error; err == nil {
+				record.ID = previous.ID
+				record.CreatedAt = previous.CreatedAt
+				if err := db.Where("student_import_id = ?", previous.ID).Delete(&models.StudentImportError{}).Error; err != nil {
+					return record, nil, err
+				}
+			}
+		}
+		if err := db.Save(&record).Error; err != nil {
+			return record, nil, err
+		}
+		apply(db, students, opts.Progress)
+	}
+
+	results := make([]Result, 0, record.TotalRows)
+	results = append(results, table.Broken...)
+	for _, s := range students {
+		results = append(results, *s.result)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Row < results[j].Row })
+	for _, r := range results {
+		switch r.Action {
+		case ActionCreate:
+			record.Created++
+		case ActionUpdate:
+			record.Updated++
+		default:
+			record.Failed++
+		}
+	}
+	if opts.DryRun {
+		return record, results, nil
+	}
+
+	var failures []models.StudentImportError
+	for _, r := range results {
+		for _, e := range r.Errors {
+			failures = append(failures, models.StudentImportError{
+				StudentImportID: record.ID,
+				Row:             r.Row,
+				NIM:             r.NIM,
+				Column:          e.Column,
+				Message:         e.Message,
+			})
+		}
+	}
+	if len(failures) > 0 {
+		db.CreateInBatches(&failures, chunkSize)
+	}
+
+	now := time.Now()
+	record.Status = models.StudentImportFinished
+	record.FinishedAt = &now
+	db.Save(&record)
+	return record, results, nil
+}
+
+// validate checks every row and looks up the students that already exist
+func validate(db *gorm.DB, rows []Line, columns map[string]int, opts Options) ([]*student, error) {
+	cell := func(line Line, field string) string {
+		i, ok := columns[field]
+		if !ok || i >= len(line.Cells) {
+			return ""
+		}
+		return strings.TrimSpace(line.Cells[i])
+	}
+
+	prodis := map[string]*models.ProgramStudi{}
+	resolveProdi := func(value string) *models.ProgramStudi {
+		key := strings.ToLower(value)
+		if prodi, ok := prodis[key]; ok {
+			return prodi
+		}
+		var found *models.ProgramStudi
+		if prodi, err := database.ResolveProgramStudi(db, value); err == nil {
+			found = &prodi
+		}
+		prodis[key] = found
+		return found
+	}
+
+	students := make([]*student, 0, len(rows))
+	seen := map[string]int{}
+	seenEmail := map[string]int{}
+	var nims, emails []string
+	for _, line := range rows {
+		s := &student{
+			result:   &Result{Row: line.Number, Action: ActionCreate},
+			name:     cell(line, FieldName),
+			nim:      cell(line, FieldNIM),
+			status:   cell(line, FieldStatus),
+			email:    strings.ToLower(cell(line, FieldEmail)),
+			semester: cell(line, FieldSemester),
+			phone:    cell(line, FieldPhoneNumber),
+		}
+		s.result.NIM, s.result.Name = s.nim, s.name
+		fail := func(column, format string, args ...interface{}) {
+			s.result.Errors = append(s.result.Errors, FieldError{Column: column, Message: fmt.Sprintf(format, args...)})
+		}
+
+		if s.name == "" {
+			fail(FieldName, "name is required")
+		}
+		switch {
+		case s.nim == "":
+			fail(FieldNIM, "nim is required")
+		case seen[s.nim] != 0:
+			fail(FieldNIM, "NIM %s is already on row %d", s.nim, seen[s.nim])
+		default:
+			seen[s.nim] = line.Number
+			nims = append(nims, s.nim)
+		}
+
+		if value := cell(line, FieldBirthdate); value == "" {
+			fail(FieldBirthdate, "birthdate is required")
+		} else if birthdate, err := parseBirthdate(value); err != nil {
+			fail(FieldBirthdate, "%v", err)
+		} else {
+			s.birthdate = birthdate
+		}
+
+		if value := cell(line, FieldProgramStudi); value == "" {
+			fail(FieldProgramStudi, "program studi is required")
+		} else if s.prodi = resolveProdi(value); s.prodi == nil {
+			fail(FieldProgramStudi, "no program studi matches %q", value)
+		} else if opts.ProdiID != nil && s.prodi.ID != *opts.ProdiID {
+			fail(FieldProgramStudi, "%s is not your program studi", s.prodi.Nama)
+		}
+
+		if s.status == "" {
+			s.status = "Aktif"
+		} else if !validStatus(&s.status) {
+			fail(FieldStatus, "status must be one of %s", strings.Join(Statuses, ", "))
+		}
+
+		if s.email != "" {
+			if _, err := mail.ParseAddress(s.email); err != nil {
+				fail(FieldEmail, "invalid email %q", s.email)
+			} else if seenEmail[s.email] != 0 {
+				fail(FieldEmail, "email %s is already on row %d", s.email, seenEmail[s.email])
+			} else {
+				seenEmail[s.email] = line.Number
+				emails = append(emails, s.email)
+			}
+		}
+		students = append(students, s)
+	}
+
+	// Match existing accounts by NIM and find usernames and emails taken
+	// by other accounts, deleted ones included as they keep their unique keys
+	for _, nim := range nims {
+		emails = append(emails, defaultEmail(nim))
+	}
+	var existing []models.User
+	for start := 0; start < len(nims) || start < len(emails); start += 1000 {
+		query := db.Unscoped().Model(&models.User{})
+		if part := window(nims, start); len(part) > 0 {
+			query = query.Or("nim IN ? OR username IN ?", part, part)
+		}
+		if part := window(emails, start); len(part) > 0 {
+			query = query.Or("email IN ?", part)
+		}
+		var found []models.User
+		if err := query.Find(&found).Error; err != nil {
+			return nil, err
+		}
+		existing = append(existing, found...)
+	}
+	byNIM := map[string]*models.User{}
+	byUsername := map[string]*models.User{}
+	byEmail := map[string]*models.User{}
+	for i := range existing {
+		u := &existing[i]
+		if u.NIM != nil && *u.NIM != "" {
+			byNIM[*u.NIM] = u
+		}
+		byUsername[u.Username] = u
+		byEmail[strings.ToLower(u.Email)] = u
+	}
+
+	for _, s := range students {
+		fail := func(column, format string, args ...interface{}) {
+			s.result.Errors = append(s.result.Errors, FieldError{Column: column, Message: fmt.Sprintf(format, args...)})
+		}
+		if s.nim != "" {
+			if u, ok := byNIM[s.nim]; ok {
+				s.existing = u
+				s.result.Action = ActionUpdate
+				if u.DeletedAt.Valid {
+					fail(FieldNIM, "NIM %s belongs to a deleted account", s.nim)
+				} else if u.Role != "student" {
+					fail(FieldNIM, "NIM %s belongs to a %s account", s.nim, u.Role)
+				}
+			} else if u, ok := byUsername[s.nim]; ok {
+				fail(FieldNIM, "username %s is taken by %s", s.nim, u.Name)
+			}
+		}
+		email := s.email
+		if email == "" && s.existing == nil {
+			email = defaultEmail(s.nim)
+		}
+		if u, ok := byEmail[email]; ok && email != "" && (s.existing == nil || u.ID != s.existing.ID) {
+			fail(FieldEmail, "email %s is used by %s", email, u.Name)
+		}
+		if len(s.result.Errors) > 0 {
+			s.result.Action = ActionError
+		}
+	}
+	return students, nil
+}
+
+func window(values []string, start int) []string {
+	if start >= len(values) {
+		return nil
+	}
+	end := start + 1000
+	if end > len(values) {
+		end = len(values)
+	}
+	return values[start:end]
+}
+
+// validStatus matches a status case-insensitively and fixes its case
+func validStatus(status *string) bool {
+	for _, s := range Statuses {
+		if strings.EqualFold(*status, s) {
+			*status = s
+			return true
+		}
+	}
+	return false
+}
+
+func defaultEmail(nim string) string {
+	return strings.ToLower(nim) + "@mbkm.ulbi.ac.id"
+}
+
+// apply writes the valid rows, chunkSize rows per transaction. When a chunk
+// fails its rows are written again one by one, so only the rows at fault are
+// reported.
+func apply(db *gorm.DB, students []*student, progress func(done, total int)) {
+	var valid []*student
+	for _, s := range students {
+		if s.result.Action != ActionError {
+			valid = append(valid, s)
+		}
+	}
+	roleID := studentRoleID(db)
+
+	for start := 0; start < len(valid); start += chunkSize {
+		end := start + chunkSize
+		if end > len(valid) {
+			end = len(valid)
+		}
+		chunk := valid[start:end]
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, s := range chunk {
+				if err := save(tx, s, roleID); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			for _, s := range chunk {
+				err := db.Transaction(func(tx *gorm.DB) error { return save(tx, s, roleID) })
+				if err != nil {
+					s.result.Action = ActionError
+					s.result.Errors = append(s.result.Errors, FieldError{Message: fmt.Sprintf("failed to save: %v", err)})
+				}
+			}
+		}
+		if progress != nil {
+			progress(end, len(valid))
+		}
+	}
+}
+
+// save creates or updates the account of a row
+func save(tx *gorm.DB, s *student, roleID uint) error {
+	if s.existing != nil {
+		update := map[string]interface{}{
+			"name":             s.name,
+			"birthdate":        s.birthdate,
+			"status":           s.status,
+			"id_program_studi": s.prodi.ID,
+			"program_study":    s.prodi.Nama,
+		}
+		if s.prodi.Fakultas != nil {
+			update["faculty"] = s.prodi.Fakultas.Nama
+		}
+		if s.email != "" {
+			update["email"] = s.email
+		}
+		if s.semester != "" {
+			update["semester"] = s.semester
+		}
+		if s.phone != "" {
+			update["phone_number"] = s.phone
+		}
+		return tx.Model(s.existing).Updates(update).Error
+	}
+
+	// New students log in with their NIM and birthdate (YYYYMMDD)
+	hash, err := bcrypt.GenerateFromPassword([]byte(s.birthdate.Format("20060102")), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	email := s.email
+	if email == "" {
+		email = defaultEmail(s.nim)
+	}
+	nim, status, birthdate := s.nim, s.status, s.birthdate
+	user := models.User{
+		Name:      s.name,
+		Email:     email,
+		Username:  nim,
+		Password:  string(hash),
+		NIM:       &nim,
+		Status:    &status,
+		Role:      "student",
+		Birthdate: &birthdate,
+		Verified:  false,
+		Approved:  false,
+	}
+	if s.semester != "" {
+		user.Semester = &s.semester
+	}
+	if s.phone != "" {
+		user.PhoneNumber = &s.phone
+	}
+	user.SetProgramStudi(s.prodi)
+	if err := tx.Create(&user).Error; err != nil {
+		return err
+	}
+	return tx.Model(&user).Association("Roles").Append(&models.Role{ID: roleID})
+}
+
+// studentRoleID returns the ID of the student role, 2 as seeded when it
+// cannot be found by title
+func studentRoleID(db *gorm.DB) uint {
+	var role models.Role
+	db.Where("title = ?", "student").First(&role)
+	if role.ID == 0 {
+		return 2
+	}
+	return role.ID
+}
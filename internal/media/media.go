@@ -0,0 +1,277 @@
+// Package media attaches stored files to any model through the polymorphic
+// media table.
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"mbkm-go/config"
+	"mbkm-go/internal/models"
+	"mbkm-go/internal/storage"
+	"mbkm-go/pkg/imaging"
+
+	"gorm.io/gorm"
+)
+
+// Upload is a file to attach
+type Upload struct {
+	Data         []byte
+	FileName     string
+	MimeType     string // detected from the file name when empty
+	UploadedByID *uint
+
+	// Conversions are resized variants stored next to the file, keyed by name
+	Conversions map[string]Conversion
+}
+
+// Conversion is a derived file, e.g. a thumbnail
+type Conversion struct {
+	Data     []byte
+	MimeType string
+}
+
+// Attach stores the upload and adds it to the model's collection
+func Attach(ctx context.Context, db *gorm.DB, modelType string, modelID uint, collection string, upload Upload) (*models.Media, error) {
+	sum := sha256.Sum256(upload.Data)
+	checksum := hex.EncodeToString(sum[:])
+
+	ext := strings.ToLower(path.Ext(upload.FileName))
+	mimeType := upload.MimeType
+	if mimeType == "" {
+		mimeType = mime.TypeByExtension(ext)
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	dir := fmt.Sprintf("media/%s/%d/%s", strings.ToLower(modelType), modelID, collection)
+	key := path.Join(dir, checksum+ext)
+	if err := storage.Default.Put(ctx, key, upload.Data, mimeType); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name, conversion := range upload.Conversions {
+		if err := storage.Default.Put(ctx, conversionKey(key, name, conversion.MimeType), conversion.Data, conversion.MimeType); err != nil {
+			return nil, err
+		}
+		names = append(names, name+":"+conversion.MimeType)
+	}
+
+	m := models.Media{
+		ModelType:      modelType,
+		ModelID:        modelID,
+		CollectionName: collection,
+		FileName:       path.Base(upload.FileName),
+		Path:           key,
+		MimeType:       mimeType,
+		Size:           int64(len(upload.Data)),
+		Checksum:       checksum,
+		Conversions:    strings.Join(names, ","),
+		UploadedByID:   upload.UploadedByID,
+	}
+	if err := db.Create(&m).Error; err != nil {
+		return nil, err
+	}
+
+	WithURL(&m)
+	return &m, nil
+}
+
+// Replace removes every file in the model's collection and attaches the upload
+func Replace(ctx context.Context, db *gorm.DB, modelType string, modelID uint, collection string, upload Upload) (*models.Media, error) {
+	existing, err := List(db, modelType, modelID, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := Attach(ctx, db, modelType, modelID, collection, upload)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range existing {
+		if existing[i].Path == m.Path {
+			// Same content uploaded again, keep the stored object
+			if err := db.Delete(&existing[i]).Error; err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := Delete(ctx, db, &existing[i]); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Link adds an already stored file to another model's collection, replacing
+// what the collection held. The stored object is shared rather than copied.
+func Link(ctx context.Context, db *gorm.DB, source *models.Media, modelType string, modelID uint, collection string) (*models.Media, error) {
+	existing, err := List(db, modelType, modelID, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	m := *source
+	m.ID = 0
+	m.ModelType = modelType
+	m.ModelID = modelID
+	m.CollectionName = collection
+	m.CreatedAt = time.Time{}
+	m.UploadedBy = nil
+	if err := db.Create(&m).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range existing {
+		if err := Delete(ctx, db, &existing[i]); err != nil {
+			return nil, err
+		}
+	}
+	WithURL(&m)
+	return &m, nil
+}
+
+// List returns the media of a model, optionally limited to one collection,
+// with signed URLs filled in
+func List(db *gorm.DB, modelType string, modelID uint, collection string) ([]models.Media, error) {
+	query := db.Where("model_type = ? AND model_id = ?", modelType, modelID)
+	if collection != "" {
+		query = query.Where("collection_name = ?", collection)
+	}
+
+	var media []models.Media
+	if err := query.Order("created_at ASC, id ASC").Find(&media).Error; err != nil {
+		return nil, err
+	}
+	for i := range media {
+		WithURL(&media[i])
+	}
+	return media, nil
+}
+
+// ListFor returns the media of several models of the same type, grouped by
+// model ID
+func ListFor(db *gorm.DB, modelType string, modelIDs []uint, collection string) (map[uint][]models.Media, error) {
+	grouped := map[uint][]models.Media{}
+	if len(modelIDs) == 0 {
+		return grouped, nil
+	}
+
+	query := db.Where("model_type = ? AND model_id IN ?", modelType, modelIDs)
+	if collection != "" {
+		query = query.Where("collection_name = ?", collection)
+	}
+
+	var media []models.Media
+	if err := query.Order("created_at ASC, id ASC").Find(&media).Error; err != nil {
+		return nil, err
+	}
+	for i := range media {
+		WithURL(&media[i])
+		grouped[media[i].ModelID] = append(grouped[media[i].ModelID], media[i])
+	}
+	return grouped, nil
+}
+
+// First returns the latest file of a collection, or nil when it is empty
+func First(db *gorm.DB, modelType string, modelID uint, collection string) *models.Media {
+	var m models.Media
+	err := db.Where("model_type = ? AND model_id = ? AND collection_name = ?", modelType, modelID, collection).
+		Order("created_at DESC, id DESC").
+		First(&m).Error
+	if err != nil {
+		return nil
+	}
+	WithURL(&m)
+	return &m
+}
+
+// Delete removes a media row and its stored files. Files that are still
+// referenced by another media row are kept.
+func Delete(ctx context.Context, db *gorm.DB, m *models.Media) error {
+	if err := db.Delete(m).Error; err != nil {
+		return err
+	}
+
+	var shared int64
+	db.Model(&models.Media{}).Where("path = ?", m.Path).Count(&shared)
+	if shared > 0 {
+		return nil
+	}
+
+	return Discard(ctx, m)
+}
+
+// Discard removes the stored files of a media without touching its row, for
+// an Attach whose transaction was rolled back
+func Discard(ctx context.Context, m *models.Media) error {
+	if err := storage.Default.Delete(ctx, m.Path); err != nil {
+		return err
+	}
+	for name, mimeType := range conversions(m) {
+		if err := storage.Default.Delete(ctx, conversionKey(m.Path, name, mimeType)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAll removes every media of a model, used when the model is deleted
+func DeleteAll(ctx context.Context, db *gorm.DB, modelType string, modelID uint) error {
+	media, err := List(db, modelType, modelID, "")
+	if err != nil {
+		return err
+	}
+	for i := range media {
+		if err := Delete(ctx, db, &media[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// URL returns a signed download URL of a media file
+func URL(m *models.Media) string {
+	return storage.SignedURL(m.Path, config.AppConfig.SignedURLTTL)
+}
+
+// WithURL fills the virtual URL fields of a media row
+func WithURL(m *models.Media) {
+	m.URL = URL(m)
+	m.ConversionURLs = nil
+	for name, mimeType := range conversions(m) {
+		if m.ConversionURLs == nil {
+			m.ConversionURLs = map[string]string{}
+		}
+		m.ConversionURLs[name] = storage.SignedURL(conversionKey(m.Path, name, mimeType), config.AppConfig.SignedURLTTL)
+	}
+}
+
+func conversions(m *models.Media) map[string]string {
+	result := map[string]string{}
+	if m.Conversions == "" {
+		return result
+	}
+	for _, entry := range strings.Split(m.Conversions, ",") {
+		name, mimeType, _ := strings.Cut(entry, ":")
+		result[name] = mimeType
+	}
+	return result
+}
+
+func conversionKey(key, name, mimeType string) string {
+	ext := imaging.Extension(mimeType)
+	if ext == "" {
+		ext = path.Ext(key)
+	}
+	return strings.TrimSuffix(key, path.Ext(key)) + "_" + name + ext
+}
@@ -14,7 +14,6 @@ type Report struct {
 	StartDate         *time.Time     `json:"start_date"`
 	EndDate           *time.Time     `json:"end_date"`
 	Status            string         `gorm:"size:50;default:'Draft'" json:"status"`
-	FileLaporan       string         `gorm:"type:text" json:"file_laporan"` // URL or path
 	CompanyCheckedID  *uint          `json:"company_checked_id"`
 	CompanyCheckedAt  *time.Time     `json:"company_checked_at"`
 	LecturerCheckedID *uint          `json:"lecturer_checked_id"`
@@ -33,35 +32,66 @@ type Report struct {
 	LecturerChecked *User            `gorm:"foreignKey:LecturerCheckedID" json:"lecturer_checked,omitempty"`
 	ExaminerChecked *User            `gorm:"foreignKey:ExaminerCheckedID" json:"examiner_checked,omitempty"`
 	ProdiChecked    *User            `gorm:"foreignKey:ProdiCheckedID" json:"prodi_checked,omitempty"`
+	Versions        []ReportVersion  `gorm:"foreignKey:ReportID" json:"versions,omitempty"`
+
+	// Virtual field for media
+	FileLaporan string `gorm:"-" json:"file_laporan,omitempty"`
 }
 
 func (Report) TableName() string {
 	return "reports"
 }
 
+// Activity approval status constants
+const (
+	ActivityStatusPending  = "Menunggu Persetujuan"
+	ActivityStatusApproved = "Disetujui"
+	ActivityStatusRejected = "Ditolak"
+)
+
 type ActivityDetail struct {
 	ID              uint           `gorm:"primarykey" json:"id"`
 	ReportJobID     uint           `json:"report_job_id"`
 	Date            *time.Time     `json:"date"`
 	ActivityDetails string         `gorm:"type:text" json:"activity_details"`
+	Hours           float64        `gorm:"type:decimal(5,2);default:0" json:"hours"`
+	ApprovalStatus  string         `gorm:"size:50;default:'Menunggu Persetujuan';index" json:"approval_status"`
+	ApprovalNote    *string        `gorm:"type:text" json:"approval_note,omitempty"`
+	ApprovedByID    *uint          `json:"approved_by_id,omitempty"`
+	ApprovedAt      *time.Time     `json:"approved_at,omitempty"`
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	// Relationships
+	ApprovedBy *User `gorm:"foreignKey:ApprovedByID" json:"approved_by,omitempty"`
+
+	// Virtual field for media
+	Attachments []Media `gorm:"-" json:"attachments,omitempty"`
 }
 
 func (ActivityDetail) TableName() string {
 	return "activity_details"
 }
 
+// BobotNilai is one version of the grade weights of a program studi. A
+// version applies to placements starting on or after EffectiveFrom (always,
+// when empty); ProgramType narrows it to jobs of one vacancy type.
 type BobotNilai struct {
 	ID                   uint           `gorm:"primarykey" json:"id"`
-	IDProgramStudi       uint           `json:"id_program_studi"`
+	IDProgramStudi       uint           `gorm:"index:idx_bobot_nilai_scope" json:"id_program_studi"`
+	ProgramType          *string        `gorm:"size:50;index:idx_bobot_nilai_scope" json:"program_type"`
+	EffectiveFrom        *time.Time     `gorm:"type:date" json:"effective_from"`
 	BobotNilaiPerusahaan float64        `json:"bobot_nilai_perusahaan"`
 	BobotNilaiPembimbing float64        `json:"bobot_nilai_pembimbing"`
 	BobotNilaiPenguji    float64        `json:"bobot_nilai_penguji"`
+	CreatedByID          *uint          `json:"created_by_id"`
 	CreatedAt            time.Time      `json:"created_at"`
 	UpdatedAt            time.Time      `json:"updated_at"`
 	DeletedAt            gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	// EvaluationCount is how many finalized evaluations used this version
+	EvaluationCount int64 `gorm:"-" json:"evaluation_count,omitempty"`
 }
 
 func (BobotNilai) TableName() string {
@@ -74,6 +104,18 @@ type Evaluation struct {
 	ApplyJob   *ApplyJob `gorm:"foreignKey:ApplyJobID" json:"apply_job,omitempty"`
 	Status     string    `gorm:"size:50" json:"status"`
 	Grade      string    `gorm:"size:5" json:"grade"`
+	FinalScore float64   `json:"final_score"`
+	GradePoint float64   `json:"grade_point"`
+	// GradeScale is the scale the final grade was given with
+	GradeScale *GradeScaleSnapshot `gorm:"type:jsonb" json:"grade_scale,omitempty"`
+
+	// A finalized evaluation is locked against grading until it is unlocked;
+	// students see its grades from PublishedAt on
+	FinalizedAt   *time.Time `json:"finalized_at"`
+	FinalizedByID *uint      `json:"finalized_by_id"`
+	PublishedAt   *time.Time `json:"published_at"`
+	// BobotNilaiID is the weights version the final grade was computed with
+	BobotNilaiID *uint `json:"bobot_nilai_id"`
 
 	CompanyPersonnelID      *uint      `json:"company_personnel_id"`
 	CompanyGrade            string     `gorm:"size:5" json:"company_grade"`
@@ -104,10 +146,12 @@ type Evaluation struct {
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 
 	// Relationships
-	CompanyPersonnel *User `gorm:"foreignKey:CompanyPersonnelID" json:"company_personnel,omitempty"`
-	Lecturer         *User `gorm:"foreignKey:LecturerID" json:"lecturer,omitempty"`
-	Examiner         *User `gorm:"foreignKey:ExaminerID" json:"examiner,omitempty"`
-	Prodi            *User `gorm:"foreignKey:ProdiID" json:"prodi,omitempty"`
+	CompanyPersonnel *User       `gorm:"foreignKey:CompanyPersonnelID" json:"company_personnel,omitempty"`
+	Lecturer         *User       `gorm:"foreignKey:LecturerID" json:"lecturer,omitempty"`
+	Examiner         *User       `gorm:"foreignKey:ExaminerID" json:"examiner,omitempty"`
+	Prodi            *User       `gorm:"foreignKey:ProdiID" json:"prodi,omitempty"`
+	FinalizedBy      *User       `gorm:"foreignKey:FinalizedByID" json:"finalized_by,omitempty"`
+	BobotNilai       *BobotNilai `gorm:"foreignKey:BobotNilaiID" json:"bobot_nilai,omitempty"`
 }
 
 func (Evaluation) TableName() string {
@@ -120,6 +164,7 @@ type KonversiNilai struct {
 	MatkulID   uint           `json:"matkul_id"` // or mata_kuliah_id
 	Grade      string         `gorm:"size:5" json:"grade"`
 	Score      float64        `json:"score"`
+	GradePoint float64        `json:"grade_point"`
 	CreatedAt  time.Time      `json:"created_at"`
 	UpdatedAt  time.Time      `json:"updated_at"`
 	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
@@ -13,6 +13,7 @@ type ApplyJob struct {
 	ResponsibleLecturerID *uint          `json:"responsible_lecturer_id,omitempty"`
 	ExaminerLecturerID    *uint          `json:"examiner_lecturer_id,omitempty"`
 	CreatedByID           *uint          `json:"created_by_id,omitempty"`
+	CompletedAt           *time.Time     `json:"completed_at,omitempty"` // when it was marked "Selesai"
 	CreatedAt             time.Time      `json:"created_at"`
 	UpdatedAt             time.Time      `json:"updated_at"`
 	DeletedAt             gorm.DeletedAt `gorm:"index" json:"-"`
@@ -33,6 +34,7 @@ type ApplyJob struct {
 	CV                    *string `gorm:"-" json:"cv,omitempty"`
 	SuratLamaran          *string `gorm:"-" json:"surat_lamaran,omitempty"`
 	SuratRekomendasiProdi *string `gorm:"-" json:"surat_rekomendasi_prodi,omitempty"`
+	SuratPengantar        *string `gorm:"-" json:"surat_pengantar,omitempty"`
 }
 
 func (ApplyJob) TableName() string {
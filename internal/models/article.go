@@ -15,8 +15,9 @@ type Article struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
 
-	// Virtual field for media
-	Picture *string `gorm:"-" json:"picture,omitempty"`
+	// Virtual fields for media
+	Picture           *string           `gorm:"-" json:"picture,omitempty"`
+	PictureThumbnails map[string]string `gorm:"-" json:"picture_thumbnails,omitempty"`
 }
 
 func (Article) TableName() string {
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+)
+
+// Attendance status constants
+const (
+	AttendanceStatusPresent = "Hadir"
+	AttendanceStatusExcused = "Izin"
+	AttendanceStatusSick    = "Sakit"
+	AttendanceStatusAbsent  = "Alpa"
+)
+
+// Attendance is one day of presence of a student in an active placement.
+// Coordinates are optional; when the company has a geofence the distance to
+// the office is stored with each check. Supervisors may override a day, e.g.
+// to record an excuse.
+type Attendance struct {
+	ID                     uint       `gorm:"primaryKey" json:"id"`
+	ApplyJobID             uint       `gorm:"uniqueIndex:idx_attendance_day" json:"apply_job_id"`
+	UserID                 uint       `gorm:"uniqueIndex:idx_attendance_day" json:"user_id"`
+	Date                   time.Time  `gorm:"type:date;uniqueIndex:idx_attendance_day" json:"date"`
+	Status                 string     `gorm:"size:20;default:'Hadir'" json:"status"`
+	CheckInAt              *time.Time `json:"check_in_at,omitempty"`
+	CheckInLatitude        *float64   `json:"check_in_latitude,omitempty"`
+	CheckInLongitude       *float64   `json:"check_in_longitude,omitempty"`
+	CheckInDistance        *float64   `json:"check_in_distance,omitempty"` // meters from the company
+	CheckInWithinGeofence  *bool      `json:"check_in_within_geofence,omitempty"`
+	CheckOutAt             *time.Time `json:"check_out_at,omitempty"`
+	CheckOutLatitude       *float64   `json:"check_out_latitude,omitempty"`
+	CheckOutLongitude      *float64   `json:"check_out_longitude,omitempty"`
+	CheckOutDistance       *float64   `json:"check_out_distance,omitempty"`
+	CheckOutWithinGeofence *bool      `json:"check_out_within_geofence,omitempty"`
+	Note                   *string    `gorm:"type:text" json:"note,omitempty"`
+	OverriddenByID         *uint      `json:"overridden_by_id,omitempty"`
+	OverriddenAt           *time.Time `json:"overridden_at,omitempty"`
+	CreatedAt              time.Time  `json:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at"`
+
+	// Relationships
+	User         *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	ApplyJob     *ApplyJob `gorm:"foreignKey:ApplyJobID" json:"apply_job,omitempty"`
+	OverriddenBy *User     `gorm:"foreignKey:OverriddenByID" json:"overridden_by,omitempty"`
+}
+
+func (Attendance) TableName() string {
+	return "attendances"
+}
+
+// AttendanceRecap summarises the attendance of a student over a month
+type AttendanceRecap struct {
+	ApplyJobID      uint    `json:"apply_job_id"`
+	UserID          uint    `json:"user_id"`
+	Month           string  `json:"month"` // YYYY-MM
+	Present         int     `json:"present"`
+	Excused         int     `json:"excused"`
+	Sick            int     `json:"sick"`
+	Absent          int     `json:"absent"`
+	OutsideGeofence int     `json:"outside_geofence"`
+	MissingCheckOut int     `json:"missing_check_out"`
+	Hours           float64 `json:"hours"`
+}
@@ -15,6 +15,9 @@ type Company struct {
 	CompanyProfileDescription *string        `gorm:"type:text" json:"company_profile_description,omitempty"`
 	CompanyPhoneNumber        *string        `gorm:"size:50" json:"company_phone_number,omitempty"`
 	CompanyAddress            *string        `gorm:"type:text" json:"company_address,omitempty"`
+	Latitude                  *float64       `json:"latitude,omitempty"`
+	Longitude                 *float64       `json:"longitude,omitempty"`
+	GeofenceRadius            *int           `json:"geofence_radius,omitempty"` // meters around the coordinates
 	UserID                    *uint          `json:"user_id,omitempty"`
 	CreatedByID               *uint          `json:"created_by_id,omitempty"`
 	CreatedAt                 time.Time      `json:"created_at"`
@@ -25,8 +28,9 @@ type Company struct {
 	User      *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	CreatedBy *User `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
 
-	// Virtual field for media
-	CompanyLogo *string `gorm:"-" json:"company_logo,omitempty"`
+	// Virtual fields for media
+	CompanyLogo           *string           `gorm:"-" json:"company_logo,omitempty"`
+	CompanyLogoThumbnails map[string]string `gorm:"-" json:"company_logo_thumbnails,omitempty"`
 }
 
 func (Company) TableName() string {
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// Document template kinds
+const (
+	DocumentTemplateLogbook          = "logbook"
+	DocumentTemplateTranscript       = "transcript"
+	DocumentTemplateCertificate      = "certificate"    // completion certificate of a student
+	DocumentTemplatePartnerLetter    = "partner_letter" // thank-you letter to a host company
+	DocumentTemplateSuratPengantar   = "surat_pengantar"
+	DocumentTemplateSuratRekomendasi = "surat_rekomendasi_prodi"
+)
+
+// DocumentTemplate customises the text of a generated PDF for one program
+// studi. Title, Header, Body and Footer may use Go template placeholders
+// such as {{.StudentName}}. Signatures holds one block per line, written as
+// "Label|Name"; both parts may use placeholders. Templates without a program
+// studi are the default for their kind. ProgramType narrows a template to
+// one vacancy type (e.g. Magang, Studi Independen).
+type DocumentTemplate struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Kind           string    `gorm:"size:50;not null;index:idx_document_template" json:"kind"`
+	IDProgramStudi *uint     `gorm:"index:idx_document_template" json:"id_program_studi,omitempty"`
+	ProgramType    *string   `gorm:"size:50;index:idx_document_template" json:"program_type,omitempty"`
+	Title          string    `gorm:"size:255" json:"title"`
+	Header         string    `gorm:"type:text" json:"header"`
+	Body           string    `gorm:"type:text" json:"body"`
+	Footer         string    `gorm:"type:text" json:"footer"`
+	Signatures     string    `gorm:"type:text" json:"signatures"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Relationships
+	ProgramStudi *ProgramStudi `gorm:"foreignKey:IDProgramStudi" json:"program_studi,omitempty"`
+}
+
+func (DocumentTemplate) TableName() string {
+	return "document_templates"
+}
@@ -13,6 +13,12 @@ const (
 	EvalStatusApprovedCompany  = "Disetujui Oleh Perusahaan"
 	EvalStatusApprovedLecturer = "Disetujui Oleh Dosen Wali"
 	EvalStatusApprovedProdi    = "Disetujui Oleh Prodi"
+
+	EvalStatusNotGraded = "Belum Dinilai"
+	EvalStatusGraded    = "Sudah Dinilai"
+	EvalStatusFinalized = "Final"
+	// EvalStatusUnpublished is shown to students until the grade is published
+	EvalStatusUnpublished = "Dalam Proses"
 )
 
 type Evaluation struct {
@@ -67,56 +73,3 @@ type BobotNilai struct {
 func (BobotNilai) TableName() string {
 	return "bobot_nilais"
 }
-
-// CalculateFinalGrade calculates the final grade based on weighted scores
-func (e *Evaluation) CalculateFinalGrade(bobot *BobotNilai) map[string]interface{} {
-	if bobot == nil {
-		return nil
-	}
-
-	totalBobot := bobot.BobotNilaiPerusahaan + bobot.BobotNilaiPembimbing + bobot.BobotNilaiPenguji
-	if totalBobot == 0 {
-		return nil
-	}
-
-	var companyScore, lecturerScore, examinerScore float64
-
-	if e.CompanyGradeScore != nil {
-		companyScore = *e.CompanyGradeScore * (bobot.BobotNilaiPerusahaan / totalBobot)
-	}
-	if e.LecturerGradeScore != nil {
-		lecturerScore = *e.LecturerGradeScore * (bobot.BobotNilaiPembimbing / totalBobot)
-	}
-	if e.ExaminerGradeScore != nil {
-		examinerScore = *e.ExaminerGradeScore * (bobot.BobotNilaiPenguji / totalBobot)
-	}
-
-	totalScore := companyScore + lecturerScore + examinerScore
-	hasGrade := companyScore > 0 && lecturerScore > 0 && examinerScore > 0
-
-	grade := calculateGradeLetter(totalScore, hasGrade)
-
-	return map[string]interface{}{
-		"company":     companyScore,
-		"lecturer":    lecturerScore,
-		"examiner":    examinerScore,
-		"total_score": totalScore,
-		"grade":       grade,
-	}
-}
-
-func calculateGradeLetter(score float64, hasGrade bool) string {
-	if !hasGrade {
-		return "-"
-	}
-	if score >= 85 {
-		return "A"
-	} else if score >= 70 {
-		return "B"
-	} else if score >= 55 {
-		return "C"
-	} else if score >= 40 {
-		return "D"
-	}
-	return "E"
-}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+)
+
+// Evaluation log actions
+const (
+	EvaluationLogFinalize = "finalize"
+	EvaluationLogUnlock   = "unlock"
+	EvaluationLogPublish  = "publish"
+
+	EvaluationLogAppeal        = "appeal"
+	EvaluationLogAppealRevised = "appeal_revised"
+	EvaluationLogAppealUpheld  = "appeal_upheld"
+)
+
+// EvaluationLog records who finalized, unlocked, published or appealed an
+// evaluation and the grade it had at that moment
+type EvaluationLog struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	EvaluationID uint       `gorm:"index" json:"evaluation_id"`
+	UserID       uint       `json:"user_id"`
+	Action       string     `gorm:"size:20" json:"action"`
+	Reason       string     `gorm:"type:text" json:"reason"`
+	Grade        string     `gorm:"size:5" json:"grade"`
+	FinalScore   float64    `json:"final_score"`
+	PublishedAt  *time.Time `json:"published_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+func (EvaluationLog) TableName() string {
+	return "evaluation_logs"
+}
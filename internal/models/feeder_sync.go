@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+)
+
+// Feeder sync status constants
+const (
+	FeederSyncSent   = "Terkirim"
+	FeederSyncFailed = "Gagal"
+)
+
+// FeederSync records the push of an application's activity to the PDDikti
+// Neo Feeder, so it is not sent twice
+type FeederSync struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	ApplyJobID  uint       `gorm:"uniqueIndex" json:"apply_job_id"`
+	Semester    string     `gorm:"size:10" json:"semester"`
+	IDAktivitas string     `gorm:"size:64" json:"id_aktivitas"` // activity ID in the Feeder
+	Status      string     `gorm:"size:50" json:"status"`
+	Error       *string    `gorm:"type:text" json:"error,omitempty"`
+	PushedByID  *uint      `json:"pushed_by_id,omitempty"`
+	PushedAt    *time.Time `json:"pushed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// Relationships
+	ApplyJob *ApplyJob `gorm:"foreignKey:ApplyJobID" json:"apply_job,omitempty"`
+	PushedBy *User     `gorm:"foreignKey:PushedByID" json:"pushed_by,omitempty"`
+}
+
+func (FeederSync) TableName() string {
+	return "feeder_syncs"
+}
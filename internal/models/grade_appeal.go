@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+)
+
+// Grade appeal status constants
+const (
+	AppealStatusSubmitted = "Diajukan"
+	AppealStatusRouted    = "Diteruskan ke Penilai"
+	AppealStatusRevised   = "Nilai Direvisi"
+	AppealStatusUpheld    = "Nilai Dipertahankan"
+)
+
+// GradeAppeal is a student's objection to one component of a published
+// grade. Prodi routes it to the evaluator of that component, who revises
+// the score or upholds it.
+type GradeAppeal struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	EvaluationID uint   `gorm:"index" json:"evaluation_id"`
+	StudentID    uint   `gorm:"index" json:"student_id"`
+	Component    string `gorm:"size:20" json:"component"` // company, lecturer or examiner
+	Reason       string `gorm:"type:text" json:"reason"`
+	Status       string `gorm:"size:50;index" json:"status"`
+
+	RoutedByID  *uint      `json:"routed_by_id"`
+	RoutedAt    *time.Time `json:"routed_at"`
+	EvaluatorID *uint      `gorm:"index" json:"evaluator_id"`
+
+	PreviousScore float64    `json:"previous_score"`
+	RevisedScore  *float64   `json:"revised_score"`
+	Justification string     `gorm:"type:text" json:"justification"`
+	DecidedAt     *time.Time `json:"decided_at"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relationships
+	Evaluation *Evaluation `gorm:"foreignKey:EvaluationID" json:"evaluation,omitempty"`
+	Student    *User       `gorm:"foreignKey:StudentID" json:"student,omitempty"`
+	Evaluator  *User       `gorm:"foreignKey:EvaluatorID" json:"evaluator,omitempty"`
+}
+
+func (GradeAppeal) TableName() string {
+	return "grade_appeals"
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// GradeScale maps scores to letter grades for a program studi. A scale
+// without a program studi is the default.
+type GradeScale struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Name           string    `gorm:"size:255" json:"name"`
+	IDProgramStudi *uint     `gorm:"uniqueIndex" json:"id_program_studi,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Relationships
+	Bands        []GradeBand   `gorm:"foreignKey:GradeScaleID" json:"bands"`
+	ProgramStudi *ProgramStudi `gorm:"foreignKey:IDProgramStudi" json:"program_studi,omitempty"`
+}
+
+func (GradeScale) TableName() string {
+	return "grade_scales"
+}
+
+// GradeBand is one letter of a grade scale: scores from MinScore up to the
+// next band get Letter
+type GradeBand struct {
+	ID           uint    `gorm:"primaryKey" json:"id,omitempty"`
+	GradeScaleID uint    `gorm:"index" json:"grade_scale_id,omitempty"`
+	Letter       string  `gorm:"size:5" json:"letter"`
+	MinScore     float64 `json:"min_score"`
+	GradePoint   float64 `json:"grade_point"`
+}
+
+func (GradeBand) TableName() string {
+	return "grade_bands"
+}
+
+// GradeScaleSnapshot is the scale a grade was given with, stored as a JSON
+// column so later edits of the scale do not change finalized grades
+type GradeScaleSnapshot struct {
+	GradeScaleID *uint       `json:"grade_scale_id,omitempty"`
+	Name         string      `json:"name"`
+	Bands        []GradeBand `json:"bands"`
+}
+
+func (s GradeScaleSnapshot) Value() (driver.Value, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+func (s *GradeScaleSnapshot) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = GradeScaleSnapshot{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	}
+	return errors.New("unsupported type for GradeScaleSnapshot")
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Issued document kinds
+const (
+	IssuedDocumentTranscript    = "transcript"
+	IssuedDocumentCertificate   = "certificate"
+	IssuedDocumentPartnerLetter = "partner_letter"
+)
+
+// DocumentSummary is the minimal, public description of an issued document
+// shown by the verification endpoint, stored as a JSON column
+type DocumentSummary map[string]string
+
+func (s DocumentSummary) Value() (driver.Value, error) {
+	if s == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+func (s *DocumentSummary) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	}
+	return errors.New("unsupported type for DocumentSummary")
+}
+
+// IssuedDocument is an official document handed out by the application. It
+// carries a unique number and a random verification code printed as a QR
+// code; anyone holding the code can check the document is authentic and not
+// revoked. Subject names what the document is about (an application, a
+// student of an application, a company over a period); a new document of the
+// same kind and subject replaces the previous one. ContentHash detects when
+// the underlying data changed so a new document has to be issued.
+type IssuedDocument struct {
+	ID           uint            `gorm:"primaryKey" json:"id"`
+	Kind         string          `gorm:"size:30;index" json:"kind"`
+	Number       string          `gorm:"size:100;uniqueIndex" json:"number"`
+	Year         int             `json:"year"`
+	Sequence     int             `json:"sequence"`
+	Code         string          `gorm:"size:64;uniqueIndex" json:"code"`
+	Subject      string          `gorm:"size:100;index" json:"subject"`
+	ApplyJobID   *uint           `gorm:"index" json:"apply_job_id,omitempty"`
+	UserID       *uint           `gorm:"index" json:"user_id,omitempty"`
+	CompanyID    *uint           `gorm:"index" json:"company_id,omitempty"`
+	Summary      DocumentSummary `gorm:"type:jsonb" json:"summary"`
+	ContentHash  string          `gorm:"size:64" json:"content_hash"`
+	IssuedByID   uint            `json:"issued_by_id"`
+	IssuedAt     time.Time       `json:"issued_at"`
+	RevokedAt    *time.Time      `json:"revoked_at,omitempty"`
+	RevokedByID  *uint           `json:"revoked_by_id,omitempty"`
+	RevokeReason string          `gorm:"type:text" json:"revoke_reason,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+
+	// Relationships
+	ApplyJob  *ApplyJob `gorm:"foreignKey:ApplyJobID" json:"apply_job,omitempty"`
+	User      *User     `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Company   *Company  `gorm:"foreignKey:CompanyID" json:"company,omitempty"`
+	IssuedBy  *User     `gorm:"foreignKey:IssuedByID" json:"issued_by,omitempty"`
+	RevokedBy *User     `gorm:"foreignKey:RevokedByID" json:"revoked_by,omitempty"`
+}
+
+func (IssuedDocument) TableName() string {
+	return "issued_documents"
+}
@@ -31,33 +31,62 @@ const (
 	VacancyTypeS3   = "S3"
 )
 
+// MaxSksMBKM is the maximum number of SKS a single MBKM placement may be
+// converted into for one program studi.
+const MaxSksMBKM = 20
+
+// HoursPerSks is the workload in hours one converted SKS stands for.
+const HoursPerSks = 45
+
 type Job struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Title       string         `gorm:"size:255;not null" json:"title"`
-	Company     string         `gorm:"size:255" json:"company"`
-	Location    string         `gorm:"size:255" json:"location"`
-	Duration    *string        `gorm:"size:255" json:"duration,omitempty"`
-	Description *string        `gorm:"type:text" json:"description,omitempty"`
-	Benefits    *string        `gorm:"type:text" json:"benefits,omitempty"`
-	JobType     *string        `gorm:"size:50" json:"job_type,omitempty"`
-	Salary      *string        `gorm:"size:255" json:"salary,omitempty"`
-	VacancyType *string        `gorm:"size:50" json:"vacancy_type,omitempty"`
-	Status      string         `gorm:"size:50;default:'Perlu Ditinjau'" json:"status"`
-	MataKuliah  *string        `gorm:"type:text" json:"mata_kuliah,omitempty"`
-	Deadline    *time.Time     `json:"deadline,omitempty"`
-	CompanyID   *uint          `json:"company_id,omitempty"`
-	CreatedByID uint           `json:"created_by_id"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	Title           string         `gorm:"size:255;not null" json:"title"`
+	Company         string         `gorm:"size:255" json:"company"`
+	Location        string         `gorm:"size:255" json:"location"`
+	Duration        *string        `gorm:"size:255" json:"duration,omitempty"`
+	Description     *string        `gorm:"type:text" json:"description,omitempty"`
+	Benefits        *string        `gorm:"type:text" json:"benefits,omitempty"`
+	JobType         *string        `gorm:"size:50" json:"job_type,omitempty"`
+	Salary          *string        `gorm:"size:255" json:"salary,omitempty"`
+	VacancyType     *string        `gorm:"size:50" json:"vacancy_type,omitempty"`
+	Status          string         `gorm:"size:50;default:'Perlu Ditinjau'" json:"status"`
+	RejectionReason *string        `gorm:"type:text" json:"rejection_reason,omitempty"`
+	MataKuliah      *string        `gorm:"type:text" json:"mata_kuliah,omitempty"`
+	Deadline        *time.Time     `json:"deadline,omitempty"`
+	CompanyID       *uint          `json:"company_id,omitempty"`
+	CreatedByID     uint           `json:"created_by_id"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relationships
-	CreatedBy *User `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+	CreatedBy *User           `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+	Courses   []JobMataKuliah `gorm:"foreignKey:JobID" json:"courses,omitempty"`
 
-	// Virtual field for media (will be handled separately)
-	JobVacancyImage *string `gorm:"-" json:"job_vacancy_image,omitempty"`
+	// Virtual fields for media
+	JobVacancyImage           *string           `gorm:"-" json:"job_vacancy_image,omitempty"`
+	JobVacancyImageThumbnails map[string]string `gorm:"-" json:"job_vacancy_image_thumbnails,omitempty"`
 }
 
 func (Job) TableName() string {
 	return "jobs"
 }
+
+// JobMataKuliah maps a job to a course that the placement can be converted
+// into, together with the SKS the placement is worth for that course.
+type JobMataKuliah struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	JobID          uint      `gorm:"uniqueIndex:idx_job_matkul" json:"job_id"`
+	MataKuliahID   uint      `gorm:"uniqueIndex:idx_job_matkul" json:"mata_kuliah_id"`
+	IDProgramStudi uint      `gorm:"index" json:"id_program_studi"`
+	Sks            int       `json:"sks"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Relationships
+	MataKuliah *MataKuliah `gorm:"foreignKey:MataKuliahID" json:"mata_kuliah,omitempty"`
+}
+
+func (JobMataKuliah) TableName() string {
+	return "job_mata_kuliah"
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Job revision status constants
+const (
+	JobRevisionStatusPending  = "Perlu Ditinjau"
+	JobRevisionStatusApproved = "Disetujui"
+	JobRevisionStatusRejected = "Ditolak"
+)
+
+// JobFieldChange describes a single changed field of a job revision
+type JobFieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// JobFieldChanges is stored as a JSON column
+type JobFieldChanges []JobFieldChange
+
+func (c JobFieldChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *JobFieldChanges) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	}
+	return errors.New("unsupported type for JobFieldChanges")
+}
+
+// JobRevision is an edit of an already published job. Edits made by a company
+// stay pending until CDC approves them, edits made by CDC/admin are recorded
+// as approved right away.
+type JobRevision struct {
+	ID              uint            `gorm:"primaryKey" json:"id"`
+	JobID           uint            `gorm:"index" json:"job_id"`
+	Status          string          `gorm:"size:50;default:'Perlu Ditinjau'" json:"status"`
+	Changes         JobFieldChanges `gorm:"type:jsonb" json:"changes"`
+	RejectionReason *string         `gorm:"type:text" json:"rejection_reason,omitempty"`
+	CreatedByID     uint            `json:"created_by_id"`
+	ReviewedByID    *uint           `json:"reviewed_by_id,omitempty"`
+	ReviewedAt      *time.Time      `json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+
+	// Relationships
+	Job        *Job  `gorm:"foreignKey:JobID" json:"job,omitempty"`
+	CreatedBy  *User `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+	ReviewedBy *User `gorm:"foreignKey:ReviewedByID" json:"reviewed_by,omitempty"`
+}
+
+func (JobRevision) TableName() string {
+	return "job_revisions"
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+)
+
+// Konversi rule modes
+const (
+	// KonversiModeUniform gives every course the final evaluation score
+	KonversiModeUniform = "uniform"
+	// KonversiModeCriteria scores a course from the rubric criteria mapped
+	// to it, falling back to the final score for unmapped courses
+	KonversiModeCriteria = "criteria"
+)
+
+// KonversiRule says how a program studi converts a final evaluation into
+// course grades. A rule without a program studi is the default.
+type KonversiRule struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	IDProgramStudi *uint     `gorm:"uniqueIndex" json:"id_program_studi,omitempty"`
+	Mode           string    `gorm:"size:20" json:"mode"`
+	MaxSks         int       `json:"max_sks"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Relationships
+	Criteria     []KonversiCriterion `gorm:"foreignKey:KonversiRuleID" json:"criteria"`
+	ProgramStudi *ProgramStudi       `gorm:"foreignKey:IDProgramStudi" json:"program_studi,omitempty"`
+}
+
+func (KonversiRule) TableName() string {
+	return "konversi_rules"
+}
+
+// KonversiCriterion maps a rubric criterion onto a course. Criteria are
+// matched by evaluator role and name so the mapping survives new rubric
+// versions.
+type KonversiCriterion struct {
+	ID             uint    `gorm:"primaryKey" json:"id,omitempty"`
+	KonversiRuleID uint    `gorm:"index" json:"konversi_rule_id,omitempty"`
+	MataKuliahID   uint    `json:"mata_kuliah_id"`
+	Role           string  `gorm:"size:20" json:"role"`
+	CriterionName  string  `gorm:"size:255" json:"criterion_name"`
+	Weight         float64 `json:"weight"`
+}
+
+func (KonversiCriterion) TableName() string {
+	return "konversi_criteria"
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// Letter types; each is also the document template kind, the issued
+// document kind and the application document collection of the letter
+const (
+	LetterTypeSuratPengantar   = "surat_pengantar"
+	LetterTypeSuratRekomendasi = "surat_rekomendasi_prodi"
+)
+
+// Letter request status constants
+const (
+	LetterStatusRequested = "Diajukan"
+	LetterStatusApproved  = "Disetujui"
+	LetterStatusRejected  = "Ditolak"
+)
+
+// LetterRequest is a student's request for an administrative letter to apply
+// for a job. Once prodi approves it the letter is rendered, numbered and
+// attached to the student's application for the job, now or when they apply.
+type LetterRequest struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	Type             string     `gorm:"size:50;index" json:"type"`
+	StudentID        uint       `gorm:"index" json:"student_id"`
+	JobID            uint       `gorm:"index" json:"job_id"`
+	ApplyJobID       *uint      `gorm:"index" json:"apply_job_id,omitempty"`
+	IDProgramStudi   *uint      `gorm:"index" json:"id_program_studi,omitempty"`
+	Purpose          string     `gorm:"type:text" json:"purpose"`
+	Status           string     `gorm:"size:50;default:'Diajukan'" json:"status"`
+	RejectionReason  *string    `gorm:"type:text" json:"rejection_reason,omitempty"`
+	SignerName       string     `gorm:"size:255" json:"signer_name,omitempty"`
+	SignerNIP        string     `gorm:"size:50" json:"signer_nip,omitempty"`
+	ReviewedByID     *uint      `json:"reviewed_by_id,omitempty"`
+	ReviewedAt       *time.Time `json:"reviewed_at,omitempty"`
+	IssuedDocumentID *uint      `json:"issued_document_id,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	// Relationships
+	Student        *User           `gorm:"foreignKey:StudentID" json:"student,omitempty"`
+	Job            *Job            `gorm:"foreignKey:JobID" json:"job,omitempty"`
+	ReviewedBy     *User           `gorm:"foreignKey:ReviewedByID" json:"reviewed_by,omitempty"`
+	IssuedDocument *IssuedDocument `gorm:"foreignKey:IssuedDocumentID" json:"issued_document,omitempty"`
+
+	// Virtual fields for media
+	File *string `gorm:"-" json:"file,omitempty"`
+}
+
+func (LetterRequest) TableName() string {
+	return "letter_requests"
+}
@@ -21,7 +21,10 @@ func (Fakultas) TableName() string {
 type ProgramStudi struct {
 	ID           uint           `gorm:"primarykey" json:"id"`
 	Nama         string         `gorm:"size:255" json:"nama"`
+	KodeProdi    *string        `gorm:"size:20" json:"kode_prodi,omitempty"` // kode program studi in PDDikti
 	IDUnitParent uint           `json:"id_unit_parent"`
+	NamaKaprodi  *string        `gorm:"size:255" json:"nama_kaprodi,omitempty"` // signs prodi letters
+	NIPKaprodi   *string        `gorm:"size:50" json:"nip_kaprodi,omitempty"`
 	Fakultas     *Fakultas      `gorm:"foreignKey:IDUnitParent" json:"fakultas,omitempty"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
@@ -38,6 +41,7 @@ type MataKuliah struct {
 	NamaMatkul     string         `gorm:"size:255" json:"nama_matkul"`
 	Sks            int            `json:"sks"`
 	IDProgramStudi uint           `json:"id_program_studi"`
+	Status         string         `gorm:"size:50;default:'Aktif'" json:"status"` // Tidak Aktif once gone from SIAKAD
 	ProgramStudi   *ProgramStudi  `gorm:"foreignKey:IDProgramStudi" json:"program_studi,omitempty"`
 	CreatedAt      time.Time      `json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+)
+
+// Media owner types
+const (
+	MediaModelReport         = "Report"
+	MediaModelReportVersion  = "ReportVersion"
+	MediaModelApplyJob       = "ApplyJob"
+	MediaModelJob            = "Job"
+	MediaModelJobRevision    = "JobRevision"
+	MediaModelCompany        = "Company"
+	MediaModelArticle        = "Article"
+	MediaModelActivityDetail = "ActivityDetail"
+	MediaModelLetterRequest  = "LetterRequest"
+)
+
+// Media collections
+const (
+	MediaCollectionFileLaporan           = "file_laporan"
+	MediaCollectionDHS                   = "dhs"
+	MediaCollectionKTM                   = "ktm"
+	MediaCollectionCV                    = "cv"
+	MediaCollectionSuratLamaran          = "surat_lamaran"
+	MediaCollectionSuratRekomendasiProdi = "surat_rekomendasi_prodi"
+	MediaCollectionSuratPengantar        = "surat_pengantar"
+	MediaCollectionJobVacancyImage       = "job_vacancy_image"
+	MediaCollectionCompanyLogo           = "company_logo"
+	MediaCollectionPicture               = "picture"
+	MediaCollectionAttachments           = "attachments"
+)
+
+// Media is a file attached to any model, modelled after Laravel MediaLibrary
+type Media struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	ModelType      string    `gorm:"size:100;not null;index:idx_media_owner" json:"model_type"`
+	ModelID        uint      `gorm:"not null;index:idx_media_owner" json:"model_id"`
+	CollectionName string    `gorm:"size:100;not null;index:idx_media_owner" json:"collection_name"`
+	FileName       string    `gorm:"size:255" json:"file_name"`
+	Path           string    `gorm:"size:512;not null" json:"-"`
+	MimeType       string    `gorm:"size:255" json:"mime_type"`
+	Size           int64     `json:"size"`
+	Checksum       string    `gorm:"size:64;index" json:"checksum"`
+	Conversions    string    `gorm:"size:255" json:"-"` // comma separated names of resized variants
+	UploadedByID   *uint     `json:"uploaded_by_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+
+	// Relationships
+	UploadedBy *User `gorm:"foreignKey:UploadedByID" json:"uploaded_by,omitempty"`
+
+	// Virtual fields
+	URL            string            `gorm:"-" json:"url,omitempty"`
+	ConversionURLs map[string]string `gorm:"-" json:"conversions,omitempty"`
+}
+
+func (Media) TableName() string {
+	return "media"
+}
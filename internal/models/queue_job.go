@@ -0,0 +1,85 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// Queue job status constants. A job that ran out of attempts stays Gagal
+// as a dead letter until it is retried by hand.
+const (
+	QueueJobQueued   = "Menunggu"
+	QueueJobRunning  = "Berjalan"
+	QueueJobFinished = "Selesai"
+	QueueJobFailed   = "Gagal"
+)
+
+// QueueData is a JSON document stored as is in a jsonb column
+type QueueData []byte
+
+func (d QueueData) Value() (driver.Value, error) {
+	if len(d) == 0 {
+		return nil, nil
+	}
+	return string(d), nil
+}
+
+func (d *QueueData) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case []byte:
+		*d = append((*d)[:0], v...)
+		return nil
+	case string:
+		*d = QueueData(v)
+		return nil
+	}
+	return errors.New("unsupported type for QueueData")
+}
+
+func (d QueueData) MarshalJSON() ([]byte, error) {
+	if len(d) == 0 {
+		return []byte("null"), nil
+	}
+	return d, nil
+}
+
+func (d *QueueData) UnmarshalJSON(data []byte) error {
+	*d = append((*d)[:0], data...)
+	return nil
+}
+
+// QueueJob is a unit of background work (an import, a Feeder push, ...)
+// run by the workers of the job queue. Jobs with the same UniqueKey are not
+// queued twice while one of them is unfinished.
+type QueueJob struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	Type            string     `gorm:"size:100;index" json:"type"`
+	Payload         QueueData  `gorm:"type:jsonb" json:"-"`
+	UniqueKey       *string    `gorm:"size:255;uniqueIndex:idx_queue_jobs_unique_key,where:finished_at IS NULL" json:"unique_key,omitempty"`
+	Status          string     `gorm:"size:50;index:idx_queue_jobs_claim,priority:1" json:"status"`
+	RunAt           time.Time  `gorm:"index:idx_queue_jobs_claim,priority:2" json:"run_at"`
+	Attempts        int        `json:"attempts"`
+	MaxAttempts     int        `json:"max_attempts"`
+	Progress        int        `json:"progress"` // percent
+	ProgressMessage string     `gorm:"size:255" json:"progress_message,omitempty"`
+	Result          QueueData  `gorm:"type:jsonb" json:"result,omitempty"`
+	LastError       *string    `gorm:"type:text" json:"last_error,omitempty"`
+	LockedBy        *string    `gorm:"size:100" json:"-"`
+	LockedUntil     *time.Time `json:"-"`
+	CreatedByID     *uint      `gorm:"index" json:"created_by_id,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	// Relationships
+	CreatedBy *User `gorm:"foreignKey:CreatedByID" json:"created_by,omitempty"`
+}
+
+func (QueueJob) TableName() string {
+	return "queue_jobs"
+}
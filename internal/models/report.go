@@ -8,10 +8,12 @@ import (
 
 // Report status constants
 const (
+	ReportStatusDraft             = "Draft"
 	ReportStatusCreatedByStudent  = "Selesai Dibuat Oleh Mahasiswa"
 	ReportStatusCheckedByCompany  = "Selesai Diperiksa Oleh Perusahaan"
 	ReportStatusCheckedByLecturer = "Selesai Diperiksa Oleh Dosen Wali"
 	ReportStatusCheckedByProdi    = "Selesai Diperiksa Oleh Prodi"
+	ReportStatusChangesRequested  = "Perlu Revisi"
 )
 
 type Report struct {
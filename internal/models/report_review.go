@@ -0,0 +1,84 @@
+package models
+
+import (
+	"time"
+)
+
+// Report review decisions
+const (
+	ReportReviewApproved         = "approved"
+	ReportReviewChangesRequested = "changes_requested"
+)
+
+// Report reviewer roles
+const (
+	ReportReviewerCompany  = "company"
+	ReportReviewerLecturer = "lecturer"
+	ReportReviewerExaminer = "examiner"
+	ReportReviewerProdi    = "prodi"
+)
+
+// ReportVersion is one submission of the report file by the student. Every
+// resubmission gets the next version number and starts a new review round.
+type ReportVersion struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ReportID      uint      `gorm:"uniqueIndex:idx_report_version" json:"report_id"`
+	Version       int       `gorm:"uniqueIndex:idx_report_version" json:"version"`
+	Note          *string   `gorm:"type:text" json:"note,omitempty"`
+	SubmittedByID *uint     `json:"submitted_by_id,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// Relationships
+	SubmittedBy *User           `gorm:"foreignKey:SubmittedByID" json:"submitted_by,omitempty"`
+	Reviews     []ReportReview  `gorm:"foreignKey:ReportVersionID" json:"reviews,omitempty"`
+	Comments    []ReportComment `gorm:"foreignKey:ReportVersionID" json:"comments,omitempty"`
+
+	// Virtual field for media
+	File *Media `gorm:"-" json:"file,omitempty"`
+}
+
+func (ReportVersion) TableName() string {
+	return "report_versions"
+}
+
+// ReportReview is the decision of one reviewer on a report version
+type ReportReview struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	ReportID        uint      `gorm:"index" json:"report_id"`
+	ReportVersionID uint      `gorm:"index" json:"report_version_id"`
+	ReviewerID      uint      `json:"reviewer_id"`
+	Role            string    `gorm:"size:20" json:"role"`
+	Decision        string    `gorm:"size:30" json:"decision"`
+	Comment         *string   `gorm:"type:text" json:"comment,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+
+	// Relationships
+	Reviewer *User `gorm:"foreignKey:ReviewerID" json:"reviewer,omitempty"`
+}
+
+func (ReportReview) TableName() string {
+	return "report_reviews"
+}
+
+// ReportComment is a message on a report version. Replies point to their
+// parent comment.
+type ReportComment struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	ReportID        uint      `gorm:"index" json:"report_id"`
+	ReportVersionID uint      `gorm:"index" json:"report_version_id"`
+	ParentID        *uint     `gorm:"index" json:"parent_id,omitempty"`
+	UserID          uint      `json:"user_id"`
+	Body            string    `gorm:"type:text" json:"body"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+
+	// Virtual field for threads
+	Replies []ReportComment `gorm:"-" json:"replies,omitempty"`
+}
+
+func (ReportComment) TableName() string {
+	return "report_comments"
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"time"
+)
+
+// Evaluator roles a rubric is written for
+const (
+	RubricRoleCompany  = "company"
+	RubricRoleLecturer = "lecturer"
+	RubricRoleExaminer = "examiner"
+)
+
+// Rubric is a versioned set of criteria one evaluator role scores a student
+// on. Rubrics without a program studi are the default for their role. Once a
+// rubric has been used, editing it creates the next version; evaluations keep
+// the version they were scored with.
+type Rubric struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Name           string    `gorm:"size:255" json:"name"`
+	Role           string    `gorm:"size:20;index:idx_rubric_scope" json:"role"`
+	IDProgramStudi *uint     `gorm:"index:idx_rubric_scope" json:"id_program_studi,omitempty"`
+	Version        int       `gorm:"default:1" json:"version"`
+	IsActive       bool      `gorm:"default:true" json:"is_active"`
+	PreviousID     *uint     `json:"previous_id,omitempty"` // the version this one replaced
+	CreatedByID    *uint     `json:"created_by_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Relationships
+	Criteria     []RubricCriterion `gorm:"foreignKey:RubricID" json:"criteria,omitempty"`
+	ProgramStudi *ProgramStudi     `gorm:"foreignKey:IDProgramStudi" json:"program_studi,omitempty"`
+}
+
+func (Rubric) TableName() string {
+	return "rubrics"
+}
+
+// RubricCriterion is one scored aspect of a rubric
+type RubricCriterion struct {
+	ID          uint    `gorm:"primaryKey" json:"id"`
+	RubricID    uint    `gorm:"index" json:"rubric_id"`
+	Name        string  `gorm:"size:255" json:"name"`
+	Description string  `gorm:"type:text" json:"description"`
+	Weight      float64 `json:"weight"`
+	MinScore    float64 `json:"min_score"`
+	MaxScore    float64 `json:"max_score"`
+	Position    int     `json:"position"`
+}
+
+func (RubricCriterion) TableName() string {
+	return "rubric_criteria"
+}
+
+// EvaluationScore is the score an evaluator gave on one criterion
+type EvaluationScore struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	EvaluationID      uint      `gorm:"uniqueIndex:idx_evaluation_score" json:"evaluation_id"`
+	RubricID          uint      `gorm:"index" json:"rubric_id"`
+	RubricCriterionID uint      `gorm:"uniqueIndex:idx_evaluation_score" json:"rubric_criterion_id"`
+	Role              string    `gorm:"size:20;index" json:"role"`
+	Score             float64   `json:"score"`
+	Note              *string   `gorm:"type:text" json:"note,omitempty"`
+	EvaluatorID       uint      `json:"evaluator_id"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+
+	// Relationships
+	Criterion *RubricCriterion `gorm:"foreignKey:RubricCriterionID" json:"criterion,omitempty"`
+}
+
+func (EvaluationScore) TableName() string {
+	return "evaluation_scores"
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+)
+
+// Student import status constants
+const (
+	StudentImportRunning  = "Berjalan"
+	StudentImportFinished = "Selesai"
+	StudentImportFailed   = "Gagal"
+)
+
+// StudentImport is one upload of a student list (CSV or XLSX). Rows are
+// matched by NIM: new students are created, existing ones updated.
+type StudentImport struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	FileName     string     `gorm:"size:255" json:"file_name"`
+	Format       string     `gorm:"size:10" json:"format"` // csv or xlsx
+	Status       string     `gorm:"size:50;index" json:"status"`
+	TotalRows    int        `json:"total_rows"`
+	Created      int        `json:"created"`
+	Updated      int        `json:"updated"`
+	Failed       int        `json:"failed"`
+	Error        *string    `gorm:"type:text" json:"error,omitempty"`
+	ImportedByID *uint      `json:"imported_by_id,omitempty"`
+	QueueJobID   *uint      `gorm:"index" json:"queue_job_id,omitempty"` // the background job running it
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	// Relationships
+	ImportedBy *User                `gorm:"foreignKey:ImportedByID" json:"imported_by,omitempty"`
+	Errors     []StudentImportError `gorm:"foreignKey:StudentImportID" json:"errors,omitempty"`
+}
+
+func (StudentImport) TableName() string {
+	return "student_imports"
+}
+
+// StudentImportError is a row an import could not apply
+type StudentImportError struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	StudentImportID uint      `gorm:"index" json:"student_import_id"`
+	Row             int       `json:"row"` // line in the file, the header being 1
+	NIM             string    `gorm:"column:nim;size:50" json:"nim"`
+	Column          string    `gorm:"size:50" json:"column,omitempty"`
+	Message         string    `gorm:"type:text" json:"message"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+func (StudentImportError) TableName() string {
+	return "student_import_errors"
+}
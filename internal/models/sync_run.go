@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// Sync run status constants
+const (
+	SyncRunRunning  = "Berjalan"
+	SyncRunFinished = "Selesai"
+	SyncRunFailed   = "Gagal"
+)
+
+// SyncRun is one synchronisation of students, lecturers and courses from
+// the campus academic system (SIAKAD)
+type SyncRun struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Source        string     `gorm:"size:20" json:"source"`  // rest or csv
+	Trigger       string     `gorm:"size:20" json:"trigger"` // manual or scheduled
+	Entities      string     `gorm:"size:100" json:"entities"`
+	Status        string     `gorm:"size:50;index" json:"status"`
+	Created       int        `json:"created"`
+	Updated       int        `json:"updated"`
+	Deactivated   int        `json:"deactivated"`
+	Failed        int        `json:"failed"`
+	Error         *string    `gorm:"type:text" json:"error,omitempty"`
+	TriggeredByID *uint      `json:"triggered_by_id,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	// Relationships
+	TriggeredBy *User          `gorm:"foreignKey:TriggeredByID" json:"triggered_by,omitempty"`
+	Errors      []SyncRunError `gorm:"foreignKey:SyncRunID" json:"errors,omitempty"`
+}
+
+func (SyncRun) TableName() string {
+	return "sync_runs"
+}
+
+// SyncRunError is a record a sync run could not apply
+type SyncRunError struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SyncRunID uint      `gorm:"index" json:"sync_run_id"`
+	Entity    string    `gorm:"size:20" json:"entity"` // students, lecturers or courses
+	Key       string    `gorm:"size:100" json:"key"`   // NIM, NIDN or kode_matkul
+	Message   string    `gorm:"type:text" json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (SyncRunError) TableName() string {
+	return "sync_run_errors"
+}
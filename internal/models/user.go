@@ -13,8 +13,9 @@ type User struct {
 	Username           string         `gorm:"size:255;uniqueIndex" json:"username"`
 	Password           string         `gorm:"size:255" json:"-"`
 	NIM                *string        `gorm:"size:50" json:"nim,omitempty"`
-	ProgramStudy       *string        `gorm:"size:255" json:"program_study,omitempty"`
-	Faculty            *string        `gorm:"size:255" json:"faculty,omitempty"`
+	NIDN               *string        `gorm:"column:nidn;size:20" json:"nidn,omitempty"` // lecturers, reported to PDDikti
+	ProgramStudy       *string        `gorm:"size:255" json:"program_study,omitempty"`   // name of ProgramStudi, kept for display
+	Faculty            *string        `gorm:"size:255" json:"faculty,omitempty"`         // name of its Fakultas, kept for display
 	Semester           *string        `gorm:"column:semester;size:255" json:"semester,omitempty"`
 	PhoneNumber        *string        `gorm:"size:50" json:"phone_number,omitempty"`
 	Address            *string        `gorm:"type:text" json:"address,omitempty"`
@@ -34,17 +35,35 @@ type User struct {
 	TwoFactorCode      *string        `gorm:"size:10" json:"-"`
 	TwoFactorExpiresAt *time.Time     `json:"-"`
 	TeamID             *uint          `json:"team_id,omitempty"`
-	IdProgramStudi     *string        `gorm:"column:id_program_studi;size:40" json:"id_program_studi,omitempty"`
+	IDProgramStudi     *uint          `gorm:"column:id_program_studi;index" json:"id_program_studi,omitempty"`
 	EmailVerifiedAt    *time.Time     `json:"email_verified_at,omitempty"`
 	CreatedAt          time.Time      `json:"created_at"`
 	UpdatedAt          time.Time      `json:"updated_at"`
 	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
 
 	// Relationships
-	Roles []Role `gorm:"many2many:role_user" json:"roles,omitempty"`
-	Team  *Team  `gorm:"foreignKey:TeamID" json:"team,omitempty"`
+	Roles        []Role        `gorm:"many2many:role_user" json:"roles,omitempty"`
+	Team         *Team         `gorm:"foreignKey:TeamID" json:"team,omitempty"`
+	ProgramStudi *ProgramStudi `gorm:"foreignKey:IDProgramStudi" json:"program_studi,omitempty"`
 }
 
 func (User) TableName() string {
 	return "users"
 }
+
+// SetProgramStudi links the user to a program studi and copies its name and
+// faculty into ProgramStudy and Faculty. prodi.Fakultas should be loaded.
+func (u *User) SetProgramStudi(prodi *ProgramStudi) {
+	if prodi == nil {
+		u.IDProgramStudi = nil
+		return
+	}
+	id := prodi.ID
+	name := prodi.Nama
+	u.IDProgramStudi = &id
+	u.ProgramStudy = &name
+	if prodi.Fakultas != nil {
+		faculty := prodi.Fakultas.Nama
+		u.Faculty = &faculty
+	}
+}
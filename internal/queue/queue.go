@@ -0,0 +1,148 @@
+// Package queue runs background work stored in Postgres. Jobs are rows of
+// queue_jobs: Enqueue adds one, workers claim due jobs with FOR UPDATE SKIP
+// LOCKED so any number of processes can share the table, and failed jobs
+// are retried with exponential backoff until they run out of attempts and
+// stay behind as dead letters.
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"mbkm-go/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultMaxAttempts is how often a job runs before it is given up
+const DefaultMaxAttempts = 5
+
+// ErrDuplicate is returned with the unfinished job of the same unique key
+var ErrDuplicate = errors.New("the same job is already queued or running")
+
+// ErrNotRetryable is returned when retrying a job that has not failed
+var ErrNotRetryable = errors.New("only failed jobs can be retried")
+
+// Options of a new job
+type Options struct {
+	UniqueKey   string    // when set, not queued while a job of the same key is unfinished
+	RunAt       time.Time // not run before, default now
+	MaxAttempts int       // default DefaultMaxAttempts
+	CreatedByID *uint
+}
+
+// Enqueue adds a job of the given type. The payload is stored as JSON and
+// decoded by the job's handler. With a unique key that is already queued or
+// running the existing job is returned with ErrDuplicate.
+func Enqueue(db *gorm.DB, jobType string, payload interface{}, opts Options) (*models.QueueJob, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := models.QueueJob{
+		Type:        jobType,
+		Payload:     data,
+		Status:      models.QueueJobQueued,
+		RunAt:       opts.RunAt,
+		MaxAttempts: opts.MaxAttempts,
+		CreatedByID: opts.CreatedByID,
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.UniqueKey == "" {
+		if err := db.Create(&job).Error; err != nil {
+			return nil, err
+		}
+		return &job, nil
+	}
+
+	job.UniqueKey = &opts.UniqueKey
+	result := db.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "unique_key"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "finished_at IS NULL"}}},
+		DoNothing:   true,
+	}).Create(&job)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		var existing models.QueueJob
+		if err := db.Where("unique_key = ? AND finished_at IS NULL", opts.UniqueKey).First(&existing).Error; err != nil {
+			return nil, err
+		}
+		return &existing, ErrDuplicate
+	}
+	return &job, nil
+}
+
+// Retry queues a failed (dead letter) job again with a fresh set of
+// attempts
+func Retry(db *gorm.DB, id uint) (*models.QueueJob, error) {
+	var job models.QueueJob
+	if err := db.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	if job.Status != models.QueueJobFailed {
+		return &job, ErrNotRetryable
+	}
+	if job.UniqueKey != nil {
+		var existing models.QueueJob
+		if err := db.Where("unique_key = ? AND finished_at IS NULL", *job.UniqueKey).First(&existing).Error; err == nil {
+			return &existing, ErrDuplicate
+		}
+	}
+
+	err := db.Model(&job).Updates(map[string]interface{}{
+		"status":           models.QueueJobQueued,
+		"run_at":           time.Now(),
+		"attempts":         0,
+		"progress":         0,
+		"progress_message": "",
+		"started_at":       nil,
+		"finished_at":      nil,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, db.First(&job, id).Error
+}
+
+// backoff is the wait before the next attempt after the given one failed:
+// 30 seconds doubling up to an hour
+func backoff(attempt int) time.Duration {
+	wait := 30 * time.Second
+	for i := 1; i < attempt && wait < time.Hour; i++ {
+		wait *= 2
+	}
+	if wait > time.Hour {
+		wait = time.Hour
+	}
+	return wait
+}
+
+// permanentError marks an error retrying cannot fix
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps an error a handler returns for a job that cannot succeed,
+// e.g. a bad payload, so it fails without further attempts
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent reports whether err was wrapped by Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
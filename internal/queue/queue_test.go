@@ -0,0 +1,237 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mbkm-go/internal/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) is not nil")
+	}
+
+	cause := errors.New("bad payload")
+	err := Permanent(cause)
+	if !IsPermanent(err) {
+		t.Error("IsPermanent(Permanent(err)) = false")
+	}
+	if err.Error() != "bad payload" || !errors.Is(err, cause) {
+		t.Errorf("Permanent(err) = %v, want it to read as and unwrap to the cause", err)
+	}
+	if !IsPermanent(fmt.Errorf("import: %w", err)) {
+		t.Error("IsPermanent of a wrapped permanent error = false")
+	}
+	if IsPermanent(cause) || IsPermanent(nil) {
+		t.Error("IsPermanent of a plain error or nil = true")
+	}
+}
+
+func TestLastAttempt(t *testing.T) {
+	tests := []struct {
+		attempts, max int
+		want          bool
+	}{
+		{1, 5, false},
+		{4, 5, false},
+		{5, 5, true},
+		{6, 5, true},
+	}
+	for _, tt := range tests {
+		job := &Job{QueueJob: &models.QueueJob{Attempts: tt.attempts, MaxAttempts: tt.max}}
+		if got := job.LastAttempt(); got != tt.want {
+			t.Errorf("LastAttempt with %d of %d attempts = %v, want %v", tt.attempts, tt.max, got, tt.want)
+		}
+	}
+}
+
+// stubJobs is a queue_jobs table behind a database/sql driver. It answers
+// the INSERT and SELECT statements of Enqueue, keeping the unique key of
+// unfinished jobs unique like the partial index idx_queue_jobs_unique_key.
+type stubJobs struct {
+	mu         sync.Mutex
+	rows       []stubJob
+	statements []string
+}
+
+type stubJob struct {
+	id       int64
+	jobType  string
+	key      interface{} // nil without a unique key
+	finished bool
+}
+
+func newStubJobs(t *testing.T) (*stubJobs, *gorm.DB) {
+	stub := &stubJobs{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(stub)}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stub, db
+}
+
+func (s *stubJobs) Connect(context.Context) (driver.Conn, error) { return stubConn{s}, nil }
+func (s *stubJobs) Driver() driver.Driver                        { return nil }
+
+type stubConn struct{ jobs *stubJobs }
+
+func (c stubConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c stubConn) Close() error                        { return nil }
+func (c stubConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c stubConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.jobs
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = append(s.statements, query)
+
+	switch {
+	case strings.HasPrefix(query, `INSERT INTO "queue_jobs"`):
+		values := insertValues(query, args)
+		if values["unique_key"] != nil && strings.Contains(query, "ON CONFLICT") {
+			for _, row := range s.rows {
+				if row.key == values["unique_key"] && !row.finished {
+					return &stubRows{columns: []string{"id"}}, nil
+				}
+			}
+		}
+		row := stubJob{id: int64(len(s.rows) + 1), jobType: values["type"].(string), key: values["unique_key"]}
+		s.rows = append(s.rows, row)
+		return &stubRows{columns: []string{"id"}, values: [][]driver.Value{{row.id}}}, nil
+
+	case strings.HasPrefix(query, `SELECT * FROM "queue_jobs" WHERE unique_key = $1 AND finished_at IS NULL`):
+		result := &stubRows{columns: []string{"id", "type", "unique_key"}}
+		for _, row := range s.rows {
+			if row.key == args[0].Value && !row.finished {
+				result.values = append(result.values, []driver.Value{row.id, row.jobType, row.key})
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("unexpected statement %q", query)
+}
+
+// insertValues maps the columns of an INSERT to their arguments
+func insertValues(query string, args []driver.NamedValue) map[string]interface{} {
+	list := query[strings.Index(query, "(")+1 : strings.Index(query, ")")]
+	values := map[string]interface{}{}
+	for i, column := range strings.Split(list, ",") {
+		values[strings.Trim(column, `" `)] = args[i].Value
+	}
+	return values
+}
+
+type stubRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *stubRows) Columns() []string { return r.columns }
+func (r *stubRows) Close() error      { return nil }
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestEnqueueUniqueKey(t *testing.T) {
+	stub, db := newStubJobs(t)
+	opts := Options{UniqueKey: "siakad_sync"}
+
+	first, err := Enqueue(db, "siakad_sync", map[string]string{"trigger": "manual"}, opts)
+	if err != nil {
+		t.Fatalf("first Enqueue: %v", err)
+	}
+	if first.ID != 1 || first.Status != models.QueueJobQueued || first.MaxAttempts != DefaultMaxAttempts || first.RunAt.IsZero() {
+		t.Errorf("first job = %+v, want a queued job with the default attempts", first)
+	}
+	if insert := stub.statements[0]; !strings.Contains(insert, `ON CONFLICT ("unique_key")`) || !strings.Contains(insert, "WHERE finished_at IS NULL DO NOTHING") {
+		t.Errorf("insert = %q, want it to skip a conflicting unfinished job", insert)
+	}
+
+	second, err := Enqueue(db, "siakad_sync", map[string]string{"trigger": "scheduled"}, opts)
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("second Enqueue error = %v, want ErrDuplicate", err)
+	}
+	if second == nil || second.ID != first.ID {
+		t.Errorf("second Enqueue returned %+v, want the queued job #%d", second, first.ID)
+	}
+
+	other, err := Enqueue(db, "siakad_sync", nil, Options{UniqueKey: "siakad_sync:2024"})
+	if err != nil || other.ID != 2 {
+		t.Errorf("Enqueue of another key = %+v, %v, want job #2", other, err)
+	}
+
+	stub.rows[0].finished = true
+	again, err := Enqueue(db, "siakad_sync", nil, opts)
+	if err != nil || again.ID != 3 {
+		t.Errorf("Enqueue after the job finished = %+v, %v, want job #3", again, err)
+	}
+}
+
+func TestEnqueueWithoutUniqueKey(t *testing.T) {
+	stub, db := newStubJobs(t)
+	runAt := time.Date(2024, time.March, 1, 8, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= 2; i++ {
+		job, err := Enqueue(db, "feeder_push", map[string]uint{"apply_job_id": 7}, Options{RunAt: runAt, MaxAttempts: 3})
+		if err != nil {
+			t.Fatalf("Enqueue %d: %v", i, err)
+		}
+		if job.ID != uint(i) || job.UniqueKey != nil || !job.RunAt.Equal(runAt) || job.MaxAttempts != 3 {
+			t.Errorf("job %d = %+v", i, job)
+		}
+		if string(job.Payload) != `{"apply_job_id":7}` {
+			t.Errorf("payload = %s", job.Payload)
+		}
+	}
+	for _, statement := range stub.statements {
+		if strings.Contains(statement, "ON CONFLICT") {
+			t.Errorf("insert without a unique key = %q, want no ON CONFLICT", statement)
+		}
+	}
+
+	if _, err := Enqueue(db, "feeder_push", func() {}, Options{}); err == nil {
+		t.Error("Enqueue of a payload JSON cannot encode succeeded")
+	}
+}
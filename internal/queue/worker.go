@@ -0,0 +1,283 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"mbkm-go/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Handler runs one job. A returned error fails the attempt; wrap it with
+// Permanent when retrying cannot help. ctx is cancelled when the worker
+// stops, the job then goes back to the queue.
+type Handler func(ctx context.Context, job *Job) error
+
+// Job is a claimed job handed to its handler
+type Job struct {
+	*models.QueueJob
+
+	db     *gorm.DB
+	worker string
+	result interface{}
+}
+
+// Decode unmarshals the payload into v
+func (j *Job) Decode(v interface{}) error {
+	if err := json.Unmarshal(j.Payload, v); err != nil {
+		return Permanent(fmt.Errorf("bad payload: %w", err))
+	}
+	return nil
+}
+
+// SetProgress records how far the job got, as a percentage and an optional
+// message, for GET /jobs-queue/:id
+func (j *Job) SetProgress(percent int, message string) {
+	if percent < 0 {
+		percent = 0
+	} else if percent > 100 {
+		percent = 100
+	}
+	j.Progress, j.ProgressMessage = percent, message
+	j.db.Model(&models.QueueJob{}).Where("id = ? AND locked_by = ?", j.ID, j.worker).
+		Updates(map[string]interface{}{"progress": percent, "progress_message": message})
+}
+
+// LastAttempt reports whether a failure of this attempt fails the job for
+// good
+func (j *Job) LastAttempt() bool {
+	return j.Attempts >= j.MaxAttempts
+}
+
+// SetResult sets what the job reports once it succeeds, stored as JSON
+func (j *Job) SetResult(v interface{}) {
+	j.result = v
+}
+
+// Worker runs the jobs of the registered types
+type Worker struct {
+	DB           *gorm.DB
+	Concurrency  int           // jobs run at the same time, default 1
+	PollInterval time.Duration // wait when no job is due, default 2s
+	Lease        time.Duration // a job whose worker stopped renewing it is run again after this, default 5m
+
+	name     string
+	handlers map[string]Handler
+}
+
+// NewWorker creates a worker of the database
+func NewWorker(db *gorm.DB, concurrency int, pollInterval time.Duration) *Worker {
+	host, _ := os.Hostname()
+	return &Worker{
+		DB:           db,
+		Concurrency:  concurrency,
+		PollInterval: pollInterval,
+		Lease:        5 * time.Minute,
+		name:         fmt.Sprintf("%s-%d", host, os.Getpid()),
+		handlers:     map[string]Handler{},
+	}
+}
+
+// Register sets the handler of a job type
+func (w *Worker) Register(jobType string, handler Handler) {
+	w.handlers[jobType] = handler
+}
+
+// Types returns the registered job types
+func (w *Worker) Types() []string {
+	types := make([]string, 0, len(w.handlers))
+	for t := range w.handlers {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Run runs jobs until ctx is done, then waits for the running ones to stop
+func (w *Worker) Run(ctx context.Context) {
+	if w.Concurrency <= 0 {
+		w.Concurrency = 1
+	}
+	if w.PollInterval <= 0 {
+		w.PollInterval = 2 * time.Second
+	}
+	if w.Lease <= 0 {
+		w.Lease = 5 * time.Minute
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := w.claim()
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Job queue: %v", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.PollInterval):
+			}
+			continue
+		}
+		w.process(ctx, job)
+	}
+}
+
+// claim takes the next due job: a queued one whose run_at has passed, or a
+// running one whose worker stopped renewing its lease
+func (w *Worker) claim() (*models.QueueJob, error) {
+	var job models.QueueJob
+	err := w.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("type IN ?", w.Types()).
+			Where("((status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?))",
+				models.QueueJobQueued, now, models.QueueJobRunning, now).
+			Order("run_at ASC, id ASC").
+			Take(&job).Error
+		if err != nil {
+			return err
+		}
+
+		until := now.Add(w.Lease)
+		job.Status = models.QueueJobRunning
+		job.Attempts++
+		job.LockedBy = &w.name
+		job.LockedUntil = &until
+		if job.StartedAt == nil {
+			job.StartedAt = &now
+		}
+		return tx.Model(&job).Updates(map[string]interface{}{
+			"status":       job.Status,
+			"attempts":     job.Attempts,
+			"locked_by":    w.name,
+			"locked_until": until,
+			"started_at":   job.StartedAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// process runs a claimed job and records its outcome
+func (w *Worker) process(ctx context.Context, record *models.QueueJob) {
+	job := &Job{QueueJob: record, db: w.DB, worker: w.name}
+
+	var err error
+	if record.Attempts > record.MaxAttempts {
+		// The worker of the last attempt stopped without finishing it
+		err = Permanent(errors.New("the job was interrupted on its last attempt"))
+	} else {
+		stop := w.renew(record.ID)
+		err = w.call(ctx, job)
+		stop()
+	}
+
+	if err != nil && ctx.Err() != nil && !IsPermanent(err) {
+		// Stopped by shutdown: give the attempt back
+		w.update(record.ID, map[string]interface{}{
+			"status":       models.QueueJobQueued,
+			"attempts":     record.Attempts - 1,
+			"run_at":       time.Now(),
+			"locked_by":    nil,
+			"locked_until": nil,
+		})
+		return
+	}
+	w.finish(job, err)
+}
+
+// call runs the handler, turning a panic into a failed attempt
+func (w *Worker) call(ctx context.Context, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job queue: job #%d (%s) panicked: %v\n%s", job.ID, job.Type, r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return w.handlers[job.Type](ctx, job)
+}
+
+// renew extends the lease of a running job until the returned func is
+// called
+func (w *Worker) renew(id uint) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(w.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				w.update(id, map[string]interface{}{"locked_until": time.Now().Add(w.Lease)})
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// finish records the outcome of an attempt: done, queued again after a
+// backoff, or failed for good
+func (w *Worker) finish(job *Job, err error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"locked_by":    nil,
+		"locked_until": nil,
+	}
+
+	switch {
+	case err == nil:
+		updates["status"] = models.QueueJobFinished
+		updates["progress"] = 100
+		updates["finished_at"] = now
+		if job.result != nil {
+			data, err := json.Marshal(job.result)
+			if err != nil {
+				log.Printf("Job queue: job #%d result: %v", job.ID, err)
+			} else {
+				updates["result"] = models.QueueData(data)
+			}
+		}
+	case IsPermanent(err) || job.LastAttempt():
+		updates["status"] = models.QueueJobFailed
+		updates["last_error"] = err.Error()
+		updates["finished_at"] = now
+		log.Printf("Job queue: job #%d (%s) failed after %d attempts: %v", job.ID, job.Type, job.Attempts, err)
+	default:
+		updates["status"] = models.QueueJobQueued
+		updates["last_error"] = err.Error()
+		updates["run_at"] = now.Add(backoff(job.Attempts))
+	}
+	w.update(job.ID, updates)
+}
+
+// update changes a job this worker still holds
+func (w *Worker) update(id uint, updates map[string]interface{}) {
+	err := w.DB.Model(&models.QueueJob{}).Where("id = ? AND locked_by = ?", id, w.name).Updates(updates).Error
+	if err != nil {
+		log.Printf("Job queue: job #%d: %v", id, err)
+	}
+}
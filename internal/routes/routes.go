@@ -15,6 +15,7 @@ func SetupRoutes(app *fiber.App) {
 	companyHandler := handlers.NewCompanyHandler()
 	dashboardHandler := handlers.NewDashboardHandler()
 	applyJobHandler := handlers.NewApplyJobHandler()
+	attendanceHandler := handlers.NewAttendanceHandler()
 
 	// API v1 routes
 	api := app.Group("/api/v1")
@@ -40,6 +41,12 @@ func SetupRoutes(app *fiber.App) {
 	public.Get("/jobs", jobHandler.Index)
 	public.Get("/jobs/:id", jobHandler.Show)
 
+	// Stored files, authorized by signed URL
+	api.Get("/files/*", handlers.DownloadFile)
+
+	// Verification of issued documents (the QR code on transcripts)
+	api.Get("/verify/:code", handlers.VerifyDocument)
+
 	// Articles (index and show are public)
 	api.Get("/articles", articleHandler.Index)
 	api.Get("/articles/:id", articleHandler.Show)
@@ -63,16 +70,22 @@ func SetupRoutes(app *fiber.App) {
 	protectedJobs.Post("", jobHandler.Store)
 	protectedJobs.Put("/:id", jobHandler.Update)
 	protectedJobs.Delete("/:id", jobHandler.Destroy)
+	protectedJobs.Post("/:id/image", jobHandler.UploadImage)
 	protectedJobs.Post("/:id/approve", jobHandler.Approve)
 	protectedJobs.Post("/:id/reject", jobHandler.Reject)
 	protectedJobs.Post("/:id/close", jobHandler.Close)
 	protectedJobs.Get("/:id/list", jobHandler.ListCandidate)
+	protectedJobs.Get("/:id/revisions", jobHandler.ListRevisions)
+	protectedJobs.Get("/:id/revisions/:revision_id", jobHandler.CompareRevision)
+	protectedJobs.Post("/:id/revisions/:revision_id/approve", jobHandler.ApproveRevision)
+	protectedJobs.Post("/:id/revisions/:revision_id/reject", jobHandler.RejectRevision)
 
 	// Articles (protected - create, update, delete)
 	protectedArticles := protected.Group("/articles")
 	protectedArticles.Post("", articleHandler.Store)
 	protectedArticles.Put("/:id", articleHandler.Update)
 	protectedArticles.Delete("/:id", articleHandler.Destroy)
+	protectedArticles.Post("/:id/picture", articleHandler.UploadPicture)
 
 	// Companies (Job Providers - Complex Entity)
 	protectedCompanies := protected.Group("/companies")
@@ -81,17 +94,37 @@ func SetupRoutes(app *fiber.App) {
 	protectedCompanies.Post("", companyHandler.Store)
 	protectedCompanies.Put("/:id", companyHandler.Update)
 	protectedCompanies.Delete("/:id", companyHandler.Destroy)
+	protectedCompanies.Post("/:id/logo", companyHandler.UploadLogo)
+	protectedCompanies.Post("/:id/appreciation-letter", handlers.IssuePartnerLetter)
+	protectedCompanies.Get("/:id/appreciation-letter.pdf", handlers.ExportPartnerLetterPDF)
 
 	// --- Master Data Routes ---
 
 	// Fakultas
-	protected.Get("/fakultas", handlers.GetFakultas)
+	protectedFakultas := protected.Group("/fakultas")
+	protectedFakultas.Get("", handlers.GetFakultas)
+	protectedFakultas.Post("", handlers.CreateFakultas)
+	protectedFakultas.Put("/:id", handlers.UpdateFakultas)
+	protectedFakultas.Delete("/:id", handlers.DeleteFakultas)
+	protectedFakultas.Post("/:id/restore", handlers.RestoreFakultas)
 
 	// Program Studi
-	protected.Get("/program-studi", handlers.GetProgramStudi)
+	protectedProdi := protected.Group("/program-studi")
+	protectedProdi.Get("", handlers.GetProgramStudi)
+	protectedProdi.Post("", handlers.CreateProgramStudi)
+	protectedProdi.Get("/user-mapping", handlers.GetProgramStudiMapping)
+	protectedProdi.Post("/user-mapping", handlers.MapProgramStudi)
+	protectedProdi.Put("/:id", handlers.UpdateProgramStudi)
+	protectedProdi.Delete("/:id", handlers.DeleteProgramStudi)
+	protectedProdi.Post("/:id/restore", handlers.RestoreProgramStudi)
 
 	// Mata Kuliah
-	protected.Get("/matkul", handlers.GetMatkul)
+	protectedMatkul := protected.Group("/matkul")
+	protectedMatkul.Get("", handlers.GetMatkul)
+	protectedMatkul.Post("", handlers.CreateMatkul)
+	protectedMatkul.Put("/:id", handlers.UpdateMatkul)
+	protectedMatkul.Delete("/:id", handlers.DeleteMatkul)
+	protectedMatkul.Post("/:id/restore", handlers.RestoreMatkul)
 
 	// Perusahaan (Simple Master Data)
 	protectedPerusahaan := protected.Group("/perusahaans")
@@ -113,7 +146,13 @@ func SetupRoutes(app *fiber.App) {
 	protectedApplyJobs.Post("/:id/activate", applyJobHandler.Activate)
 	protectedApplyJobs.Post("/:id/done", applyJobHandler.Done)
 	protectedApplyJobs.Post("/:id/set-lecturer", applyJobHandler.SetLecturer)
+	protectedApplyJobs.Post("/:id/documents", applyJobHandler.UploadDocuments)
 	protectedApplyJobs.Get("/user/:user_id", applyJobHandler.GetByUser)
+	protectedApplyJobs.Post("/:id/konversi/generate", handlers.GenerateKonversiNilai)
+	protectedApplyJobs.Post("/:id/transcript", handlers.IssueTranscript)
+	protectedApplyJobs.Get("/:id/transcript.pdf", handlers.ExportTranscriptPDF)
+	protectedApplyJobs.Post("/:id/certificate", handlers.IssueCertificate)
+	protectedApplyJobs.Get("/:id/certificate.pdf", handlers.ExportCertificatePDF)
 
 	// Dashboard
 	protected.Get("/dashboard/overview", dashboardHandler.Overview)
@@ -145,27 +184,66 @@ func SetupRoutes(app *fiber.App) {
 
 	// --- Academic Features ---
 
+	// Attendance
+	protectedAttendances := protected.Group("/attendances")
+	protectedAttendances.Get("", attendanceHandler.Index)
+	protectedAttendances.Get("/recap", attendanceHandler.Recap)
+	protectedAttendances.Post("/check-in", attendanceHandler.CheckIn)
+	protectedAttendances.Post("/check-out", attendanceHandler.CheckOut)
+	protectedAttendances.Post("/override", attendanceHandler.Override)
+
 	// Reports
 	protectedReports := protected.Group("/reports")
 	protectedReports.Get("", handlers.GetReports)
 	protectedReports.Post("", handlers.CreateReport)
 	protectedReports.Get("/:id", handlers.GetReportDetail) // ID is ApplyJobID
+	protectedReports.Get("/:id/file", handlers.GetReportFile)
 	protectedReports.Post("/:id/check", handlers.CheckReport)
+	protectedReports.Post("/:id/versions", handlers.SubmitReportVersion)
+	protectedReports.Post("/:id/reviews", handlers.ReviewReport)
+	protectedReports.Post("/:id/comments", handlers.AddReportComment)
+	protectedReports.Get("/:id/history", handlers.GetReportHistory)
+	protectedReports.Get("/:id/hours", handlers.GetActivityHours)
+	protectedReports.Get("/:id/export.pdf", handlers.ExportReportPDF)
 	protectedReports.Delete("/:id", handlers.DeleteReport)
 
 	// Activity Details
 	protectedActivities := protected.Group("/activity-details")
 	protectedActivities.Get("", handlers.GetActivityDetails)
 	protectedActivities.Post("", handlers.CreateActivityDetail)
+	protectedActivities.Post("/approve-week", handlers.ApproveActivityWeek)
 	protectedActivities.Get("/:id", handlers.GetActivityDetail)
 	protectedActivities.Put("/:id", handlers.UpdateActivityDetail)
 	protectedActivities.Delete("/:id", handlers.DeleteActivityDetail)
+	protectedActivities.Post("/:id/attachments", handlers.UploadActivityAttachment)
+	protectedActivities.Delete("/:id/attachments/:media_id", handlers.DeleteActivityAttachment)
+	protectedActivities.Post("/:id/approve", handlers.ApproveActivityDetail)
+	protectedActivities.Post("/:id/reject", handlers.RejectActivityDetail)
 
 	// Evaluations
 	protectedEvaluations := protected.Group("/evaluations")
 	protectedEvaluations.Get("", handlers.GetEvaluations)
 	protectedEvaluations.Post("", handlers.UpdateEvaluation)       // Store/Update Logic combined
 	protectedEvaluations.Get("/:id", handlers.GetEvaluationDetail) // ID is ApplyJobID
+	protectedEvaluations.Get("/:id/rubric", handlers.GetEvaluationRubric)
+	protectedEvaluations.Post("/:id/finalize", handlers.FinalizeEvaluation)
+	protectedEvaluations.Post("/:id/publish", handlers.PublishEvaluation)
+	protectedEvaluations.Post("/:id/unlock", handlers.UnlockEvaluation)
+	protectedEvaluations.Post("/:id/appeals", handlers.FileGradeAppeal)
+
+	// Grade appeals
+	protectedAppeals := protected.Group("/grade-appeals")
+	protectedAppeals.Get("", handlers.GetGradeAppeals)
+	protectedAppeals.Post("/:id/route", handlers.RouteGradeAppeal)
+	protectedAppeals.Post("/:id/decide", handlers.DecideGradeAppeal)
+
+	// Rubrics
+	protectedRubrics := protected.Group("/rubrics")
+	protectedRubrics.Get("", handlers.GetRubrics)
+	protectedRubrics.Post("", handlers.CreateRubric)
+	protectedRubrics.Get("/:id", handlers.GetRubric)
+	protectedRubrics.Put("/:id", handlers.UpdateRubric)
+	protectedRubrics.Delete("/:id", handlers.DeleteRubric)
 
 	// Konversi Nilai
 	protectedKonversi := protected.Group("/konversi-nilai")
@@ -175,12 +253,70 @@ func SetupRoutes(app *fiber.App) {
 	protectedKonversi.Put("/:id", handlers.UpdateKonversiNilai)
 	protectedKonversi.Delete("/:id", handlers.DeleteKonversiNilai)
 
+	// Konversi rules
+	protectedKonversiRules := protected.Group("/konversi-rules")
+	protectedKonversiRules.Get("", handlers.GetKonversiRules)
+	protectedKonversiRules.Post("", handlers.SaveKonversiRule)
+	protectedKonversiRules.Delete("/:id", handlers.DeleteKonversiRule)
+
 	// --- Utilities ---
 
 	// Settings (Bobot Nilai)
 	protected.Get("/settings/bobot-nilai", handlers.GetBobotNilai)
 	protected.Post("/settings/bobot-nilai", handlers.UpdateBobotNilai)
+	protected.Get("/settings/bobot-nilai/history", handlers.GetBobotNilaiHistory)
+
+	// Grade scales
+	protectedGradeScales := protected.Group("/grade-scales")
+	protectedGradeScales.Get("", handlers.GetGradeScales)
+	protectedGradeScales.Post("", handlers.CreateGradeScale)
+	protectedGradeScales.Get("/:id", handlers.GetGradeScale)
+	protectedGradeScales.Put("/:id", handlers.UpdateGradeScale)
+	protectedGradeScales.Delete("/:id", handlers.DeleteGradeScale)
+
+	// Document templates
+	protectedTemplates := protected.Group("/document-templates")
+	protectedTemplates.Get("", handlers.GetDocumentTemplates)
+	protectedTemplates.Post("", handlers.CreateDocumentTemplate)
+	protectedTemplates.Put("/:id", handlers.UpdateDocumentTemplate)
+	protectedTemplates.Delete("/:id", handlers.DeleteDocumentTemplate)
+
+	// Issued documents
+	protectedIssuedDocuments := protected.Group("/issued-documents")
+	protectedIssuedDocuments.Get("", handlers.GetIssuedDocuments)
+	protectedIssuedDocuments.Post("/:id/revoke", handlers.RevokeIssuedDocument)
+	protected.Post("/certificates/generate", handlers.GenerateCertificates)
+
+	// Letter requests (surat pengantar, surat rekomendasi prodi)
+	protectedLetters := protected.Group("/letter-requests")
+	protectedLetters.Get("", handlers.GetLetterRequests)
+	protectedLetters.Post("", handlers.RequestLetter)
+	protectedLetters.Get("/:id", handlers.GetLetterRequest)
+	protectedLetters.Post("/:id/approve", handlers.ApproveLetterRequest)
+	protectedLetters.Post("/:id/reject", handlers.RejectLetterRequest)
+
+	// PDDikti Neo Feeder export
+	protectedFeeder := protected.Group("/feeder")
+	protectedFeeder.Get("/validate", handlers.ValidateFeederExport)
+	protectedFeeder.Get("/export", handlers.ExportFeeder)
+	protectedFeeder.Post("/push", handlers.PushFeeder)
+	protectedFeeder.Get("/syncs", handlers.GetFeederSyncs)
+
+	// SIAKAD sync
+	protectedSiakad := protected.Group("/siakad")
+	protectedSiakad.Post("/sync", handlers.StartSiakadSync)
+	protectedSiakad.Get("/runs", handlers.GetSyncRuns)
+	protectedSiakad.Get("/runs/:id", handlers.GetSyncRun)
 
 	// Import
 	protected.Post("/import/student", handlers.ImportStudents)
+	protected.Get("/import/student/history", handlers.GetStudentImports)
+	protected.Get("/import/student/history/:id", handlers.GetStudentImport)
+	protected.Get("/import/student/history/:id/errors.csv", handlers.GetStudentImportErrors)
+
+	// Background job queue
+	protectedQueue := protected.Group("/jobs-queue")
+	protectedQueue.Get("", handlers.GetQueueJobs)
+	protectedQueue.Get("/:id", handlers.GetQueueJob)
+	protectedQueue.Post("/:id/retry", handlers.RetryQueueJob)
 }
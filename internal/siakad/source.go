@@ -0,0 +1,306 @@
+// Package siakad keeps students, lecturers and courses in line with the
+// campus academic system (SIAKAD). A Source reads the records, a Syncer
+// upserts them by NIM, NIDN and course code and deactivates what the source
+// no longer lists.
+package siakad
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotProvided is returned when a source has no data for an entity. The
+// entity is then left as it is rather than deactivated.
+var ErrNotProvided = errors.New("siakad: not provided by the source")
+
+// Student is a student record of the source
+type Student struct {
+	NIM         string `json:"nim"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	KodeProdi   string `json:"kode_prodi"`
+	Semester    string `json:"semester"`
+	PhoneNumber string `json:"phone_number"`
+	Birthdate   string `json:"birthdate"` // YYYY-MM-DD
+	Status      string `json:"status"`    // Aktif when empty
+}
+
+// Lecturer is a lecturer record of the source
+type Lecturer struct {
+	NIDN      string `json:"nidn"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	KodeProdi string `json:"kode_prodi"`
+	Status    string `json:"status"`
+}
+
+// Course is a course record of the source
+type Course struct {
+	KodeMatkul string `json:"kode_matkul"`
+	NamaMatkul string `json:"nama_matkul"`
+	Sks        int    `json:"sks"`
+	KodeProdi  string `json:"kode_prodi"`
+}
+
+// Source reads the records of the academic system
+type Source interface {
+	Name() string
+	Students(ctx context.Context) ([]Student, error)
+	Lecturers(ctx context.Context) ([]Lecturer, error)
+	Courses(ctx context.Context) ([]Course, error)
+}
+
+// Archiver is implemented by sources that consume their input, e.g. files
+// that are moved away once a run has applied them
+type Archiver interface {
+	Archive() error
+}
+
+// --- REST JSON source ---
+
+// REST reads the records from a JSON API: GET {URL}/students, /lecturers and
+// /courses returning an array, or an object with "data" and an optional
+// "next" URL for the following page. A 404 means the entity is not provided.
+type REST struct {
+	URL    string
+	Token  string // sent as a bearer token when set
+	Client *http.Client
+}
+
+func NewREST(url, token string) (*REST, error) {
+	if url == "" {
+		return nil, errors.New("SIAKAD_URL is not configured")
+	}
+	return &REST{
+		URL:    strings.TrimRight(url, "/"),
+		Token:  token,
+		Client: &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (r *REST) Name() string { return "rest" }
+
+func (r *REST) Students(ctx context.Context) ([]Student, error) {
+	var records []Student
+	return records, r.fetch(ctx, "/students", &records)
+}
+
+func (r *REST) Lecturers(ctx context.Context) ([]Lecturer, error) {
+	var records []Lecturer
+	return records, r.fetch(ctx, "/lecturers", &records)
+}
+
+func (r *REST) Courses(ctx context.Context) ([]Course, error) {
+	var records []Course
+	return records, r.fetch(ctx, "/courses", &records)
+}
+
+// fetch reads every page of an endpoint into out, a pointer to a slice
+func (r *REST) fetch(ctx context.Context, path string, out interface{}) error {
+	var all []json.RawMessage
+	next := r.URL + path
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if r.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.Token)
+		}
+
+		resp, err := r.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return ErrNotProvided
+		}
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("siakad %s: HTTP %d", path, resp.StatusCode)
+		}
+
+		var page struct {
+			Data []json.RawMessage `json:"data"`
+			Next string            `json:"next"`
+		}
+		body = bytes.TrimSpace(body)
+		if len(body) > 0 && body[0] == '[' {
+			err = json.Unmarshal(body, &page.Data)
+		} else {
+			err = json.Unmarshal(body, &page)
+		}
+		if err != nil {
+			return fmt.Errorf("siakad %s: %w", path, err)
+		}
+		all = append(all, page.Data...)
+		next = page.Next
+	}
+
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// --- CSV drop folder source ---
+
+// CSV reads students.csv, lecturers.csv and courses.csv from a folder. The
+// first row names the columns (the JSON names of the records). A missing
+// file means the entity is not provided; Archive moves the files read into
+// processed/ so the next run only applies new drops.
+type CSV struct {
+	Dir string
+
+	read []string
+}
+
+func NewCSV(dir string) (*CSV, error) {
+	if dir == "" {
+		return nil, errors.New("SIAKAD_DIR is not configured")
+	}
+	return &CSV{Dir: dir}, nil
+}
+
+func (s *CSV) Name() string { return "csv" }
+
+func (s *CSV) Students(ctx context.Context) ([]Student, error) {
+	rows, err := s.rows("students.csv")
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Student, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, Student{
+			NIM:         row["nim"],
+			Name:        row["name"],
+			Email:       row["email"],
+			KodeProdi:   row["kode_prodi"],
+			Semester:    row["semester"],
+			PhoneNumber: row["phone_number"],
+			Birthdate:   row["birthdate"],
+			Status:      row["status"],
+		})
+	}
+	return records, nil
+}
+
+func (s *CSV) Lecturers(ctx context.Context) ([]Lecturer, error) {
+	rows, err := s.rows("lecturers.csv")
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Lecturer, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, Lecturer{
+			NIDN:      row["nidn"],
+			Name:      row["name"],
+			Email:     row["email"],
+			KodeProdi: row["kode_prodi"],
+			Status:    row["status"],
+		})
+	}
+	return records, nil
+}
+
+func (s *CSV) Courses(ctx context.Context) ([]Course, error) {
+	rows, err := s.rows("courses.csv")
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Course, 0, len(rows))
+	for _, row := range rows {
+		sks, err := strconv.Atoi(row["sks"])
+		if err != nil {
+			sks = -1 // reported by the sync
+		}
+		records = append(records, Course{
+			KodeMatkul: row["kode_matkul"],
+			NamaMatkul: row["nama_matkul"],
+			Sks:        sks,
+			KodeProdi:  row["kode_prodi"],
+		})
+	}
+	return records, nil
+}
+
+// rows reads a CSV file into maps keyed by the header
+func (s *CSV) rows(name string) ([]map[string]string, error) {
+	f, err := os.Open(filepath.Join(s.Dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotProvided
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(records) == 0 {
+		return nil, ErrNotProvided
+	}
+
+	header := records[0]
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff")))
+	}
+	rows := make([]map[string]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, value := range record {
+			if i < len(header) {
+				row[header[i]] = strings.TrimSpace(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	for _, read := range s.read {
+		if read == name {
+			return rows, nil
+		}
+	}
+	s.read = append(s.read, name)
+	return rows, nil
+}
+
+// Archive moves the files read so far into processed/
+func (s *CSV) Archive() error {
+	if len(s.read) == 0 {
+		return nil
+	}
+	dir := filepath.Join(s.Dir, "processed")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	stamp := time.Now().Format("20060102-150405")
+	for _, name := range s.read {
+		if err := os.Rename(filepath.Join(s.Dir, name), filepath.Join(dir, stamp+"-"+name)); err != nil {
+			return err
+		}
+	}
+	s.read = nil
+	return nil
+}
@@ -0,0 +1,586 @@
+package siakad
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"mbkm-go/config"
+	"mbkm-go/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Entities synchronised, in the order they run
+const (
+	EntityStudents  = "students"
+	EntityLecturers = "lecturers"
+	EntityCourses   = "courses"
+)
+
+var entities = []string{EntityStudents, EntityLecturers, EntityCourses}
+
+// Status of users and courses
+const (
+	StatusActive   = "Aktif"
+	StatusInactive = "Tidak Aktif"
+)
+
+// ErrRunning is returned when a run is started while another is running
+var ErrRunning = errors.New("a SIAKAD sync is already running")
+
+// Syncer applies the records of a source to the database, one run at a time
+type Syncer struct {
+	DB     *gorm.DB
+	Source Source
+
+	mu      sync.Mutex
+	running bool
+}
+
+// Default is the syncer of the configured source, nil when SIAKAD_SOURCE is
+// not set
+var Default *Syncer
+
+// Init creates the syncer of the source selected by SIAKAD_SOURCE
+func Init(db *gorm.DB) error {
+	cfg := config.AppConfig
+
+	var source Source
+	var err error
+	switch cfg.SiakadSource {
+	case "":
+		return nil
+	case "rest":
+		source, err = NewREST(cfg.SiakadURL, cfg.SiakadToken)
+	case "csv":
+		source, err = NewCSV(cfg.SiakadDir)
+	default:
+		return fmt.Errorf("unknown SIAKAD source %q", cfg.SiakadSource)
+	}
+	if err != nil {
+		return err
+	}
+	Default = &Syncer{DB: db, Source: source}
+	return nil
+}
+
+// ValidateEntities checks the entities a run is limited to
+func ValidateEntities(only []string) error {
+	_, err := selectEntities(only)
+	return err
+}
+
+// selectEntities returns the given entities in the order they run, all when
+// none are given
+func selectEntities(only []string) ([]string, error) {
+	if len(only) == 0 {
+		return entities, nil
+	}
+	var selected []string
+	for _, entity := range entities {
+		for _, o := range only {
+			if o == entity {
+				selected = append(selected, entity)
+			}
+		}
+	}
+	if len(selected) != len(only) {
+		return nil, fmt.Errorf("entities must be %s", strings.Join(entities, ", "))
+	}
+	return selected, nil
+}
+
+// Start records a new run of the given entities (all when empty). Execute
+// then applies it.
+func (s *Syncer) Start(trigger string, only []string, triggeredByID *uint) (*models.SyncRun, error) {
+	selected, err := selectEntities(only)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return nil, ErrRunning
+	}
+
+	run := models.SyncRun{
+		Source:        s.Source.Name(),
+		Trigger:       trigger,
+		Entities:      strings.Join(selected, ","),
+		Status:        models.SyncRunRunning,
+		TriggeredByID: triggeredByID,
+		StartedAt:     time.Now(),
+	}
+	if err := s.DB.Create(&run).Error; err != nil {
+		return nil, err
+	}
+	s.running = true
+	return &run, nil
+}
+
+// Execute applies a started run and records its outcome
+func (s *Syncer) Execute(ctx context.Context, run *models.SyncRun) {
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	var failures []string
+	for _, entity := range strings.Split(run.Entities, ",") {
+		var err error
+		switch entity {
+		case EntityStudents:
+			err = s.syncStudents(ctx, run)
+		case EntityLecturers:
+			err = s.syncLecturers(ctx, run)
+		case EntityCourses:
+			err = s.syncCourses(ctx, run)
+		}
+		if err != nil && !errors.Is(err, ErrNotProvided) {
+			failures = append(failures, fmt.Sprintf("%s: %v", entity, err))
+		}
+		s.DB.Model(run).Select("created", "updated", "deactivated", "failed").Updates(run)
+	}
+
+	now := time.Now()
+	run.FinishedAt = &now
+	run.Status = models.SyncRunFinished
+	if len(failures) > 0 {
+		message := strings.Join(failures, "; ")
+		run.Status = models.SyncRunFailed
+		run.Error = &message
+	} else if archiver, ok := s.Source.(Archiver); ok {
+		if err := archiver.Archive(); err != nil {
+			message := "archive: " + err.Error()
+			run.Error = &message
+		}
+	}
+	s.DB.Model(run).Select("status", "error", "finished_at", "created", "updated", "deactivated", "failed").Updates(run)
+}
+
+// Run starts and applies a run
+func (s *Syncer) Run(ctx context.Context, trigger string, only []string, triggeredByID *uint) (*models.SyncRun, error) {
+	run, err := s.Start(trigger, only, triggeredByID)
+	if err != nil {
+		return nil, err
+	}
+	s.Execute(ctx, run)
+	return run, nil
+}
+
+// fail records a record the run could not apply
+func (s *Syncer) fail(run *models.SyncRun, entity, key, format string, args ...interface{}) {
+	run.Failed++
+	s.DB.Create(&models.SyncRunError{
+		SyncRunID: run.ID,
+		Entity:    entity,
+		Key:       key,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// prodis returns the program studi by PDDikti code
+func (s *Syncer) prodis() map[string]models.ProgramStudi {
+	var list []models.ProgramStudi
+	s.DB.Preload("Fakultas").Where("kode_prodi IS NOT NULL AND kode_prodi <> ''").Find(&list)
+	byCode := map[string]models.ProgramStudi{}
+	for _, p := range list {
+		byCode[strings.TrimSpace(*p.KodeProdi)] = p
+	}
+	return byCode
+}
+
+// changes collects the columns of a record that differ from the source.
+// Empty source values leave the column as it is.
+type changes map[string]interface{}
+
+func (c changes) set(column string, current *string, value string) {
+	if value != "" && (current == nil || *current != value) {
+		c[column] = value
+	}
+}
+
+// setProdi links a user to the program studi of the source
+func (c changes) setProdi(user *models.User, prodi *models.ProgramStudi) {
+	if user.IDProgramStudi == nil || *user.IDProgramStudi != prodi.ID {
+		c["id_program_studi"] = prodi.ID
+	}
+	c.set("program_study", user.ProgramStudy, prodi.Nama)
+	if prodi.Fakultas != nil {
+		c.set("faculty", user.Faculty, prodi.Fakultas.Nama)
+	}
+}
+
+func randomPassword() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func hashPassword(password string) string {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash)
+}
+
+func orActive(status string) string {
+	if status == "" {
+		return StatusActive
+	}
+	return status
+}
+
+func (s *Syncer) syncStudents(ctx context.Context, run *models.SyncRun) error {
+	records, err := s.Source.Students(ctx)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotProvided
+	}
+	prodis := s.prodis()
+
+	seen := map[string]bool{}
+	for _, r := range records {
+		nim := strings.TrimSpace(r.NIM)
+		switch {
+		case nim == "":
+			s.fail(run, EntityStudents, "", "Record without NIM (%s)", r.Name)
+			continue
+		case seen[nim]:
+			s.fail(run, EntityStudents, nim, "NIM listed twice")
+			continue
+		case strings.TrimSpace(r.Name) == "":
+			s.fail(run, EntityStudents, nim, "Name is required")
+			continue
+		}
+		seen[nim] = true
+
+		var prodi *models.ProgramStudi
+		if r.KodeProdi != "" {
+			p, ok := prodis[strings.TrimSpace(r.KodeProdi)]
+			if !ok {
+				s.fail(run, EntityStudents, nim, "Unknown kode_prodi %s", r.KodeProdi)
+				continue
+			}
+			prodi = &p
+		}
+		var birthdate *time.Time
+		if r.Birthdate != "" {
+			t, err := time.Parse("2006-01-02", r.Birthdate)
+			if err != nil {
+				s.fail(run, EntityStudents, nim, "Invalid birthdate %s, expected YYYY-MM-DD", r.Birthdate)
+				continue
+			}
+			birthdate = &t
+		}
+
+		var user models.User
+		err := s.DB.Where("nim = ?", nim).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := s.createStudent(r, nim, prodi, birthdate); err != nil {
+				s.fail(run, EntityStudents, nim, "Failed to create the student: %v", err)
+				continue
+			}
+			run.Created++
+			continue
+		}
+		if err != nil {
+			s.fail(run, EntityStudents, nim, "%v", err)
+			continue
+		}
+
+		update := changes{}
+		update.set("name", &user.Name, strings.TrimSpace(r.Name))
+		update.set("semester", user.Semester, r.Semester)
+		update.set("phone_number", user.PhoneNumber, r.PhoneNumber)
+		update.set("status", user.Status, orActive(r.Status))
+		if prodi != nil {
+			update.setProdi(&user, prodi)
+		}
+		if birthdate != nil && (user.Birthdate == nil || !user.Birthdate.Equal(*birthdate)) {
+			update["birthdate"] = *birthdate
+		}
+		if len(update) == 0 {
+			continue
+		}
+		if err := s.DB.Model(&user).Updates(map[string]interface{}(update)).Error; err != nil {
+			s.fail(run, EntityStudents, nim, "Failed to update the student: %v", err)
+			continue
+		}
+		run.Updated++
+	}
+
+	return s.deactivateUsers(run, "student", "nim", seen)
+}
+
+// createStudent creates a student account the way ImportStudents does: the
+// NIM is the username and the birthdate (YYYYMMDD) the first password
+func (s *Syncer) createStudent(r Student, nim string, prodi *models.ProgramStudi, birthdate *time.Time) error {
+	email := r.Email
+	if email == "" {
+		email = fmt.Sprintf("%s@mbkm.ulbi.ac.id", nim)
+	}
+	password := randomPassword()
+	if birthdate != nil {
+		password = birthdate.Format("20060102")
+	}
+	status := orActive(r.Status)
+
+	user := models.User{
+		Name:      strings.TrimSpace(r.Name),
+		Email:     email,
+		Username:  nim,
+		Password:  hashPassword(password),
+		NIM:       &nim,
+		Role:      "student",
+		Status:    &status,
+		Birthdate: birthdate,
+	}
+	if r.Semester != "" {
+		user.Semester = &r.Semester
+	}
+	if r.PhoneNumber != "" {
+		user.PhoneNumber = &r.PhoneNumber
+	}
+	if prodi != nil {
+		user.SetProgramStudi(prodi)
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Association("Roles").Append(&models.Role{ID: 2})
+	})
+}
+
+func (s *Syncer) syncLecturers(ctx context.Context, run *models.SyncRun) error {
+	records, err := s.Source.Lecturers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotProvided
+	}
+	prodis := s.prodis()
+
+	seen := map[string]bool{}
+	for _, r := range records {
+		nidn := strings.TrimSpace(r.NIDN)
+		switch {
+		case nidn == "":
+			s.fail(run, EntityLecturers, "", "Record without NIDN (%s)", r.Name)
+			continue
+		case seen[nidn]:
+			s.fail(run, EntityLecturers, nidn, "NIDN listed twice")
+			continue
+		case strings.TrimSpace(r.Name) == "":
+			s.fail(run, EntityLecturers, nidn, "Name is required")
+			continue
+		}
+		seen[nidn] = true
+
+		var prodi *models.ProgramStudi
+		if r.KodeProdi != "" {
+			p, ok := prodis[strings.TrimSpace(r.KodeProdi)]
+			if !ok {
+				s.fail(run, EntityLecturers, nidn, "Unknown kode_prodi %s", r.KodeProdi)
+				continue
+			}
+			prodi = &p
+		}
+
+		var user models.User
+		err := s.DB.Where("nidn = ?", nidn).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := s.createLecturer(r, nidn, prodi); err != nil {
+				s.fail(run, EntityLecturers, nidn, "Failed to create the lecturer: %v", err)
+				continue
+			}
+			run.Created++
+			continue
+		}
+		if err != nil {
+			s.fail(run, EntityLecturers, nidn, "%v", err)
+			continue
+		}
+
+		update := changes{}
+		update.set("name", &user.Name, strings.TrimSpace(r.Name))
+		update.set("status", user.Status, orActive(r.Status))
+		if prodi != nil {
+			update.setProdi(&user, prodi)
+		}
+		if len(update) == 0 {
+			continue
+		}
+		if err := s.DB.Model(&user).Updates(map[string]interface{}(update)).Error; err != nil {
+			s.fail(run, EntityLecturers, nidn, "Failed to update the lecturer: %v", err)
+			continue
+		}
+		run.Updated++
+	}
+
+	return s.deactivateUsers(run, "dosen", "nidn", seen)
+}
+
+// createLecturer creates a lecturer account with the NIDN as username and a
+// random password
+func (s *Syncer) createLecturer(r Lecturer, nidn string, prodi *models.ProgramStudi) error {
+	email := r.Email
+	if email == "" {
+		email = fmt.Sprintf("%s@mbkm.ulbi.ac.id", nidn)
+	}
+	status := orActive(r.Status)
+
+	user := models.User{
+		Name:     strings.TrimSpace(r.Name),
+		Email:    email,
+		Username: nidn,
+		Password: hashPassword(randomPassword()),
+		NIDN:     &nidn,
+		Role:     "dosen",
+		Status:   &status,
+		Verified: true,
+		Approved: true,
+	}
+	if prodi != nil {
+		user.SetProgramStudi(prodi)
+	}
+
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Association("Roles").Append(&models.Role{ID: 5})
+	})
+}
+
+// deactivateUsers marks the users of a role that have a key (NIM, NIDN) the
+// source no longer lists as Tidak Aktif
+func (s *Syncer) deactivateUsers(run *models.SyncRun, role, column string, seen map[string]bool) error {
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	query := s.DB.Model(&models.User{}).
+		Where("role = ?", role).
+		Where(column+" IS NOT NULL AND "+column+" <> ''").
+		Where("status IS NULL OR status <> ?", StatusInactive)
+	if len(keys) > 0 {
+		query = query.Where(column+" NOT IN ?", keys)
+	}
+	result := query.Update("status", StatusInactive)
+	if result.Error != nil {
+		return result.Error
+	}
+	run.Deactivated += int(result.RowsAffected)
+	return nil
+}
+
+func (s *Syncer) syncCourses(ctx context.Context, run *models.SyncRun) error {
+	records, err := s.Source.Courses(ctx)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNotProvided
+	}
+	prodis := s.prodis()
+
+	type courseKey struct {
+		code    string
+		prodiID uint
+	}
+	seen := map[courseKey]bool{}
+	for _, r := range records {
+		code := strings.TrimSpace(r.KodeMatkul)
+		if code == "" {
+			s.fail(run, EntityCourses, "", "Record without kode_matkul (%s)", r.NamaMatkul)
+			continue
+		}
+		prodi, ok := prodis[strings.TrimSpace(r.KodeProdi)]
+		switch {
+		case !ok:
+			s.fail(run, EntityCourses, code, "Unknown kode_prodi %q", r.KodeProdi)
+			continue
+		case strings.TrimSpace(r.NamaMatkul) == "":
+			s.fail(run, EntityCourses, code, "nama_matkul is required")
+			continue
+		case r.Sks <= 0:
+			s.fail(run, EntityCourses, code, "sks must be a positive number")
+			continue
+		}
+		key := courseKey{code, prodi.ID}
+		if seen[key] {
+			s.fail(run, EntityCourses, code, "Course listed twice for program studi %s", r.KodeProdi)
+			continue
+		}
+		seen[key] = true
+
+		var course models.MataKuliah
+		err := s.DB.Where("kode_matkul = ? AND id_program_studi = ?", code, prodi.ID).First(&course).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			course = models.MataKuliah{
+				KodeMatkul:     code,
+				NamaMatkul:     strings.TrimSpace(r.NamaMatkul),
+				Sks:            r.Sks,
+				IDProgramStudi: prodi.ID,
+				Status:         StatusActive,
+			}
+			if err := s.DB.Create(&course).Error; err != nil {
+				s.fail(run, EntityCourses, code, "Failed to create the course: %v", err)
+				continue
+			}
+			run.Created++
+			continue
+		}
+		if err != nil {
+			s.fail(run, EntityCourses, code, "%v", err)
+			continue
+		}
+
+		update := changes{}
+		update.set("nama_matkul", &course.NamaMatkul, strings.TrimSpace(r.NamaMatkul))
+		update.set("status", &course.Status, StatusActive)
+		if course.Sks != r.Sks {
+			update["sks"] = r.Sks
+		}
+		if len(update) == 0 {
+			continue
+		}
+		if err := s.DB.Model(&course).Updates(map[string]interface{}(update)).Error; err != nil {
+			s.fail(run, EntityCourses, code, "Failed to update the course: %v", err)
+			continue
+		}
+		run.Updated++
+	}
+
+	var courses []models.MataKuliah
+	if err := s.DB.Where("kode_matkul <> '' AND (status IS NULL OR status <> ?)", StatusInactive).Find(&courses).Error; err != nil {
+		return err
+	}
+	var gone []uint
+	for _, course := range courses {
+		if !seen[courseKey{course.KodeMatkul, course.IDProgramStudi}] {
+			gone = append(gone, course.ID)
+		}
+	}
+	if len(gone) > 0 {
+		result := s.DB.Model(&models.MataKuliah{}).Where("id IN ?", gone).Update("status", StatusInactive)
+		if result.Error != nil {
+			return result.Error
+		}
+		run.Deactivated += int(result.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mbkm-go/config"
+)
+
+func withSigningKey(t *testing.T, key string) {
+	t.Helper()
+	saved := config.AppConfig
+	config.AppConfig = &config.Config{FileSigningKey: key}
+	t.Cleanup(func() { config.AppConfig = saved })
+}
+
+// parseSignedURL splits a URL made by SignedURL into its key, expiry and
+// signature
+func parseSignedURL(t *testing.T, raw string) (key, expires, signature string) {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+	key = strings.TrimPrefix(u.Path, "/api/v1/files/")
+	q := u.Query()
+	return key, q.Get("expires"), q.Get("signature")
+}
+
+func TestSignedURLVerify(t *testing.T) {
+	withSigningKey(t, "test-secret")
+
+	const key = "media/report/7/file laporan/abc.pdf"
+	urlKey, expires, signature := parseSignedURL(t, SignedURL(key, time.Hour))
+	if urlKey != key {
+		t.Fatalf("key in URL = %q, want %q", urlKey, key)
+	}
+	exp, _ := strconv.ParseInt(expires, 10, 64)
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name      string
+		key       string
+		expires   string
+		signature string
+		want      bool
+	}{
+		{"valid", key, expires, signature, true},
+		{"other key", "media/report/8/file laporan/abc.pdf", expires, signature, false},
+		{"extended expiry", key, strconv.FormatInt(exp+3600, 10), signature, false},
+		{"tampered signature", key, expires, strings.Repeat("0", len(signature)), false},
+		{"truncated signature", key, expires, signature[:len(signature)-1], false},
+		{"empty signature", key, expires, "", false},
+		{"bad expiry", key, "tomorrow", signature, false},
+		{"empty expiry", key, "", signature, false},
+		{"expired", key, past, sign(key, time.Now().Add(-time.Minute).Unix()), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.key, tt.expires, tt.signature); got != tt.want {
+				t.Errorf("Verify(%q, %q, %q) = %v, want %v", tt.key, tt.expires, tt.signature, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedURLExpiry(t *testing.T) {
+	withSigningKey(t, "test-secret")
+
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want bool
+	}{
+		{"valid for an hour", time.Hour, true},
+		{"valid for a minute", time.Minute, true},
+		{"expired a second ago", -time.Second, false},
+		{"expired a day ago", -24 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, expires, signature := parseSignedURL(t, SignedURL("documents/1.pdf", tt.ttl))
+			if got := Verify(key, expires, signature); got != tt.want {
+				t.Errorf("Verify of a URL with ttl %v = %v, want %v", tt.ttl, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignedURLOtherSigningKey(t *testing.T) {
+	withSigningKey(t, "test-secret")
+	key, expires, signature := parseSignedURL(t, SignedURL("documents/1.pdf", time.Hour))
+
+	withSigningKey(t, "rotated-secret")
+	if Verify(key, expires, signature) {
+		t.Error("a URL signed with the previous key still verifies")
+	}
+}
@@ -0,0 +1,146 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register GIF decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("file must be a JPEG, PNG or GIF image")
+	ErrTooLarge        = errors.New("file is too large")
+)
+
+// Rules describes what an uploaded image must satisfy
+type Rules struct {
+	MaxBytes  int64
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+}
+
+// Variant is a resized copy of an image that fits inside Width x Height
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// DefaultVariants are generated for every uploaded image
+var DefaultVariants = []Variant{
+	{Name: "thumb", Width: 150, Height: 150},
+	{Name: "medium", Width: 600, Height: 600},
+}
+
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Validate sniffs the content type of data and checks it against the rules.
+// It returns the detected MIME type.
+func Validate(data []byte, rules Rules) (string, error) {
+	if rules.MaxBytes > 0 && int64(len(data)) > rules.MaxBytes {
+		return "", fmt.Errorf("%w: maximum is %d KB", ErrTooLarge, rules.MaxBytes/1024)
+	}
+
+	mime := http.DetectContentType(data)
+	if _, ok := extensions[mime]; !ok {
+		return "", ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrUnsupportedType
+	}
+
+	if cfg.Width < rules.MinWidth || cfg.Height < rules.MinHeight {
+		return "", fmt.Errorf("image must be at least %dx%d pixels", rules.MinWidth, rules.MinHeight)
+	}
+	if (rules.MaxWidth > 0 && cfg.Width > rules.MaxWidth) || (rules.MaxHeight > 0 && cfg.Height > rules.MaxHeight) {
+		return "", fmt.Errorf("image must be at most %dx%d pixels", rules.MaxWidth, rules.MaxHeight)
+	}
+
+	return mime, nil
+}
+
+// Extension returns the file extension used for a MIME type
+func Extension(mime string) string {
+	return extensions[mime]
+}
+
+// Resize scales the image so it fits inside the variant's bounding box while
+// keeping its aspect ratio. Images are never scaled up. JPEG input is encoded
+// as JPEG, everything else as PNG to keep transparency; the returned MIME
+// type tells which one was used.
+func Resize(data []byte, v Variant) ([]byte, string, error) {
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	b := src.Bounds()
+	w, h := fit(b.Dx(), b.Dy(), v.Width, v.Height)
+	dst := boxResize(src, w, h)
+
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(&buf, dst)
+	return buf.Bytes(), "image/png", err
+}
+
+func fit(w, h, maxW, maxH int) (int, int) {
+	if w <= maxW && h <= maxH {
+		return w, h
+	}
+	if w*maxH > h*maxW {
+		return maxW, max(1, h*maxW/w)
+	}
+	return max(1, w*maxH/h), maxH
+}
+
+// boxResize averages every source pixel that falls into a destination pixel
+func boxResize(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0 := b.Min.Y + y*sh/h
+		y1 := max(y0+1, b.Min.Y+(y+1)*sh/h)
+		for x := 0; x < w; x++ {
+			x0 := b.Min.X + x*sw/w
+			x1 := max(x0+1, b.Min.X+(x+1)*sw/w)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr)
+					g += uint64(cg)
+					bl += uint64(cb)
+					a += uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,141 @@
+package pdf
+
+// Flow lays content out top to bottom, starting a new page when the current
+// one is full
+type Flow struct {
+	Doc    *Document
+	Margin float64
+	Y      float64
+
+	// Header is drawn at the top of every page after the first, e.g. to
+	// repeat a table header
+	Header func(f *Flow)
+}
+
+// NewFlow starts the first page of the document
+func NewFlow(doc *Document, margin float64) *Flow {
+	doc.AddPage()
+	return &Flow{Doc: doc, Margin: margin, Y: margin}
+}
+
+// Width is the usable width between the margins
+func (f *Flow) Width() float64 {
+	return PageWidth - 2*f.Margin
+}
+
+// Ensure starts a new page unless height points are left on the current one
+func (f *Flow) Ensure(height float64) {
+	if f.Y+height <= PageHeight-f.Margin {
+		return
+	}
+	f.Doc.AddPage()
+	f.Y = f.Margin
+	if f.Header != nil {
+		f.Header(f)
+	}
+}
+
+// Space moves down by the given height
+func (f *Flow) Space(height float64) {
+	f.Y += height
+}
+
+// Paragraph writes wrapped text across the full width
+func (f *Flow) Paragraph(bold bool, size float64, text string) {
+	f.Doc.SetFont(bold, size)
+	lineHeight := size * 1.4
+	for _, line := range f.Doc.Wrap(text, f.Width()) {
+		f.Ensure(lineHeight)
+		f.Y += size
+		f.Doc.Text(f.Margin, f.Y, line)
+		f.Y += lineHeight - size
+	}
+}
+
+// Centered writes a single centred line
+func (f *Flow) Centered(bold bool, size float64, text string) {
+	f.Doc.SetFont(bold, size)
+	f.Ensure(size * 1.4)
+	f.Y += size
+	f.Doc.TextCenter(PageWidth/2, f.Y, text)
+	f.Y += size * 0.4
+}
+
+// Fields writes "label : value" rows with aligned values
+func (f *Flow) Fields(size, labelWidth float64, fields [][2]string) {
+	for _, field := range fields {
+		f.Doc.SetFont(false, size)
+		lines := f.Doc.Wrap(field[1], f.Width()-labelWidth-10)
+		f.Ensure(float64(len(lines)) * size * 1.4)
+		for i, line := range lines {
+			f.Y += size
+			if i == 0 {
+				f.Doc.Text(f.Margin, f.Y, field[0])
+				f.Doc.Text(f.Margin+labelWidth, f.Y, ":")
+			}
+			f.Doc.Text(f.Margin+labelWidth+10, f.Y, line)
+			f.Y += size * 0.4
+		}
+	}
+}
+
+// Column of a table; widths are in points
+type Column struct {
+	Title string
+	Width float64
+}
+
+// Table draws a bordered table. Cells wrap and the header row is repeated
+// on every page the table spans.
+func (f *Flow) Table(size float64, columns []Column, rows [][]string) {
+	const padding = 4
+	lineHeight := size * 1.3
+
+	drawRow := func(bold bool, cells []string) {
+		f.Doc.SetFont(bold, size)
+		wrapped := make([][]string, len(columns))
+		lines := 1
+		for i, column := range columns {
+			text := ""
+			if i < len(cells) {
+				text = cells[i]
+			}
+			wrapped[i] = f.Doc.Wrap(text, column.Width-2*padding)
+			if len(wrapped[i]) > lines {
+				lines = len(wrapped[i])
+			}
+		}
+
+		height := float64(lines)*lineHeight + 2*padding
+		f.Ensure(height)
+		x := f.Margin
+		for i, column := range columns {
+			f.Doc.Rect(x, f.Y, column.Width, height, false)
+			for j, line := range wrapped[i] {
+				f.Doc.Text(x+padding, f.Y+padding+size+float64(j)*lineHeight, line)
+			}
+			x += column.Width
+		}
+		f.Y += height
+	}
+
+	titles := make([]string, len(columns))
+	for i, column := range columns {
+		titles[i] = column.Title
+	}
+
+	previous := f.Header
+	f.Header = func(f *Flow) {
+		if previous != nil {
+			previous(f)
+		}
+		drawRow(true, titles)
+	}
+	defer func() { f.Header = previous }()
+
+	f.Ensure(2 * (lineHeight + 2*padding))
+	drawRow(true, titles)
+	for _, row := range rows {
+		drawRow(false, row)
+	}
+}
@@ -0,0 +1,222 @@
+// Package xlsx reads the cell values of the first worksheet of an Office
+// Open XML workbook (.xlsx). Styles, formulas and further sheets are
+// ignored: text cells give their text, other cells their stored value, so
+// dates come back as serial numbers (see SerialTime).
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoSheet is returned for workbooks without a worksheet
+var ErrNoSheet = errors.New("xlsx: no worksheet")
+
+// maxColumns bounds the width of a row, guarding against huge cell references
+const maxColumns = 16384
+
+// Read returns the rows of the first worksheet. Rows and cells missing from
+// the file are returned empty, so row i is line i+1 of the sheet.
+func Read(r io.ReaderAt, size int64) ([][]string, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: %w", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	sheet, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if shared, err = readSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+	return readSheet(sheet, shared)
+}
+
+// SerialTime converts a date serial number of the 1900 date system to a
+// time in UTC
+func SerialTime(serial float64) time.Time {
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	days := int(serial)
+	seconds := int((serial - float64(days)) * 86400)
+	return base.AddDate(0, 0, days).Add(time.Duration(seconds) * time.Second)
+}
+
+func decode(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("xlsx: %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("xlsx: %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// firstSheet finds the worksheet listed first in the workbook
+func firstSheet(files map[string]*zip.File) (*zip.File, error) {
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+
+	wb, okWorkbook := files["xl/workbook.xml"]
+	rel, okRels := files["xl/_rels/workbook.xml.rels"]
+	if okWorkbook && okRels {
+		if err := decode(wb, &workbook); err != nil {
+			return nil, err
+		}
+		if err := decode(rel, &rels); err != nil {
+			return nil, err
+		}
+		if len(workbook.Sheets) > 0 {
+			for _, r := range rels.Relationships {
+				if r.ID != workbook.Sheets[0].ID {
+					continue
+				}
+				target := strings.TrimPrefix(r.Target, "/")
+				if !strings.HasPrefix(target, "xl/") {
+					target = path.Join("xl", target)
+				}
+				if f, ok := files[target]; ok {
+					return f, nil
+				}
+			}
+		}
+	}
+
+	if f, ok := files["xl/worksheets/sheet1.xml"]; ok {
+		return f, nil
+	}
+	return nil, ErrNoSheet
+}
+
+// richText is a shared or inline string: plain text or runs of text
+type richText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s richText) String() string {
+	if len(s.Runs) == 0 {
+		return s.T
+	}
+	var b strings.Builder
+	for _, r := range s.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	var sst struct {
+		Items []richText `xml:"si"`
+	}
+	if err := decode(f, &sst); err != nil {
+		return nil, err
+	}
+	shared := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		shared[i] = item.String()
+	}
+	return shared, nil
+}
+
+func readSheet(f *zip.File, shared []string) ([][]string, error) {
+	var sheet struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R      string   `xml:"r,attr"`
+				T      string   `xml:"t,attr"`
+				V      string   `xml:"v"`
+				Inline richText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decode(f, &sheet); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		index := len(rows)
+		if row.R > 0 {
+			index = row.R - 1
+		}
+		for len(rows) <= index {
+			rows = append(rows, nil)
+		}
+
+		var cells []string
+		for _, cell := range row.Cells {
+			col := len(cells)
+			if cell.R != "" {
+				parsed, err := column(cell.R)
+				if err != nil {
+					return nil, err
+				}
+				col = parsed
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+
+			switch cell.T {
+			case "s":
+				i, err := strconv.Atoi(strings.TrimSpace(cell.V))
+				if err != nil || i < 0 || i >= len(shared) {
+					return nil, fmt.Errorf("xlsx: cell %s: bad shared string %q", cell.R, cell.V)
+				}
+				cells[col] = shared[i]
+			case "inlineStr":
+				cells[col] = cell.Inline.String()
+			default:
+				cells[col] = cell.V
+			}
+		}
+		rows[index] = cells
+	}
+	return rows, nil
+}
+
+// column returns the zero-based column of a cell reference such as "AB12"
+func column(ref string) (int, error) {
+	col := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 || col > maxColumns {
+		return 0, fmt.Errorf("xlsx: bad cell reference %q", ref)
+	}
+	return col - 1, nil
+}